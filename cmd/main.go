@@ -3,10 +3,16 @@ package main
 import (
 	"context"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
 	"middleware-platform/internal/config"
+	"middleware-platform/internal/prom"
 	"middleware-platform/internal/repository"
 	"middleware-platform/internal/router"
 	"middleware-platform/internal/service"
+	"strings"
+	"syscall"
 	"time"
 
 	"gorm.io/driver/postgres"
@@ -31,23 +37,95 @@ func main() {
 	metricsRepo := repository.NewMetricsRepository(db)
 	alertRepo := repository.NewAlertRepository(db)
 	hostRepo := repository.NewHostRepository(db)
+	certificateRepo := repository.NewCertificateRepository(db)
+	deployRepo := repository.NewDeployRepository(db)
 
 	// 初始化服务层
 	middlewareService := service.NewMiddlewareService(middlewareRepo)
 	metricsService := service.NewMetricsService(metricsRepo, middlewareRepo)
 	alertService := service.NewAlertService(alertRepo, metricsRepo)
-	hostService := service.NewHostService(hostRepo)
+	hostService := service.NewHostService(hostRepo, cfg.Sync.Workers, cfg.Sync.QueueSize)
+	certificateService := service.NewCertificateService(certificateRepo, middlewareRepo, hostRepo)
+	deployService := service.NewDeployService(deployRepo, hostRepo, middlewareService)
 
-	// 启动监控和告警后台任务
+	// 指标采集和健康检查共享中间件客户端，退出时统一关闭
+	clients := service.NewClientPool(cfg.Metrics.Collection.MaxClients)
+	defer clients.Close()
+	metricsService.SetClientPool(clients)
+	middlewareService.SetClientPool(clients)
+	// 启停操作通过 SSH 在中间件关联的主机上执行
+	middlewareService.SetHostRepository(hostRepo)
+	// 集群槽位失效、主从切换和 ZooKeeper 失去法定人数告警
+	metricsService.SetAlerter(alertService)
+	metricsService.SetZKAdminPort(cfg.Metrics.ZooKeeper.AdminPort)
+
+	// 对接外部 Prometheus
+	metricsService.SetRemoteWrite(cfg.Prometheus.RemoteWrite)
+	if cfg.Prometheus.QueryURL != "" {
+		client := prom.NewClient(cfg.Prometheus.QueryURL, time.Duration(cfg.Prometheus.QueryTimeout)*time.Second)
+		metricsService.SetPrometheus(client)
+		alertService.SetPrometheus(client)
+	}
+
+	// 收到 SIGINT/SIGTERM 时停止后台任务并关闭服务器
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	// 指标保留策略和过期数据清理
+	retention := retentionPolicy(cfg.Metrics.Retention)
+	metricsService.SetRetention(retention)
+	service.NewRetentionJanitor(metricsRepo, alertRepo, retention, cfg.Metrics.JanitorBatchSize).
+		Start(ctx, time.Duration(cfg.Metrics.JanitorInterval)*time.Second)
+
+	// 启动文件同步worker和定时/监听触发
+	hostService.SetAlerter(alertService)
+	if err := hostService.SetTransferPolicy(service.TransferPolicy{
+		BandwidthLimit: cfg.Sync.BandwidthLimit,
+		LargeFileSize:  int64(cfg.Sync.LargeFileSize) * 1024 * 1024,
+		Window:         cfg.Sync.TransferWindow,
+	}); err != nil {
+		log.Fatalf("Invalid sync transfer config: %v", err)
+	}
+	hostService.SetCollectionStorage(cfg.Sync.StorageDir)
+	hostService.SetRevisionStorage(cfg.Sync.RevisionDir, cfg.Sync.RevisionRetention)
+	hostService.StartSyncWorkers(ctx)
+	hostService.StartSyncScheduler(ctx, time.Duration(cfg.Sync.WatchInterval)*time.Second)
+	hostService.StartDriftScanner(ctx, time.Duration(cfg.Sync.DriftInterval)*time.Second)
+
+	// 部署任务，回滚上次停止时未完成的部署
+	deployService.Start(ctx)
+
+	// 中间件启停操作随服务停止而中断，标记上次停止时未结束的操作
+	middlewareService.Start(ctx)
+
+	// 定期检查中间件健康状态
+	middlewareService.StartHealthChecks(ctx, service.HealthConfig{
+		Interval:         time.Duration(cfg.Health.Interval) * time.Second,
+		LatencyThreshold: time.Duration(cfg.Health.LatencyThreshold) * time.Millisecond,
+		FailureThreshold: cfg.Health.FailureThreshold,
+	})
+
+	// 定期扫描中间件端点和主机上的证书，临近过期时告警
+	certificateService.SetAlerter(alertService)
+	if err := certificateService.SetPolicy(service.CertificatePolicy{
+		AlertDays: cfg.Certificates.AlertDays,
+		HostPaths: cfg.Certificates.HostPaths,
+	}); err != nil {
+		log.Fatalf("Invalid certificates config: %v", err)
+	}
+	certificateService.StartScanner(ctx, time.Duration(cfg.Certificates.ScanInterval)*time.Second)
+
+	// 启动指标采集和告警后台任务
+	metricsService.StartCollector(ctx, scrapeConfig(cfg.Metrics.Collection))
 	go func() {
 		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
 		for {
 			select {
+			case <-ctx.Done():
+				return
 			case <-ticker.C:
-				if err := metricsService.CollectMetrics(context.Background()); err != nil {
-					log.Printf("Failed to collect metrics: %v", err)
-				}
-				if err := alertService.CheckAlerts(context.Background()); err != nil {
+				if err := alertService.CheckAlerts(ctx); err != nil {
 					log.Printf("Failed to check alerts: %v", err)
 				}
 			}
@@ -60,6 +138,8 @@ func main() {
 		metricsService,
 		alertService,
 		hostService,
+		certificateService,
+		deployService,
 	)
 
 	// 启动服务器
@@ -68,8 +148,56 @@ func main() {
 		port = "8080"
 	}
 
-	log.Printf("Server starting on port %s", port)
-	if err := r.Run(":" + port); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := &http.Server{Addr: ":" + port, Handler: r}
+	go func() {
+		log.Printf("Server starting on port %s", port)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Printf("Shutting down")
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Failed to shut down server: %v", err)
+	}
+}
+
+// retentionPolicy 将配置的保留天数转换为保留策略：0 使用默认值，负数表示永久保留
+func retentionPolicy(cfg config.RetentionConfig) service.RetentionPolicy {
+	policy := service.DefaultRetentionPolicy()
+	apply := func(days int, ttl *time.Duration) {
+		switch {
+		case days > 0:
+			*ttl = time.Duration(days) * 24 * time.Hour
+		case days < 0:
+			*ttl = 0
+		}
+	}
+	apply(cfg.Raw, &policy.Raw)
+	apply(cfg.Rollup1m, &policy.Rollup1m)
+	apply(cfg.Rollup5m, &policy.Rollup5m)
+	apply(cfg.Rollup1h, &policy.Rollup1h)
+	apply(cfg.AlertHistory, &policy.AlertHistory)
+	return policy
+}
+
+// scrapeConfig 将配置中以秒为单位的采集间隔和超时转换为调度配置
+func scrapeConfig(cfg config.CollectionConfig) service.ScrapeConfig {
+	seconds := func(m map[string]int) map[string]time.Duration {
+		durations := make(map[string]time.Duration, len(m))
+		for mwType, n := range m {
+			durations[strings.ToLower(mwType)] = time.Duration(n) * time.Second
+		}
+		return durations
+	}
+	return service.ScrapeConfig{
+		Workers:       cfg.Workers,
+		Interval:      time.Duration(cfg.Interval) * time.Second,
+		Timeout:       time.Duration(cfg.Timeout) * time.Second,
+		TypeIntervals: seconds(cfg.TypeIntervals),
+		TypeTimeouts:  seconds(cfg.TypeTimeouts),
 	}
-} 
\ No newline at end of file
+}
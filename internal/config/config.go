@@ -8,14 +8,106 @@ import (
 )
 
 type Config struct {
-	Server   ServerConfig   `yaml:"server"`
-	Database DatabaseConfig `yaml:"database"`
+	Server     ServerConfig     `yaml:"server"`
+	Database   DatabaseConfig   `yaml:"database"`
+	Sync       SyncConfig       `yaml:"sync"`
+	Prometheus PrometheusConfig `yaml:"prometheus"`
+	Metrics    MetricsConfig    `yaml:"metrics"`
+	Health     HealthConfig     `yaml:"health"`
+	// 证书清单和过期提醒
+	Certificates CertificatesConfig `yaml:"certificates"`
 }
 
 type ServerConfig struct {
 	Port string `yaml:"port"`
 }
 
+// SyncConfig 文件同步任务队列配置
+type SyncConfig struct {
+	Workers   int `yaml:"workers"`    // 并发执行的同步任务数
+	QueueSize int `yaml:"queue_size"` // 排队任务上限
+	// watch 模式下源文件的检查间隔（秒）
+	WatchInterval int `yaml:"watch_interval"`
+	// 远程文件漂移检测间隔（秒），0 表示关闭
+	DriftInterval int `yaml:"drift_interval"`
+	// 所有传输共享的带宽上限（KB/s），0 表示不限制
+	BandwidthLimit int `yaml:"bandwidth_limit"`
+	// 不小于该大小（MB）的文件只在 transfer_window 内开始传输，0 表示不限制
+	LargeFileSize  int    `yaml:"large_file_size"`
+	TransferWindow string `yaml:"transfer_window"` // 如 "01:00-05:00"
+	// 拉取模式收集到的文件在平台上的存储目录
+	StorageDir string `yaml:"storage_dir"`
+	// 推送版本的存储目录及每个同步任务保留的版本数，用于回滚
+	RevisionDir       string `yaml:"revision_dir"`
+	RevisionRetention int    `yaml:"revision_retention"`
+}
+
+// PrometheusConfig 与外部 Prometheus 的对接
+type PrometheusConfig struct {
+	// 是否接收 POST /api/v1/prom/write 推送的样本
+	RemoteWrite bool `yaml:"remote_write"`
+	// 外部 Prometheus 地址，用于告警规则和图表查询，为空表示不使用
+	QueryURL     string `yaml:"query_url"`
+	QueryTimeout int    `yaml:"query_timeout"` // 查询超时（秒）
+}
+
+// HealthConfig 中间件健康检查配置
+type HealthConfig struct {
+	Interval int `yaml:"interval"` // 检查间隔（秒）
+	// 检查耗时超过该值（毫秒）时状态为 degraded
+	LatencyThreshold int `yaml:"latency_threshold"`
+	// 连续失败达到该次数时状态为 down
+	FailureThreshold int `yaml:"failure_threshold"`
+}
+
+// CertificatesConfig 证书扫描配置
+type CertificatesConfig struct {
+	// 扫描中间件端点和主机证书文件的间隔（秒），0 表示只手动扫描
+	ScanInterval int `yaml:"scan_interval"`
+	// 剩余天数越过这些值时各告警一次，为空时使用 30、14、7、1
+	AlertDays []int `yaml:"alert_days"`
+	// 通过 SSH 在主机上查找 .pem/.crt/.cer 文件的目录，为空时使用默认目录
+	HostPaths []string `yaml:"host_paths"`
+}
+
+// MetricsConfig 指标存储配置
+type MetricsConfig struct {
+	Collection CollectionConfig `yaml:"collection"`
+	Retention  RetentionConfig  `yaml:"retention"`
+	// 过期数据清理间隔（秒），0 表示不清理
+	JanitorInterval int `yaml:"janitor_interval"`
+	// 每次 DELETE 的最大行数
+	JanitorBatchSize int             `yaml:"janitor_batch_size"`
+	ZooKeeper        ZooKeeperConfig `yaml:"zookeeper"`
+}
+
+// ZooKeeperConfig ZooKeeper 采集配置
+type ZooKeeperConfig struct {
+	// AdminServer 端口，mntr 未加入四字命令白名单时通过 /commands/monitor 采集，0 表示不使用
+	AdminPort int `yaml:"admin_port"`
+}
+
+// CollectionConfig 指标采集调度，时间单位为秒
+type CollectionConfig struct {
+	Workers  int `yaml:"workers"`  // 并发采集的中间件数
+	Interval int `yaml:"interval"` // 默认采集间隔
+	Timeout  int `yaml:"timeout"`  // 默认单次采集超时
+	// 缓存的中间件客户端数上限，超出时关闭最久未使用的
+	MaxClients int `yaml:"max_clients"`
+	// 按中间件类型覆盖间隔和超时，如 redis: 15
+	TypeIntervals map[string]int `yaml:"type_intervals"`
+	TypeTimeouts  map[string]int `yaml:"type_timeouts"`
+}
+
+// RetentionConfig 各粒度数据的保留天数，未配置时使用默认值，负数表示永久保留
+type RetentionConfig struct {
+	Raw          int `yaml:"raw"`
+	Rollup1m     int `yaml:"rollup_1m"`
+	Rollup5m     int `yaml:"rollup_5m"`
+	Rollup1h     int `yaml:"rollup_1h"`
+	AlertHistory int `yaml:"alert_history"`
+}
+
 type DatabaseConfig struct {
 	Host     string `yaml:"host"`
 	Port     int    `yaml:"port"`
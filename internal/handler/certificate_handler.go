@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"middleware-platform/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CertificateHandler struct {
+	service *service.CertificateService
+}
+
+func NewCertificateHandler(service *service.CertificateService) *CertificateHandler {
+	return &CertificateHandler{service: service}
+}
+
+// GetCertificates 证书清单，按过期时间排列；expiring_within=N 只返回 N 天内过期（含已过期）的证书
+func (h *CertificateHandler) GetCertificates(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("expiring_within", "0"))
+	if err != nil || days < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid expiring_within",
+		})
+		return
+	}
+
+	certs, err := h.service.GetCertificates(days)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": certs,
+		"message": "success",
+	})
+}
+
+// ScanCertificates 在后台立即扫描一次
+func (h *CertificateHandler) ScanCertificates(c *gin.Context) {
+	if err := h.service.TriggerScan(); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrCertScanBusy) {
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"code": status,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"code": 202,
+		"message": "certificate scan started",
+	})
+}
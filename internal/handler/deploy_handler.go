@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"middleware-platform/internal/model"
+	"middleware-platform/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DeployHandler struct {
+	service *service.DeployService
+}
+
+func NewDeployHandler(service *service.DeployService) *DeployHandler {
+	return &DeployHandler{service: service}
+}
+
+// deployErrorStatus 校验失败返回400，模板版本已存在或主机正在部署返回409
+func deployErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidTemplate), errors.Is(err, service.ErrInvalidDeployment):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrTemplateExists), errors.Is(err, service.ErrHostDeploying):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// CreateTemplate 创建安装模板，模板创建后不可修改，新版本以新的 version 创建
+func (h *DeployHandler) CreateTemplate(c *gin.Context) {
+	var tmpl model.DeployTemplate
+	if err := c.ShouldBindJSON(&tmpl); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := h.service.CreateTemplate(&tmpl); err != nil {
+		status := deployErrorStatus(err)
+		c.JSON(status, gin.H{
+			"code": status,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": tmpl,
+		"message": "success",
+	})
+}
+
+// GetTemplates 安装模板列表，支持按名称过滤
+func (h *DeployHandler) GetTemplates(c *gin.Context) {
+	templates, err := h.service.GetTemplates(c.Query("name"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": templates,
+		"message": "success",
+	})
+}
+
+func (h *DeployHandler) GetTemplate(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid id",
+		})
+		return
+	}
+
+	tmpl, err := h.service.GetTemplate(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": 404,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": tmpl,
+		"message": "success",
+	})
+}
+
+// CreateDeployment 按模板在主机上部署中间件，部署在后台执行，进度通过 GET /jobs/:id 查看
+func (h *DeployHandler) CreateDeployment(c *gin.Context) {
+	var deployment model.Deployment
+	if err := c.ShouldBindJSON(&deployment); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := h.service.CreateDeployment(&deployment); err != nil {
+		status := deployErrorStatus(err)
+		c.JSON(status, gin.H{
+			"code": status,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"code": 202,
+		"data": deployment,
+		"message": "deployment started",
+	})
+}
+
+func (h *DeployHandler) GetDeployments(c *gin.Context) {
+	deployments, err := h.service.GetDeployments()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": deployments,
+		"message": "success",
+	})
+}
+
+// GetDeployment 部署任务及各步骤的命令、输出和回滚结果
+func (h *DeployHandler) GetDeployment(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid id",
+		})
+		return
+	}
+
+	deployment, err := h.service.GetDeployment(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": 404,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": deployment,
+		"message": "success",
+	})
+}
+
+// CancelDeployment 取消执行中的部署，已执行的步骤会被回滚
+func (h *DeployHandler) CancelDeployment(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid id",
+		})
+		return
+	}
+
+	if err := h.service.CancelDeployment(uint(id)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"message": "success",
+	})
+}
@@ -1,13 +1,15 @@
 package handler
 
 import (
+	"io"
+	"log"
 	"middleware-platform/internal/model"
 	"middleware-platform/internal/service"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"log"
 )
 
 type HostHandler struct {
@@ -128,8 +130,8 @@ func (h *HostHandler) SyncFile(c *gin.Context) {
 		return
 	}
 
-	log.Printf("Syncing file: %v", fileSync)
-	if err := h.service.SyncFile(&fileSync); err != nil {
+	log.Printf("Queueing file sync: %s -> host %d:%s", fileSync.SourcePath, fileSync.HostID, fileSync.TargetPath)
+	if err := h.service.SubmitSync(&fileSync); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code": 500,
 			"message": err.Error(),
@@ -139,6 +141,7 @@ func (h *HostHandler) SyncFile(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
+		"data": gin.H{"id": fileSync.ID},
 		"message": "success",
 	})
 }
@@ -167,4 +170,500 @@ func (h *HostHandler) GetFileSyncs(c *gin.Context) {
 		"data": fileSyncs,
 		"message": "success",
 	})
-} 
\ No newline at end of file
+}
+
+func (h *HostHandler) GetFileSync(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid id",
+		})
+		return
+	}
+
+	fileSync, err := h.service.GetFileSync(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": 404,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": fileSync,
+		"message": "success",
+	})
+}
+
+// UpdateFileSync 修改同步任务的路径、cron表达式或监听配置
+func (h *HostHandler) UpdateFileSync(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid id",
+		})
+		return
+	}
+
+	var input model.FileSync
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	fileSync, err := h.service.UpdateFileSyncDefinition(uint(id), &input)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": fileSync,
+		"message": "success",
+	})
+}
+
+func (h *HostHandler) GetSyncHistory(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid id",
+		})
+		return
+	}
+
+	history, err := h.service.GetSyncHistory(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": history,
+		"message": "success",
+	})
+}
+
+// GetSyncRevisions 列出可以回滚的版本
+func (h *HostHandler) GetSyncRevisions(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid id",
+		})
+		return
+	}
+
+	revisions, err := h.service.GetSyncRevisions(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": revisions,
+		"message": "success",
+	})
+}
+
+// RollbackSync 将目标文件恢复为指定版本：?revision=N
+func (h *HostHandler) RollbackSync(c *gin.Context) {
+	revision, err := strconv.Atoi(c.Query("revision"))
+	if err != nil || revision <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid revision",
+		})
+		return
+	}
+
+	h.controlSync(c, func(id uint) error {
+		return h.service.RollbackSync(id, revision)
+	})
+}
+
+// GetDriftedSyncs 列出目标文件被带外修改、丢失或无法校验的同步任务
+func (h *HostHandler) GetDriftedSyncs(c *gin.Context) {
+	fileSyncs, err := h.service.GetDriftedFileSyncs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": fileSyncs,
+		"message": "success",
+	})
+}
+
+// VerifySync 立即在目标主机上重新计算SHA-256并与同步时的源文件比对
+func (h *HostHandler) VerifySync(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid id",
+		})
+		return
+	}
+
+	fileSync, err := h.service.VerifyFileSync(uint(id))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": fileSync,
+		"message": "success",
+	})
+}
+
+func (h *HostHandler) PauseSync(c *gin.Context) {
+	h.controlSync(c, h.service.PauseSync)
+}
+
+func (h *HostHandler) ResumeSync(c *gin.Context) {
+	h.controlSync(c, h.service.ResumeSync)
+}
+
+func (h *HostHandler) CancelSync(c *gin.Context) {
+	h.controlSync(c, h.service.CancelSync)
+}
+
+// controlSync 按路径中的id执行暂停/恢复/取消等操作的公共处理
+func (h *HostHandler) controlSync(c *gin.Context, action func(uint) error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid id",
+		})
+		return
+	}
+
+	if err := action(uint(id)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"message": "success",
+	})
+}
+
+// StreamSyncProgress 通过SSE推送同步进度，任务结束后关闭连接
+func (h *HostHandler) StreamSyncProgress(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid id",
+		})
+		return
+	}
+
+	// 先订阅再读取当前状态，避免丢失两者之间的事件
+	progress, unsubscribe := h.service.SubscribeSyncProgress(uint(id))
+	defer unsubscribe()
+
+	fileSync, err := h.service.GetFileSync(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": 404,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("progress", service.SyncProgress{
+		FileSyncID: fileSync.ID,
+		Status:     fileSync.Status,
+		Progress:   fileSync.Progress,
+		Speed:      fileSync.Speed,
+		SyncedSize: fileSync.SyncedSize,
+		FileSize:   fileSync.FileSize,
+	})
+	c.Writer.Flush()
+	if service.IsFinalSyncStatus(fileSync.Status) {
+		return
+	}
+
+	heartbeat := time.NewTicker(15 * time.Second)
+	defer heartbeat.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case p := <-progress:
+			c.SSEvent("progress", p)
+			return !service.IsFinalSyncStatus(p.Status)
+		case <-heartbeat.C:
+			c.SSEvent("ping", time.Now().Unix())
+			return true
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+// CreateDistribution 创建滚动分发任务，将同一源文件推送到多台主机
+func (h *HostHandler) CreateDistribution(c *gin.Context) {
+	var distribution model.Distribution
+	if err := c.ShouldBindJSON(&distribution); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := h.service.CreateDistribution(&distribution); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{"id": distribution.ID},
+		"message": "success",
+	})
+}
+
+func (h *HostHandler) GetDistributions(c *gin.Context) {
+	distributions, err := h.service.GetDistributions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": distributions,
+		"message": "success",
+	})
+}
+
+// GetDistribution 分发任务详情：各主机状态、校验和以及汇总
+func (h *HostHandler) GetDistribution(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid id",
+		})
+		return
+	}
+
+	distribution, summary, err := h.service.GetDistribution(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": 404,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"distribution": distribution,
+			"summary":      summary,
+		},
+		"message": "success",
+	})
+}
+
+func (h *HostHandler) CancelDistribution(c *gin.Context) {
+	h.controlSync(c, h.service.CancelDistribution)
+}
+
+// CreateFileCollection 创建拉取任务，从主机下载文件或目录到平台存储
+func (h *HostHandler) CreateFileCollection(c *gin.Context) {
+	var collection model.FileCollection
+	if err := c.ShouldBindJSON(&collection); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	if err := h.service.CreateFileCollection(&collection); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{"id": collection.ID},
+		"message": "success",
+	})
+}
+
+// GetFileCollections 获取拉取任务列表，可按 host_id 过滤
+func (h *HostHandler) GetFileCollections(c *gin.Context) {
+	var hostID uint64
+	if v := c.Query("host_id"); v != "" {
+		var err error
+		hostID, err = strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code": 400,
+				"message": "invalid host id",
+			})
+			return
+		}
+	}
+
+	collections, err := h.service.GetFileCollections(uint(hostID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": collections,
+		"message": "success",
+	})
+}
+
+// GetFileCollection 拉取任务详情及其保留的版本
+func (h *HostHandler) GetFileCollection(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid id",
+		})
+		return
+	}
+
+	collection, err := h.service.GetFileCollection(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": 404,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": collection,
+		"message": "success",
+	})
+}
+
+// CollectFiles 立即重新收集一次
+func (h *HostHandler) CollectFiles(c *gin.Context) {
+	h.controlSync(c, h.service.CollectFiles)
+}
+
+// DownloadCollectedFile 下载收集到的版本
+func (h *HostHandler) DownloadCollectedFile(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("fileId"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid id",
+		})
+		return
+	}
+
+	file, err := h.service.GetCollectedFile(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": 404,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.FileAttachment(file.StoragePath, file.FileName)
+}
+
+// DiffCollectedFiles 对比两个收集版本：?from=<版本ID>&to=<版本ID>，可跨主机
+func (h *HostHandler) DiffCollectedFiles(c *gin.Context) {
+	from, err := strconv.ParseUint(c.Query("from"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid from",
+		})
+		return
+	}
+	to, err := strconv.ParseUint(c.Query("to"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid to",
+		})
+		return
+	}
+
+	diff, err := h.service.DiffCollectedFiles(uint(from), uint(to))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"identical": diff == "",
+			"diff":      diff,
+		},
+		"message": "success",
+	})
+}
@@ -1,9 +1,17 @@
 package handler
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"middleware-platform/internal/prom"
 	"middleware-platform/internal/service"
 
 	"github.com/gin-gonic/gin"
@@ -18,8 +26,12 @@ func NewMetricsHandler(service *service.MetricsService) *MetricsHandler {
 }
 
 func (h *MetricsHandler) GetMetricsStatus(c *gin.Context) {
-	middlewareID := uint(1) // 从请求参数中获取
-	metrics, err := h.service.GetLatestMetrics(middlewareID)
+	middlewareID, err := strconv.ParseUint(c.Query("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid middleware id"})
+		return
+	}
+	metrics, err := h.service.GetLatestMetrics(uint(middlewareID))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -32,10 +44,22 @@ func (h *MetricsHandler) GetMetricsStatus(c *gin.Context) {
 }
 
 func (h *MetricsHandler) GetPerformanceMetrics(c *gin.Context) {
-	middlewareID := uint(1) // 从请求参数中获取
+	middlewareID, err := strconv.ParseUint(c.Query("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid middleware id"})
+		return
+	}
 	duration := 24 * time.Hour // 默认查询最近24小时
+	if v := c.Query("duration"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid duration"})
+			return
+		}
+		duration = d
+	}
 
-	metrics, err := h.service.GetPerformanceMetrics(middlewareID, duration)
+	metrics, err := h.service.GetPerformanceMetrics(uint(middlewareID), duration)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -44,4 +68,409 @@ func (h *MetricsHandler) GetPerformanceMetrics(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"performance": metrics,
 	})
-}
\ No newline at end of file
+}
+
+// QueryMetrics 指标查询：
+// ?ids=1,2&selector=type=redis,host=10.0.0.1&metrics=memory_usage&start=&end=&step=&agg=avg
+// start/end 为 Unix 时间戳或 RFC3339，默认最近1小时；agg 可选 avg、min、max、sum、p95、rate
+func (h *MetricsHandler) QueryMetrics(c *gin.Context) {
+	query := service.MetricsQuery{
+		End:         time.Now(),
+		Aggregation: c.DefaultQuery("agg", service.AggregationAvg),
+	}
+	query.Start = query.End.Add(-time.Hour)
+
+	for _, v := range splitList(c.QueryArray("ids")) {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid middleware id %q", v)})
+			return
+		}
+		query.MiddlewareIDs = append(query.MiddlewareIDs, uint(id))
+	}
+	for _, v := range splitList(c.QueryArray("selector")) {
+		key, value, ok := strings.Cut(v, "=")
+		if !ok || key == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid selector %q, expected key=value", v)})
+			return
+		}
+		if query.Selector == nil {
+			query.Selector = make(map[string]string)
+		}
+		query.Selector[key] = value
+	}
+	query.Metrics = splitList(c.QueryArray("metrics"))
+
+	if v := c.Query("start"); v != "" {
+		t, err := parseQueryTime(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query.Start = t
+	}
+	if v := c.Query("end"); v != "" {
+		t, err := parseQueryTime(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query.End = t
+	}
+	if v := c.Query("step"); v != "" {
+		d, err := parseQueryStep(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query.Step = d
+	}
+
+	result, err := h.service.QueryMetrics(query)
+	if err != nil {
+		var invalid *service.InvalidQueryError
+		if errors.As(err, &invalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// splitList 展开重复参数和逗号分隔的值
+func splitList(values []string) []string {
+	var list []string
+	for _, v := range values {
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+	}
+	return list
+}
+
+// GetScrapeStatuses 每个中间件最近一次采集的结果：最后成功时间、错误和耗时
+func (h *MetricsHandler) GetScrapeStatuses(c *gin.Context) {
+	statuses, err := h.service.GetScrapeStatuses()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"scrapes": statuses})
+}
+
+// GetRedisSlowLogs 分页浏览采集时保存的 Redis 慢查询
+func (h *MetricsHandler) GetRedisSlowLogs(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid middleware id"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid offset"})
+		return
+	}
+
+	logs, total, err := h.service.GetSlowLogs(uint(id), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"slowlogs": logs, "total": total})
+}
+
+// ScanRedisBigKeys 按需扫描 Redis 中占用内存最大的 key
+func (h *MetricsHandler) ScanRedisBigKeys(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid middleware id"})
+		return
+	}
+	opts := service.BigKeyScanOptions{Match: c.Query("match")}
+	for name, dst := range map[string]*int{"max_keys": &opts.Limit, "top": &opts.Top} {
+		if v := c.Query(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name})
+				return
+			}
+			*dst = n
+		}
+	}
+
+	report, err := h.service.ScanBigKeys(c.Request.Context(), uint(id), opts)
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, service.ErrNotRedis):
+			status = http.StatusBadRequest
+		case errors.Is(err, context.DeadlineExceeded):
+			status = http.StatusGatewayTimeout
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"bigkeys": report})
+}
+
+// GetRedisTopology Redis Cluster 或 Sentinel 的拓扑：槽位覆盖、主从关系和节点对应的子实例
+func (h *MetricsHandler) GetRedisTopology(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid middleware id"})
+		return
+	}
+	topology, err := h.service.GetRedisTopology(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"topology": topology})
+}
+
+// GetRedisFailovers 最近的主从切换记录
+func (h *MetricsHandler) GetRedisFailovers(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid middleware id"})
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 1000 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 1000"})
+		return
+	}
+	events, err := h.service.GetFailoverEvents(uint(id), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"failovers": events})
+}
+
+// GetZKEnsemble ZooKeeper 集群成员、各成员模式和法定人数
+func (h *MetricsHandler) GetZKEnsemble(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid middleware id"})
+		return
+	}
+	ensemble, err := h.service.GetZKEnsemble(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ensemble": ensemble})
+}
+
+// GetEtcdCluster etcd 集群成员、leader 和数据库大小
+func (h *MetricsHandler) GetEtcdCluster(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid middleware id"})
+		return
+	}
+	cluster, err := h.service.GetEtcdCluster(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"cluster": cluster})
+}
+
+// GetConsulCluster Consul 集群 raft 状态和服务目录健康检查汇总
+func (h *MetricsHandler) GetConsulCluster(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid middleware id"})
+		return
+	}
+	cluster, err := h.service.GetConsulCluster(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"cluster": cluster})
+}
+
+// GetESCluster Elasticsearch 集群健康、节点 JVM 堆和磁盘水位
+func (h *MetricsHandler) GetESCluster(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid middleware id"})
+		return
+	}
+	cluster, err := h.service.GetESCluster(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"cluster": cluster})
+}
+
+// GetStorageUsage 指标存储占用：各表大小和每个中间件的估算大小
+func (h *MetricsHandler) GetStorageUsage(c *gin.Context) {
+	report, err := h.service.GetStorageUsage()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"storage": report})
+}
+
+// Prometheus 以 Prometheus 文本格式输出最新采集的中间件指标和平台运行指标
+func (h *MetricsHandler) Prometheus(c *gin.Context) {
+	var buf bytes.Buffer
+	if err := h.service.WritePrometheus(&buf); err != nil {
+		c.String(http.StatusInternalServerError, "# failed to read metrics: %v\n", err)
+		return
+	}
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", buf.Bytes())
+}
+
+// maxRemoteWriteBody 压缩后的 remote_write 请求体上限
+const maxRemoteWriteBody = 16 << 20
+
+// RemoteWrite Prometheus remote_write 接收端，请求体为 snappy 压缩的 WriteRequest
+func (h *MetricsHandler) RemoteWrite(c *gin.Context) {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxRemoteWriteBody+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(body) > maxRemoteWriteBody {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "request body too large"})
+		return
+	}
+	data, err := prom.DecodeSnappy(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	series, err := prom.DecodeWriteRequest(data)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 4xx 不会被 Prometheus 重试，5xx 会
+	if _, _, err := h.service.IngestRemoteWrite(series); err != nil {
+		if errors.Is(err, service.ErrRemoteWriteDisabled) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// QueryPrometheus 在外部 Prometheus 上执行即时查询：?query=&time=
+func (h *MetricsHandler) QueryPrometheus(c *gin.Context) {
+	expr := c.Query("query")
+	if expr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query is required"})
+		return
+	}
+	var at time.Time
+	if v := c.Query("time"); v != "" {
+		t, err := parseQueryTime(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		at = t
+	}
+
+	series, err := h.service.QueryPrometheus(c.Request.Context(), expr, at)
+	if err != nil {
+		c.JSON(prometheusErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": series})
+}
+
+// QueryPrometheusRange 在外部 Prometheus 上执行区间查询：?query=&start=&end=&step=，
+// 默认查询最近1小时，步长60秒
+func (h *MetricsHandler) QueryPrometheusRange(c *gin.Context) {
+	expr := c.Query("query")
+	if expr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "query is required"})
+		return
+	}
+	end := time.Now()
+	start := end.Add(-time.Hour)
+	step := time.Minute
+	if v := c.Query("start"); v != "" {
+		t, err := parseQueryTime(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		start = t
+	}
+	if v := c.Query("end"); v != "" {
+		t, err := parseQueryTime(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		end = t
+	}
+	if v := c.Query("step"); v != "" {
+		d, err := parseQueryStep(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		step = d
+	}
+
+	series, err := h.service.QueryPrometheusRange(c.Request.Context(), expr, start, end, step)
+	if err != nil {
+		c.JSON(prometheusErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": series})
+}
+
+func prometheusErrorStatus(err error) int {
+	if errors.Is(err, service.ErrPrometheusNotConfigured) {
+		return http.StatusNotImplemented
+	}
+	return http.StatusBadGateway
+}
+
+// parseQueryTime 支持 Unix 时间戳（秒，可带小数）和 RFC3339
+func parseQueryTime(v string) (time.Time, error) {
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		sec := int64(f)
+		return time.Unix(sec, int64((f-float64(sec))*1e9)), nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q", v)
+	}
+	return t, nil
+}
+
+// parseQueryStep 支持秒数和 Go 时长格式，如 30、1m
+func parseQueryStep(v string) (time.Duration, error) {
+	if f, err := strconv.ParseFloat(v, 64); err == nil {
+		return time.Duration(f * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid step %q", v)
+	}
+	return d, nil
+}
@@ -2,6 +2,7 @@ package handler
 
 import (
 	"encoding/csv"
+	"errors"
 	"middleware-platform/internal/model"
 	"middleware-platform/internal/service"
 	"net/http"
@@ -56,6 +57,13 @@ func (h *MiddlewareHandler) CreateMiddleware(c *gin.Context) {
 	}
 
 	if err := h.service.Create(&middleware); err != nil {
+		if errors.Is(err, service.ErrInvalidProbe) || errors.Is(err, service.ErrInvalidControl) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code": 400,
+				"message": err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code": 500,
 			"message": err.Error(),
@@ -91,6 +99,13 @@ func (h *MiddlewareHandler) UpdateMiddleware(c *gin.Context) {
 	middleware.ID = uint(id)
 
 	if err := h.service.Update(&middleware); err != nil {
+		if errors.Is(err, service.ErrInvalidProbe) || errors.Is(err, service.ErrInvalidControl) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code": 400,
+				"message": err.Error(),
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code": 500,
 			"message": err.Error(),
@@ -193,4 +208,120 @@ func (h *MiddlewareHandler) ExportMiddlewareList(c *gin.Context) {
 		})
 		return
 	}
-} 
\ No newline at end of file
+}
+
+// GetMiddlewareHealth 当前健康状态、最近的状态变化和最近一天/一周/一个月的可用率
+func (h *MiddlewareHandler) GetMiddlewareHealth(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid id",
+		})
+		return
+	}
+
+	health, err := h.service.GetHealth(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"code": 404,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": health,
+		"message": "success",
+	})
+}
+
+// GetMiddlewareAvailability 最近一天/一周/一个月的可用率
+func (h *MiddlewareHandler) GetMiddlewareAvailability(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid id",
+		})
+		return
+	}
+
+	availability, err := h.service.GetAvailability(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": availability,
+		"message": "success",
+	})
+}
+
+// RunMiddlewareAction 在中间件所在主机上执行 start、stop、restart 或 reload，操作在后台执行，
+// 结果通过 GET /:id/operations 查看
+func (h *MiddlewareHandler) RunMiddlewareAction(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid id",
+		})
+		return
+	}
+
+	op, err := h.service.RunAction(uint(id), c.Param("action"), c.ClientIP())
+	if err != nil {
+		status := http.StatusInternalServerError
+		switch {
+		case errors.Is(err, service.ErrInvalidAction), errors.Is(err, service.ErrNoControl):
+			status = http.StatusBadRequest
+		case errors.Is(err, service.ErrOperationBusy):
+			status = http.StatusConflict
+		}
+		c.JSON(status, gin.H{
+			"code": status,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"code": 202,
+		"data": op,
+		"message": "operation started",
+	})
+}
+
+// GetMiddlewareOperations 最近的启停操作审计记录
+func (h *MiddlewareHandler) GetMiddlewareOperations(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code": 400,
+			"message": "invalid id",
+		})
+		return
+	}
+
+	ops, err := h.service.GetOperations(uint(id))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code": 500,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": ops,
+		"message": "success",
+	})
+}
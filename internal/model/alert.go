@@ -4,11 +4,13 @@ import "time"
 
 type AlertRule struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
-	Type      string    `json:"type" gorm:"not null"` // cpu_usage, memory_usage, etc
-	Target    string    `json:"target" gorm:"not null"` // middleware id or '*' for all
+	Type      string    `json:"type" gorm:"not null"` // cpu_usage, memory_usage, etc; 事件类告警: file_sync_failed, file_sync_drift
+	Target    string    `json:"target" gorm:"not null"` // middleware id (事件类告警为事件对象id) or '*' for all
 	Threshold string    `json:"threshold" gorm:"not null"` // 阈值
 	Operator  string    `json:"operator" gorm:"not null"` // >, <, >=, <=, =
 	Status    string    `json:"status"` // enabled, disabled
+	Source    string    `json:"source" gorm:"default:builtin"` // builtin: 平台采集的指标; prometheus: 对外部 Prometheus 执行 Expr
+	Expr      string    `json:"expr"` // Source 为 prometheus 时的 PromQL 表达式
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -18,5 +20,5 @@ type AlertHistory struct {
 	RuleID    uint      `json:"rule_id"`
 	Message   string    `json:"message"`
 	Status    string    `json:"status"` // triggered, resolved
-	CreatedAt time.Time `json:"created_at"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
 }
\ No newline at end of file
@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 证书来源
+const (
+	CertSourceEndpoint = "endpoint"  // 中间件端点 TLS 握手时出示的证书
+	CertSourceHostFile = "host_file" // 通过 SSH 在主机上找到的证书文件
+)
+
+// Certificate 证书清单中的一张证书（叶子证书），每个位置只保留当前的证书
+type Certificate struct {
+	gorm.Model
+	// 位置的唯一标识：middleware/<ID> 或 host/<ID>/<路径>
+	Key          string    `json:"key" gorm:"not null;uniqueIndex"`
+	Source       string    `json:"source" gorm:"not null"`
+	MiddlewareID *uint     `json:"middleware_id" gorm:"index"`
+	HostID       *uint     `json:"host_id" gorm:"index"`
+	Location     string    `json:"location"` // 端点地址 host:port 或主机上的文件路径
+	Subject      string    `json:"subject"`
+	Issuer       string    `json:"issuer"`
+	SANs         []string  `json:"sans" gorm:"serializer:json"`
+	SerialNumber string    `json:"serial_number"`
+	Fingerprint  string    `json:"fingerprint"` // 证书 DER 的 SHA-256
+	NotBefore    time.Time `json:"not_before"`
+	NotAfter     time.Time `json:"not_after" gorm:"index"`
+	SelfSigned   bool      `json:"self_signed"`
+	VerifyError  string    `json:"verify_error"` // 按系统根证书校验失败的原因，为空表示受信任
+	LastSeenAt   time.Time `json:"last_seen_at"`
+	// 已告警的级别：越过的提醒天数个数，过期时再加一；证书更换后清零
+	AlertLevel int `json:"alert_level"`
+}
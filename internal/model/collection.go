@@ -0,0 +1,36 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// FileCollection 从主机拉取文件或目录到平台存储（拉取模式），每次收集保存为一个版本
+type FileCollection struct {
+	gorm.Model
+	HostID          uint       `json:"host_id" gorm:"not null;index"`
+	Host            Host       `json:"host" gorm:"foreignKey:HostID"`
+	SourcePath      string     `json:"sourcePath" gorm:"not null"` // 远程主机上的文件或目录
+	Description     string     `json:"description"`
+	Retention       int        `json:"retention"`    // 保留的版本数
+	IsDirectory     bool       `json:"is_directory"` // 目录以 tar.gz 打包保存
+	Status          string     `json:"status"`       // pending, collecting, completed, failed
+	Message         string     `json:"message"`
+	LastCollectedAt *time.Time `json:"last_collected_at"`
+
+	Versions []CollectedFile `json:"versions,omitempty" gorm:"foreignKey:CollectionID"`
+}
+
+// CollectedFile 收集到的一个版本
+type CollectedFile struct {
+	gorm.Model
+	CollectionID uint   `json:"collection_id" gorm:"not null;index"`
+	HostID       uint   `json:"host_id" gorm:"not null"`
+	Version      int    `json:"version"`
+	FileName     string `json:"file_name"`
+	StoragePath  string `json:"-"` // 平台上的存储路径
+	IsArchive    bool   `json:"is_archive"`
+	SHA256       string `json:"sha256"`
+	Size         int64  `json:"size"`
+}
@@ -0,0 +1,83 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 安装方式
+const (
+	InstallPackage = "package" // 通过 apt/dnf/yum 安装软件包
+	InstallTarball = "tarball" // 下载并解压到安装目录
+)
+
+// DeployTemplate 中间件安装模板。同名模板按版本区分，创建后不可修改。
+// 除 Name/Version/MiddlewareType 外的字符串字段都是 text/template 模板，
+// 可以引用 {{.Name}}（部署名称）、{{.Version}}、{{.Host}}（主机 IP）和 {{.Params.xxx}}
+type DeployTemplate struct {
+	gorm.Model
+	Name    string `json:"name" gorm:"not null;uniqueIndex:idx_deploy_template_version"`
+	Version string `json:"version" gorm:"not null;uniqueIndex:idx_deploy_template_version"`
+	// 注册的中间件类型，如 redis、mysql、zookeeper；没有对应健康检查的类型（如 nginx）可以使用 probe
+	MiddlewareType string `json:"middleware_type" gorm:"not null"`
+	Description    string `json:"description"`
+	InstallMethod  string `json:"install_method" gorm:"not null"` // package, tarball
+	Package        string `json:"package"`                        // 软件包名，可带版本，如 redis-server=5:7.0.15-1
+	TarballURL     string `json:"tarball_url"`
+	InstallDir     string `json:"install_dir"` // tarball 解压目录，必须不存在或为空
+	ConfigPath     string `json:"config_path"`
+	ConfigTemplate string `json:"config_template" gorm:"type:text"`
+	UnitName       string `json:"unit_name" gorm:"not null"`
+	// systemd unit 文件内容，为空时使用软件包自带的 unit
+	UnitTemplate string `json:"unit_template" gorm:"type:text"`
+	// 部署时可以传入的参数，port 为必需参数，password 参数会作为中间件的连接凭据
+	Parameters []DeployParameter `json:"parameters" gorm:"serializer:json"`
+}
+
+// DeployParameter 模板参数
+type DeployParameter struct {
+	Name        string `json:"name"`
+	Default     string `json:"default"`
+	Required    bool   `json:"required"`
+	Description string `json:"description"`
+}
+
+// Deployment 一次部署任务：按模板在主机上逐步执行，失败时按相反顺序回滚已执行的步骤
+type Deployment struct {
+	gorm.Model
+	TemplateID      uint              `json:"template_id" gorm:"not null"`
+	TemplateName    string            `json:"template_name"`
+	TemplateVersion string            `json:"template_version"`
+	HostID          uint              `json:"host_id" gorm:"not null;index"`
+	Name            string            `json:"name" gorm:"not null"` // 注册的中间件名称
+	Params          map[string]string `json:"params" gorm:"serializer:json"`
+	Sudo            bool              `json:"sudo"`   // 通过 sudo -n 执行各步骤
+	Status          string            `json:"status"` // pending, running, success, rolled_back, failed
+	Message         string            `json:"message"`
+	MiddlewareID    *uint             `json:"middleware_id"` // 部署成功后注册的中间件
+	StartedAt       *time.Time        `json:"started_at"`
+	FinishedAt      *time.Time        `json:"finished_at"`
+
+	Steps []DeploymentStep `json:"steps,omitempty" gorm:"foreignKey:DeploymentID"`
+}
+
+// DeploymentStep 部署任务中的一个步骤及其日志
+type DeploymentStep struct {
+	gorm.Model
+	DeploymentID uint   `json:"deployment_id" gorm:"not null;index"`
+	Seq          int    `json:"seq"`
+	Name         string `json:"name"`    // precheck, install, config, unit, start, register, verify
+	Command      string `json:"command"` // 展示用的命令，写入文件的步骤不包含文件内容
+	// 回滚命令，重启后回滚被中断的部署时使用
+	RollbackCommand string     `json:"rollback_command"`
+	Status          string     `json:"status"` // pending, running, success, failed, skipped, rolled_back, rollback_failed
+	Output          string     `json:"output"`
+	Error           string     `json:"error"`
+	RollbackOutput  string     `json:"rollback_output"`
+	StartedAt       *time.Time `json:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at"`
+
+	// 实际执行的脚本，可能包含配置中的密码，不保存
+	Script string `json:"-" gorm:"-"`
+}
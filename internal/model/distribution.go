@@ -0,0 +1,49 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Distribution 将同一个源文件分批推送到多台主机（滚动分发）
+type Distribution struct {
+	gorm.Model
+	FileSyncID  uint   `json:"file_sync_id"` // 可选，引用已有同步任务的源路径和目标路径
+	SourcePath  string `json:"sourcePath" gorm:"not null"`
+	TargetPath  string `json:"targetPath" gorm:"not null"`
+	HostIDs     []uint `json:"host_ids" gorm:"-"`
+	BatchSize   int    `json:"batch_size"`   // 每批并发推送的主机数
+	MaxFailures int    `json:"max_failures"` // 失败主机数超过该值时中止后续批次
+	PreCommand  string `json:"pre_command"`  // 推送前在目标主机执行，如配置检查
+	PostCommand string `json:"post_command"` // 推送后在目标主机执行，如 reload
+	// 整个分发任务共享的带宽上限 KB/s，0 表示只受全局限制
+	BandwidthLimit int        `json:"bandwidth_limit"`
+	TransferWindow string     `json:"transfer_window"` // 只在该时间段内开始分发，如 01:00-05:00
+	Status         string     `json:"status"`          // pending, waiting, running, completed, failed, halted, cancelled
+	Message        string     `json:"message"`
+	MD5            string     `json:"md5"`    // 源文件校验和
+	SHA256         string     `json:"sha256"` // 源文件SHA-256，与目标主机上的校验和比对
+	FileSize       int64      `json:"file_size"`
+	StartedAt      *time.Time `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at"`
+
+	Targets []DistributionTarget `json:"targets,omitempty" gorm:"foreignKey:DistributionID"`
+}
+
+// DistributionTarget 分发任务中单台主机的执行结果
+type DistributionTarget struct {
+	gorm.Model
+	DistributionID uint       `json:"distribution_id" gorm:"not null;index"`
+	HostID         uint       `json:"host_id" gorm:"not null"`
+	HostName       string     `json:"host_name"`
+	HostIP         string     `json:"host_ip"`
+	Batch          int        `json:"batch"`
+	Status         string     `json:"status"`   // pending, running, success, failed, skipped
+	Checksum       string     `json:"checksum"` // 推送后目标主机上的文件SHA-256
+	PreOutput      string     `json:"pre_output"`
+	PostOutput     string     `json:"post_output"`
+	Error          string     `json:"error"`
+	StartedAt      *time.Time `json:"started_at"`
+	FinishedAt     *time.Time `json:"finished_at"`
+}
@@ -1,6 +1,8 @@
 package model
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -24,7 +26,7 @@ type FileSync struct {
 	Host          Host    `json:"host" gorm:"foreignKey:HostID"`
 	SourcePath    string  `json:"sourcePath" gorm:"not null"`
 	TargetPath    string  `json:"targetPath" gorm:"not null"`
-	Status        string  `json:"status"`      // syncing, paused, completed, failed, cancelled
+	Status        string  `json:"status"`      // pending, waiting, syncing, paused, completed, failed, cancelled
 	Progress      float64 `json:"progress"`    // 同步进度 0-100
 	Speed         float64 `json:"speed"`       // 传输速度 bytes/s
 	LastSyncAt    string  `json:"last_sync_at"`
@@ -35,6 +37,20 @@ type FileSync struct {
 	IsIncremental bool    `json:"isIncremental"`
 	SyncedSize    int64   `json:"synced_size"`  // 已同步大小，用于断点续传
 	IsPaused      bool    `json:"is_paused"`    // 是否暂停
+	TriggerMode     string `json:"trigger_mode"`     // manual, cron, watch
+	Schedule        string `json:"schedule"`         // cron 表达式，trigger_mode 为 cron 时生效
+	DebounceSeconds int    `json:"debounce_seconds"` // watch 模式下源文件变化后的防抖时间
+	LastTrigger     string `json:"last_trigger"`     // 最近一次执行的触发方式
+	SHA256          string     `json:"sha256"`           // 最近一次同步的源文件SHA-256
+	RemoteSHA256    string     `json:"remote_sha256"`    // 最近一次校验时目标文件的SHA-256
+	DriftStatus     string     `json:"drift_status"`     // in_sync, drifted, missing, error
+	DriftMessage    string     `json:"drift_message"`
+	DriftCheckedAt  *time.Time `json:"drift_checked_at"`
+	Priority        int        `json:"priority"`        // 排队时优先级高的先执行
+	BandwidthLimit  int        `json:"bandwidth_limit"` // 带宽上限 KB/s，0 表示只受全局限制
+	TransferWindow  string     `json:"transfer_window"` // 只在该时间段内开始传输，如 01:00-05:00
+	Revision         int `json:"revision"`          // 目标主机上当前的版本号
+	RollbackRevision int `json:"rollback_revision"` // 排队中的回滚目标版本，0 表示普通同步
 }
 
 // FileSyncHistory 文件同步历史记录
@@ -45,6 +61,10 @@ type FileSyncHistory struct {
 	Status       string `json:"status"`
 	Message      string `json:"message"`
 	MD5          string `json:"md5"`
+	SHA256       string `json:"sha256"`
+	Revision     int    `json:"revision"` // 执行后目标主机上的版本号
+	StoragePath  string `json:"-"`        // 该版本内容在平台上的存储路径，为空表示未保存或已清理
 	FileSize     int64  `json:"file_size"`
 	SyncType     string `json:"sync_type"` // full: 全量同步, incremental: 增量同步
+	Trigger      string `json:"trigger"`   // manual, cron, watch
 } 
\ No newline at end of file
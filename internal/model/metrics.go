@@ -1,12 +1,122 @@
 package model
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Metrics struct {
 	ID           uint      `json:"id" gorm:"primaryKey"`
-	MiddlewareID uint      `json:"middleware_id"`
-	Type         string    `json:"type"` // cpu_usage, memory_usage, qps, etc
+	SeriesID     uint      `json:"series_id" gorm:"index:idx_metrics_series_time,priority:1"`
+	MiddlewareID uint      `json:"middleware_id" gorm:"index:idx_metrics_middleware_type_time,priority:1"`
+	Type         string    `json:"type" gorm:"index:idx_metrics_middleware_type_time,priority:2"` // cpu_usage, memory_usage, qps, etc
 	Value        float64   `json:"value"`
 	Unit         string    `json:"unit"` // %, ms, count/s
-	Timestamp    time.Time `json:"timestamp"`
-} 
\ No newline at end of file
+	Timestamp    time.Time `json:"timestamp" gorm:"index:idx_metrics_series_time,priority:2;index:idx_metrics_middleware_type_time,priority:3;index"`
+	// 写入时与 MiddlewareID、Type 一起确定所属序列，不单独存储
+	Labels map[string]string `json:"labels,omitempty" gorm:"-"`
+}
+
+// MetricSeries 一条时间序列：中间件 + 指标名 + 标签
+type MetricSeries struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	MiddlewareID uint      `json:"middleware_id" gorm:"not null;uniqueIndex:idx_metric_series_key,priority:1"`
+	Name         string    `json:"name" gorm:"not null;uniqueIndex:idx_metric_series_key,priority:2"`
+	Labels       string    `json:"labels" gorm:"not null;default:'';uniqueIndex:idx_metric_series_key,priority:3"` // SeriesLabels 生成的规范形式
+	Unit         string    `json:"unit"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// LabelMap 解析序列标签
+func (s MetricSeries) LabelMap() map[string]string {
+	labels := map[string]string{}
+	if s.Labels != "" {
+		json.Unmarshal([]byte(s.Labels), &labels)
+	}
+	return labels
+}
+
+// SeriesLabels 标签的规范形式（键排序的JSON），没有标签时为空字符串
+func SeriesLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(labels)
+	return string(data)
+}
+
+// MetricRollup 一条序列在一个时间桶内的聚合值
+type MetricRollup struct {
+	SeriesID   uint      `json:"series_id" gorm:"primaryKey;autoIncrement:false"`
+	Resolution string    `json:"resolution" gorm:"primaryKey;size:8;index:idx_metric_rollups_expiry,priority:1"`
+	Bucket     time.Time `json:"bucket" gorm:"primaryKey;index:idx_metric_rollups_expiry,priority:2"`
+	Count      int64     `json:"count"`
+	Sum        float64   `json:"sum"`
+	Min        float64   `json:"min"`
+	Max        float64   `json:"max"`
+	Last       float64   `json:"last"`
+	LastAt     time.Time `json:"last_at"`
+}
+
+// 指标存储粒度，raw 为原始样本，其余为写入时同步生成的聚合
+const (
+	ResolutionRaw = "raw"
+	Resolution1m  = "1m"
+	Resolution5m  = "5m"
+	Resolution1h  = "1h"
+)
+
+// Resolution 聚合粒度及其时间桶长度
+type Resolution struct {
+	Name string
+	Step time.Duration
+}
+
+// RollupResolutions 按从细到粗排列
+var RollupResolutions = []Resolution{
+	{Name: Resolution1m, Step: time.Minute},
+	{Name: Resolution5m, Step: 5 * time.Minute},
+	{Name: Resolution1h, Step: time.Hour},
+}
+
+// MetricPoint 查询结果中的一个点，raw 粒度时 Count 为1
+type MetricPoint struct {
+	SeriesID  uint      `json:"series_id"`
+	Timestamp time.Time `json:"timestamp"`
+	Count     int64     `json:"count"`
+	Sum       float64   `json:"sum"`
+	Min       float64   `json:"min"`
+	Max       float64   `json:"max"`
+	Last      float64   `json:"last"`
+}
+
+// Avg 时间桶内的平均值
+func (p MetricPoint) Avg() float64 {
+	if p.Count == 0 {
+		return 0
+	}
+	return p.Sum / float64(p.Count)
+}
+
+// MetricStorageUsage 单个中间件的指标存储占用，字节数按表的平均行大小估算
+type MetricStorageUsage struct {
+	MiddlewareID   uint  `json:"middleware_id"`
+	Series         int64 `json:"series"`
+	Samples        int64 `json:"samples"`
+	RollupPoints   int64 `json:"rollup_points"`
+	EstimatedBytes int64 `json:"estimated_bytes"`
+}
+
+// MetricTableSize 指标相关表的实际大小（含索引）
+type MetricTableSize struct {
+	Table string `json:"table"`
+	Rows  int64  `json:"rows"` // 来自 pg_class 的估算值
+	Bytes int64  `json:"bytes"`
+}
+
+// MetricStorageReport 指标存储报告
+type MetricStorageReport struct {
+	Tables      []MetricTableSize    `json:"tables"`
+	Middlewares []MetricStorageUsage `json:"middlewares"`
+	TotalBytes  int64                `json:"total_bytes"`
+}
@@ -1,16 +1,70 @@
 package model
 
-import "time"
+import (
+    "encoding/json"
+    "time"
+)
 
 type Middleware struct {
-    ID          uint      `json:"id" gorm:"primaryKey"`
-    Name        string    `json:"name" gorm:"not null"`
-    Type        string    `json:"type" gorm:"not null"` // 中间件类型：Redis, MySQL, RabbitMQ 等
-    Version     string    `json:"version"`
-    Status      string    `json:"status"`
-    Host        string    `json:"host" gorm:"not null"`
-    Port        string    `json:"port" gorm:"not null"`
-    Credentials string    `json:"credentials,omitempty"`
-    CreatedAt   time.Time `json:"created_at"`
-    UpdatedAt   time.Time `json:"updated_at"`
+    ID             uint      `json:"id" gorm:"primaryKey"`
+    Name           string    `json:"name" gorm:"not null"`
+    Type           string    `json:"type" gorm:"not null"` // 中间件类型：Redis, MySQL, RabbitMQ 等
+    Version        string    `json:"version"`
+    Status         string    `json:"status"` // 由健康检查维护：up, degraded, down, unknown
+    Host           string    `json:"host" gorm:"not null"`
+    Port           string    `json:"port" gorm:"not null"`
+    Credentials    string    `json:"credentials,omitempty"`
+    // 按类型不同的连接选项，如基于 HTTP 的中间件：{"scheme": "https", "insecure_skip_verify": true}
+    Options        json.RawMessage `json:"options,omitempty" gorm:"type:jsonb"`
+    ScrapeInterval int       `json:"scrape_interval"` // 指标采集间隔（秒），0 使用按类型或全局的默认值
+    ScrapeTimeout  int       `json:"scrape_timeout"`  // 单次采集超时（秒），0 使用默认值
+    ParentID       *uint     `json:"parent_id" gorm:"index"` // 自动发现的成员（如 Redis Cluster 节点）所属的实例
+    Role           string    `json:"role"`                   // 成员角色，由自动发现维护：master, replica, sentinel 等
+    // 运行该实例的主机及启停方式，用于启动、停止、重启和重载操作
+    HostID         *uint              `json:"host_id" gorm:"index"`
+    Control        *MiddlewareControl `json:"control,omitempty" gorm:"serializer:json"`
+    CreatedAt      time.Time `json:"created_at"`
+    UpdatedAt      time.Time `json:"updated_at"`
+
+    // 最近一次健康检查
+    LastCheckAt   *time.Time `json:"last_check_at"`
+    Latency       float64    `json:"latency"` // 毫秒
+    HealthMessage string     `json:"health_message"`
+}
+
+// 启停方式
+const (
+    ControlSystemd    = "systemd"    // systemctl 管理的 unit
+    ControlDocker     = "docker"     // docker 容器
+    ControlSupervisor = "supervisor" // supervisorctl 管理的程序
+    ControlScript     = "script"     // 按操作配置的自定义命令
+)
+
+// MiddlewareControl 中间件在主机上的启停方式
+type MiddlewareControl struct {
+    Method string `json:"method"` // systemd, docker, supervisor, script
+    Target string `json:"target"` // systemd unit、容器名或 supervisor 程序名，script 方式不使用
+    // script 方式下各操作执行的命令，如 {"start": "/opt/app/bin/start.sh"}
+    Scripts map[string]string `json:"scripts,omitempty"`
+    Sudo    bool              `json:"sudo"` // 通过 sudo -n 执行
+    // 操作后等待健康检查结果的时间（秒），0 使用默认值
+    VerifyTimeout int `json:"verify_timeout"`
+}
+
+// 中间件健康状态
+const (
+    StatusUp       = "up"
+    StatusDegraded = "degraded"
+    StatusDown     = "down"
+    StatusUnknown  = "unknown"
+)
+
+// MiddlewareStatusChange 健康状态变化记录，用于计算可用率
+type MiddlewareStatusChange struct {
+    ID           uint      `json:"id" gorm:"primaryKey"`
+    MiddlewareID uint      `json:"middleware_id" gorm:"not null;index:idx_status_change_mw_time,priority:1"`
+    From         string    `json:"from"`
+    To           string    `json:"to"`
+    Message      string    `json:"message"`
+    CreatedAt    time.Time `json:"created_at" gorm:"index:idx_status_change_mw_time,priority:2"`
 } 
\ No newline at end of file
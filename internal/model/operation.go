@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// 运维操作
+const (
+	ActionStart   = "start"
+	ActionStop    = "stop"
+	ActionRestart = "restart"
+	ActionReload  = "reload"
+)
+
+// MiddlewareOperation 中间件启停操作的审计记录
+type MiddlewareOperation struct {
+	ID           uint   `json:"id" gorm:"primaryKey"`
+	MiddlewareID uint   `json:"middleware_id" gorm:"not null;index"`
+	HostID       uint   `json:"host_id"`
+	Action       string `json:"action"` // start, stop, restart, reload
+	Method       string `json:"method"` // systemd, docker, supervisor, script
+	Command      string `json:"command"`
+	Operator     string `json:"operator"` // 发起请求的客户端地址
+	Status       string `json:"status"`   // running, success, failed, interrupted
+	// 操作前检查的输出，如 unit 或容器的当前状态
+	PreCheck string `json:"pre_check"`
+	Output   string `json:"output"`
+	Error    string `json:"error"`
+	// 操作后健康检查得到的状态：up, down, unknown
+	HealthStatus  string     `json:"health_status"`
+	HealthMessage string     `json:"health_message"`
+	StartedAt     time.Time  `json:"started_at" gorm:"index"`
+	FinishedAt    *time.Time `json:"finished_at"`
+}
@@ -0,0 +1,62 @@
+package model
+
+import "time"
+
+// RedisSlowLog 采集时从 SLOWLOG GET 保存的慢查询
+type RedisSlowLog struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	MiddlewareID uint      `json:"middleware_id" gorm:"not null;uniqueIndex:idx_redis_slowlog_entry,priority:1"`
+	EntryID      int64     `json:"entry_id" gorm:"not null;uniqueIndex:idx_redis_slowlog_entry,priority:2"` // Redis 分配的慢查询ID
+	ExecutedAt   time.Time `json:"executed_at" gorm:"index"`
+	Duration     int64     `json:"duration"` // 微秒
+	Command      string    `json:"command"`
+	ClientAddr   string    `json:"client_addr"`
+	ClientName   string    `json:"client_name"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// RedisTopology Redis Cluster 或 Sentinel 最近一次发现的拓扑概况
+type RedisTopology struct {
+	MiddlewareID  uint      `json:"middleware_id" gorm:"primaryKey;autoIncrement:false"`
+	Mode          string    `json:"mode"`  // cluster, sentinel
+	State         string    `json:"state"` // Cluster 为 cluster_state；Sentinel 有客观下线的主节点时为 fail
+	SlotsAssigned int       `json:"slots_assigned"`
+	SlotsOK       int       `json:"slots_ok"`
+	SlotsPfail    int       `json:"slots_pfail"`
+	SlotsFail     int       `json:"slots_fail"`
+	Masters       int       `json:"masters"`
+	Replicas      int       `json:"replicas"`
+	KnownNodes    int       `json:"known_nodes"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	Nodes []RedisNode `json:"nodes" gorm:"-"`
+}
+
+// RedisNode 拓扑中的一个数据节点
+type RedisNode struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	ParentID     uint      `json:"parent_id" gorm:"not null;index"` // 集群或 Sentinel 实例
+	MiddlewareID uint      `json:"middleware_id"`                   // 节点对应的中间件，通常是自动创建的子实例
+	NodeID       string    `json:"node_id"`                         // Cluster 节点ID，Sentinel 为 run_id
+	Host         string    `json:"host"`
+	Port         string    `json:"port"`
+	Role         string    `json:"role"` // master, replica
+	MasterNodeID string    `json:"master_node_id"`
+	MasterAddr   string    `json:"master_addr"` // replica 复制的主节点地址
+	MasterName   string    `json:"master_name"` // Sentinel 监控的主节点名称
+	Slots        string    `json:"slots"`       // 如 0-5460,10923
+	SlotCount    int       `json:"slot_count"`
+	Flags        string    `json:"flags"`
+	LinkState    string    `json:"link_state"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// RedisFailoverEvent 发现拓扑时检测到的主从切换
+type RedisFailoverEvent struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	MiddlewareID uint      `json:"middleware_id" gorm:"not null;index"` // 集群或 Sentinel 实例
+	MasterName   string    `json:"master_name"`                         // Sentinel 主节点名称，Cluster 为新主节点负责的槽位
+	OldMaster    string    `json:"old_master"`
+	NewMaster    string    `json:"new_master"`
+	CreatedAt    time.Time `json:"created_at" gorm:"index"`
+}
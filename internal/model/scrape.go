@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// ScrapeStatus 中间件最近一次指标采集的结果
+type ScrapeStatus struct {
+	MiddlewareID        uint       `json:"middleware_id" gorm:"primaryKey;autoIncrement:false"`
+	Health              string     `json:"health"` // ok, error, timeout
+	LastScrapeAt        *time.Time `json:"last_scrape_at"`
+	LastSuccessAt       *time.Time `json:"last_success_at"`
+	LastError           string     `json:"last_error"`
+	LastDuration        float64    `json:"last_duration"` // 秒
+	Samples             int        `json:"samples"`       // 最近一次采集到的样本数
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Skipped             int64      `json:"skipped"` // 因上一次采集未结束而跳过的次数
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,298 @@
+// Package mongowire MongoDB 线协议的最小实现：BSON 编解码、OP_MSG 命令和 SCRAM-SHA-256 认证，
+// 只用于执行 serverStatus、replSetGetStatus 等监控命令
+package mongowire
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// D 有序的 BSON 文档，命令名必须是第一个字段
+type D []E
+
+// E 文档中的一个字段
+type E struct {
+	Key   string
+	Value interface{}
+}
+
+// Timestamp BSON 内部时间戳，用于复制的 optime
+type Timestamp struct {
+	T uint32
+	I uint32
+}
+
+// ObjectID BSON ObjectId
+type ObjectID [12]byte
+
+// Binary BSON 二进制数据
+type Binary struct {
+	Subtype byte
+	Data    []byte
+}
+
+var errShortDocument = errors.New("bson: document is truncated")
+
+// Lookup 按路径查找字段，如 Lookup("wiredTiger", "cache", "bytes currently in the cache")
+func (d D) Lookup(path ...string) interface{} {
+	var cur interface{} = d
+	for _, key := range path {
+		doc, ok := cur.(D)
+		if !ok {
+			return nil
+		}
+		cur = nil
+		for _, e := range doc {
+			if e.Key == key {
+				cur = e.Value
+				break
+			}
+		}
+	}
+	return cur
+}
+
+// Number 按路径取数值字段，兼容 int32、int64 和 double
+func (d D) Number(path ...string) (float64, bool) {
+	return Number(d.Lookup(path...))
+}
+
+// Number 将 BSON 数值转换为 float64
+func Number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// Marshal 编码文档，值支持 string、bool、int、int32、int64、float64、D、[]interface{}、[]byte、Binary 和 nil
+func Marshal(d D) ([]byte, error) {
+	return appendDocument(nil, d)
+}
+
+func appendDocument(dst []byte, d D) ([]byte, error) {
+	start := len(dst)
+	dst = append(dst, 0, 0, 0, 0)
+	for _, e := range d {
+		var err error
+		if dst, err = appendElement(dst, e.Key, e.Value); err != nil {
+			return nil, err
+		}
+	}
+	dst = append(dst, 0)
+	binary.LittleEndian.PutUint32(dst[start:], uint32(len(dst)-start))
+	return dst, nil
+}
+
+func appendElement(dst []byte, key string, value interface{}) ([]byte, error) {
+	header := func(kind byte) {
+		dst = append(dst, kind)
+		dst = append(dst, key...)
+		dst = append(dst, 0)
+	}
+	switch v := value.(type) {
+	case float64:
+		header(0x01)
+		dst = binary.LittleEndian.AppendUint64(dst, math.Float64bits(v))
+	case string:
+		header(0x02)
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(len(v)+1))
+		dst = append(dst, v...)
+		dst = append(dst, 0)
+	case D:
+		header(0x03)
+		return appendDocument(dst, v)
+	case []interface{}:
+		header(0x04)
+		arr := make(D, len(v))
+		for i, item := range v {
+			arr[i] = E{Key: fmt.Sprint(i), Value: item}
+		}
+		return appendDocument(dst, arr)
+	case []byte:
+		return appendElement(dst, key, Binary{Data: v})
+	case Binary:
+		header(0x05)
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(len(v.Data)))
+		dst = append(dst, v.Subtype)
+		dst = append(dst, v.Data...)
+	case bool:
+		header(0x08)
+		if v {
+			dst = append(dst, 1)
+		} else {
+			dst = append(dst, 0)
+		}
+	case nil:
+		header(0x0A)
+	case int32:
+		header(0x10)
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(v))
+	case int:
+		if v >= math.MinInt32 && v <= math.MaxInt32 {
+			return appendElement(dst, key, int32(v))
+		}
+		return appendElement(dst, key, int64(v))
+	case int64:
+		header(0x12)
+		dst = binary.LittleEndian.AppendUint64(dst, uint64(v))
+	default:
+		return nil, fmt.Errorf("bson: unsupported type %T for field %q", value, key)
+	}
+	return dst, nil
+}
+
+// Unmarshal 解码一个文档，不支持的类型（如 JavaScript 代码）返回错误
+func Unmarshal(b []byte) (D, error) {
+	d, n, err := readDocument(b)
+	if err != nil {
+		return nil, err
+	}
+	if n != len(b) {
+		return nil, fmt.Errorf("bson: %d trailing bytes after document", len(b)-n)
+	}
+	return d, nil
+}
+
+// readDocument 解码b开头的文档，返回文档和占用的字节数
+func readDocument(b []byte) (D, int, error) {
+	if len(b) < 5 {
+		return nil, 0, errShortDocument
+	}
+	size := int(binary.LittleEndian.Uint32(b))
+	if size < 5 || size > len(b) || b[size-1] != 0 {
+		return nil, 0, errShortDocument
+	}
+	body := b[4 : size-1]
+	d := D{}
+	for len(body) > 0 {
+		kind := body[0]
+		end := indexZero(body[1:])
+		if end < 0 {
+			return nil, 0, errShortDocument
+		}
+		key := string(body[1 : 1+end])
+		body = body[2+end:]
+
+		value, n, err := readValue(kind, body)
+		if err != nil {
+			return nil, 0, fmt.Errorf("bson: field %q: %v", key, err)
+		}
+		body = body[n:]
+		d = append(d, E{Key: key, Value: value})
+	}
+	return d, size, nil
+}
+
+func readValue(kind byte, b []byte) (interface{}, int, error) {
+	need := func(n int) error {
+		if len(b) < n {
+			return errShortDocument
+		}
+		return nil
+	}
+	switch kind {
+	case 0x01: // double
+		if err := need(8); err != nil {
+			return nil, 0, err
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), 8, nil
+	case 0x02, 0x0D, 0x0E: // string, JavaScript code, symbol
+		if err := need(4); err != nil {
+			return nil, 0, err
+		}
+		n := int(binary.LittleEndian.Uint32(b))
+		if n < 1 || len(b) < 4+n {
+			return nil, 0, errShortDocument
+		}
+		return string(b[4 : 4+n-1]), 4 + n, nil
+	case 0x03: // document
+		return readDocument(b)
+	case 0x04: // array
+		doc, n, err := readDocument(b)
+		if err != nil {
+			return nil, 0, err
+		}
+		arr := make([]interface{}, len(doc))
+		for i, e := range doc {
+			arr[i] = e.Value
+		}
+		return arr, n, nil
+	case 0x05: // binary
+		if err := need(5); err != nil {
+			return nil, 0, err
+		}
+		n := int(binary.LittleEndian.Uint32(b))
+		if n < 0 || len(b) < 5+n {
+			return nil, 0, errShortDocument
+		}
+		return Binary{Subtype: b[4], Data: append([]byte(nil), b[5:5+n]...)}, 5 + n, nil
+	case 0x06, 0x0A, 0x7F, 0xFF: // undefined, null, max key, min key
+		return nil, 0, nil
+	case 0x07: // ObjectId
+		if err := need(12); err != nil {
+			return nil, 0, err
+		}
+		var id ObjectID
+		copy(id[:], b)
+		return id, 12, nil
+	case 0x08: // bool
+		if err := need(1); err != nil {
+			return nil, 0, err
+		}
+		return b[0] == 1, 1, nil
+	case 0x09: // UTC datetime
+		if err := need(8); err != nil {
+			return nil, 0, err
+		}
+		return time.UnixMilli(int64(binary.LittleEndian.Uint64(b))).UTC(), 8, nil
+	case 0x0B: // regex：两个以0结尾的字符串
+		first := indexZero(b)
+		if first < 0 {
+			return nil, 0, errShortDocument
+		}
+		second := indexZero(b[first+1:])
+		if second < 0 {
+			return nil, 0, errShortDocument
+		}
+		return string(b[:first]), first + second + 2, nil
+	case 0x10: // int32
+		if err := need(4); err != nil {
+			return nil, 0, err
+		}
+		return int32(binary.LittleEndian.Uint32(b)), 4, nil
+	case 0x11: // timestamp
+		if err := need(8); err != nil {
+			return nil, 0, err
+		}
+		return Timestamp{I: binary.LittleEndian.Uint32(b), T: binary.LittleEndian.Uint32(b[4:])}, 8, nil
+	case 0x12: // int64
+		if err := need(8); err != nil {
+			return nil, 0, err
+		}
+		return int64(binary.LittleEndian.Uint64(b)), 8, nil
+	case 0x13: // decimal128，监控命令中很少出现，保留原始字节
+		if err := need(16); err != nil {
+			return nil, 0, err
+		}
+		return Binary{Data: append([]byte(nil), b[:16]...)}, 16, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported type 0x%02x", kind)
+}
+
+func indexZero(b []byte) int {
+	for i, c := range b {
+		if c == 0 {
+			return i
+		}
+	}
+	return -1
+}
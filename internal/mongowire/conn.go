@@ -0,0 +1,182 @@
+package mongowire
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	opMsg = 2013
+	// 响应大小上限，与服务端的 maxMessageSizeBytes 默认值一致
+	maxMessageSize = 48 << 20
+	// OP_MSG flagBits 中表示消息末尾带 CRC-32C 校验和
+	flagChecksumPresent = 1
+)
+
+var ErrConnBroken = errors.New("mongodb connection is broken")
+
+// CommandError 命令执行失败（ok: 0）
+type CommandError struct {
+	Code    int32
+	Name    string
+	Message string
+}
+
+func (e *CommandError) Error() string {
+	if e.Name != "" {
+		return fmt.Sprintf("mongodb command failed: %s (%s, code %d)", e.Message, e.Name, e.Code)
+	}
+	return fmt.Sprintf("mongodb command failed: %s (code %d)", e.Message, e.Code)
+}
+
+// IsCode 判断err是否为指定错误码的命令错误
+func IsCode(err error, code int32) bool {
+	var cmdErr *CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Code == code
+}
+
+// Conn 一个到 mongod/mongos 的连接，命令串行执行。需要 MongoDB 3.6 及以上（OP_MSG）
+type Conn struct {
+	mu        sync.Mutex
+	conn      net.Conn
+	requestID int32
+	broken    bool
+}
+
+// Dial 建立连接，tlsConfig不为nil时使用 TLS
+func Dial(ctx context.Context, addr string, tlsConfig *tls.Config) (*Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		tlsConn := tls.Client(conn, tlsConfig)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	return &Conn{conn: conn}, nil
+}
+
+// Broken 连接读写出错后不再可用，需要重新建立
+func (c *Conn) Broken() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.broken
+}
+
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// RunCommand 在数据库db上执行命令，ok不为1时返回 *CommandError。
+// 读写出错后连接不再可用，之后的调用都返回 ErrConnBroken
+func (c *Conn) RunCommand(ctx context.Context, db string, cmd D) (D, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.broken {
+		return nil, ErrConnBroken
+	}
+
+	body := append(D{}, cmd...)
+	body = append(body, E{Key: "$db", Value: db})
+	doc, err := Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	// 没有截止时间时清除上一次命令设置的截止时间
+	deadline, _ := ctx.Deadline()
+	c.conn.SetDeadline(deadline)
+	// ctx 取消时中断阻塞的读写
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			c.conn.SetDeadline(time.Unix(1, 0))
+		case <-stop:
+		}
+	}()
+
+	c.requestID++
+	reply, err := c.roundTrip(c.requestID, doc)
+	if err != nil {
+		c.broken = true
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	if okValue, _ := reply.Number("ok"); okValue != 1 {
+		cmdErr := &CommandError{}
+		if code, ok := reply.Number("code"); ok {
+			cmdErr.Code = int32(code)
+		}
+		cmdErr.Name, _ = reply.Lookup("codeName").(string)
+		cmdErr.Message, _ = reply.Lookup("errmsg").(string)
+		return reply, cmdErr
+	}
+	return reply, nil
+}
+
+// roundTrip 发送只有一个 body 段的 OP_MSG 并读取响应的 body 文档
+func (c *Conn) roundTrip(requestID int32, doc []byte) (D, error) {
+	msg := make([]byte, 0, 21+len(doc))
+	msg = binary.LittleEndian.AppendUint32(msg, uint32(21+len(doc)))
+	msg = binary.LittleEndian.AppendUint32(msg, uint32(requestID))
+	msg = binary.LittleEndian.AppendUint32(msg, 0)
+	msg = binary.LittleEndian.AppendUint32(msg, opMsg)
+	msg = binary.LittleEndian.AppendUint32(msg, 0)
+	msg = append(msg, 0)
+	msg = append(msg, doc...)
+	if _, err := c.conn.Write(msg); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(c.conn, header); err != nil {
+		return nil, err
+	}
+	size := int(binary.LittleEndian.Uint32(header))
+	responseTo := int32(binary.LittleEndian.Uint32(header[8:]))
+	opCode := binary.LittleEndian.Uint32(header[12:])
+	if size < 21 || size > maxMessageSize {
+		return nil, fmt.Errorf("invalid mongodb message size %d", size)
+	}
+	payload := make([]byte, size-16)
+	if _, err := io.ReadFull(c.conn, payload); err != nil {
+		return nil, err
+	}
+	if opCode != opMsg {
+		return nil, fmt.Errorf("unexpected mongodb reply opcode %d", opCode)
+	}
+	if responseTo != requestID {
+		return nil, fmt.Errorf("mongodb reply to request %d, expected %d", responseTo, requestID)
+	}
+
+	flags := binary.LittleEndian.Uint32(payload)
+	payload = payload[4:]
+	if flags&flagChecksumPresent != 0 {
+		if len(payload) < 4 {
+			return nil, errShortDocument
+		}
+		payload = payload[:len(payload)-4]
+	}
+	// 监控命令的响应只有 body 段（kind 0）
+	if len(payload) == 0 || payload[0] != 0 {
+		return nil, errors.New("mongodb reply has no body section")
+	}
+	reply, _, err := readDocument(payload[1:])
+	return reply, err
+}
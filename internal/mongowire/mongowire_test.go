@@ -0,0 +1,141 @@
+package mongowire
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalRoundTrip(t *testing.T) {
+	doc := D{
+		{Key: "serverStatus", Value: 1},
+		{Key: "name", Value: "mongo"},
+		{Key: "ratio", Value: 0.5},
+		{Key: "big", Value: int64(1) << 40},
+		{Key: "flag", Value: true},
+		{Key: "none", Value: nil},
+		{Key: "nested", Value: D{{Key: "list", Value: []interface{}{"a", int32(2)}}}},
+		{Key: "payload", Value: []byte("n,,n=user")},
+	}
+	data, err := Marshal(doc)
+	assert.NoError(t, err)
+
+	decoded, err := Unmarshal(data)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1), decoded.Lookup("serverStatus"))
+	assert.Equal(t, "mongo", decoded.Lookup("name"))
+	assert.Equal(t, int64(1)<<40, decoded.Lookup("big"))
+	assert.Equal(t, true, decoded.Lookup("flag"))
+	assert.Nil(t, decoded.Lookup("none"))
+	assert.Equal(t, []interface{}{"a", int32(2)}, decoded.Lookup("nested", "list"))
+	assert.Equal(t, Binary{Data: []byte("n,,n=user")}, decoded.Lookup("payload"))
+
+	v, ok := decoded.Number("ratio")
+	assert.True(t, ok)
+	assert.Equal(t, 0.5, v)
+	_, ok = decoded.Number("name")
+	assert.False(t, ok)
+	assert.Nil(t, decoded.Lookup("nested", "missing"))
+
+	_, err = Unmarshal(data[:len(data)-3])
+	assert.Error(t, err)
+	_, err = Marshal(D{{Key: "bad", Value: struct{}{}}})
+	assert.Error(t, err)
+}
+
+func TestUnmarshalTypes(t *testing.T) {
+	// {t: Timestamp(5, 7), d: Date(1000), id: ObjectId}
+	var body []byte
+	body = append(body, 0x11, 't', 0)
+	body = binary.LittleEndian.AppendUint32(body, 7)
+	body = binary.LittleEndian.AppendUint32(body, 5)
+	body = append(body, 0x09, 'd', 0)
+	body = binary.LittleEndian.AppendUint64(body, 1000)
+	body = append(body, 0x07, 'i', 'd', 0)
+	body = append(body, make([]byte, 12)...)
+	doc := binary.LittleEndian.AppendUint32(nil, uint32(len(body)+5))
+	doc = append(append(doc, body...), 0)
+
+	decoded, err := Unmarshal(doc)
+	assert.NoError(t, err)
+	assert.Equal(t, Timestamp{T: 5, I: 7}, decoded.Lookup("t"))
+	assert.Equal(t, time.UnixMilli(1000).UTC(), decoded.Lookup("d"))
+	assert.Equal(t, ObjectID{}, decoded.Lookup("id"))
+}
+
+// RFC 7677 中的示例
+func TestScramConversation(t *testing.T) {
+	conv := newScramConversation("user", "pencil", "rOprNGfwEbeRWgbNEkqO")
+	assert.Equal(t, "n,,n=user,r=rOprNGfwEbeRWgbNEkqO", conv.clientFirst())
+
+	final, err := conv.clientFinal("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	assert.NoError(t, err)
+	assert.Equal(t, "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=", final)
+	assert.NoError(t, conv.verifyServerFinal("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="))
+	assert.Error(t, conv.verifyServerFinal("v=AAAA"))
+	assert.EqualError(t, conv.verifyServerFinal("e=invalid-proof"), "invalid-proof")
+
+	// 服务端 nonce 必须以客户端 nonce 开头
+	_, err = conv.clientFinal("r=other,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	assert.Error(t, err)
+}
+
+// serve 读取一个 OP_MSG 请求，用reply回复
+func serve(t *testing.T, conn net.Conn, reply D) D {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Fatal(err)
+	}
+	payload := make([]byte, binary.LittleEndian.Uint32(header)-16)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		t.Fatal(err)
+	}
+	request, err := Unmarshal(payload[5:])
+	assert.NoError(t, err)
+
+	doc, _ := Marshal(reply)
+	msg := binary.LittleEndian.AppendUint32(nil, uint32(21+len(doc)))
+	msg = binary.LittleEndian.AppendUint32(msg, 99)
+	msg = append(msg, header[4:8]...)
+	msg = binary.LittleEndian.AppendUint32(msg, opMsg)
+	msg = binary.LittleEndian.AppendUint32(msg, 0)
+	msg = append(msg, 0)
+	conn.Write(append(msg, doc...))
+	return request
+}
+
+func TestRunCommand(t *testing.T) {
+	client, server := net.Pipe()
+	c := &Conn{conn: client}
+	defer c.Close()
+
+	go func() {
+		request := serve(t, server, D{{Key: "ok", Value: 1.0}, {Key: "connections", Value: D{{Key: "current", Value: int32(3)}}}})
+		assert.Equal(t, "admin", request.Lookup("$db"))
+		serve(t, server, D{{Key: "ok", Value: 0.0}, {Key: "errmsg", Value: "not running with --replSet"},
+			{Key: "code", Value: int32(76)}, {Key: "codeName", Value: "NoReplicationEnabled"}})
+		server.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	reply, err := c.RunCommand(ctx, "admin", D{{Key: "serverStatus", Value: 1}})
+	assert.NoError(t, err)
+	current, _ := reply.Number("connections", "current")
+	assert.Equal(t, 3.0, current)
+
+	_, err = c.RunCommand(ctx, "admin", D{{Key: "replSetGetStatus", Value: 1}})
+	assert.True(t, IsCode(err, 76))
+	assert.Contains(t, err.Error(), "NoReplicationEnabled")
+
+	// 连接断开后不再可用
+	_, err = c.RunCommand(ctx, "admin", D{{Key: "ping", Value: 1}})
+	assert.Error(t, err)
+	_, err = c.RunCommand(ctx, "admin", D{{Key: "ping", Value: 1}})
+	assert.ErrorIs(t, err, ErrConnBroken)
+}
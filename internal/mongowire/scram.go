@@ -0,0 +1,165 @@
+package mongowire
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	scramMechanism = "SCRAM-SHA-256"
+	// 服务端要求的最小迭代次数
+	minScramIterations = 4096
+)
+
+// Auth 使用 SCRAM-SHA-256 认证（MongoDB 4.0 及以上的默认机制）。
+// 密码不做 SASLprep 规范化，只包含 ASCII 字符的密码不受影响
+func (c *Conn) Auth(ctx context.Context, source, username, password string) error {
+	nonce := make([]byte, 24)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	conv := newScramConversation(username, password, base64.StdEncoding.EncodeToString(nonce))
+
+	reply, err := c.RunCommand(ctx, source, D{
+		{Key: "saslStart", Value: 1},
+		{Key: "mechanism", Value: scramMechanism},
+		{Key: "payload", Value: []byte(conv.clientFirst())},
+		{Key: "autoAuthorize", Value: 1},
+		{Key: "options", Value: D{{Key: "skipEmptyExchange", Value: true}}},
+	})
+	if err != nil {
+		return fmt.Errorf("authentication failed: %v", err)
+	}
+
+	clientFinal, err := conv.clientFinal(payloadOf(reply))
+	if err != nil {
+		return fmt.Errorf("authentication failed: %v", err)
+	}
+	conversationID := reply.Lookup("conversationId")
+	reply, err = c.RunCommand(ctx, source, D{
+		{Key: "saslContinue", Value: 1},
+		{Key: "conversationId", Value: conversationID},
+		{Key: "payload", Value: []byte(clientFinal)},
+	})
+	if err != nil {
+		return fmt.Errorf("authentication failed: %v", err)
+	}
+	if err := conv.verifyServerFinal(payloadOf(reply)); err != nil {
+		return fmt.Errorf("authentication failed: %v", err)
+	}
+
+	// 不支持 skipEmptyExchange 的旧版本需要再发送一次空消息
+	for done, _ := reply.Lookup("done").(bool); !done; done, _ = reply.Lookup("done").(bool) {
+		reply, err = c.RunCommand(ctx, source, D{
+			{Key: "saslContinue", Value: 1},
+			{Key: "conversationId", Value: conversationID},
+			{Key: "payload", Value: []byte{}},
+		})
+		if err != nil {
+			return fmt.Errorf("authentication failed: %v", err)
+		}
+	}
+	return nil
+}
+
+func payloadOf(reply D) string {
+	if b, ok := reply.Lookup("payload").(Binary); ok {
+		return string(b.Data)
+	}
+	return ""
+}
+
+// scramConversation RFC 5802 / RFC 7677 客户端的计算过程
+type scramConversation struct {
+	username    string
+	password    string
+	nonce       string
+	authMessage string
+	serverKey   []byte
+}
+
+func newScramConversation(username, password, nonce string) *scramConversation {
+	return &scramConversation{username: username, password: password, nonce: nonce}
+}
+
+func (s *scramConversation) clientFirstBare() string {
+	name := strings.NewReplacer("=", "=3D", ",", "=2C").Replace(s.username)
+	return "n=" + name + ",r=" + s.nonce
+}
+
+func (s *scramConversation) clientFirst() string {
+	return "n,," + s.clientFirstBare()
+}
+
+// clientFinal 根据 server-first-message 计算带证明的 client-final-message
+func (s *scramConversation) clientFinal(serverFirst string) (string, error) {
+	fields := parseScramFields(serverFirst)
+	serverNonce := fields["r"]
+	if !strings.HasPrefix(serverNonce, s.nonce) || len(serverNonce) == len(s.nonce) {
+		return "", errors.New("invalid server nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(fields["s"])
+	if err != nil {
+		return "", fmt.Errorf("invalid salt: %v", err)
+	}
+	iterations, err := strconv.Atoi(fields["i"])
+	if err != nil || iterations < minScramIterations {
+		return "", fmt.Errorf("invalid iteration count %q", fields["i"])
+	}
+
+	salted := pbkdf2.Key([]byte(s.password), salt, iterations, sha256.Size, sha256.New)
+	clientKey := hmacSHA256(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	s.serverKey = hmacSHA256(salted, "Server Key")
+
+	withoutProof := "c=biws,r=" + serverNonce
+	s.authMessage = s.clientFirstBare() + "," + serverFirst + "," + withoutProof
+	signature := hmacSHA256(storedKey[:], s.authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ signature[i]
+	}
+	return withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+// verifyServerFinal 校验服务端签名，确认对端知道密码
+func (s *scramConversation) verifyServerFinal(serverFinal string) error {
+	fields := parseScramFields(serverFinal)
+	if e, ok := fields["e"]; ok {
+		return errors.New(e)
+	}
+	signature, err := base64.StdEncoding.DecodeString(fields["v"])
+	if err != nil {
+		return fmt.Errorf("invalid server signature: %v", err)
+	}
+	if !bytes.Equal(signature, hmacSHA256(s.serverKey, s.authMessage)) {
+		return errors.New("server signature mismatch")
+	}
+	return nil
+}
+
+func parseScramFields(msg string) map[string]string {
+	fields := make(map[string]string)
+	for _, part := range strings.Split(msg, ",") {
+		if len(part) >= 2 && part[1] == '=' {
+			fields[part[:1]] = part[2:]
+		}
+	}
+	return fields
+}
+
+func hmacSHA256(key []byte, msg string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
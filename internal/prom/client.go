@@ -0,0 +1,187 @@
+package prom
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client 外部 Prometheus 的 HTTP 查询接口客户端
+type Client struct {
+	baseURL string
+	http    *http.Client
+}
+
+func NewClient(baseURL string, timeout time.Duration) *Client {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &Client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		http:    &http.Client{Timeout: timeout},
+	}
+}
+
+// Point 一个取值
+type Point struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// Series 查询结果中的一条序列，即时查询只有一个点
+type Series struct {
+	Metric map[string]string `json:"metric"`
+	Points []Point           `json:"points"`
+}
+
+// Query 即时查询，结果为 vector 或 scalar
+func (c *Client) Query(ctx context.Context, expr string, at time.Time) ([]Series, error) {
+	params := url.Values{}
+	params.Set("query", expr)
+	if !at.IsZero() {
+		params.Set("time", formatTime(at))
+	}
+	return c.do(ctx, "/api/v1/query", params)
+}
+
+// QueryRange 区间查询，结果为 matrix
+func (c *Client) QueryRange(ctx context.Context, expr string, start, end time.Time, step time.Duration) ([]Series, error) {
+	params := url.Values{}
+	params.Set("query", expr)
+	params.Set("start", formatTime(start))
+	params.Set("end", formatTime(end))
+	params.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+	return c.do(ctx, "/api/v1/query_range", params)
+}
+
+type apiResponse struct {
+	Status    string `json:"status"`
+	ErrorType string `json:"errorType"`
+	Error     string `json:"error"`
+	Data      struct {
+		ResultType string          `json:"resultType"`
+		Result     json.RawMessage `json:"result"`
+	} `json:"data"`
+}
+
+func (c *Client) do(ctx context.Context, path string, params url.Values) ([]Series, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxDecodedSize))
+	if err != nil {
+		return nil, err
+	}
+	var result apiResponse
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("prometheus returned %s: %s", resp.Status, truncate(string(body), 200))
+	}
+	if result.Status != "success" {
+		return nil, fmt.Errorf("prometheus query failed (%s): %s", result.ErrorType, result.Error)
+	}
+	return parseResult(result.Data.ResultType, result.Data.Result)
+}
+
+func parseResult(resultType string, raw json.RawMessage) ([]Series, error) {
+	switch resultType {
+	case "vector":
+		var vector []struct {
+			Metric map[string]string `json:"metric"`
+			Value  []interface{}     `json:"value"`
+		}
+		if err := json.Unmarshal(raw, &vector); err != nil {
+			return nil, err
+		}
+		series := make([]Series, 0, len(vector))
+		for _, v := range vector {
+			point, err := parsePoint(v.Value)
+			if err != nil {
+				return nil, err
+			}
+			series = append(series, Series{Metric: v.Metric, Points: []Point{point}})
+		}
+		return series, nil
+	case "matrix":
+		var matrix []struct {
+			Metric map[string]string `json:"metric"`
+			Values [][]interface{}   `json:"values"`
+		}
+		if err := json.Unmarshal(raw, &matrix); err != nil {
+			return nil, err
+		}
+		series := make([]Series, 0, len(matrix))
+		for _, m := range matrix {
+			s := Series{Metric: m.Metric, Points: make([]Point, 0, len(m.Values))}
+			for _, v := range m.Values {
+				point, err := parsePoint(v)
+				if err != nil {
+					return nil, err
+				}
+				s.Points = append(s.Points, point)
+			}
+			series = append(series, s)
+		}
+		return series, nil
+	case "scalar":
+		var value []interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, err
+		}
+		point, err := parsePoint(value)
+		if err != nil {
+			return nil, err
+		}
+		return []Series{{Metric: map[string]string{}, Points: []Point{point}}}, nil
+	}
+	return nil, fmt.Errorf("unsupported result type %q", resultType)
+}
+
+// parsePoint 解析 [<unix秒>, "<值>"]
+func parsePoint(v []interface{}) (Point, error) {
+	if len(v) != 2 {
+		return Point{}, fmt.Errorf("invalid sample %v", v)
+	}
+	ts, ok := v[0].(float64)
+	if !ok {
+		return Point{}, fmt.Errorf("invalid sample timestamp %v", v[0])
+	}
+	s, ok := v[1].(string)
+	if !ok {
+		return Point{}, fmt.Errorf("invalid sample value %v", v[1])
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return Point{}, err
+	}
+	sec := int64(ts)
+	return Point{
+		Timestamp: time.Unix(sec, int64((ts-float64(sec))*1e9)).Round(time.Millisecond),
+		Value:     value,
+	}, nil
+}
+
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano())/1e9, 'f', 3, 64)
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n] + "..."
+	}
+	return s
+}
@@ -0,0 +1,155 @@
+package prom
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func TestDecodeSnappy(t *testing.T) {
+	// 1个字面量 'a' + 2字节偏移复制19字节（与输出重叠）
+	block := []byte{20, 0x00, 'a', (19-1)<<2 | 0x02, 0x01, 0x00}
+	out, err := DecodeSnappy(block)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("a", 20), string(out))
+
+	// 1字节偏移复制：literal "abcd" + copy len 4 offset 4
+	block = []byte{8, (4-1)<<2 | 0x00, 'a', 'b', 'c', 'd', 0x01, 4}
+	out, err = DecodeSnappy(block)
+	assert.NoError(t, err)
+	assert.Equal(t, "abcdabcd", string(out))
+
+	// 长字面量（长度用1个额外字节表示）
+	long := strings.Repeat("x", 100)
+	block = append(binary.AppendUvarint(nil, 100), 60<<2, 99)
+	block = append(block, long...)
+	out, err = DecodeSnappy(block)
+	assert.NoError(t, err)
+	assert.Equal(t, long, string(out))
+
+	for _, corrupt := range [][]byte{
+		{},
+		{5, 0x00, 'a'},               // 长度不符
+		{4, 0x01, 0x05},              // 偏移超出已输出内容
+		{4, (10 - 1) << 2, 'a', 'b'}, // 字面量被截断
+	} {
+		_, err := DecodeSnappy(corrupt)
+		assert.Error(t, err)
+	}
+}
+
+func appendMessage(b []byte, num protowire.Number, msg []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, msg)
+}
+
+func encodeSeries(labels []Label, samples []Sample) []byte {
+	var ts []byte
+	for _, l := range labels {
+		var lb []byte
+		lb = appendMessage(lb, 1, []byte(l.Name))
+		lb = appendMessage(lb, 2, []byte(l.Value))
+		ts = appendMessage(ts, 1, lb)
+	}
+	for _, s := range samples {
+		var sb []byte
+		sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+		sb = protowire.AppendFixed64(sb, math.Float64bits(s.Value))
+		sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+		sb = protowire.AppendVarint(sb, uint64(s.Timestamp))
+		ts = appendMessage(ts, 2, sb)
+	}
+	return ts
+}
+
+func TestDecodeWriteRequest(t *testing.T) {
+	var req []byte
+	req = appendMessage(req, 1, encodeSeries(
+		[]Label{{"__name__", "redis_up"}, {"instance", "10.0.0.1:6379"}},
+		[]Sample{{1, 1700000000000}, {0, 1700000015000}},
+	))
+	// metadata（字段3）被忽略
+	req = appendMessage(req, 3, []byte{0x08, 0x01})
+
+	series, err := DecodeWriteRequest(req)
+	assert.NoError(t, err)
+	assert.Len(t, series, 1)
+	assert.Equal(t, "redis_up", series[0].Label("__name__"))
+	assert.Equal(t, "10.0.0.1:6379", series[0].Label("instance"))
+	assert.Equal(t, []Sample{{1, 1700000000000}, {0, 1700000015000}}, series[0].Samples)
+
+	_, err = DecodeWriteRequest([]byte{0x0a, 0x05, 0x01})
+	assert.Error(t, err)
+}
+
+func TestClient_Query(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseForm())
+		switch r.URL.Path {
+		case "/api/v1/query":
+			if r.Form.Get("query") == "bad(" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+				return
+			}
+			w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"instance":"a"},"value":[1700000000.5,"42"]}]}}`))
+		case "/api/v1/query_range":
+			assert.Equal(t, "60", r.Form.Get("step"))
+			w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[
+				{"metric":{"instance":"a"},"values":[[1700000000,"1"],[1700000060,"2"]]}]}}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL+"/", time.Second)
+	series, err := client.Query(context.Background(), "up", time.Time{})
+	assert.NoError(t, err)
+	assert.Len(t, series, 1)
+	assert.Equal(t, "a", series[0].Metric["instance"])
+	assert.Equal(t, 42.0, series[0].Points[0].Value)
+	assert.Equal(t, time.UnixMilli(1700000000500), series[0].Points[0].Timestamp)
+
+	start := time.Unix(1700000000, 0)
+	series, err = client.QueryRange(context.Background(), "up", start, start.Add(time.Minute), time.Minute)
+	assert.NoError(t, err)
+	assert.Len(t, series[0].Points, 2)
+	assert.Equal(t, 2.0, series[0].Points[1].Value)
+
+	_, err = client.Query(context.Background(), "bad(", time.Time{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "parse error")
+}
+
+func TestParseText(t *testing.T) {
+	samples, err := ParseText(strings.NewReader(`# HELP etcd_server_has_leader Whether or not a leader exists.
+# TYPE etcd_server_has_leader gauge
+etcd_server_has_leader 1
+etcd_disk_wal_fsync_duration_seconds_bucket{le="0.001"} 12 1700000000000
+grpc_server_handled_total{grpc_code="OK",grpc_method="Range",msg="a \"quoted\", value"} 3
+grpc_server_handled_total{grpc_code="Unavailable",grpc_method="Range",} 2
+process_start_time_seconds 1.7e+09
+`))
+	assert.NoError(t, err)
+	assert.Len(t, samples, 5)
+	assert.Equal(t, TextSample{Name: "etcd_server_has_leader", Value: 1}, samples[0])
+	assert.Equal(t, "0.001", samples[1].Labels["le"])
+	assert.Equal(t, `a "quoted", value`, samples[2].Labels["msg"])
+
+	sum, ok := Sum(samples, "grpc_server_handled_total")
+	assert.True(t, ok)
+	assert.Equal(t, 5.0, sum)
+	_, ok = Sum(samples, "missing")
+	assert.False(t, ok)
+
+	_, err = ParseText(strings.NewReader("bad{le=\"1\" 1\n"))
+	assert.Error(t, err)
+}
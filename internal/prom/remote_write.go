@@ -0,0 +1,163 @@
+package prom
+
+import (
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// Label 时间序列的标签
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample 样本，Timestamp 为毫秒时间戳
+type Sample struct {
+	Value     float64
+	Timestamp int64
+}
+
+// TimeSeries remote_write 中的一条时间序列
+type TimeSeries struct {
+	Labels  []Label
+	Samples []Sample
+}
+
+// Label 返回指定标签的值，不存在时返回空字符串
+func (ts TimeSeries) Label(name string) string {
+	for _, l := range ts.Labels {
+		if l.Name == name {
+			return l.Value
+		}
+	}
+	return ""
+}
+
+// DecodeWriteRequest 解析 prometheus.WriteRequest，只读取 timeseries 的 labels 和 samples，
+// exemplars、histograms 和 metadata 被忽略
+func DecodeWriteRequest(b []byte) ([]TimeSeries, error) {
+	var series []TimeSeries
+	err := walkMessage(b, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if num != 1 || typ != protowire.BytesType {
+			return nil
+		}
+		ts, err := decodeTimeSeries(value)
+		if err != nil {
+			return err
+		}
+		series = append(series, ts)
+		return nil
+	})
+	return series, err
+}
+
+func decodeTimeSeries(b []byte) (TimeSeries, error) {
+	var ts TimeSeries
+	err := walkMessage(b, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			label, err := decodeLabel(value)
+			if err != nil {
+				return err
+			}
+			ts.Labels = append(ts.Labels, label)
+		case 2:
+			sample, err := decodeSample(value)
+			if err != nil {
+				return err
+			}
+			ts.Samples = append(ts.Samples, sample)
+		}
+		return nil
+	})
+	return ts, err
+}
+
+func decodeLabel(b []byte) (Label, error) {
+	var label Label
+	err := walkMessage(b, func(num protowire.Number, typ protowire.Type, value []byte) error {
+		if typ != protowire.BytesType {
+			return nil
+		}
+		switch num {
+		case 1:
+			label.Name = string(value)
+		case 2:
+			label.Value = string(value)
+		}
+		return nil
+	})
+	return label, err
+}
+
+func decodeSample(b []byte) (Sample, error) {
+	var sample Sample
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return sample, protowire.ParseError(n)
+		}
+		b = b[n:]
+		switch {
+		case num == 1 && typ == protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			if n < 0 {
+				return sample, protowire.ParseError(n)
+			}
+			sample.Value = math.Float64frombits(v)
+			b = b[n:]
+		case num == 2 && typ == protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			if n < 0 {
+				return sample, protowire.ParseError(n)
+			}
+			sample.Timestamp = int64(v)
+			b = b[n:]
+		default:
+			n := protowire.ConsumeFieldValue(num, typ, b)
+			if n < 0 {
+				return sample, protowire.ParseError(n)
+			}
+			b = b[n:]
+		}
+	}
+	return sample, nil
+}
+
+// walkMessage 遍历消息的字段，长度分隔的字段把内容传给fn，其余字段只传类型
+func walkMessage(b []byte, fn func(num protowire.Number, typ protowire.Type, value []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if typ == protowire.BytesType {
+			value, n := protowire.ConsumeBytes(b)
+			if n < 0 {
+				return fmt.Errorf("field %d: %v", num, protowire.ParseError(n))
+			}
+			if err := fn(num, typ, value); err != nil {
+				return err
+			}
+			b = b[n:]
+			continue
+		}
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		if n < 0 {
+			return fmt.Errorf("field %d: %v", num, protowire.ParseError(n))
+		}
+		if err := fn(num, typ, nil); err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package prom
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// MaxDecodedSize remote_write 请求解压后的大小上限
+const MaxDecodedSize = 64 << 20
+
+var errCorrupt = errors.New("snappy: corrupt input")
+
+// DecodeSnappy 解码 snappy block 格式（remote_write 使用的格式，不是 framed 格式）
+func DecodeSnappy(src []byte) ([]byte, error) {
+	length, n := binary.Uvarint(src)
+	if n <= 0 {
+		return nil, errCorrupt
+	}
+	if length > MaxDecodedSize {
+		return nil, fmt.Errorf("snappy: decoded size %d exceeds limit %d", length, MaxDecodedSize)
+	}
+	src = src[n:]
+	dst := make([]byte, 0, length)
+
+	for len(src) > 0 {
+		tag := src[0]
+		var copyLen, offset int
+		switch tag & 0x03 {
+		case 0x00: // 字面量
+			litLen := int(tag >> 2)
+			src = src[1:]
+			if litLen >= 60 {
+				extra := litLen - 59
+				if len(src) < extra {
+					return nil, errCorrupt
+				}
+				litLen = 0
+				for i := extra - 1; i >= 0; i-- {
+					litLen = litLen<<8 | int(src[i])
+				}
+				src = src[extra:]
+			}
+			litLen++
+			if litLen <= 0 || len(src) < litLen || uint64(len(dst)+litLen) > length {
+				return nil, errCorrupt
+			}
+			dst = append(dst, src[:litLen]...)
+			src = src[litLen:]
+			continue
+		case 0x01: // 1字节偏移的复制
+			if len(src) < 2 {
+				return nil, errCorrupt
+			}
+			copyLen = 4 + int(tag>>2)&0x07
+			offset = int(tag&0xe0)<<3 | int(src[1])
+			src = src[2:]
+		case 0x02: // 2字节偏移的复制
+			if len(src) < 3 {
+				return nil, errCorrupt
+			}
+			copyLen = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint16(src[1:3]))
+			src = src[3:]
+		case 0x03: // 4字节偏移的复制
+			if len(src) < 5 {
+				return nil, errCorrupt
+			}
+			copyLen = 1 + int(tag>>2)
+			offset = int(binary.LittleEndian.Uint32(src[1:5]))
+			src = src[5:]
+		}
+
+		if offset <= 0 || offset > len(dst) || uint64(len(dst)+copyLen) > length {
+			return nil, errCorrupt
+		}
+		// 复制区间可能与输出重叠，逐字节复制
+		start := len(dst) - offset
+		for i := 0; i < copyLen; i++ {
+			dst = append(dst, dst[start+i])
+		}
+	}
+
+	if uint64(len(dst)) != length {
+		return nil, errCorrupt
+	}
+	return dst, nil
+}
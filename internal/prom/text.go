@@ -0,0 +1,122 @@
+package prom
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// TextSample 文本格式中的一个样本
+type TextSample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// ParseText 解析 Prometheus 文本格式（/metrics 的输出），忽略注释、HELP/TYPE 行和时间戳
+func ParseText(r io.Reader) ([]TextSample, error) {
+	var samples []TextSample
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sample, err := parseTextLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		samples = append(samples, sample)
+	}
+	return samples, scanner.Err()
+}
+
+func parseTextLine(line string) (TextSample, error) {
+	var sample TextSample
+	i := strings.IndexAny(line, "{ \t")
+	if i <= 0 {
+		return sample, fmt.Errorf("invalid sample %q", line)
+	}
+	sample.Name = line[:i]
+	rest := line[i:]
+
+	if rest[0] == '{' {
+		labels, n, err := parseTextLabels(rest)
+		if err != nil {
+			return sample, err
+		}
+		sample.Labels = labels
+		rest = rest[n:]
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return sample, fmt.Errorf("missing value in %q", line)
+	}
+	value, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return sample, fmt.Errorf("invalid value in %q", line)
+	}
+	sample.Value = value
+	return sample, nil
+}
+
+// parseTextLabels 解析 {a="1",b="2"}，返回标签和消耗的字节数
+func parseTextLabels(s string) (map[string]string, int, error) {
+	labels := make(map[string]string)
+	i := 1
+	for {
+		for i < len(s) && (s[i] == ' ' || s[i] == ',') {
+			i++
+		}
+		if i >= len(s) {
+			return nil, 0, fmt.Errorf("unterminated labels in %q", s)
+		}
+		if s[i] == '}' {
+			return labels, i + 1, nil
+		}
+
+		eq := strings.IndexByte(s[i:], '=')
+		if eq <= 0 || i+eq+1 >= len(s) || s[i+eq+1] != '"' {
+			return nil, 0, fmt.Errorf("invalid label in %q", s)
+		}
+		name := strings.TrimSpace(s[i : i+eq])
+		i += eq + 2
+
+		var value strings.Builder
+		for ; i < len(s) && s[i] != '"'; i++ {
+			if s[i] == '\\' && i+1 < len(s) {
+				i++
+				switch s[i] {
+				case 'n':
+					value.WriteByte('\n')
+				default:
+					value.WriteByte(s[i])
+				}
+				continue
+			}
+			value.WriteByte(s[i])
+		}
+		if i >= len(s) {
+			return nil, 0, fmt.Errorf("unterminated label value in %q", s)
+		}
+		labels[name] = value.String()
+		i++
+	}
+}
+
+// Sum 返回指定指标所有标签组合的样本之和，以及是否存在该指标
+func Sum(samples []TextSample, name string) (float64, bool) {
+	var sum float64
+	found := false
+	for _, s := range samples {
+		if s.Name == name {
+			sum += s.Value
+			found = true
+		}
+	}
+	return sum, found
+}
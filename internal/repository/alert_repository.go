@@ -36,6 +36,12 @@ func (r *AlertRepository) FindEnabledRules() ([]model.AlertRule, error) {
 	return rules, err
 }
 
+func (r *AlertRepository) FindEnabledRulesByType(ruleType string) ([]model.AlertRule, error) {
+	var rules []model.AlertRule
+	err := r.db.Where("status = ? AND type = ?", "enabled", ruleType).Find(&rules).Error
+	return rules, err
+}
+
 func (r *AlertRepository) CreateHistory(history *model.AlertHistory) error {
 	return r.db.Create(history).Error
 }
@@ -46,4 +52,11 @@ func (r *AlertRepository) FindHistoryByTimeRange(start, end time.Time) ([]model.
 		Order("created_at DESC").
 		Find(&history).Error
 	return history, err
-}
\ No newline at end of file
+}
+
+// DeleteHistoryBefore 删除before之前的告警历史，每次至多limit行
+func (r *AlertRepository) DeleteHistoryBefore(before time.Time, limit int) (int64, error) {
+	result := r.db.Exec(`DELETE FROM alert_histories WHERE id IN (
+		SELECT id FROM alert_histories WHERE created_at < ? LIMIT ?)`, before, limit)
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"middleware-platform/internal/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type CertificateRepository struct {
+	db *gorm.DB
+}
+
+func NewCertificateRepository(db *gorm.DB) *CertificateRepository {
+	db.AutoMigrate(&model.Certificate{})
+	return &CertificateRepository{db: db}
+}
+
+// FindAll 按过期时间从早到晚排列，before不为零时只返回在此之前过期的证书
+func (r *CertificateRepository) FindAll(before time.Time) ([]model.Certificate, error) {
+	var certs []model.Certificate
+	query := r.db.Order("not_after ASC")
+	if !before.IsZero() {
+		query = query.Where("not_after < ?", before)
+	}
+	err := query.Find(&certs).Error
+	return certs, err
+}
+
+func (r *CertificateRepository) FindByKey(key string) (*model.Certificate, error) {
+	var cert model.Certificate
+	if err := r.db.Where("key = ?", key).First(&cert).Error; err != nil {
+		return nil, err
+	}
+	return &cert, nil
+}
+
+// Save 新建或更新证书记录
+func (r *CertificateRepository) Save(cert *model.Certificate) error {
+	return r.db.Save(cert).Error
+}
+
+// DeleteExcept 删除不在keys中的证书，用于清理已更换、已删除或不再出示证书的位置
+func (r *CertificateRepository) DeleteExcept(keys []string) (int64, error) {
+	query := r.db.Unscoped()
+	if len(keys) > 0 {
+		query = query.Where("key NOT IN ?", keys)
+	} else {
+		query = query.Where("1 = 1")
+	}
+	result := query.Delete(&model.Certificate{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"middleware-platform/internal/model"
+
+	"gorm.io/gorm"
+)
+
+type DeployRepository struct {
+	db *gorm.DB
+}
+
+func NewDeployRepository(db *gorm.DB) *DeployRepository {
+	db.AutoMigrate(&model.DeployTemplate{}, &model.Deployment{}, &model.DeploymentStep{})
+	return &DeployRepository{db: db}
+}
+
+func (r *DeployRepository) CreateTemplate(tmpl *model.DeployTemplate) error {
+	return r.db.Create(tmpl).Error
+}
+
+// FindTemplates 按名称和版本排列，name不为空时只返回该名称的各版本
+func (r *DeployRepository) FindTemplates(name string) ([]model.DeployTemplate, error) {
+	var templates []model.DeployTemplate
+	query := r.db.Order("name ASC, id DESC")
+	if name != "" {
+		query = query.Where("name = ?", name)
+	}
+	err := query.Find(&templates).Error
+	return templates, err
+}
+
+func (r *DeployRepository) FindTemplateByID(id uint) (*model.DeployTemplate, error) {
+	var tmpl model.DeployTemplate
+	if err := r.db.First(&tmpl, id).Error; err != nil {
+		return nil, err
+	}
+	return &tmpl, nil
+}
+
+// CountTemplates 统计同名同版本的模板数
+func (r *DeployRepository) CountTemplates(name, version string) (int64, error) {
+	var count int64
+	err := r.db.Model(&model.DeployTemplate{}).Where("name = ? AND version = ?", name, version).Count(&count).Error
+	return count, err
+}
+
+// CreateDeployment 创建部署任务及其步骤
+func (r *DeployRepository) CreateDeployment(deployment *model.Deployment) error {
+	return r.db.Create(deployment).Error
+}
+
+// UpdateDeployment 更新部署任务本身，不级联更新步骤
+func (r *DeployRepository) UpdateDeployment(deployment *model.Deployment) error {
+	return r.db.Omit("Steps").Save(deployment).Error
+}
+
+func (r *DeployRepository) UpdateStep(step *model.DeploymentStep) error {
+	return r.db.Save(step).Error
+}
+
+// FindDeploymentByID 查找部署任务，步骤按执行顺序排列
+func (r *DeployRepository) FindDeploymentByID(id uint) (*model.Deployment, error) {
+	var deployment model.Deployment
+	err := r.db.Preload("Steps", func(db *gorm.DB) *gorm.DB {
+		return db.Order("seq ASC")
+	}).First(&deployment, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
+// FindDeployments 查找最近的部署任务（不含步骤）
+func (r *DeployRepository) FindDeployments(limit int) ([]model.Deployment, error) {
+	var deployments []model.Deployment
+	err := r.db.Order("id DESC").Limit(limit).Find(&deployments).Error
+	return deployments, err
+}
+
+func (r *DeployRepository) FindDeploymentsByStatus(statuses ...string) ([]model.Deployment, error) {
+	var deployments []model.Deployment
+	err := r.db.Where("status IN ?", statuses).Find(&deployments).Error
+	return deployments, err
+}
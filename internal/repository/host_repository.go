@@ -11,7 +11,9 @@ type HostRepository struct {
 }
 
 func NewHostRepository(db *gorm.DB) *HostRepository {
-	db.AutoMigrate(&model.Host{}, &model.FileSync{})
+	db.AutoMigrate(&model.Host{}, &model.FileSync{}, &model.FileSyncHistory{},
+		&model.Distribution{}, &model.DistributionTarget{},
+		&model.FileCollection{}, &model.CollectedFile{})
 	return &HostRepository{db: db}
 }
 
@@ -72,4 +74,202 @@ func (r *HostRepository) FindFileSyncByID(id uint) (*model.FileSync, error) {
 		return nil, err
 	}
 	return &fileSync, nil
-} 
\ No newline at end of file
+}
+
+// FindFileSyncsByStatus 查找处于指定状态的文件同步任务
+func (r *HostRepository) FindFileSyncsByStatus(statuses ...string) ([]model.FileSync, error) {
+	var fileSyncs []model.FileSync
+	result := r.db.Where("status IN ?", statuses).Order("id ASC").Find(&fileSyncs)
+	return fileSyncs, result.Error
+}
+
+// UpdateFileSyncStatus 仅更新同步任务的状态，避免覆盖worker正在写入的其他字段
+func (r *HostRepository) UpdateFileSyncStatus(id uint, status string) error {
+	return r.db.Model(&model.FileSync{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":    status,
+		"is_paused": status == "paused",
+	}).Error
+}
+
+// FindFileSyncsByTriggerMode 查找指定触发方式的文件同步任务
+func (r *HostRepository) FindFileSyncsByTriggerMode(modes ...string) ([]model.FileSync, error) {
+	var fileSyncs []model.FileSync
+	result := r.db.Where("trigger_mode IN ?", modes).Find(&fileSyncs)
+	return fileSyncs, result.Error
+}
+
+// FindMaxSyncRevision 返回同步任务已使用的最大版本号
+func (r *HostRepository) FindMaxSyncRevision(fileSyncID uint) (int, error) {
+	var revision int
+	result := r.db.Model(&model.FileSyncHistory{}).Where("file_sync_id = ?", fileSyncID).
+		Select("COALESCE(MAX(revision), 0)").Scan(&revision)
+	return revision, result.Error
+}
+
+// CountSyncRevisions 统计保存了内容的版本数，包括首次同步前的备份记录
+func (r *HostRepository) CountSyncRevisions(fileSyncID uint) (int64, error) {
+	var count int64
+	result := r.db.Model(&model.FileSyncHistory{}).
+		Where("file_sync_id = ? AND (storage_path <> '' OR status = ?)", fileSyncID, "backup").
+		Count(&count)
+	return count, result.Error
+}
+
+// FindSyncRevision 查找内容仍保存在平台上的指定版本
+func (r *HostRepository) FindSyncRevision(fileSyncID uint, revision int) (*model.FileSyncHistory, error) {
+	var history model.FileSyncHistory
+	result := r.db.Where("file_sync_id = ? AND revision = ? AND storage_path <> ''", fileSyncID, revision).
+		Order("id ASC").First(&history)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &history, nil
+}
+
+// FindSyncRevisions 查找内容仍保存在平台上的所有版本，新版本在前
+func (r *HostRepository) FindSyncRevisions(fileSyncID uint) ([]model.FileSyncHistory, error) {
+	var revisions []model.FileSyncHistory
+	result := r.db.Where("file_sync_id = ? AND storage_path <> ''", fileSyncID).
+		Order("revision DESC").Find(&revisions)
+	return revisions, result.Error
+}
+
+// ClearSyncRevisionStorage 版本内容被清理后保留历史记录，只清空存储路径
+func (r *HostRepository) ClearSyncRevisionStorage(historyID uint) error {
+	return r.db.Model(&model.FileSyncHistory{}).Where("id = ?", historyID).Update("storage_path", "").Error
+}
+
+// ClearFileSyncRollback 清除排队中的回滚目标
+func (r *HostRepository) ClearFileSyncRollback(fileSyncID uint) error {
+	return r.db.Model(&model.FileSync{}).Where("id = ?", fileSyncID).Update("rollback_revision", 0).Error
+}
+
+// UpdateFileSyncDrift 仅更新漂移检测结果。
+// 只有任务仍是completed且源文件校验和未变时才写入，避免覆盖检测期间重新同步的结果。
+func (r *HostRepository) UpdateFileSyncDrift(fileSync *model.FileSync) (bool, error) {
+	result := r.db.Model(&model.FileSync{}).
+		Where("id = ? AND status = ? AND sha256 = ?", fileSync.ID, "completed", fileSync.SHA256).
+		Updates(map[string]interface{}{
+			"remote_sha256":    fileSync.RemoteSHA256,
+			"drift_status":     fileSync.DriftStatus,
+			"drift_message":    fileSync.DriftMessage,
+			"drift_checked_at": fileSync.DriftCheckedAt,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// FindFileSyncsByDriftStatus 查找处于指定漂移状态的文件同步任务
+func (r *HostRepository) FindFileSyncsByDriftStatus(statuses ...string) ([]model.FileSync, error) {
+	var fileSyncs []model.FileSync
+	result := r.db.Preload("Host").Where("drift_status IN ?", statuses).Order("drift_checked_at DESC").Find(&fileSyncs)
+	return fileSyncs, result.Error
+}
+
+// CreateDistribution 创建分发任务及其目标主机
+func (r *HostRepository) CreateDistribution(distribution *model.Distribution) error {
+	return r.db.Create(distribution).Error
+}
+
+// UpdateDistribution 更新分发任务本身，不级联更新目标主机
+func (r *HostRepository) UpdateDistribution(distribution *model.Distribution) error {
+	return r.db.Omit("Targets").Save(distribution).Error
+}
+
+func (r *HostRepository) UpdateDistributionTarget(target *model.DistributionTarget) error {
+	return r.db.Save(target).Error
+}
+
+// FindDistributionByID 查找分发任务，目标主机按批次排序
+func (r *HostRepository) FindDistributionByID(id uint) (*model.Distribution, error) {
+	var distribution model.Distribution
+	err := r.db.Preload("Targets", func(db *gorm.DB) *gorm.DB {
+		return db.Order("batch ASC, id ASC")
+	}).First(&distribution, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &distribution, nil
+}
+
+// FindDistributions 查找最近的分发任务（不含目标主机明细）
+func (r *HostRepository) FindDistributions(limit int) ([]model.Distribution, error) {
+	var distributions []model.Distribution
+	result := r.db.Order("id DESC").Limit(limit).Find(&distributions)
+	return distributions, result.Error
+}
+
+func (r *HostRepository) FindDistributionsByStatus(statuses ...string) ([]model.Distribution, error) {
+	var distributions []model.Distribution
+	result := r.db.Where("status IN ?", statuses).Find(&distributions)
+	return distributions, result.Error
+}
+
+// CreateFileCollection 创建文件收集任务
+func (r *HostRepository) CreateFileCollection(collection *model.FileCollection) error {
+	return r.db.Create(collection).Error
+}
+
+// UpdateFileCollection 更新文件收集任务，不级联保存版本
+func (r *HostRepository) UpdateFileCollection(collection *model.FileCollection) error {
+	return r.db.Omit("Versions", "Host").Save(collection).Error
+}
+
+// FindFileCollectionByID 查找文件收集任务及其版本，新版本在前
+func (r *HostRepository) FindFileCollectionByID(id uint) (*model.FileCollection, error) {
+	var collection model.FileCollection
+	result := r.db.Preload("Host").Preload("Versions", func(db *gorm.DB) *gorm.DB {
+		return db.Order("version DESC")
+	}).First(&collection, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &collection, nil
+}
+
+// FindFileCollections 查找文件收集任务，hostID为0时返回全部
+func (r *HostRepository) FindFileCollections(hostID uint) ([]model.FileCollection, error) {
+	var collections []model.FileCollection
+	query := r.db.Preload("Host").Order("id DESC")
+	if hostID != 0 {
+		query = query.Where("host_id = ?", hostID)
+	}
+	result := query.Find(&collections)
+	return collections, result.Error
+}
+
+// FindFileCollectionsByStatus 查找处于指定状态的文件收集任务
+func (r *HostRepository) FindFileCollectionsByStatus(statuses ...string) ([]model.FileCollection, error) {
+	var collections []model.FileCollection
+	result := r.db.Where("status IN ?", statuses).Find(&collections)
+	return collections, result.Error
+}
+
+// CreateCollectedFile 保存收集到的版本
+func (r *HostRepository) CreateCollectedFile(file *model.CollectedFile) error {
+	return r.db.Create(file).Error
+}
+
+// FindCollectedFileByID 查找收集到的版本
+func (r *HostRepository) FindCollectedFileByID(id uint) (*model.CollectedFile, error) {
+	var file model.CollectedFile
+	result := r.db.First(&file, id)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &file, nil
+}
+
+// FindCollectedFiles 查找收集任务的全部版本，新版本在前
+func (r *HostRepository) FindCollectedFiles(collectionID uint) ([]model.CollectedFile, error) {
+	var files []model.CollectedFile
+	result := r.db.Where("collection_id = ?", collectionID).Order("version DESC").Find(&files)
+	return files, result.Error
+}
+
+// DeleteCollectedFiles 删除超出保留数量的版本记录
+func (r *HostRepository) DeleteCollectedFiles(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return r.db.Unscoped().Delete(&model.CollectedFile{}, ids).Error
+}
@@ -1,19 +1,35 @@
 package repository
 
 import (
+	"fmt"
+	"log"
 	"middleware-platform/internal/model"
+	"strconv"
+	"sync"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// 批量写入时每条 INSERT 的行数
+const insertBatchSize = 500
+
 type MetricsRepository struct {
 	db *gorm.DB
+
+	// 序列ID缓存，键为 seriesKey
+	seriesMu sync.Mutex
+	series   map[string]uint
 }
 
 func NewMetricsRepository(db *gorm.DB) *MetricsRepository {
-	db.AutoMigrate(&model.Metrics{})
-	return &MetricsRepository{db: db}
+	db.AutoMigrate(&model.Metrics{}, &model.MetricSeries{}, &model.MetricRollup{}, &model.ScrapeStatus{}, &model.RedisSlowLog{})
+	r := &MetricsRepository{db: db, series: make(map[string]uint)}
+	if err := r.migrateLegacySamples(); err != nil {
+		log.Printf("Failed to migrate legacy metrics to series: %v", err)
+	}
+	return r
 }
 
 func (r *MetricsRepository) Create(metrics *model.Metrics) error {
@@ -45,4 +61,347 @@ func (r *MetricsRepository) FindLatestByType(metricType string) ([]model.Metrics
 		Limit(1).
 		Find(&metrics).Error
 	return metrics, err
-} 
\ No newline at end of file
+} 
+
+// FindLatestPerSeries 返回每条序列在since之后的最新一条，Labels为序列的标签
+func (r *MetricsRepository) FindLatestPerSeries(since time.Time) ([]model.Metrics, error) {
+	var rows []struct {
+		model.Metrics
+		SeriesLabels string
+	}
+	err := r.db.Raw(`SELECT DISTINCT ON (m.series_id) m.*, s.labels AS series_labels
+		FROM metrics m JOIN metric_series s ON s.id = m.series_id
+		WHERE m.timestamp >= ? ORDER BY m.series_id, m.timestamp DESC`, since).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	metrics := make([]model.Metrics, len(rows))
+	for i, row := range rows {
+		metrics[i] = row.Metrics
+		if row.SeriesLabels != "" {
+			metrics[i].Labels = model.MetricSeries{Labels: row.SeriesLabels}.LabelMap()
+		}
+	}
+	return metrics, nil
+}
+
+// SaveSamples 批量写入一个采集周期的样本：确定每个样本所属序列，写入原始样本并合并到各粒度的聚合中
+func (r *MetricsRepository) SaveSamples(samples []model.Metrics) error {
+	if len(samples) == 0 {
+		return nil
+	}
+	for i := range samples {
+		id, err := r.seriesID(&samples[i])
+		if err != nil {
+			return err
+		}
+		samples[i].SeriesID = id
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(samples, insertBatchSize).Error; err != nil {
+			return err
+		}
+		return upsertRollups(tx, buildRollups(samples))
+	})
+}
+
+func seriesKey(middlewareID uint, name, labels string) string {
+	return strconv.FormatUint(uint64(middlewareID), 10) + "\x00" + name + "\x00" + labels
+}
+
+// seriesID 查找或创建样本所属的序列
+func (r *MetricsRepository) seriesID(m *model.Metrics) (uint, error) {
+	labels := model.SeriesLabels(m.Labels)
+	key := seriesKey(m.MiddlewareID, m.Type, labels)
+
+	r.seriesMu.Lock()
+	defer r.seriesMu.Unlock()
+	if id, ok := r.series[key]; ok {
+		return id, nil
+	}
+
+	series := model.MetricSeries{MiddlewareID: m.MiddlewareID, Name: m.Type, Labels: labels, Unit: m.Unit}
+	err := r.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&series).Error
+	if err != nil {
+		return 0, err
+	}
+	if series.ID == 0 {
+		// 已存在（可能由另一个实例创建）
+		err = r.db.Where("middleware_id = ? AND name = ? AND labels = ?", m.MiddlewareID, m.Type, labels).
+			First(&series).Error
+		if err != nil {
+			return 0, err
+		}
+	}
+	r.series[key] = series.ID
+	return series.ID, nil
+}
+
+// buildRollups 在内存中将样本按序列、粒度和时间桶聚合，保证同一批写入中每个键只出现一次
+func buildRollups(samples []model.Metrics) []model.MetricRollup {
+	type rollupKey struct {
+		seriesID   uint
+		resolution string
+		bucket     int64
+	}
+	index := make(map[rollupKey]int)
+	var rollups []model.MetricRollup
+	for _, m := range samples {
+		for _, res := range model.RollupResolutions {
+			bucket := m.Timestamp.UTC().Truncate(res.Step)
+			key := rollupKey{m.SeriesID, res.Name, bucket.Unix()}
+			i, ok := index[key]
+			if !ok {
+				index[key] = len(rollups)
+				rollups = append(rollups, model.MetricRollup{
+					SeriesID:   m.SeriesID,
+					Resolution: res.Name,
+					Bucket:     bucket,
+					Count:      1,
+					Sum:        m.Value,
+					Min:        m.Value,
+					Max:        m.Value,
+					Last:       m.Value,
+					LastAt:     m.Timestamp,
+				})
+				continue
+			}
+			rollup := &rollups[i]
+			rollup.Count++
+			rollup.Sum += m.Value
+			if m.Value < rollup.Min {
+				rollup.Min = m.Value
+			}
+			if m.Value > rollup.Max {
+				rollup.Max = m.Value
+			}
+			if !m.Timestamp.Before(rollup.LastAt) {
+				rollup.Last = m.Value
+				rollup.LastAt = m.Timestamp
+			}
+		}
+	}
+	return rollups
+}
+
+// upsertRollups 将本批聚合合并到已有的时间桶
+func upsertRollups(tx *gorm.DB, rollups []model.MetricRollup) error {
+	if len(rollups) == 0 {
+		return nil
+	}
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "series_id"}, {Name: "resolution"}, {Name: "bucket"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"count":   gorm.Expr("metric_rollups.count + excluded.count"),
+			"sum":     gorm.Expr("metric_rollups.sum + excluded.sum"),
+			"min":     gorm.Expr("LEAST(metric_rollups.min, excluded.min)"),
+			"max":     gorm.Expr("GREATEST(metric_rollups.max, excluded.max)"),
+			"last":    gorm.Expr("CASE WHEN excluded.last_at >= metric_rollups.last_at THEN excluded.last ELSE metric_rollups.last END"),
+			"last_at": gorm.Expr("GREATEST(metric_rollups.last_at, excluded.last_at)"),
+		}),
+	}).CreateInBatches(rollups, insertBatchSize).Error
+}
+
+// rollupBucketExpr 计算样本所在时间桶的SQL表达式
+func rollupBucketExpr(res model.Resolution) string {
+	return fmt.Sprintf("to_timestamp(floor(extract(epoch from m.timestamp) / %d) * %d)",
+		int64(res.Step.Seconds()), int64(res.Step.Seconds()))
+}
+
+// migrateLegacySamples 为引入序列之前写入的样本（series_id 为0）创建序列并补齐聚合
+func (r *MetricsRepository) migrateLegacySamples() error {
+	var legacy []uint
+	err := r.db.Model(&model.Metrics{}).Where("series_id = 0 OR series_id IS NULL").
+		Limit(1).Pluck("id", &legacy).Error
+	if err != nil || len(legacy) == 0 {
+		return err
+	}
+
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`INSERT INTO metric_series (middleware_id, name, labels, unit, created_at)
+			SELECT DISTINCT ON (middleware_id, type) middleware_id, type, '', unit, NOW() FROM metrics
+			WHERE series_id = 0 OR series_id IS NULL ORDER BY middleware_id, type, timestamp DESC
+			ON CONFLICT DO NOTHING`).Error
+		if err != nil {
+			return err
+		}
+
+		for _, res := range model.RollupResolutions {
+			bucket := rollupBucketExpr(res)
+			err := tx.Exec(`INSERT INTO metric_rollups (series_id, resolution, bucket, count, sum, min, max, last, last_at)
+				SELECT s.id, ?, `+bucket+`, COUNT(*), SUM(m.value), MIN(m.value), MAX(m.value),
+					(ARRAY_AGG(m.value ORDER BY m.timestamp DESC))[1], MAX(m.timestamp)
+				FROM metrics m JOIN metric_series s
+					ON s.middleware_id = m.middleware_id AND s.name = m.type AND s.labels = ''
+				WHERE m.series_id = 0 OR m.series_id IS NULL
+				GROUP BY s.id, `+bucket+`
+				ON CONFLICT (series_id, resolution, bucket) DO UPDATE SET
+					count = metric_rollups.count + excluded.count,
+					sum = metric_rollups.sum + excluded.sum,
+					min = LEAST(metric_rollups.min, excluded.min),
+					max = GREATEST(metric_rollups.max, excluded.max),
+					last = CASE WHEN excluded.last_at >= metric_rollups.last_at THEN excluded.last ELSE metric_rollups.last END,
+					last_at = GREATEST(metric_rollups.last_at, excluded.last_at)`, res.Name).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Exec(`UPDATE metrics m SET series_id = s.id FROM metric_series s
+			WHERE (m.series_id = 0 OR m.series_id IS NULL)
+				AND s.middleware_id = m.middleware_id AND s.name = m.type AND s.labels = ''`).Error
+	})
+}
+
+// FindSeries 查找中间件的序列，names为空时返回全部指标
+func (r *MetricsRepository) FindSeries(middlewareIDs []uint, names []string) ([]model.MetricSeries, error) {
+	var series []model.MetricSeries
+	query := r.db.Where("middleware_id IN ?", middlewareIDs)
+	if len(names) > 0 {
+		query = query.Where("name IN ?", names)
+	}
+	err := query.Order("middleware_id, name, labels").Find(&series).Error
+	return series, err
+}
+
+// FindSeriesPoints 按粒度读取序列在时间范围内的点：raw 读取原始样本，其余读取聚合
+func (r *MetricsRepository) FindSeriesPoints(seriesIDs []uint, resolution string, start, end time.Time) ([]model.MetricPoint, error) {
+	var points []model.MetricPoint
+	if len(seriesIDs) == 0 {
+		return points, nil
+	}
+	if resolution == model.ResolutionRaw {
+		err := r.db.Model(&model.Metrics{}).
+			Select("series_id, timestamp, 1 AS count, value AS sum, value AS min, value AS max, value AS last").
+			Where("series_id IN ? AND timestamp BETWEEN ? AND ?", seriesIDs, start, end).
+			Order("series_id, timestamp").
+			Scan(&points).Error
+		return points, err
+	}
+	err := r.db.Model(&model.MetricRollup{}).
+		Select("series_id, bucket AS timestamp, count, sum, min, max, last").
+		Where("series_id IN ? AND resolution = ? AND bucket BETWEEN ? AND ?", seriesIDs, resolution, start, end).
+		Order("series_id, bucket").
+		Scan(&points).Error
+	return points, err
+}
+
+// DeleteSamplesBefore 删除before之前的原始样本，每次至多limit行
+func (r *MetricsRepository) DeleteSamplesBefore(before time.Time, limit int) (int64, error) {
+	result := r.db.Exec(`DELETE FROM metrics WHERE id IN (
+		SELECT id FROM metrics WHERE timestamp < ? LIMIT ?)`, before, limit)
+	return result.RowsAffected, result.Error
+}
+
+// DeleteRollupsBefore 删除指定粒度在before之前的聚合，每次至多limit行
+func (r *MetricsRepository) DeleteRollupsBefore(resolution string, before time.Time, limit int) (int64, error) {
+	result := r.db.Exec(`DELETE FROM metric_rollups WHERE ctid IN (
+		SELECT ctid FROM metric_rollups WHERE resolution = ? AND bucket < ? LIMIT ?)`, resolution, before, limit)
+	return result.RowsAffected, result.Error
+}
+
+// DeleteSlowLogsBefore 删除before之前执行的慢查询，每次至多limit行
+func (r *MetricsRepository) DeleteSlowLogsBefore(before time.Time, limit int) (int64, error) {
+	result := r.db.Exec(`DELETE FROM redis_slow_logs WHERE id IN (
+		SELECT id FROM redis_slow_logs WHERE executed_at < ? LIMIT ?)`, before, limit)
+	return result.RowsAffected, result.Error
+}
+
+// StorageUsage 统计各表大小和每个中间件的行数，按表的平均行大小估算每个中间件占用的字节数
+func (r *MetricsRepository) StorageUsage() (*model.MetricStorageReport, error) {
+	report := &model.MetricStorageReport{}
+	err := r.db.Raw(`SELECT relname AS "table", GREATEST(reltuples, 0)::bigint AS rows,
+			pg_total_relation_size(oid) AS bytes
+		FROM pg_class WHERE relkind = 'r' AND relname IN ('metrics', 'metric_rollups', 'metric_series')
+		ORDER BY relname`).Scan(&report.Tables).Error
+	if err != nil {
+		return nil, err
+	}
+
+	rowSize := make(map[string]float64)
+	for _, t := range report.Tables {
+		report.TotalBytes += t.Bytes
+		if t.Rows > 0 {
+			rowSize[t.Table] = float64(t.Bytes) / float64(t.Rows)
+		}
+	}
+
+	err = r.db.Raw(`SELECT s.middleware_id,
+			COUNT(*) AS series,
+			COALESCE(SUM(m.samples), 0) AS samples,
+			COALESCE(SUM(ru.points), 0) AS rollup_points
+		FROM metric_series s
+		LEFT JOIN (SELECT series_id, COUNT(*) AS samples FROM metrics GROUP BY series_id) m ON m.series_id = s.id
+		LEFT JOIN (SELECT series_id, COUNT(*) AS points FROM metric_rollups GROUP BY series_id) ru ON ru.series_id = s.id
+		GROUP BY s.middleware_id
+		ORDER BY s.middleware_id`).Scan(&report.Middlewares).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range report.Middlewares {
+		usage := &report.Middlewares[i]
+		usage.EstimatedBytes = int64(float64(usage.Samples)*rowSize["metrics"] +
+			float64(usage.RollupPoints)*rowSize["metric_rollups"] +
+			float64(usage.Series)*rowSize["metric_series"])
+	}
+	return report, nil
+}
+
+// FindScrapeStatus 获取中间件最近一次采集的结果
+func (r *MetricsRepository) FindScrapeStatus(middlewareID uint) (*model.ScrapeStatus, error) {
+	var status model.ScrapeStatus
+	err := r.db.First(&status, "middleware_id = ?", middlewareID).Error
+	return &status, err
+}
+
+func (r *MetricsRepository) FindScrapeStatuses() ([]model.ScrapeStatus, error) {
+	var statuses []model.ScrapeStatus
+	err := r.db.Order("middleware_id").Find(&statuses).Error
+	return statuses, err
+}
+
+// SaveScrapeStatus 写入采集结果，跳过次数由 IncrementScrapeSkipped 单独累加，不被覆盖
+func (r *MetricsRepository) SaveScrapeStatus(status *model.ScrapeStatus) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "middleware_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"health", "last_scrape_at", "last_success_at", "last_error", "last_duration",
+			"samples", "consecutive_failures", "updated_at",
+		}),
+	}).Create(status).Error
+}
+
+// IncrementScrapeSkipped 累加因上一次采集未结束而跳过的次数
+func (r *MetricsRepository) IncrementScrapeSkipped(middlewareID uint) error {
+	return r.db.Exec(`INSERT INTO scrape_statuses (middleware_id, skipped, updated_at) VALUES (?, 1, NOW())
+		ON CONFLICT (middleware_id) DO UPDATE SET skipped = scrape_statuses.skipped + 1, updated_at = NOW()`,
+		middlewareID).Error
+}
+
+// SaveSlowLogs 保存慢查询，已保存过的条目（同一中间件的相同ID）忽略
+func (r *MetricsRepository) SaveSlowLogs(logs []model.RedisSlowLog) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "middleware_id"}, {Name: "entry_id"}},
+		DoNothing: true,
+	}).Create(&logs).Error
+}
+
+// FindSlowLogs 按执行时间从新到旧分页返回慢查询及总数
+func (r *MetricsRepository) FindSlowLogs(middlewareID uint, limit, offset int) ([]model.RedisSlowLog, int64, error) {
+	var total int64
+	if err := r.db.Model(&model.RedisSlowLog{}).Where("middleware_id = ?", middlewareID).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var logs []model.RedisSlowLog
+	err := r.db.Where("middleware_id = ?", middlewareID).
+		Order("executed_at DESC, entry_id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&logs).Error
+	return logs, total, err
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"middleware-platform/internal/model"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildRollups(t *testing.T) {
+	base := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	samples := []model.Metrics{
+		{SeriesID: 1, Value: 3, Timestamp: base.Add(10 * time.Second)},
+		{SeriesID: 1, Value: 1, Timestamp: base.Add(40 * time.Second)},
+		{SeriesID: 1, Value: 5, Timestamp: base.Add(70 * time.Second)},
+		{SeriesID: 2, Value: 7, Timestamp: base.Add(20 * time.Second)},
+	}
+
+	rollups := buildRollups(samples)
+	find := func(seriesID uint, resolution string, bucket time.Time) model.MetricRollup {
+		for _, r := range rollups {
+			if r.SeriesID == seriesID && r.Resolution == resolution && r.Bucket.Equal(bucket) {
+				return r
+			}
+		}
+		t.Fatalf("rollup %d/%s/%v not found", seriesID, resolution, bucket)
+		return model.MetricRollup{}
+	}
+
+	// 序列1：1m 两个桶，5m 和 1h 各一个桶；序列2 每种粒度一个桶
+	assert.Len(t, rollups, 4+3)
+
+	first := find(1, model.Resolution1m, base)
+	assert.Equal(t, int64(2), first.Count)
+	assert.Equal(t, 4.0, first.Sum)
+	assert.Equal(t, 1.0, first.Min)
+	assert.Equal(t, 3.0, first.Max)
+	assert.Equal(t, 1.0, first.Last)
+
+	hour := find(1, model.Resolution1h, base)
+	assert.Equal(t, int64(3), hour.Count)
+	assert.Equal(t, 9.0, hour.Sum)
+	assert.Equal(t, 5.0, hour.Max)
+	assert.Equal(t, 5.0, hour.Last)
+	assert.Equal(t, base.Add(70*time.Second), hour.LastAt)
+
+	assert.Equal(t, 7.0, find(2, model.Resolution5m, base).Sum)
+}
+
+func TestSeriesLabels(t *testing.T) {
+	assert.Equal(t, "", model.SeriesLabels(nil))
+	labels := model.SeriesLabels(map[string]string{"job": "node", "instance": "a"})
+	assert.Equal(t, `{"instance":"a","job":"node"}`, labels)
+	assert.Equal(t, map[string]string{"job": "node", "instance": "a"},
+		model.MetricSeries{Labels: labels}.LabelMap())
+}
+
+func TestFindLatestPerSeries(t *testing.T) {
+	db, mock := setupTestDB(t)
+	repo := &MetricsRepository{db: db}
+	now := time.Now()
+
+	rows := sqlmock.NewRows([]string{"id", "series_id", "middleware_id", "type", "value", "timestamp", "series_labels"}).
+		AddRow(10, 1, 1, "consumer_lag", 7, now, `{"topic":"orders"}`).
+		AddRow(11, 2, 1, "consumer_lag", 40, now, `{"topic":"payments"}`).
+		AddRow(12, 3, 1, "connections", 5, now, "")
+	mock.ExpectQuery(`SELECT DISTINCT ON \(m.series_id\) m.\*, s.labels AS series_labels FROM metrics m JOIN metric_series s`).
+		WillReturnRows(rows)
+
+	metrics, err := repo.FindLatestPerSeries(now.Add(-time.Minute))
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	if assert.Len(t, metrics, 3) {
+		// 同一指标的不同标签序列各自保留
+		assert.Equal(t, map[string]string{"topic": "orders"}, metrics[0].Labels)
+		assert.Equal(t, map[string]string{"topic": "payments"}, metrics[1].Labels)
+		assert.Equal(t, 40.0, metrics[1].Value)
+		assert.Nil(t, metrics[2].Labels)
+		assert.Equal(t, uint(3), metrics[2].SeriesID)
+	}
+}
@@ -1,9 +1,12 @@
 package repository
 
 import (
+	"errors"
 	"middleware-platform/internal/model"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type MiddlewareRepository struct {
@@ -12,7 +15,8 @@ type MiddlewareRepository struct {
 
 func NewMiddlewareRepository(db *gorm.DB) *MiddlewareRepository {
 	// 自动迁移数据库表
-	db.AutoMigrate(&model.Middleware{})
+	db.AutoMigrate(&model.Middleware{}, &model.MiddlewareStatusChange{},
+		&model.RedisTopology{}, &model.RedisNode{}, &model.RedisFailoverEvent{}, &model.MiddlewareOperation{})
 	return &MiddlewareRepository{db: db}
 }
 
@@ -35,14 +39,40 @@ func (r *MiddlewareRepository) Create(middleware *model.Middleware) error {
 	return r.db.Create(middleware).Error
 }
 
+// healthColumns 由健康检查维护的字段，用户更新中间件时不覆盖
+var healthColumns = []string{"status", "last_check_at", "latency", "health_message"}
+
+// discoveryColumns 由自动发现维护的字段
+var discoveryColumns = []string{"parent_id", "role"}
+
 // Update 更新中间件
 func (r *MiddlewareRepository) Update(middleware *model.Middleware) error {
-	return r.db.Save(middleware).Error
+	return r.db.Omit(append(healthColumns, discoveryColumns...)...).Save(middleware).Error
 }
 
-// Delete 删除中间件
+// Delete 删除中间件及其发现的拓扑
 func (r *MiddlewareRepository) Delete(id uint) error {
-	return r.db.Delete(&model.Middleware{}, id).Error
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("parent_id = ?", id).Delete(&model.RedisNode{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&model.RedisTopology{}, "middleware_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.Middleware{}, id).Error
+	})
+}
+
+// FindChildren 查找自动发现的成员
+func (r *MiddlewareRepository) FindChildren(parentID uint) ([]model.Middleware, error) {
+	var middlewares []model.Middleware
+	err := r.db.Where("parent_id = ?", parentID).Order("id").Find(&middlewares).Error
+	return middlewares, err
+}
+
+// UpdateRole 更新自动发现的成员角色
+func (r *MiddlewareRepository) UpdateRole(id uint, role string) error {
+	return r.db.Model(&model.Middleware{}).Where("id = ?", id).Update("role", role).Error
 }
 
 func (r *MiddlewareRepository) FindByID(id uint) (*model.Middleware, error) {
@@ -51,4 +81,117 @@ func (r *MiddlewareRepository) FindByID(id uint) (*model.Middleware, error) {
 		return nil, err
 	}
 	return &middleware, nil
-} 
\ No newline at end of file
+}
+
+// UpdateHealth 只更新健康检查相关字段
+func (r *MiddlewareRepository) UpdateHealth(middleware *model.Middleware) error {
+	return r.db.Model(&model.Middleware{}).Where("id = ?", middleware.ID).
+		Select(healthColumns).
+		Updates(middleware).Error
+}
+
+// CreateStatusChange 记录健康状态变化
+func (r *MiddlewareRepository) CreateStatusChange(change *model.MiddlewareStatusChange) error {
+	return r.db.Create(change).Error
+}
+
+// FindStatusChanges 按时间顺序返回since之后的状态变化，以及since之前的最后一次变化（用于确定起始状态）
+func (r *MiddlewareRepository) FindStatusChanges(middlewareID uint, since time.Time) ([]model.MiddlewareStatusChange, error) {
+	var changes []model.MiddlewareStatusChange
+	var before model.MiddlewareStatusChange
+	err := r.db.Where("middleware_id = ? AND created_at < ?", middlewareID, since).
+		Order("created_at DESC").
+		First(&before).Error
+	if err == nil {
+		changes = append(changes, before)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var after []model.MiddlewareStatusChange
+	err = r.db.Where("middleware_id = ? AND created_at >= ?", middlewareID, since).
+		Order("created_at ASC").
+		Find(&after).Error
+	return append(changes, after...), err
+}
+
+// FindRecentStatusChanges 返回最近limit次状态变化，从新到旧
+func (r *MiddlewareRepository) FindRecentStatusChanges(middlewareID uint, limit int) ([]model.MiddlewareStatusChange, error) {
+	var changes []model.MiddlewareStatusChange
+	err := r.db.Where("middleware_id = ?", middlewareID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&changes).Error
+	return changes, err
+}
+
+// FindRedisTopology 获取拓扑概况及节点，未发现过时返回 gorm.ErrRecordNotFound
+func (r *MiddlewareRepository) FindRedisTopology(middlewareID uint) (*model.RedisTopology, error) {
+	var topology model.RedisTopology
+	if err := r.db.First(&topology, "middleware_id = ?", middlewareID).Error; err != nil {
+		return nil, err
+	}
+	err := r.db.Where("parent_id = ?", middlewareID).
+		Order("role, master_name, host, port").
+		Find(&topology.Nodes).Error
+	return &topology, err
+}
+
+// SaveRedisTopology 保存拓扑概况并替换全部节点
+func (r *MiddlewareRepository) SaveRedisTopology(topology *model.RedisTopology) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(topology).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("parent_id = ?", topology.MiddlewareID).Delete(&model.RedisNode{}).Error; err != nil {
+			return err
+		}
+		if len(topology.Nodes) == 0 {
+			return nil
+		}
+		return tx.Create(&topology.Nodes).Error
+	})
+}
+
+// CreateFailoverEvent 记录主从切换
+func (r *MiddlewareRepository) CreateFailoverEvent(event *model.RedisFailoverEvent) error {
+	return r.db.Create(event).Error
+}
+
+// FindFailoverEvents 返回最近limit次主从切换，从新到旧
+func (r *MiddlewareRepository) FindFailoverEvents(middlewareID uint, limit int) ([]model.RedisFailoverEvent, error) {
+	var events []model.RedisFailoverEvent
+	err := r.db.Where("middleware_id = ?", middlewareID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
+
+// CreateOperation 记录启停操作
+func (r *MiddlewareRepository) CreateOperation(op *model.MiddlewareOperation) error {
+	return r.db.Create(op).Error
+}
+
+// UpdateOperation 更新启停操作的执行结果
+func (r *MiddlewareRepository) UpdateOperation(op *model.MiddlewareOperation) error {
+	return r.db.Save(op).Error
+}
+
+// FinishRunningOperations 将仍为 running 的启停操作更新为指定的结束状态，返回更新的记录数
+func (r *MiddlewareRepository) FinishRunningOperations(status, message string, finishedAt time.Time) (int64, error) {
+	result := r.db.Model(&model.MiddlewareOperation{}).
+		Where("status = ?", "running").
+		Updates(map[string]interface{}{"status": status, "error": message, "finished_at": finishedAt})
+	return result.RowsAffected, result.Error
+}
+
+// FindOperations 返回最近limit次启停操作，从新到旧
+func (r *MiddlewareRepository) FindOperations(middlewareID uint, limit int) ([]model.MiddlewareOperation, error) {
+	var ops []model.MiddlewareOperation
+	err := r.db.Where("middleware_id = ?", middlewareID).
+		Order("started_at DESC").
+		Limit(limit).
+		Find(&ops).Error
+	return ops, err
+}
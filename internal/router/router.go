@@ -13,6 +13,8 @@ func InitRouter(
 	metricsService *service.MetricsService,
 	alertService *service.AlertService,
 	hostService *service.HostService,
+	certificateService *service.CertificateService,
+	deployService *service.DeployService,
 ) *gin.Engine {
 	r := gin.Default()
 
@@ -25,6 +27,13 @@ func InitRouter(
 	metricsHandler := handler.NewMetricsHandler(metricsService)
 	alertHandler := handler.NewAlertHandler(alertService)
 	hostHandler := handler.NewHostHandler(hostService)
+	certificateHandler := handler.NewCertificateHandler(certificateService)
+	deployHandler := handler.NewDeployHandler(deployService)
+
+	// Prometheus 抓取入口
+	r.GET("/metrics", metricsHandler.Prometheus)
+	// Prometheus remote_write 接收入口
+	r.POST("/api/v1/prom/write", metricsHandler.RemoteWrite)
 
 	// API 路由组
 	api := r.Group("/api/v1")
@@ -37,6 +46,10 @@ func InitRouter(
 			mw.PUT("/:id", middlewareHandler.UpdateMiddleware)
 			mw.DELETE("/:id", middlewareHandler.DeleteMiddleware)
 			mw.GET("/export", middlewareHandler.ExportMiddlewareList)
+			mw.GET("/:id/health", middlewareHandler.GetMiddlewareHealth)
+			mw.GET("/:id/availability", middlewareHandler.GetMiddlewareAvailability)
+			mw.POST("/:id/actions/:action", middlewareHandler.RunMiddlewareAction)
+			mw.GET("/:id/operations", middlewareHandler.GetMiddlewareOperations)
 		}
 
 		// 监控指标
@@ -44,6 +57,44 @@ func InitRouter(
 		{
 			metrics.GET("/status", metricsHandler.GetMetricsStatus)
 			metrics.GET("/performance", metricsHandler.GetPerformanceMetrics)
+			metrics.GET("/storage", metricsHandler.GetStorageUsage)
+			metrics.GET("/query", metricsHandler.QueryMetrics)
+			metrics.GET("/scrapes", metricsHandler.GetScrapeStatuses)
+			metrics.GET("/prometheus/query", metricsHandler.QueryPrometheus)
+			metrics.GET("/prometheus/query_range", metricsHandler.QueryPrometheusRange)
+		}
+
+		// Redis 深度检查
+		redis := api.Group("/redis")
+		{
+			redis.GET("/:id/slowlog", metricsHandler.GetRedisSlowLogs)
+			redis.POST("/:id/bigkeys", metricsHandler.ScanRedisBigKeys)
+			redis.GET("/:id/topology", metricsHandler.GetRedisTopology)
+			redis.GET("/:id/failovers", metricsHandler.GetRedisFailovers)
+		}
+
+		// ZooKeeper 集群
+		zookeeper := api.Group("/zookeeper")
+		{
+			zookeeper.GET("/:id/ensemble", metricsHandler.GetZKEnsemble)
+		}
+
+		// etcd 集群
+		etcd := api.Group("/etcd")
+		{
+			etcd.GET("/:id/cluster", metricsHandler.GetEtcdCluster)
+		}
+
+		// Consul 集群和服务目录
+		consul := api.Group("/consul")
+		{
+			consul.GET("/:id/cluster", metricsHandler.GetConsulCluster)
+		}
+
+		// Elasticsearch 集群
+		elasticsearch := api.Group("/elasticsearch")
+		{
+			elasticsearch.GET("/:id/cluster", metricsHandler.GetESCluster)
 		}
 
 		// 告警管理
@@ -54,6 +105,25 @@ func InitRouter(
 			alerts.PUT("/rules/:id", alertHandler.UpdateAlertRule)
 		}
 
+		// 证书清单
+		certificates := api.Group("/certificates")
+		{
+			certificates.GET("", certificateHandler.GetCertificates)
+			certificates.POST("/scan", certificateHandler.ScanCertificates)
+		}
+
+		// 中间件安装模板和部署任务
+		deploy := api.Group("/deploy")
+		{
+			deploy.POST("/templates", deployHandler.CreateTemplate)
+			deploy.GET("/templates", deployHandler.GetTemplates)
+			deploy.GET("/templates/:id", deployHandler.GetTemplate)
+			deploy.POST("/jobs", deployHandler.CreateDeployment)
+			deploy.GET("/jobs", deployHandler.GetDeployments)
+			deploy.GET("/jobs/:id", deployHandler.GetDeployment)
+			deploy.POST("/jobs/:id/cancel", deployHandler.CancelDeployment)
+		}
+
 		// 主机管理
 		hosts := api.Group("/hosts")
 		{
@@ -63,6 +133,27 @@ func InitRouter(
 			hosts.DELETE("/:id", hostHandler.DeleteHost)
 			hosts.POST("/sync", hostHandler.SyncFile)
 			hosts.GET("/:hostId/syncs", hostHandler.GetFileSyncs)
+			hosts.GET("/syncs/drift", hostHandler.GetDriftedSyncs)
+			hosts.GET("/syncs/:id", hostHandler.GetFileSync)
+			hosts.PUT("/syncs/:id", hostHandler.UpdateFileSync)
+			hosts.GET("/syncs/:id/history", hostHandler.GetSyncHistory)
+			hosts.GET("/syncs/:id/progress", hostHandler.StreamSyncProgress)
+			hosts.POST("/syncs/:id/pause", hostHandler.PauseSync)
+			hosts.POST("/syncs/:id/resume", hostHandler.ResumeSync)
+			hosts.POST("/syncs/:id/cancel", hostHandler.CancelSync)
+			hosts.POST("/syncs/:id/verify", hostHandler.VerifySync)
+			hosts.GET("/syncs/:id/revisions", hostHandler.GetSyncRevisions)
+			hosts.POST("/syncs/:id/rollback", hostHandler.RollbackSync)
+			hosts.POST("/distributions", hostHandler.CreateDistribution)
+			hosts.GET("/distributions", hostHandler.GetDistributions)
+			hosts.GET("/distributions/:id", hostHandler.GetDistribution)
+			hosts.POST("/distributions/:id/cancel", hostHandler.CancelDistribution)
+			hosts.POST("/collections", hostHandler.CreateFileCollection)
+			hosts.GET("/collections", hostHandler.GetFileCollections)
+			hosts.GET("/collections/diff", hostHandler.DiffCollectedFiles)
+			hosts.GET("/collections/:id", hostHandler.GetFileCollection)
+			hosts.POST("/collections/:id/collect", hostHandler.CollectFiles)
+			hosts.GET("/collections/files/:fileId/download", hostHandler.DownloadCollectedFile)
 		}
 	}
 
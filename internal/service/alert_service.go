@@ -4,14 +4,31 @@ import (
 	"context"
 	"fmt"
 	"middleware-platform/internal/model"
+	"middleware-platform/internal/prom"
 	"middleware-platform/internal/repository"
+	"middleware-platform/internal/telemetry"
 	"strconv"
 	"time"
 )
 
+var alertEvaluations = telemetry.Default.Counter("middleware_platform_alert_evaluations_total",
+	"Alert rule evaluations by result (ok, triggered, error).", "result")
+
+// 非指标类告警事件，对应告警规则的 Type
+const (
+	AlertEventFileSyncFailed = "file_sync_failed"
+	AlertEventFileSyncDrift  = "file_sync_drift"
+)
+
+// EventAlerter 非指标类事件的告警出口，target为事件对象的ID
+type EventAlerter interface {
+	RaiseEvent(eventType, target, message string) error
+}
+
 type AlertService struct {
 	alertRepo   *repository.AlertRepository
 	metricsRepo *repository.MetricsRepository
+	prometheus  *prom.Client
 }
 
 func NewAlertService(alertRepo *repository.AlertRepository, metricsRepo *repository.MetricsRepository) *AlertService {
@@ -22,13 +39,35 @@ func NewAlertService(alertRepo *repository.AlertRepository, metricsRepo *reposit
 }
 
 func (s *AlertService) CreateRule(rule *model.AlertRule) error {
+	if err := validateRuleSource(rule); err != nil {
+		return err
+	}
 	return s.alertRepo.CreateRule(rule)
 }
 
 func (s *AlertService) UpdateRule(rule *model.AlertRule) error {
+	if err := validateRuleSource(rule); err != nil {
+		return err
+	}
 	return s.alertRepo.UpdateRule(rule)
 }
 
+// validateRuleSource 未指定来源的规则使用平台采集的指标，prometheus 规则必须提供表达式
+func validateRuleSource(rule *model.AlertRule) error {
+	switch rule.Source {
+	case "":
+		rule.Source = AlertSourceBuiltin
+	case AlertSourceBuiltin:
+	case AlertSourcePrometheus:
+		if rule.Expr == "" {
+			return fmt.Errorf("expr is required for prometheus alert rules")
+		}
+	default:
+		return fmt.Errorf("unknown alert rule source %q", rule.Source)
+	}
+	return nil
+}
+
 func (s *AlertService) GetRules() ([]model.AlertRule, error) {
 	return s.alertRepo.FindAllRules()
 }
@@ -40,30 +79,64 @@ func (s *AlertService) CheckAlerts(ctx context.Context) error {
 	}
 
 	for _, rule := range rules {
+		if rule.Source == AlertSourcePrometheus {
+			if err := s.checkPrometheusRule(ctx, rule); err != nil {
+				alertEvaluations.Inc("error")
+			}
+			continue
+		}
+
 		// 获取最新指标
 		metrics, err := s.metricsRepo.FindLatestByType(rule.Type)
 		if err != nil {
+			alertEvaluations.Inc("error")
 			continue
 		}
 
 		// 检查每个指标是否触发告警
 		for _, metric := range metrics {
-			if s.shouldTriggerAlert(rule, metric) {
-				// 创建告警历史记录
-				alert := &model.AlertHistory{
-					RuleID:  rule.ID,
-					Message: fmt.Sprintf("%s exceeded threshold: %v%s (threshold: %s)",
-						rule.Type, metric.Value, metric.Unit, rule.Threshold),
-					Status: "triggered",
-				}
-				s.alertRepo.CreateHistory(alert)
+			if !s.shouldTriggerAlert(rule, metric) {
+				alertEvaluations.Inc("ok")
+				continue
+			}
+			alertEvaluations.Inc("triggered")
+
+			// 创建告警历史记录
+			alert := &model.AlertHistory{
+				RuleID:  rule.ID,
+				Message: fmt.Sprintf("%s exceeded threshold: %v%s (threshold: %s)",
+					rule.Type, metric.Value, metric.Unit, rule.Threshold),
+				Status: "triggered",
 			}
+			s.alertRepo.CreateHistory(alert)
 		}
 	}
 
 	return nil
 }
 
+// RaiseEvent 按事件类型匹配启用的告警规则（Target为事件对象ID或'*'），为每条规则记录告警
+func (s *AlertService) RaiseEvent(eventType, target, message string) error {
+	rules, err := s.alertRepo.FindEnabledRulesByType(eventType)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		if rule.Target != "*" && rule.Target != target {
+			continue
+		}
+		if err := s.alertRepo.CreateHistory(&model.AlertHistory{
+			RuleID:  rule.ID,
+			Message: message,
+			Status:  "triggered",
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *AlertService) shouldTriggerAlert(rule model.AlertRule, metric model.Metrics) bool {
 	threshold, err := strconv.ParseFloat(rule.Threshold, 64)
 	if err != nil {
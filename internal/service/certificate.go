@@ -0,0 +1,568 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"middleware-platform/internal/model"
+	"middleware-platform/internal/repository"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlertEventCertificateExpiring 证书剩余天数越过提醒天数或已经过期
+const AlertEventCertificateExpiring = "certificate_expiring"
+
+const (
+	// 同时扫描的中间件端点和主机数
+	certScanWorkers = 4
+	// 单个端点建立连接和握手的超时
+	certHandshakeTimeout = 5 * time.Second
+	// 每台主机最多读取的证书文件数
+	maxHostCertFiles = 500
+)
+
+var (
+	ErrCertScanBusy = errors.New("certificate scan is already running")
+	// errNoTLS 端点可以连接但没有出示证书
+	errNoTLS = errors.New("endpoint does not speak TLS")
+)
+
+// defaultCertAlertDays 默认在剩余 30、14、7、1 天时各提醒一次
+var defaultCertAlertDays = []int{30, 14, 7, 1}
+
+// defaultCertHostPaths 默认在主机上查找证书文件的目录
+var defaultCertHostPaths = []string{"/etc/nginx", "/etc/httpd", "/etc/pki/tls/certs", "/etc/ssl", "/etc/redis", "/etc/mysql", "/etc/kafka"}
+
+// CertificatePolicy 证书提醒天数和主机上的查找目录
+type CertificatePolicy struct {
+	AlertDays []int
+	HostPaths []string
+}
+
+// CertificateService 汇总中间件端点和主机证书文件中的证书，按过期时间提醒
+type CertificateService struct {
+	repo           *repository.CertificateRepository
+	middlewareRepo *repository.MiddlewareRepository
+	hostRepo       *repository.HostRepository
+	alerter        EventAlerter
+	alertDays      []int
+	hostPaths      []string
+
+	mu       sync.Mutex
+	scanning bool
+}
+
+func NewCertificateService(repo *repository.CertificateRepository, middlewareRepo *repository.MiddlewareRepository,
+	hostRepo *repository.HostRepository) *CertificateService {
+	return &CertificateService{
+		repo:           repo,
+		middlewareRepo: middlewareRepo,
+		hostRepo:       hostRepo,
+		alertDays:      defaultCertAlertDays,
+		hostPaths:      defaultCertHostPaths,
+	}
+}
+
+// SetAlerter 设置证书即将过期时的告警出口
+func (s *CertificateService) SetAlerter(alerter EventAlerter) {
+	s.alerter = alerter
+}
+
+// SetPolicy 设置提醒天数和主机查找目录，为空时保留默认值
+func (s *CertificateService) SetPolicy(policy CertificatePolicy) error {
+	if len(policy.AlertDays) > 0 {
+		days := append([]int(nil), policy.AlertDays...)
+		for _, d := range days {
+			if d <= 0 {
+				return fmt.Errorf("certificate alert days must be positive, got %d", d)
+			}
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(days)))
+		s.alertDays = days
+	}
+	if len(policy.HostPaths) > 0 {
+		s.hostPaths = policy.HostPaths
+	}
+	return nil
+}
+
+// GetCertificates 按过期时间排列的证书清单，expiringWithin>0 时只返回该天数内过期（含已过期）的证书
+func (s *CertificateService) GetCertificates(expiringWithin int) ([]model.Certificate, error) {
+	var before time.Time
+	if expiringWithin > 0 {
+		before = time.Now().AddDate(0, 0, expiringWithin)
+	}
+	return s.repo.FindAll(before)
+}
+
+// StartScanner 启动后立即扫描一次，之后按interval定期扫描，interval<=0 时只在手动触发时扫描
+func (s *CertificateService) StartScanner(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := s.Scan(ctx); err != nil && !errors.Is(err, ErrCertScanBusy) && ctx.Err() == nil {
+				log.Printf("Certificate scan failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Scan 扫描所有中间件端点和主机。无法连接的位置保留上一次的记录，
+// 可以连接但不再出示证书的位置以及已删除的中间件和主机的记录被清理
+func (s *CertificateService) Scan(ctx context.Context) error {
+	if !s.beginScan() {
+		return ErrCertScanBusy
+	}
+	defer s.endScan()
+	return s.scan(ctx)
+}
+
+// TriggerScan 在后台立即扫描一次，已有扫描进行中时返回 ErrCertScanBusy
+func (s *CertificateService) TriggerScan() error {
+	if !s.beginScan() {
+		return ErrCertScanBusy
+	}
+	go func() {
+		defer s.endScan()
+		if err := s.scan(context.Background()); err != nil {
+			log.Printf("Certificate scan failed: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (s *CertificateService) beginScan() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.scanning {
+		return false
+	}
+	s.scanning = true
+	return true
+}
+
+func (s *CertificateService) endScan() {
+	s.mu.Lock()
+	s.scanning = false
+	s.mu.Unlock()
+}
+
+func (s *CertificateService) scan(ctx context.Context) error {
+	middlewares, err := s.middlewareRepo.FindAll()
+	if err != nil {
+		return err
+	}
+	hosts, err := s.hostRepo.FindAll()
+	if err != nil {
+		return err
+	}
+	existing, err := s.repo.FindAll(time.Time{})
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	var keep []string
+	keepKeys := func(keys ...string) {
+		mu.Lock()
+		keep = append(keep, keys...)
+		mu.Unlock()
+	}
+	// 扫描失败时保留该位置已有的记录
+	keepExisting := func(prefix string) {
+		for _, cert := range existing {
+			if cert.Key == prefix || strings.HasPrefix(cert.Key, prefix+"/") {
+				keepKeys(cert.Key)
+			}
+		}
+	}
+
+	sem := make(chan struct{}, certScanWorkers)
+	var wg sync.WaitGroup
+	for i := range middlewares {
+		mw := &middlewares[i]
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			key := certMiddlewareKey(mw.ID)
+			chain, err := endpointCertificates(ctx, mw)
+			switch {
+			case err == nil:
+				if s.recordCertificate(key, model.CertSourceEndpoint, mw, nil, net.JoinHostPort(mw.Host, mw.Port),
+					chain[0], chain[1:], mw.Host) {
+					keepKeys(key)
+				}
+			case !errors.Is(err, errNoTLS):
+				keepExisting(key)
+			}
+		}()
+	}
+	for i := range hosts {
+		host := &hosts[i]
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			prefix := certHostPrefix(host.ID)
+			files, err := s.hostCertificates(ctx, host)
+			if err != nil {
+				log.Printf("Failed to scan certificates on host %d: %v", host.ID, err)
+				keepExisting(prefix)
+				return
+			}
+			for _, file := range files {
+				for n, leaf := range file.leaves {
+					key := prefix + "/" + file.path
+					if n > 0 {
+						key += "#" + strconv.Itoa(n+1)
+					}
+					if s.recordCertificate(key, model.CertSourceHostFile, nil, host, file.path, leaf, file.others, "") {
+						keepKeys(key)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// 中途取消时不知道哪些位置已经失效
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	removed, err := s.repo.DeleteExcept(keep)
+	if err != nil {
+		return err
+	}
+	if removed > 0 {
+		log.Printf("Removed %d certificates no longer presented", removed)
+	}
+	return nil
+}
+
+func certMiddlewareKey(id uint) string {
+	return "middleware/" + strconv.FormatUint(uint64(id), 10)
+}
+
+func certHostPrefix(id uint) string {
+	return "host/" + strconv.FormatUint(uint64(id), 10)
+}
+
+// recordCertificate 保存证书，证书更换时清除告警级别，越过新的提醒天数时告警。保存失败时返回false
+func (s *CertificateService) recordCertificate(key, source string, mw *model.Middleware, host *model.Host, location string,
+	leaf *x509.Certificate, intermediates []*x509.Certificate, dnsName string) bool {
+	record := certificateRecord(leaf, intermediates, dnsName)
+	if existing, err := s.repo.FindByKey(key); err == nil {
+		record.ID = existing.ID
+		record.CreatedAt = existing.CreatedAt
+		if existing.Fingerprint == record.Fingerprint {
+			record.AlertLevel = existing.AlertLevel
+		}
+	}
+	record.Key = key
+	record.Source = source
+	record.Location = location
+	record.LastSeenAt = time.Now()
+	if mw != nil {
+		record.MiddlewareID = &mw.ID
+	}
+	if host != nil {
+		record.HostID = &host.ID
+	}
+
+	level := certAlertLevel(record.NotAfter, time.Now(), s.alertDays)
+	if level > record.AlertLevel {
+		s.raiseExpiring(record, mw, host)
+		record.AlertLevel = level
+	}
+	if err := s.repo.Save(record); err != nil {
+		log.Printf("Failed to save certificate %s: %v", key, err)
+		return false
+	}
+	return true
+}
+
+func (s *CertificateService) raiseExpiring(cert *model.Certificate, mw *model.Middleware, host *model.Host) {
+	if s.alerter == nil {
+		return
+	}
+	owner := ""
+	switch {
+	case mw != nil:
+		owner = fmt.Sprintf("middleware %s (%s)", mw.Name, cert.Location)
+	case host != nil:
+		owner = fmt.Sprintf("host %s:%s", host.Name, cert.Location)
+	}
+	days := int(time.Until(cert.NotAfter).Hours() / 24)
+	message := fmt.Sprintf("certificate %s on %s expires in %d days (%s)",
+		cert.Subject, owner, days, cert.NotAfter.Format("2006-01-02"))
+	if days < 0 || time.Now().After(cert.NotAfter) {
+		message = fmt.Sprintf("certificate %s on %s expired on %s", cert.Subject, owner, cert.NotAfter.Format("2006-01-02"))
+	}
+	if err := s.alerter.RaiseEvent(AlertEventCertificateExpiring, cert.Key, message); err != nil {
+		log.Printf("Failed to raise certificate alert for %s: %v", cert.Key, err)
+	}
+}
+
+// certAlertLevel 剩余时间越过的提醒天数个数，已过期时再加一
+func certAlertLevel(notAfter, now time.Time, alertDays []int) int {
+	remaining := notAfter.Sub(now)
+	level := 0
+	for _, days := range alertDays {
+		if remaining <= time.Duration(days)*24*time.Hour {
+			level++
+		}
+	}
+	if remaining <= 0 {
+		level++
+	}
+	return level
+}
+
+// certificateRecord 提取证书信息，并按系统根证书校验证书链；dnsName为空时不校验主机名
+func certificateRecord(leaf *x509.Certificate, intermediates []*x509.Certificate, dnsName string) *model.Certificate {
+	sum := sha256.Sum256(leaf.Raw)
+	record := &model.Certificate{
+		Subject:      leaf.Subject.String(),
+		Issuer:       leaf.Issuer.String(),
+		SerialNumber: leaf.SerialNumber.Text(16),
+		Fingerprint:  hex.EncodeToString(sum[:]),
+		NotBefore:    leaf.NotBefore,
+		NotAfter:     leaf.NotAfter,
+		SelfSigned:   bytes.Equal(leaf.RawSubject, leaf.RawIssuer) && leaf.CheckSignatureFrom(leaf) == nil,
+	}
+	record.SANs = append(record.SANs, leaf.DNSNames...)
+	for _, ip := range leaf.IPAddresses {
+		record.SANs = append(record.SANs, ip.String())
+	}
+
+	pool := x509.NewCertPool()
+	for _, cert := range intermediates {
+		pool.AddCert(cert)
+	}
+	opts := x509.VerifyOptions{DNSName: dnsName, Intermediates: pool}
+	if _, err := leaf.Verify(opts); err != nil {
+		record.VerifyError = err.Error()
+	}
+	return record
+}
+
+// endpointCertificates 与中间件端点握手并返回出示的证书链。MySQL 和 PostgreSQL 先按各自协议请求切换到 TLS，
+// 其他类型直接进行 TLS 握手。连接失败时返回连接错误，可以连接但握手失败时返回 errNoTLS
+func endpointCertificates(ctx context.Context, mw *model.Middleware) ([]*x509.Certificate, error) {
+	ctx, cancel := context.WithTimeout(ctx, certHandshakeTimeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(mw.Host, mw.Port))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	switch strings.ToLower(mw.Type) {
+	case "mysql":
+		err = mysqlStartTLS(conn)
+	case "postgresql":
+		err = pgStartTLS(conn)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var opts struct {
+		ServerName string `json:"server_name"`
+	}
+	decodeOptions(mw, &opts)
+	if opts.ServerName == "" && net.ParseIP(mw.Host) == nil {
+		opts.ServerName = mw.Host
+	}
+	// 只记录证书，是否受信任由 certificateRecord 单独校验
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: opts.ServerName, InsecureSkipVerify: true})
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("%w: %v", errNoTLS, err)
+	}
+	certs := tlsConn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return nil, errNoTLS
+	}
+	return certs, nil
+}
+
+const (
+	mysqlClientLongPassword   = 0x00000001
+	mysqlClientProtocol41     = 0x00000200
+	mysqlClientSSL            = 0x00000800
+	mysqlClientSecureConn     = 0x00008000
+	mysqlMaxPacketSize        = 1 << 24
+	mysqlCharsetUTF8MB4       = 45
+	pgSSLRequestCode          = 80877103
+	mysqlSSLRequestPacketSize = 32
+)
+
+// mysqlStartTLS 读取服务端握手包，服务端支持 SSL 时发送 SSLRequest，之后的数据走 TLS
+func mysqlStartTLS(conn net.Conn) error {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return fmt.Errorf("%w: %v", errNoTLS, err)
+	}
+	size := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return fmt.Errorf("%w: %v", errNoTLS, err)
+	}
+	if len(payload) == 0 || payload[0] == 0xff {
+		return fmt.Errorf("%w: mysql refused connection", errNoTLS)
+	}
+
+	// 协议版本、以0结尾的服务端版本、连接ID(4)、挑战数据(8)、填充(1)、能力标志低16位
+	end := bytes.IndexByte(payload[1:], 0)
+	offset := 1 + end + 1 + 4 + 8 + 1
+	if end < 0 || len(payload) < offset+2 {
+		return fmt.Errorf("%w: invalid mysql handshake", errNoTLS)
+	}
+	if binary.LittleEndian.Uint16(payload[offset:])&mysqlClientSSL == 0 {
+		return fmt.Errorf("%w: mysql server does not support SSL", errNoTLS)
+	}
+
+	packet := make([]byte, 4+mysqlSSLRequestPacketSize)
+	packet[0] = mysqlSSLRequestPacketSize
+	packet[3] = header[3] + 1
+	binary.LittleEndian.PutUint32(packet[4:],
+		mysqlClientLongPassword|mysqlClientProtocol41|mysqlClientSSL|mysqlClientSecureConn)
+	binary.LittleEndian.PutUint32(packet[8:], mysqlMaxPacketSize)
+	packet[12] = mysqlCharsetUTF8MB4
+	_, err := conn.Write(packet)
+	return err
+}
+
+// pgStartTLS 发送 SSLRequest，服务端回复 S 时切换到 TLS
+func pgStartTLS(conn net.Conn) error {
+	request := make([]byte, 8)
+	binary.BigEndian.PutUint32(request, 8)
+	binary.BigEndian.PutUint32(request[4:], pgSSLRequestCode)
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+	reply := make([]byte, 1)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("%w: %v", errNoTLS, err)
+	}
+	if reply[0] != 'S' {
+		return fmt.Errorf("%w: postgresql server does not support SSL", errNoTLS)
+	}
+	return nil
+}
+
+// hostCertFile 主机上的一个证书文件：叶子证书和同一文件中的其他证书（中间证书）
+type hostCertFile struct {
+	path   string
+	leaves []*x509.Certificate
+	others []*x509.Certificate
+}
+
+// hostCertificates 通过 SSH 在查找目录中读取 .pem/.crt/.cer 文件并解析其中的证书
+func (s *CertificateService) hostCertificates(ctx context.Context, host *model.Host) ([]hostCertFile, error) {
+	client, err := newSSHClient(host)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+	defer closeOnCancel(ctx, client)()
+
+	out, err := runRemoteCommand(client, hostCertCommand(s.hostPaths))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(out))
+	}
+	return parseHostCertFiles(out), nil
+}
+
+// hostCertFileMarker 远程输出中每个文件内容之前的分隔行
+const hostCertFileMarker = "==> "
+
+func hostCertCommand(paths []string) string {
+	quoted := make([]string, len(paths))
+	for i, p := range paths {
+		quoted[i] = shellQuote(p)
+	}
+	// 目录不存在或没有权限时 find 返回非零，不视为失败
+	return fmt.Sprintf(`find %s -maxdepth 5 -type f \( -name '*.pem' -o -name '*.crt' -o -name '*.cer' \) -size -256k 2>/dev/null `+
+		`| head -n %d | while IFS= read -r f; do echo "%s$f"; cat "$f" 2>/dev/null; echo; done; true`,
+		strings.Join(quoted, " "), maxHostCertFiles, hostCertFileMarker)
+}
+
+// parseHostCertFiles 解析远程输出中的 PEM 证书，CA 证书（如系统证书包）不计入清单
+func parseHostCertFiles(out string) []hostCertFile {
+	var files []hostCertFile
+	var path string
+	var content strings.Builder
+	flush := func() {
+		if path == "" {
+			return
+		}
+		file := hostCertFile{path: path}
+		rest := []byte(content.String())
+		for {
+			var block *pem.Block
+			block, rest = pem.Decode(rest)
+			if block == nil {
+				break
+			}
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				continue
+			}
+			if cert.IsCA {
+				file.others = append(file.others, cert)
+			} else {
+				file.leaves = append(file.leaves, cert)
+			}
+		}
+		if len(file.leaves) > 0 {
+			files = append(files, file)
+		}
+		content.Reset()
+	}
+
+	for _, line := range strings.SplitAfter(out, "\n") {
+		if strings.HasPrefix(line, hostCertFileMarker) {
+			flush()
+			path = strings.TrimSpace(strings.TrimPrefix(line, hostCertFileMarker))
+			continue
+		}
+		content.WriteString(line)
+	}
+	flush()
+	return files
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"middleware-platform/internal/model"
+	"middleware-platform/internal/telemetry"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/go-zookeeper/zk"
+)
+
+const (
+	defaultMaxClients = 64
+	// 连续失败达到该次数后关闭客户端，下次使用时重新建立连接
+	maxClientErrors = 3
+	// 每个客户端内部的连接数上限
+	clientPoolSize = 2
+)
+
+var (
+	ErrClientPoolClosed = errors.New("client pool is closed")
+
+	clientEvictions = telemetry.Default.Counter("middleware_platform_client_evictions_total",
+		"Pooled middleware clients closed by reason (config_changed, errors, capacity, shutdown).", "reason")
+)
+
+// 缓存的客户端种类，同一中间件的不同种类分别缓存
+const (
+	clientRedis = "redis"
+	clientSQL   = "sql"
+	clientZK    = "zookeeper"
+)
+
+// ClientPool 在采集周期和健康检查之间复用中间件客户端。
+// 客户端按中间件ID和种类缓存，连接配置（地址、凭据）变化或连续出错时关闭重建，
+// 总数超过上限时关闭最久未使用的客户端。被移除时仍在使用的客户端在最后一个使用方归还后关闭。
+type ClientPool struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string]*list.Element
+	lru     *list.List // 最近使用的在前
+	closed  bool
+}
+
+type pooledClient struct {
+	key         string
+	fingerprint string
+	client      io.Closer
+	errors      int
+	lastUsed    time.Time
+	refs        int  // 正在使用的调用方数
+	evicted     bool // 已从缓存中移除，refs 归零时关闭
+}
+
+// NewClientPool max<=0 时使用默认上限
+func NewClientPool(max int) *ClientPool {
+	if max <= 0 {
+		max = defaultMaxClients
+	}
+	return &ClientPool{
+		max:     max,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+}
+
+func clientKey(mw *model.Middleware, kind string) string {
+	return kind + "/" + strconv.FormatUint(uint64(mw.ID), 10)
+}
+
+// clientFingerprint 连接配置（含连接选项）的摘要，凭据不以明文保存在键中
+func clientFingerprint(mw *model.Middleware) string {
+	sum := sha256.Sum256([]byte(strings.Join([]string{mw.Type, mw.Host, mw.Port, mw.Credentials, string(mw.Options)}, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// get 返回缓存的客户端，不存在或连接配置已变化时调用open新建。
+// 使用完后必须调用返回的release，之前客户端不会被关闭
+func (p *ClientPool) get(mw *model.Middleware, kind string, open func() (io.Closer, error)) (io.Closer, func(), error) {
+	key := clientKey(mw, kind)
+	fingerprint := clientFingerprint(mw)
+
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return nil, nil, ErrClientPoolClosed
+	}
+	if el, ok := p.entries[key]; ok {
+		entry := el.Value.(*pooledClient)
+		if entry.fingerprint == fingerprint {
+			entry.lastUsed = time.Now()
+			p.lru.MoveToFront(el)
+			release := p.acquireLocked(entry)
+			p.mu.Unlock()
+			return entry.client, release, nil
+		}
+		p.removeLocked(el, "config_changed")
+	}
+	p.mu.Unlock()
+
+	// 建立连接可能较慢，不持有锁
+	client, err := open()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		client.Close()
+		return nil, nil, ErrClientPoolClosed
+	}
+	if el, ok := p.entries[key]; ok {
+		// 并发创建时保留先放入的
+		entry := el.Value.(*pooledClient)
+		if entry.fingerprint == fingerprint {
+			client.Close()
+			p.lru.MoveToFront(el)
+			return entry.client, p.acquireLocked(entry), nil
+		}
+		p.removeLocked(el, "config_changed")
+	}
+	entry := &pooledClient{key: key, fingerprint: fingerprint, client: client, lastUsed: time.Now()}
+	release := p.acquireLocked(entry)
+	p.entries[key] = p.lru.PushFront(entry)
+	for p.lru.Len() > p.max {
+		p.removeLocked(p.lru.Back(), "capacity")
+	}
+	return client, release, nil
+}
+
+// acquireLocked 增加客户端的使用计数，返回的release可以重复调用
+func (p *ClientPool) acquireLocked(entry *pooledClient) func() {
+	entry.refs++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			entry.refs--
+			if entry.evicted && entry.refs == 0 {
+				closeClient(entry)
+			}
+		})
+	}
+}
+
+// report 记录一次使用结果，连续出错达到上限时关闭客户端
+func (p *ClientPool) report(mw *model.Middleware, kind string, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	el, ok := p.entries[clientKey(mw, kind)]
+	if !ok {
+		return
+	}
+	entry := el.Value.(*pooledClient)
+	if err == nil {
+		entry.errors = 0
+		return
+	}
+	entry.errors++
+	if entry.errors >= maxClientErrors {
+		p.removeLocked(el, "errors")
+	}
+}
+
+// Evict 关闭某个中间件的所有客户端，用于中间件被修改或删除时
+func (p *ClientPool) Evict(middlewareID uint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	suffix := "/" + strconv.FormatUint(uint64(middlewareID), 10)
+	for key, el := range p.entries {
+		if strings.HasSuffix(key, suffix) {
+			p.removeLocked(el, "config_changed")
+		}
+	}
+}
+
+// Len 当前缓存的客户端数
+func (p *ClientPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.lru.Len()
+}
+
+// Close 关闭所有客户端，之后的获取都返回 ErrClientPoolClosed
+func (p *ClientPool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	for p.lru.Len() > 0 {
+		p.removeLocked(p.lru.Back(), "shutdown")
+	}
+}
+
+// removeLocked 从缓存中移除客户端，没有使用方时立即关闭，否则由最后一个使用方归还时关闭
+func (p *ClientPool) removeLocked(el *list.Element, reason string) {
+	entry := el.Value.(*pooledClient)
+	p.lru.Remove(el)
+	delete(p.entries, entry.key)
+	clientEvictions.Inc(reason)
+	entry.evicted = true
+	if entry.refs == 0 {
+		closeClient(entry)
+	}
+}
+
+// closeClient 关闭可能阻塞（如等待 ZooKeeper 会话结束），放到后台
+func closeClient(entry *pooledClient) {
+	go func() {
+		if err := entry.client.Close(); err != nil {
+			log.Printf("Failed to close client %s: %v", entry.key, err)
+		}
+	}()
+}
+
+// redisClient 获取中间件的 Redis 客户端，使用完后调用release
+func (p *ClientPool) redisClient(mw *model.Middleware) (*redis.Client, func(), error) {
+	client, release, err := p.get(mw, clientRedis, func() (io.Closer, error) {
+		return redis.NewClient(&redis.Options{
+			Addr:     fmt.Sprintf("%s:%s", mw.Host, mw.Port),
+			Password: mw.Credentials,
+			DB:       0,
+			PoolSize: clientPoolSize,
+		}), nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return client.(*redis.Client), release, nil
+}
+
+// sqlDB 获取中间件的数据库连接池，postgresql 使用 lib/pq，mysql 需要注册 mysql 驱动
+func (p *ClientPool) sqlDB(mw *model.Middleware) (*sql.DB, func(), error) {
+	client, release, err := p.get(mw, clientSQL, func() (io.Closer, error) {
+		driver, dsn := sqlDSN(mw)
+		db, err := sql.Open(driver, dsn)
+		if err != nil {
+			return nil, err
+		}
+		db.SetMaxOpenConns(clientPoolSize)
+		db.SetMaxIdleConns(1)
+		db.SetConnMaxIdleTime(5 * time.Minute)
+		return db, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return client.(*sql.DB), release, nil
+}
+
+func sqlDSN(mw *model.Middleware) (driver, dsn string) {
+	if strings.EqualFold(mw.Type, "postgresql") {
+		return "postgres", fmt.Sprintf("host=%s port=%s user=postgres password=%s sslmode=disable connect_timeout=5",
+			mw.Host, mw.Port, mw.Credentials)
+	}
+	return "mysql", fmt.Sprintf("%s:%s@tcp(%s:%s)/", "user", mw.Credentials, mw.Host, mw.Port)
+}
+
+// zkConn 获取中间件的 ZooKeeper 连接，使用完后调用release
+func (p *ClientPool) zkConn(mw *model.Middleware) (*zk.Conn, func(), error) {
+	client, release, err := p.get(mw, clientZK, func() (io.Closer, error) {
+		conn, _, err := zk.Connect([]string{fmt.Sprintf("%s:%s", mw.Host, mw.Port)}, 5*time.Second,
+			zk.WithLogInfo(false))
+		if err != nil {
+			return nil, err
+		}
+		return zkCloser{conn}, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return client.(zkCloser).Conn, release, nil
+}
+
+// zkCloser zk.Conn 的 Close 没有返回值
+type zkCloser struct {
+	*zk.Conn
+}
+
+func (c zkCloser) Close() error {
+	c.Conn.Close()
+	return nil
+}
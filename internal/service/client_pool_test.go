@@ -0,0 +1,147 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"middleware-platform/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeClient struct {
+	closed int32
+}
+
+func (c *fakeClient) Close() error {
+	atomic.StoreInt32(&c.closed, 1)
+	return nil
+}
+
+func (c *fakeClient) isClosed() bool {
+	return atomic.LoadInt32(&c.closed) == 1
+}
+
+func openFake(opened *[]*fakeClient) func() (io.Closer, error) {
+	return func() (io.Closer, error) {
+		c := &fakeClient{}
+		*opened = append(*opened, c)
+		return c, nil
+	}
+}
+
+func waitClosed(t *testing.T, c *fakeClient) {
+	assert.Eventually(t, c.isClosed, time.Second, 5*time.Millisecond)
+}
+
+// getFake 获取客户端并立即归还
+func getFake(pool *ClientPool, mw *model.Middleware, kind string, opened *[]*fakeClient) (io.Closer, error) {
+	client, release, err := pool.get(mw, kind, openFake(opened))
+	if err != nil {
+		return nil, err
+	}
+	release()
+	return client, nil
+}
+
+func TestClientPool_ReuseAndConfigChange(t *testing.T) {
+	pool := NewClientPool(10)
+	var opened []*fakeClient
+	mw := &model.Middleware{ID: 1, Type: "redis", Host: "10.0.0.1", Port: "6379", Credentials: "a"}
+
+	first, err := getFake(pool, mw, clientRedis, &opened)
+	assert.NoError(t, err)
+	second, err := getFake(pool, mw, clientRedis, &opened)
+	assert.NoError(t, err)
+	assert.Same(t, first, second)
+	assert.Len(t, opened, 1)
+
+	// 种类不同分别缓存
+	_, err = getFake(pool, mw, clientSQL, &opened)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, pool.Len())
+
+	// 凭据变化后重建
+	changed := *mw
+	changed.Credentials = "b"
+	third, err := getFake(pool, &changed, clientRedis, &opened)
+	assert.NoError(t, err)
+	assert.NotSame(t, first, third)
+	waitClosed(t, opened[0])
+}
+
+func TestClientPool_EvictOnErrors(t *testing.T) {
+	pool := NewClientPool(10)
+	var opened []*fakeClient
+	mw := &model.Middleware{ID: 1}
+
+	getFake(pool, mw, clientRedis, &opened)
+	boom := errors.New("boom")
+	pool.report(mw, clientRedis, boom)
+	pool.report(mw, clientRedis, nil) // 成功后重新计数
+	pool.report(mw, clientRedis, boom)
+	pool.report(mw, clientRedis, boom)
+	assert.Equal(t, 1, pool.Len())
+
+	pool.report(mw, clientRedis, boom)
+	assert.Equal(t, 0, pool.Len())
+	waitClosed(t, opened[0])
+}
+
+func TestClientPool_CapacityAndClose(t *testing.T) {
+	pool := NewClientPool(2)
+	var opened []*fakeClient
+	mws := []*model.Middleware{{ID: 1}, {ID: 2}, {ID: 3}}
+
+	getFake(pool, mws[0], clientRedis, &opened)
+	getFake(pool, mws[1], clientRedis, &opened)
+	getFake(pool, mws[0], clientRedis, &opened) // 1 变为最近使用
+	getFake(pool, mws[2], clientRedis, &opened)
+
+	assert.Equal(t, 2, pool.Len())
+	waitClosed(t, opened[1])
+	assert.False(t, opened[0].isClosed())
+
+	pool.Evict(1)
+	assert.Equal(t, 1, pool.Len())
+	waitClosed(t, opened[0])
+
+	pool.Close()
+	waitClosed(t, opened[2])
+	_, err := getFake(pool, mws[0], clientRedis, &opened)
+	assert.ErrorIs(t, err, ErrClientPoolClosed)
+}
+
+func TestClientPool_EvictedClientClosedAfterRelease(t *testing.T) {
+	pool := NewClientPool(1)
+	var opened []*fakeClient
+	mws := []*model.Middleware{{ID: 1}, {ID: 2}}
+
+	// 两个使用方同时持有同一个客户端
+	_, releaseA, err := pool.get(mws[0], clientRedis, openFake(&opened))
+	assert.NoError(t, err)
+	_, releaseB, err := pool.get(mws[0], clientRedis, openFake(&opened))
+	assert.NoError(t, err)
+
+	pool.Evict(1)
+	assert.Equal(t, 0, pool.Len())
+	releaseA()
+	releaseA() // 重复归还不影响计数
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, opened[0].isClosed(), "client still in use must not be closed")
+	releaseB()
+	waitClosed(t, opened[0])
+
+	// 超过容量被挤出的客户端同样等到归还后关闭
+	_, release, err := pool.get(mws[0], clientRedis, openFake(&opened))
+	assert.NoError(t, err)
+	getFake(pool, mws[1], clientRedis, &opened)
+	assert.Equal(t, 1, pool.Len())
+	time.Sleep(20 * time.Millisecond)
+	assert.False(t, opened[1].isClosed())
+	release()
+	waitClosed(t, opened[1])
+}
@@ -0,0 +1,376 @@
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"middleware-platform/internal/model"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+const (
+	defaultCollectionDir       = "data/collections"
+	defaultCollectionRetention = 10
+	// 超过该大小的版本不做文本对比
+	maxDiffSize = 1 << 20
+)
+
+var ErrCollectionBusy = errors.New("file collection is already running")
+
+// SetCollectionStorage 设置收集结果在平台上的存储目录
+func (s *HostService) SetCollectionStorage(dir string) {
+	if dir != "" {
+		s.storageDir = dir
+	}
+}
+
+// CreateFileCollection 创建拉取任务并在后台立即收集一次
+func (s *HostService) CreateFileCollection(collection *model.FileCollection) error {
+	if _, err := s.repo.FindByID(collection.HostID); err != nil {
+		return fmt.Errorf("host %d not found: %v", collection.HostID, err)
+	}
+	if collection.SourcePath == "" {
+		return fmt.Errorf("sourcePath is required")
+	}
+	if collection.Retention < 0 {
+		return fmt.Errorf("retention must not be negative")
+	}
+	if collection.Retention == 0 {
+		collection.Retention = defaultCollectionRetention
+	}
+
+	collection.Status = "pending"
+	if err := s.repo.CreateFileCollection(collection); err != nil {
+		return err
+	}
+
+	go s.runCollection(collection.ID)
+	return nil
+}
+
+// CollectFiles 重新收集一次，内容与最新版本相同时不产生新版本
+func (s *HostService) CollectFiles(id uint) error {
+	collection, err := s.repo.FindFileCollectionByID(id)
+	if err != nil {
+		return err
+	}
+	if collection.Status == "pending" || collection.Status == "collecting" {
+		return ErrCollectionBusy
+	}
+
+	collection.Status = "pending"
+	collection.Message = ""
+	if err := s.repo.UpdateFileCollection(collection); err != nil {
+		return err
+	}
+
+	go s.runCollection(id)
+	return nil
+}
+
+// GetFileCollection 获取收集任务及其版本
+func (s *HostService) GetFileCollection(id uint) (*model.FileCollection, error) {
+	return s.repo.FindFileCollectionByID(id)
+}
+
+// GetFileCollections 获取收集任务，hostID为0时返回全部
+func (s *HostService) GetFileCollections(hostID uint) ([]model.FileCollection, error) {
+	return s.repo.FindFileCollections(hostID)
+}
+
+// GetCollectedFile 获取收集到的版本，用于下载
+func (s *HostService) GetCollectedFile(id uint) (*model.CollectedFile, error) {
+	return s.repo.FindCollectedFileByID(id)
+}
+
+// resumeCollections 重启后继续执行未完成的收集任务
+func (s *HostService) resumeCollections() {
+	collections, err := s.repo.FindFileCollectionsByStatus("pending", "collecting")
+	if err != nil {
+		log.Printf("Failed to load unfinished file collections: %v", err)
+		return
+	}
+	for _, collection := range collections {
+		go s.runCollection(collection.ID)
+	}
+}
+
+func (s *HostService) runCollection(id uint) {
+	ctx, ok := s.collections.start(id)
+	if !ok {
+		return
+	}
+	defer s.collections.done(id)
+
+	collection, err := s.repo.FindFileCollectionByID(id)
+	if err != nil {
+		log.Printf("Failed to load file collection %d: %v", id, err)
+		return
+	}
+
+	collection.Status = "collecting"
+	if err := s.repo.UpdateFileCollection(collection); err != nil {
+		log.Printf("Failed to update file collection %d: %v", id, err)
+	}
+
+	file, changed, err := s.collect(ctx, collection)
+	if s.collections.stopping() {
+		return
+	}
+
+	now := time.Now()
+	switch {
+	case err != nil:
+		collection.Status = "failed"
+		collection.Message = err.Error()
+	case changed:
+		collection.Status = "completed"
+		collection.Message = fmt.Sprintf("collected version %d", file.Version)
+		collection.LastCollectedAt = &now
+	default:
+		collection.Status = "completed"
+		collection.Message = fmt.Sprintf("unchanged since version %d", file.Version)
+		collection.LastCollectedAt = &now
+	}
+	if err := s.repo.UpdateFileCollection(collection); err != nil {
+		log.Printf("Failed to update file collection %d: %v", id, err)
+	}
+}
+
+// collect 下载远程文件（目录打包为 tar.gz）到存储目录，内容变化时保存为新版本并清理超出保留数量的旧版本
+func (s *HostService) collect(ctx context.Context, collection *model.FileCollection) (*model.CollectedFile, bool, error) {
+	client, err := newSSHClient(&collection.Host)
+	if err != nil {
+		return nil, false, err
+	}
+	defer client.Close()
+	defer closeOnCancel(ctx, client)()
+
+	kind, err := remotePathKind(client, collection.SourcePath)
+	if err != nil {
+		return nil, false, err
+	}
+	if kind == "missing" {
+		return nil, false, fmt.Errorf("%s does not exist on host", collection.SourcePath)
+	}
+	collection.IsDirectory = kind == "dir"
+
+	dir := filepath.Join(s.storageDir, strconv.FormatUint(uint64(collection.ID), 10))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, false, err
+	}
+	tmp, err := os.CreateTemp(dir, ".collect-*")
+	if err != nil {
+		return nil, false, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	counter := &countingWriter{}
+	out := s.throttleWriter(ctx, io.MultiWriter(tmp, hash, counter))
+	err = remoteDownload(client, collection.SourcePath, collection.IsDirectory, out)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("download failed: %v", err)
+	}
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	files, err := s.repo.FindCollectedFiles(collection.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	version := 1
+	if len(files) > 0 {
+		if files[0].SHA256 == sum {
+			return &files[0], false, nil
+		}
+		version = files[0].Version + 1
+	}
+
+	name := collectedFileName(collection.SourcePath, collection.IsDirectory)
+	storagePath := filepath.Join(dir, fmt.Sprintf("v%d-%s", version, name))
+	if err := os.Rename(tmp.Name(), storagePath); err != nil {
+		return nil, false, err
+	}
+
+	file := &model.CollectedFile{
+		CollectionID: collection.ID,
+		HostID:       collection.HostID,
+		Version:      version,
+		FileName:     name,
+		StoragePath:  storagePath,
+		IsArchive:    collection.IsDirectory,
+		SHA256:       sum,
+		Size:         counter.n,
+	}
+	if err := s.repo.CreateCollectedFile(file); err != nil {
+		os.Remove(storagePath)
+		return nil, false, err
+	}
+
+	s.pruneCollectedFiles(collection, append([]model.CollectedFile{*file}, files...))
+	return file, true, nil
+}
+
+// pruneCollectedFiles 删除超出保留数量的旧版本，files按版本从新到旧排列
+func (s *HostService) pruneCollectedFiles(collection *model.FileCollection, files []model.CollectedFile) {
+	retention := collection.Retention
+	if retention <= 0 {
+		retention = defaultCollectionRetention
+	}
+	if len(files) <= retention {
+		return
+	}
+
+	var ids []uint
+	for _, file := range files[retention:] {
+		if err := os.Remove(file.StoragePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove collected file %s: %v", file.StoragePath, err)
+			continue
+		}
+		ids = append(ids, file.ID)
+	}
+	if err := s.repo.DeleteCollectedFiles(ids); err != nil {
+		log.Printf("Failed to delete collected files of collection %d: %v", collection.ID, err)
+	}
+}
+
+// collectedFileName 版本文件名：源文件名，目录加 .tar.gz 后缀
+func collectedFileName(sourcePath string, isDir bool) string {
+	name := filepath.Base(filepath.Clean(sourcePath))
+	if name == "/" || name == "." {
+		name = "root"
+	}
+	if isDir {
+		name += ".tar.gz"
+	}
+	return name
+}
+
+// DiffCollectedFiles 对比两个收集版本，可以是同一任务的不同时间，也可以是不同主机上的同一文件。
+// 目录版本对比文件清单（路径、大小、SHA-256），文件版本输出 unified diff。
+func (s *HostService) DiffCollectedFiles(fromID, toID uint) (string, error) {
+	from, err := s.repo.FindCollectedFileByID(fromID)
+	if err != nil {
+		return "", fmt.Errorf("collected file %d not found: %v", fromID, err)
+	}
+	to, err := s.repo.FindCollectedFileByID(toID)
+	if err != nil {
+		return "", fmt.Errorf("collected file %d not found: %v", toID, err)
+	}
+	return diffCollectedFiles(from, to)
+}
+
+func diffCollectedFiles(from, to *model.CollectedFile) (string, error) {
+	if from.IsArchive != to.IsArchive {
+		return "", fmt.Errorf("cannot diff a directory archive against a single file")
+	}
+	if from.SHA256 == to.SHA256 {
+		return "", nil
+	}
+
+	a, err := diffableContent(from)
+	if err != nil {
+		return "", err
+	}
+	b, err := diffableContent(to)
+	if err != nil {
+		return "", err
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(a),
+		B:        difflib.SplitLines(b),
+		FromFile: collectedFileLabel(from),
+		ToFile:   collectedFileLabel(to),
+		Context:  3,
+	})
+}
+
+func collectedFileLabel(file *model.CollectedFile) string {
+	return fmt.Sprintf("host-%d/v%d/%s", file.HostID, file.Version, file.FileName)
+}
+
+// diffableContent 读取用于对比的文本：目录为文件清单，文件为原始内容
+func diffableContent(file *model.CollectedFile) (string, error) {
+	if file.IsArchive {
+		return archiveManifest(file.StoragePath)
+	}
+	if file.Size > maxDiffSize {
+		return "", fmt.Errorf("%s is too large to diff (%d bytes)", file.FileName, file.Size)
+	}
+	data, err := os.ReadFile(file.StoragePath)
+	if err != nil {
+		return "", err
+	}
+	if bytes.IndexByte(data, 0) >= 0 {
+		return "", fmt.Errorf("%s is a binary file, compare sha256 instead", file.FileName)
+	}
+	return string(data), nil
+}
+
+// archiveManifest 列出 tar.gz 中每个条目的路径、大小和SHA-256，按路径排序
+func archiveManifest(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return "", err
+	}
+	defer gz.Close()
+
+	var lines []string
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		name := strings.TrimPrefix(header.Name, "./")
+		switch header.Typeflag {
+		case tar.TypeReg:
+			hash := sha256.New()
+			if _, err := io.Copy(hash, tr); err != nil {
+				return "", err
+			}
+			lines = append(lines, fmt.Sprintf("%s\t%d\t%s", name, header.Size, hex.EncodeToString(hash.Sum(nil))))
+		case tar.TypeSymlink:
+			lines = append(lines, fmt.Sprintf("%s\t-> %s", name, header.Linkname))
+		}
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// countingWriter 统计写入的字节数
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
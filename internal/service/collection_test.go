@@ -0,0 +1,83 @@
+package service
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"middleware-platform/internal/model"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeArchive(t *testing.T, path string, files map[string]string) {
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	defer gz.Close()
+	tw := tar.NewWriter(gz)
+	defer tw.Close()
+
+	assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "./", Typeflag: tar.TypeDir, Mode: 0755}))
+	for name, content := range files {
+		assert.NoError(t, tw.WriteHeader(&tar.Header{Name: "./" + name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		assert.NoError(t, err)
+	}
+}
+
+func TestArchiveManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conf.tar.gz")
+	writeArchive(t, path, map[string]string{"b.conf": "b", "a.conf": "a"})
+
+	manifest, err := archiveManifest(path)
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(manifest), "\n")
+	assert.Len(t, lines, 2)
+	assert.True(t, strings.HasPrefix(lines[0], "a.conf\t1\t"))
+	assert.True(t, strings.HasPrefix(lines[1], "b.conf\t1\t"))
+}
+
+func TestDiffCollectedFiles(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+
+	from := &model.CollectedFile{HostID: 1, Version: 1, FileName: "redis.conf", SHA256: "a", Size: 20,
+		StoragePath: write("v1", "port 6379\nmaxmemory 1gb\n")}
+	to := &model.CollectedFile{HostID: 2, Version: 3, FileName: "redis.conf", SHA256: "b", Size: 20,
+		StoragePath: write("v3", "port 6379\nmaxmemory 2gb\n")}
+
+	diff, err := diffCollectedFiles(from, to)
+	assert.NoError(t, err)
+	assert.Contains(t, diff, "--- host-1/v1/redis.conf")
+	assert.Contains(t, diff, "+++ host-2/v3/redis.conf")
+	assert.Contains(t, diff, "-maxmemory 1gb")
+	assert.Contains(t, diff, "+maxmemory 2gb")
+
+	// 校验和相同视为无差异
+	to.SHA256 = from.SHA256
+	diff, err = diffCollectedFiles(from, to)
+	assert.NoError(t, err)
+	assert.Empty(t, diff)
+
+	binary := &model.CollectedFile{FileName: "core", SHA256: "c", Size: 3, StoragePath: write("core", "\x00\x01\x02")}
+	_, err = diffCollectedFiles(from, binary)
+	assert.Error(t, err)
+
+	archive := &model.CollectedFile{IsArchive: true, SHA256: "d"}
+	_, err = diffCollectedFiles(from, archive)
+	assert.Error(t, err)
+}
+
+func TestCollectedFileName(t *testing.T) {
+	assert.Equal(t, "redis.conf", collectedFileName("/etc/redis/redis.conf", false))
+	assert.Equal(t, "logs.tar.gz", collectedFileName("/var/log/app/logs/", true))
+	assert.Equal(t, "root.tar.gz", collectedFileName("/", true))
+}
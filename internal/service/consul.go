@@ -0,0 +1,400 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"middleware-platform/internal/model"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AlertEventConsulLeaderChanged Consul 集群的 raft leader 发生变化
+const AlertEventConsulLeaderChanged = "consul_leader_changed"
+
+var (
+	// ErrConsulNoLeader agent 可以访问但集群没有 leader，与无法连接区分
+	ErrConsulNoLeader  = errors.New("consul cluster has no leader")
+	ErrNoConsulCluster = errors.New("no consul cluster checked for this middleware")
+)
+
+// consulOptions Consul 在 Middleware.Options 中的选项
+type consulOptions struct {
+	endpointOptions
+	// 需要导入为中间件实例的服务：服务名 -> 中间件类型，类型为空时根据服务名和标签推断
+	ImportServices map[string]string `json:"import_services"`
+}
+
+// consulImportTypes 可以从服务名或标签推断出的中间件类型
+var consulImportTypes = []string{"redis", "mysql", "postgresql", "zookeeper", "etcd"}
+
+// consulAutopilotHealth GET /v1/operator/autopilot/health 的响应
+type consulAutopilotHealth struct {
+	Healthy          bool `json:"Healthy"`
+	FailureTolerance int  `json:"FailureTolerance"`
+	Servers          []struct {
+		ID          string `json:"ID"`
+		Name        string `json:"Name"`
+		Address     string `json:"Address"`
+		SerfStatus  string `json:"SerfStatus"`
+		Version     string `json:"Version"`
+		Leader      bool   `json:"Leader"`
+		Voter       bool   `json:"Voter"`
+		Healthy     bool   `json:"Healthy"`
+		LastContact string `json:"LastContact"`
+	} `json:"Servers"`
+}
+
+// consulCheck GET /v1/health/state/any 中的一个健康检查
+type consulCheck struct {
+	Node        string `json:"Node"`
+	CheckID     string `json:"CheckID"`
+	Status      string `json:"Status"` // passing, warning, critical
+	ServiceID   string `json:"ServiceID"`
+	ServiceName string `json:"ServiceName"`
+}
+
+// consulCatalogService GET /v1/catalog/service/<name> 中的一个服务实例
+type consulCatalogService struct {
+	Node           string   `json:"Node"`
+	Address        string   `json:"Address"`
+	ServiceID      string   `json:"ServiceID"`
+	ServiceAddress string   `json:"ServiceAddress"`
+	ServicePort    int      `json:"ServicePort"`
+	ServiceTags    []string `json:"ServiceTags"`
+}
+
+// ConsulServer Consul 服务端节点
+type ConsulServer struct {
+	Name        string `json:"name"`
+	Address     string `json:"address"`
+	Version     string `json:"version"`
+	Leader      bool   `json:"leader"`
+	Voter       bool   `json:"voter"`
+	Healthy     bool   `json:"healthy"`
+	SerfStatus  string `json:"serf_status"`
+	LastContact string `json:"last_contact"`
+}
+
+// ConsulService 服务目录中的服务及其健康检查汇总
+type ConsulService struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+	// 有健康检查的实例数
+	Instances int    `json:"instances"`
+	Passing   int    `json:"passing"`
+	Warning   int    `json:"warning"`
+	Critical  int    `json:"critical"`
+	Status    string `json:"status"` // 最差的检查状态，没有检查时为空
+	// 导入为中间件实例时的类型和实例ID
+	ImportType    string `json:"import_type,omitempty"`
+	MiddlewareIDs []uint `json:"middleware_ids,omitempty"`
+}
+
+// ConsulCluster Consul 集群最近一次检查的状态
+type ConsulCluster struct {
+	MiddlewareID     uint            `json:"middleware_id"`
+	Leader           string          `json:"leader"`
+	Peers            []string        `json:"peers"`
+	AutopilotHealthy *bool           `json:"autopilot_healthy,omitempty"` // 没有 operator:read 权限时为空
+	FailureTolerance int             `json:"failure_tolerance"`
+	Servers          []ConsulServer  `json:"servers"`
+	Services         []ConsulService `json:"services"`
+	NodeChecks       map[string]int  `json:"node_checks"` // 节点级检查按状态计数
+	CheckedAt        time.Time       `json:"checked_at"`
+}
+
+// GetConsulCluster 获取最近一次检查的 raft 状态和服务目录
+func (s *MetricsService) GetConsulCluster(middlewareID uint) (*ConsulCluster, error) {
+	cluster, _ := s.clusters.get(middlewareID).(*ConsulCluster)
+	if cluster == nil {
+		return nil, ErrNoConsulCluster
+	}
+	return cluster, nil
+}
+
+func (s *MetricsService) collectConsulMetrics(ctx context.Context, mw model.Middleware) ([]model.Metrics, error) {
+	var opts consulOptions
+	if err := decodeOptions(&mw, &opts); err != nil {
+		return nil, err
+	}
+	endpoint, release, err := s.clients.httpEndpoint(&mw)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var leader string
+	err = endpoint.getJSON(ctx, "/v1/status/leader", &leader)
+	s.clients.report(&mw, clientHTTP, err)
+	if err != nil {
+		return nil, err
+	}
+	cluster := &ConsulCluster{MiddlewareID: mw.ID, Leader: leader, CheckedAt: time.Now()}
+	if err := endpoint.getJSON(ctx, "/v1/status/peers", &cluster.Peers); err != nil {
+		return nil, err
+	}
+
+	// autopilot 需要 operator:read 权限，失败不影响其他指标
+	if autopilot, err := consulAutopilot(ctx, endpoint); err != nil {
+		log.Printf("Failed to get consul autopilot health of middleware %d: %v", mw.ID, err)
+	} else {
+		applyAutopilot(cluster, autopilot)
+	}
+
+	var catalog map[string][]string
+	if err := endpoint.getJSON(ctx, "/v1/catalog/services", &catalog); err != nil {
+		return nil, err
+	}
+	var checks []consulCheck
+	if err := endpoint.getJSON(ctx, "/v1/health/state/any", &checks); err != nil {
+		return nil, err
+	}
+	cluster.Services, cluster.NodeChecks = consulServices(catalog, checks)
+
+	// 服务只从用户添加的实例导入
+	if mw.ParentID == nil && len(opts.ImportServices) > 0 {
+		if err := s.importConsulServices(ctx, endpoint, &mw, cluster, opts.ImportServices); err != nil {
+			log.Printf("Failed to import consul services of middleware %d: %v", mw.ID, err)
+		}
+	}
+
+	previous, _ := s.clusters.get(mw.ID).(*ConsulCluster)
+	if previous != nil && previous.Leader != "" && cluster.Leader != "" && previous.Leader != cluster.Leader {
+		s.raiseEvent(AlertEventConsulLeaderChanged, mw.ID, fmt.Sprintf("consul cluster %s leader changed from %s to %s",
+			mw.Name, previous.Leader, cluster.Leader))
+	}
+	s.clusters.set(mw.ID, cluster)
+	return consulMetrics(cluster, checks), nil
+}
+
+// consulAutopilot 集群不健康时接口返回 429，响应内容仍是健康状态
+func consulAutopilot(ctx context.Context, endpoint *httpEndpoint) (*consulAutopilotHealth, error) {
+	data, code, err := endpoint.do(ctx, http.MethodGet, "/v1/operator/autopilot/health", nil)
+	if err != nil && code != http.StatusTooManyRequests {
+		return nil, err
+	}
+	var health consulAutopilotHealth
+	if err := json.Unmarshal(data, &health); err != nil {
+		return nil, fmt.Errorf("invalid autopilot health response: %v", err)
+	}
+	return &health, nil
+}
+
+func applyAutopilot(cluster *ConsulCluster, health *consulAutopilotHealth) {
+	healthy := health.Healthy
+	cluster.AutopilotHealthy = &healthy
+	cluster.FailureTolerance = health.FailureTolerance
+	for _, server := range health.Servers {
+		cluster.Servers = append(cluster.Servers, ConsulServer{
+			Name:        server.Name,
+			Address:     server.Address,
+			Version:     server.Version,
+			Leader:      server.Leader,
+			Voter:       server.Voter,
+			Healthy:     server.Healthy,
+			SerfStatus:  server.SerfStatus,
+			LastContact: server.LastContact,
+		})
+	}
+}
+
+// consulServices 按服务汇总健康检查，没有关联服务的检查按节点级检查计数。服务按名称排序
+func consulServices(catalog map[string][]string, checks []consulCheck) ([]ConsulService, map[string]int) {
+	byName := make(map[string]*ConsulService, len(catalog))
+	for name, tags := range catalog {
+		byName[name] = &ConsulService{Name: name, Tags: tags}
+	}
+
+	nodeChecks := make(map[string]int)
+	instances := make(map[string]map[string]bool)
+	for _, check := range checks {
+		if check.ServiceName == "" {
+			nodeChecks[check.Status]++
+			continue
+		}
+		service := byName[check.ServiceName]
+		if service == nil {
+			service = &ConsulService{Name: check.ServiceName}
+			byName[check.ServiceName] = service
+		}
+		switch check.Status {
+		case "passing":
+			service.Passing++
+		case "warning":
+			service.Warning++
+		case "critical":
+			service.Critical++
+		}
+		if consulStatusRank(check.Status) > consulStatusRank(service.Status) {
+			service.Status = check.Status
+		}
+		if instances[check.ServiceName] == nil {
+			instances[check.ServiceName] = make(map[string]bool)
+		}
+		instances[check.ServiceName][check.Node+"/"+check.ServiceID] = true
+	}
+
+	services := make([]ConsulService, 0, len(byName))
+	for name, service := range byName {
+		service.Instances = len(instances[name])
+		services = append(services, *service)
+	}
+	sort.Slice(services, func(i, j int) bool { return services[i].Name < services[j].Name })
+	return services, nodeChecks
+}
+
+func consulStatusRank(status string) int {
+	switch status {
+	case "passing":
+		return 1
+	case "warning":
+		return 2
+	case "critical":
+		return 3
+	}
+	return 0
+}
+
+// consulServiceType 导入服务的中间件类型：配置的类型优先，否则在服务名和标签中查找已知类型
+func consulServiceType(configured, name string, tags []string) string {
+	if configured != "" {
+		return strings.ToLower(configured)
+	}
+	for _, candidate := range append([]string{name}, tags...) {
+		candidate = strings.ToLower(candidate)
+		for _, mwType := range consulImportTypes {
+			if strings.Contains(candidate, mwType) {
+				return mwType
+			}
+		}
+	}
+	return ""
+}
+
+// importConsulServices 将配置的服务的实例同步为子中间件，服务地址为空时使用节点地址
+func (s *MetricsService) importConsulServices(ctx context.Context, endpoint *httpEndpoint, mw *model.Middleware,
+	cluster *ConsulCluster, imports map[string]string) error {
+	var members []discoveredMember
+	memberServices := make(map[string][]int)
+	for i := range cluster.Services {
+		service := &cluster.Services[i]
+		configured, ok := imports[service.Name]
+		if !ok {
+			continue
+		}
+		mwType := consulServiceType(configured, service.Name, service.Tags)
+		if mwType == "" {
+			log.Printf("Cannot infer middleware type of consul service %s, set it in import_services", service.Name)
+			continue
+		}
+		service.ImportType = mwType
+
+		var instances []consulCatalogService
+		if err := endpoint.getJSON(ctx, "/v1/catalog/service/"+url.PathEscape(service.Name), &instances); err != nil {
+			return err
+		}
+		for _, instance := range instances {
+			host := instance.ServiceAddress
+			if host == "" {
+				host = instance.Address
+			}
+			if host == "" || instance.ServicePort == 0 {
+				continue
+			}
+			port := strconv.Itoa(instance.ServicePort)
+			members = append(members, discoveredMember{
+				Host: host,
+				Port: port,
+				Type: mwType,
+				Name: fmt.Sprintf("%s/%s/%s", mw.Name, service.Name, memberAddr(host, port)),
+			})
+			addr := memberAddr(host, port)
+			memberServices[addr] = append(memberServices[addr], i)
+		}
+	}
+
+	ids, err := s.syncMembers(mw, members)
+	if err != nil {
+		return err
+	}
+	for addr, indexes := range memberServices {
+		for _, i := range indexes {
+			if id, ok := ids[addr]; ok {
+				cluster.Services[i].MiddlewareIDs = append(cluster.Services[i].MiddlewareIDs, id)
+			}
+		}
+	}
+	return nil
+}
+
+// consulMetrics 集群和服务目录的汇总指标
+func consulMetrics(cluster *ConsulCluster, checks []consulCheck) []model.Metrics {
+	var metrics []model.Metrics
+	add := func(name string, value float64) {
+		metrics = append(metrics, model.Metrics{
+			MiddlewareID: cluster.MiddlewareID,
+			Type:         name,
+			Value:        value,
+			Timestamp:    cluster.CheckedAt,
+		})
+	}
+
+	add("consul_has_leader", boolValue(cluster.Leader != ""))
+	add("consul_peers", float64(len(cluster.Peers)))
+	if cluster.AutopilotHealthy != nil {
+		add("consul_autopilot_healthy", boolValue(*cluster.AutopilotHealthy))
+		add("consul_failure_tolerance", float64(cluster.FailureTolerance))
+	}
+
+	var critical, warning int
+	for _, service := range cluster.Services {
+		switch service.Status {
+		case "critical":
+			critical++
+		case "warning":
+			warning++
+		}
+	}
+	add("consul_services", float64(len(cluster.Services)))
+	add("consul_services_critical", float64(critical))
+	add("consul_services_warning", float64(warning))
+
+	counts := make(map[string]int)
+	for _, check := range checks {
+		counts[check.Status]++
+	}
+	add("consul_checks_passing", float64(counts["passing"]))
+	add("consul_checks_warning", float64(counts["warning"]))
+	add("consul_checks_critical", float64(counts["critical"]))
+	return metrics
+}
+
+// checkConsulHealth 通过 /v1/status/leader 检查 agent，区分无法连接和集群没有 leader
+func (s *MiddlewareService) checkConsulHealth(m *model.Middleware) error {
+	endpoint, release, err := s.clients.httpEndpoint(m)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	var leader string
+	err = endpoint.getJSON(ctx, "/v1/status/leader", &leader)
+	s.clients.report(m, clientHTTP, err)
+	if err != nil {
+		return fmt.Errorf("consul unreachable: %v", err)
+	}
+	if leader == "" {
+		return ErrConsulNoLeader
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"middleware-platform/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeConsul 返回固定内容的 Consul agent stand-in，leader 为 /v1/status/leader 的响应
+func fakeConsul(t *testing.T, leader string) *model.Middleware {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("X-Consul-Token"))
+		switch r.URL.Path {
+		case "/v1/status/leader":
+			io.WriteString(w, leader)
+		case "/v1/status/peers":
+			io.WriteString(w, `["10.0.0.1:8300","10.0.0.2:8300","10.0.0.3:8300"]`)
+		case "/v1/operator/autopilot/health":
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, `{"Healthy":false,"FailureTolerance":0,"Servers":[
+				{"Name":"s1","Address":"10.0.0.1:8300","Leader":true,"Voter":true,"Healthy":true,"SerfStatus":"alive"},
+				{"Name":"s2","Address":"10.0.0.2:8300","Voter":true,"Healthy":false,"SerfStatus":"failed"}]}`)
+		case "/v1/catalog/services":
+			io.WriteString(w, `{"consul":[],"redis-cache":["primary"],"web":["v1"]}`)
+		case "/v1/health/state/any":
+			io.WriteString(w, `[
+				{"Node":"n1","CheckID":"serfHealth","Status":"passing"},
+				{"Node":"n1","CheckID":"c1","Status":"passing","ServiceID":"redis-1","ServiceName":"redis-cache"},
+				{"Node":"n2","CheckID":"c2","Status":"critical","ServiceID":"redis-2","ServiceName":"redis-cache"},
+				{"Node":"n2","CheckID":"c3","Status":"warning","ServiceID":"web-1","ServiceName":"web"},
+				{"Node":"n2","CheckID":"c4","Status":"passing","ServiceID":"web-1","ServiceName":"web"}]`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	parentID := uint(1)
+	return &model.Middleware{ID: 2, Type: "consul", Host: host, Port: port, Credentials: "secret", ParentID: &parentID}
+}
+
+func TestCollectConsulMetrics(t *testing.T) {
+	mw := fakeConsul(t, `"10.0.0.1:8300"`)
+	s := &MetricsService{clients: NewClientPool(0)}
+
+	metrics, err := s.collectConsulMetrics(context.Background(), *mw)
+	assert.NoError(t, err)
+	values := metricValues(metrics)
+	assert.Equal(t, 1.0, values["consul_has_leader"])
+	assert.Equal(t, 3.0, values["consul_peers"])
+	assert.Equal(t, 0.0, values["consul_autopilot_healthy"])
+	assert.Equal(t, 3.0, values["consul_services"])
+	assert.Equal(t, 1.0, values["consul_services_critical"])
+	assert.Equal(t, 1.0, values["consul_services_warning"])
+	assert.Equal(t, 3.0, values["consul_checks_passing"])
+	assert.Equal(t, 1.0, values["consul_checks_critical"])
+
+	cluster, err := s.GetConsulCluster(mw.ID)
+	if !assert.NoError(t, err) || !assert.Len(t, cluster.Services, 3) {
+		return
+	}
+	redis := cluster.Services[1]
+	assert.Equal(t, "redis-cache", redis.Name)
+	assert.Equal(t, 2, redis.Instances)
+	assert.Equal(t, "critical", redis.Status)
+	assert.Equal(t, "warning", cluster.Services[2].Status)
+	assert.Equal(t, "", cluster.Services[0].Status)
+	assert.Equal(t, map[string]int{"passing": 1}, cluster.NodeChecks)
+	assert.Len(t, cluster.Servers, 2)
+}
+
+func TestCheckConsulHealth(t *testing.T) {
+	s := &MiddlewareService{clients: NewClientPool(0)}
+
+	assert.NoError(t, s.checkConsulHealth(fakeConsul(t, `"10.0.0.1:8300"`)))
+	assert.ErrorIs(t, s.checkConsulHealth(fakeConsul(t, `""`)), ErrConsulNoLeader)
+
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+	err := s.checkConsulHealth(&model.Middleware{ID: 3, Type: "consul", Host: host, Port: port})
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrConsulNoLeader)
+}
+
+func TestConsulServiceType(t *testing.T) {
+	assert.Equal(t, "mysql", consulServiceType("MySQL", "orders-db", nil))
+	assert.Equal(t, "redis", consulServiceType("", "redis-cache", nil))
+	assert.Equal(t, "postgresql", consulServiceType("", "orders-db", []string{"primary", "postgresql"}))
+	assert.Equal(t, "", consulServiceType("", "web", []string{"v1"}))
+}
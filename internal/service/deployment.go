@@ -0,0 +1,713 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"middleware-platform/internal/model"
+	"middleware-platform/internal/repository"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// 单个步骤的执行超时，软件包安装和下载可能较慢
+	deployStepTimeout = 10 * time.Minute
+	// 回滚全部步骤的超时
+	deployRollbackTimeout = 5 * time.Minute
+	// 部署列表返回的最近任务数
+	recentDeployments = 100
+	// 没有健康检查的类型验证时单次连接端口的超时
+	deployPortCheckTimeout = 5 * time.Second
+)
+
+// 部署状态
+const (
+	DeployPending    = "pending"
+	DeployRunning    = "running"
+	DeploySuccess    = "success"
+	DeployRolledBack = "rolled_back" // 部署失败或被取消，已回滚
+	DeployFailed     = "failed"      // 部署失败且回滚未完成，需要人工清理
+)
+
+// 部署步骤
+const (
+	stepPrecheck = "precheck"
+	stepInstall  = "install"
+	stepConfig   = "config"
+	stepUnit     = "unit"
+	stepStart    = "start"
+	stepRegister = "register"
+	stepVerify   = "verify"
+)
+
+var (
+	ErrInvalidTemplate   = errors.New("invalid deploy template")
+	ErrTemplateExists    = errors.New("deploy template version already exists")
+	ErrInvalidDeployment = errors.New("invalid deployment")
+	ErrHostDeploying     = errors.New("another deployment is running on this host")
+)
+
+var deployParamName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// DeployService 按安装模板在主机上部署中间件，成功后注册为监控对象
+type DeployService struct {
+	repo        *repository.DeployRepository
+	hostRepo    *repository.HostRepository
+	middlewares *MiddlewareService
+	jobs        runningJobs
+
+	mu    sync.Mutex
+	hosts map[uint]bool // 执行或回滚部署中的主机
+}
+
+func NewDeployService(repo *repository.DeployRepository, hostRepo *repository.HostRepository,
+	middlewares *MiddlewareService) *DeployService {
+	return &DeployService{
+		repo:        repo,
+		hostRepo:    hostRepo,
+		middlewares: middlewares,
+		jobs:        runningJobs{cancels: make(map[uint]context.CancelFunc)},
+		hosts:       make(map[uint]bool),
+	}
+}
+
+// Start 绑定后台任务的生命周期，并回滚上次停止时未完成的部署
+func (s *DeployService) Start(ctx context.Context) {
+	s.jobs.mu.Lock()
+	s.jobs.ctx = ctx
+	s.jobs.mu.Unlock()
+	s.recoverDeployments()
+}
+
+// CreateTemplate 创建安装模板，同名同版本的模板已存在时返回 ErrTemplateExists
+func (s *DeployService) CreateTemplate(tmpl *model.DeployTemplate) error {
+	tmpl.InstallMethod = strings.ToLower(tmpl.InstallMethod)
+	if err := validateTemplate(tmpl); err != nil {
+		return err
+	}
+	count, err := s.repo.CountTemplates(tmpl.Name, tmpl.Version)
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: %s %s", ErrTemplateExists, tmpl.Name, tmpl.Version)
+	}
+	return s.repo.CreateTemplate(tmpl)
+}
+
+// GetTemplates 获取安装模板，name不为空时只返回该名称的各版本
+func (s *DeployService) GetTemplates(name string) ([]model.DeployTemplate, error) {
+	return s.repo.FindTemplates(name)
+}
+
+func (s *DeployService) GetTemplate(id uint) (*model.DeployTemplate, error) {
+	return s.repo.FindTemplateByID(id)
+}
+
+// GetDeployments 获取最近的部署任务
+func (s *DeployService) GetDeployments() ([]model.Deployment, error) {
+	return s.repo.FindDeployments(recentDeployments)
+}
+
+// GetDeployment 获取部署任务及各步骤的日志
+func (s *DeployService) GetDeployment(id uint) (*model.Deployment, error) {
+	return s.repo.FindDeploymentByID(id)
+}
+
+// CancelDeployment 取消执行中的部署，正在执行的步骤被中断，已执行的步骤回滚
+func (s *DeployService) CancelDeployment(id uint) error {
+	if !s.jobs.cancel(id) {
+		return fmt.Errorf("deployment %d is not running", id)
+	}
+	return nil
+}
+
+// deployPlan 执行部署所需的模板、主机和渲染后的 unit 名称
+type deployPlan struct {
+	deployment *model.Deployment
+	tmpl       *model.DeployTemplate
+	host       *model.Host
+	unit       string
+	middleware *model.Middleware // register 步骤注册的中间件
+}
+
+// CreateDeployment 校验参数并渲染模板，生成步骤后在后台执行；同一主机同时只执行一个部署
+func (s *DeployService) CreateDeployment(deployment *model.Deployment) error {
+	deployment.Name = strings.TrimSpace(deployment.Name)
+	if deployment.Name == "" {
+		return fmt.Errorf("%w: name is required", ErrInvalidDeployment)
+	}
+	tmpl, err := s.repo.FindTemplateByID(deployment.TemplateID)
+	if err != nil {
+		return fmt.Errorf("%w: template %d not found: %v", ErrInvalidDeployment, deployment.TemplateID, err)
+	}
+	host, err := s.hostRepo.FindByID(deployment.HostID)
+	if err != nil {
+		return fmt.Errorf("%w: host %d not found: %v", ErrInvalidDeployment, deployment.HostID, err)
+	}
+	params, err := resolveDeployParams(tmpl, deployment.Params)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDeployment, err)
+	}
+	rendered, err := renderDeployTemplate(tmpl, deployData{
+		Name:    deployment.Name,
+		Version: tmpl.Version,
+		Host:    host.IP,
+		Params:  params,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDeployment, err)
+	}
+
+	deployment.Params = params
+	deployment.TemplateName = tmpl.Name
+	deployment.TemplateVersion = tmpl.Version
+	deployment.Status = DeployPending
+	deployment.Message = ""
+	deployment.MiddlewareID = nil
+	deployment.StartedAt = nil
+	deployment.FinishedAt = nil
+	deployment.Steps = buildDeploySteps(tmpl, rendered, params["port"], deployment.Sudo, time.Now())
+
+	if !s.acquireHost(host.ID) {
+		return ErrHostDeploying
+	}
+	if err := s.repo.CreateDeployment(deployment); err != nil {
+		s.releaseHost(host.ID)
+		return err
+	}
+
+	// 后台任务使用副本，返回给调用方的记录不会被并发修改
+	run := *deployment
+	run.Steps = append([]model.DeploymentStep(nil), deployment.Steps...)
+	go s.runDeployment(&deployPlan{deployment: &run, tmpl: tmpl, host: host, unit: rendered.Unit})
+	return nil
+}
+
+func (s *DeployService) acquireHost(hostID uint) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hosts[hostID] {
+		return false
+	}
+	s.hosts[hostID] = true
+	return true
+}
+
+func (s *DeployService) releaseHost(hostID uint) {
+	s.mu.Lock()
+	delete(s.hosts, hostID)
+	s.mu.Unlock()
+}
+
+// validateTemplate 校验模板必填字段、参数定义和各字段的模板语法
+func validateTemplate(tmpl *model.DeployTemplate) error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrInvalidTemplate, fmt.Sprintf(format, args...))
+	}
+	if tmpl.Name == "" || tmpl.Version == "" || tmpl.MiddlewareType == "" || tmpl.UnitName == "" {
+		return invalid("name, version, middleware_type and unit_name are required")
+	}
+	switch tmpl.InstallMethod {
+	case model.InstallPackage:
+		if tmpl.Package == "" {
+			return invalid("package is required for package install")
+		}
+	case model.InstallTarball:
+		if tmpl.TarballURL == "" || tmpl.InstallDir == "" {
+			return invalid("tarball_url and install_dir are required for tarball install")
+		}
+	default:
+		return invalid("unsupported install_method %q", tmpl.InstallMethod)
+	}
+	if tmpl.ConfigTemplate != "" && tmpl.ConfigPath == "" {
+		return invalid("config_path is required with config_template")
+	}
+
+	seen := make(map[string]bool)
+	for _, p := range tmpl.Parameters {
+		if !deployParamName.MatchString(p.Name) {
+			return invalid("invalid parameter name %q", p.Name)
+		}
+		if seen[p.Name] {
+			return invalid("duplicate parameter %q", p.Name)
+		}
+		seen[p.Name] = true
+	}
+	if !seen["port"] {
+		return invalid("parameter port is required to register the middleware")
+	}
+
+	for _, field := range deployTemplateFields(tmpl) {
+		if _, err := template.New(field.name).Parse(field.text); err != nil {
+			return invalid("%s: %v", field.name, err)
+		}
+	}
+	return nil
+}
+
+type deployTemplateField struct {
+	name string
+	text string
+}
+
+func deployTemplateFields(tmpl *model.DeployTemplate) []deployTemplateField {
+	return []deployTemplateField{
+		{"package", tmpl.Package},
+		{"tarball_url", tmpl.TarballURL},
+		{"install_dir", tmpl.InstallDir},
+		{"config_path", tmpl.ConfigPath},
+		{"config_template", tmpl.ConfigTemplate},
+		{"unit_name", tmpl.UnitName},
+		{"unit_template", tmpl.UnitTemplate},
+	}
+}
+
+// resolveDeployParams 按模板的参数定义补齐默认值，拒绝未定义的参数和缺少的必需参数
+func resolveDeployParams(tmpl *model.DeployTemplate, params map[string]string) (map[string]string, error) {
+	defined := make(map[string]bool, len(tmpl.Parameters))
+	resolved := make(map[string]string, len(tmpl.Parameters))
+	for _, p := range tmpl.Parameters {
+		defined[p.Name] = true
+		value, ok := params[p.Name]
+		if !ok || value == "" {
+			value = p.Default
+		}
+		if value == "" && p.Required {
+			return nil, fmt.Errorf("parameter %s is required", p.Name)
+		}
+		resolved[p.Name] = value
+	}
+	for name := range params {
+		if !defined[name] {
+			return nil, fmt.Errorf("unknown parameter %s", name)
+		}
+	}
+	if port, err := strconv.Atoi(resolved["port"]); err != nil || port < 1 || port > 65535 {
+		return nil, fmt.Errorf("invalid port %q", resolved["port"])
+	}
+	return resolved, nil
+}
+
+// deployData 渲染模板时可以引用的数据
+type deployData struct {
+	Name    string
+	Version string
+	Host    string
+	Params  map[string]string
+}
+
+// renderedTemplate 渲染后的模板字段
+type renderedTemplate struct {
+	Package    string
+	TarballURL string
+	InstallDir string
+	ConfigPath string
+	Config     string
+	Unit       string // 带 .service 等后缀的 unit 名称
+	UnitFile   string
+}
+
+func renderDeployTemplate(tmpl *model.DeployTemplate, data deployData) (renderedTemplate, error) {
+	values := make(map[string]string)
+	for _, field := range deployTemplateFields(tmpl) {
+		t, err := template.New(field.name).Option("missingkey=error").Parse(field.text)
+		if err != nil {
+			return renderedTemplate{}, fmt.Errorf("%s: %v", field.name, err)
+		}
+		var b strings.Builder
+		if err := t.Execute(&b, data); err != nil {
+			return renderedTemplate{}, fmt.Errorf("%s: %v", field.name, err)
+		}
+		values[field.name] = b.String()
+	}
+
+	r := renderedTemplate{
+		Package:    strings.TrimSpace(values["package"]),
+		TarballURL: strings.TrimSpace(values["tarball_url"]),
+		InstallDir: strings.TrimSpace(values["install_dir"]),
+		ConfigPath: strings.TrimSpace(values["config_path"]),
+		Config:     values["config_template"],
+		Unit:       strings.TrimSpace(values["unit_name"]),
+		UnitFile:   values["unit_template"],
+	}
+	if r.Unit == "" || strings.Contains(r.Unit, "/") {
+		return r, fmt.Errorf("invalid unit name %q", r.Unit)
+	}
+	if !strings.Contains(r.Unit, ".") {
+		r.Unit += ".service"
+	}
+	// 回滚时会删除安装目录
+	if tmpl.InstallMethod == model.InstallTarball && (!path.IsAbs(r.InstallDir) || path.Clean(r.InstallDir) == "/") {
+		return r, fmt.Errorf("install_dir must be an absolute path other than /, got %q", r.InstallDir)
+	}
+	if r.Config != "" && !path.IsAbs(r.ConfigPath) {
+		return r, fmt.Errorf("config_path must be an absolute path, got %q", r.ConfigPath)
+	}
+	return r, nil
+}
+
+// packageName 去掉 apt 风格的版本号（name=version），用于检查和卸载
+func packageName(pkg string) string {
+	if i := strings.Index(pkg, "="); i > 0 {
+		return pkg[:i]
+	}
+	return pkg
+}
+
+// writeFileScript 通过 base64 写入文件内容，避免内容中的特殊字符被 shell 解释
+func writeFileScript(target, content string) string {
+	return "echo " + base64.StdEncoding.EncodeToString([]byte(content)) + " | base64 -d > " + target
+}
+
+// buildDeploySteps 生成部署步骤。每个会修改主机的步骤都带有回滚命令，
+// 配置文件已存在时先备份，回滚时恢复
+func buildDeploySteps(tmpl *model.DeployTemplate, r renderedTemplate, port string, sudo bool, now time.Time) []model.DeploymentStep {
+	wrap := func(script string) string {
+		if sudo && script != "" {
+			return "sudo -n sh -c " + shellQuote(script)
+		}
+		return script
+	}
+	var steps []model.DeploymentStep
+	add := func(name, script, command, rollback string) {
+		if command == "" {
+			command = wrap(script)
+		}
+		steps = append(steps, model.DeploymentStep{
+			Seq:             len(steps) + 1,
+			Name:            name,
+			Script:          wrap(script),
+			Command:         command,
+			RollbackCommand: wrap(rollback),
+			Status:          "pending",
+		})
+	}
+	unit := shellQuote(r.Unit)
+
+	// 操作前检查：unit 不存在、端口空闲，回滚不会删除原有的软件包或目录
+	checks := []string{
+		"command -v systemctl >/dev/null 2>&1 || { echo 'systemctl not found'; exit 1; }",
+		fmt.Sprintf("if systemctl cat %s >/dev/null 2>&1; then echo %s; exit 1; fi", unit, shellQuote("unit "+r.Unit+" already exists")),
+		fmt.Sprintf("if (ss -ltnH 2>/dev/null || netstat -ltn 2>/dev/null) | awk '{print $4}' | grep -Eq '[:.]%s$'; then echo %s; exit 1; fi",
+			port, shellQuote("port "+port+" is already in use")),
+	}
+	var install, rollback string
+	switch tmpl.InstallMethod {
+	case model.InstallPackage:
+		pkg, name := shellQuote(r.Package), shellQuote(packageName(r.Package))
+		checks = append(checks, fmt.Sprintf("if dpkg -s %s >/dev/null 2>&1 || rpm -q %s >/dev/null 2>&1; then echo %s; exit 1; fi",
+			name, name, shellQuote("package "+packageName(r.Package)+" is already installed")))
+		install = "if command -v apt-get >/dev/null 2>&1; then DEBIAN_FRONTEND=noninteractive apt-get install -y " + pkg +
+			"; elif command -v dnf >/dev/null 2>&1; then dnf install -y " + pkg + "; else yum install -y " + pkg + "; fi"
+		rollback = "if command -v apt-get >/dev/null 2>&1; then DEBIAN_FRONTEND=noninteractive apt-get purge -y " + name +
+			"; elif command -v dnf >/dev/null 2>&1; then dnf remove -y " + name + "; else yum remove -y " + name + "; fi"
+	case model.InstallTarball:
+		dir := shellQuote(r.InstallDir)
+		checks = append(checks,
+			fmt.Sprintf("if [ -n \"$(ls -A %s 2>/dev/null)\" ]; then echo %s; exit 1; fi", dir, shellQuote("install dir "+r.InstallDir+" is not empty")),
+			"command -v curl >/dev/null 2>&1 || { echo 'curl not found'; exit 1; }")
+		install = fmt.Sprintf("mkdir -p %s && curl -fsSL %s | tar -xz -C %s --strip-components=1", dir, shellQuote(r.TarballURL), dir)
+		rollback = "rm -rf " + dir
+	}
+	add(stepPrecheck, strings.Join(checks, "\n"), "", "")
+	add(stepInstall, install, "", rollback)
+
+	if r.Config != "" {
+		backup := `"$f"` + shellQuote(".bak-deploy-"+now.Format("20060102150405"))
+		script := fmt.Sprintf(`f=%s; mkdir -p "$(dirname "$f")" && if [ -e "$f" ]; then cp -p "$f" %s; fi && %s`,
+			shellQuote(r.ConfigPath), backup, writeFileScript(`"$f"`, r.Config))
+		add(stepConfig, script,
+			fmt.Sprintf("write %s (%d bytes)", r.ConfigPath, len(r.Config)),
+			fmt.Sprintf(`f=%s; if [ -e %s ]; then mv -f %s "$f"; else rm -f "$f"; fi`, shellQuote(r.ConfigPath), backup, backup))
+	}
+	if r.UnitFile != "" {
+		unitPath := "/etc/systemd/system/" + r.Unit
+		add(stepUnit, writeFileScript(shellQuote(unitPath), r.UnitFile)+" && systemctl daemon-reload",
+			fmt.Sprintf("write %s (%d bytes) && systemctl daemon-reload", unitPath, len(r.UnitFile)),
+			"rm -f "+shellQuote(unitPath)+" && systemctl daemon-reload")
+	}
+	// 软件包安装后可能已经以默认配置启动，使用 restart 加载新配置
+	add(stepStart, fmt.Sprintf("systemctl enable %s && systemctl restart %s", unit, unit), "",
+		"systemctl disable --now "+unit)
+	// 以下步骤在平台上执行，不经过 SSH
+	for _, step := range []model.DeploymentStep{
+		{Name: stepRegister, Command: "register " + tmpl.MiddlewareType + " middleware for monitoring",
+			RollbackCommand: "delete registered middleware"},
+		{Name: stepVerify, Command: "wait for health check to pass"},
+	} {
+		step.Seq = len(steps) + 1
+		step.Status = "pending"
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// runDeployment 依次执行各步骤，失败或取消时回滚；服务停止时保持 running，重启后回滚
+func (s *DeployService) runDeployment(plan *deployPlan) {
+	deployment := plan.deployment
+	defer s.releaseHost(plan.host.ID)
+	ctx, ok := s.jobs.start(deployment.ID)
+	if !ok {
+		return
+	}
+	defer s.jobs.done(deployment.ID)
+
+	now := time.Now()
+	deployment.Status = DeployRunning
+	deployment.StartedAt = &now
+	if err := s.repo.UpdateDeployment(deployment); err != nil {
+		log.Printf("Failed to update deployment %d: %v", deployment.ID, err)
+	}
+
+	err := s.executeSteps(ctx, plan)
+	if s.jobs.stopping() {
+		return
+	}
+	if err == nil {
+		s.finishDeployment(deployment, DeploySuccess,
+			fmt.Sprintf("deployed %s %s, registered as middleware %d", plan.tmpl.Name, plan.tmpl.Version, *deployment.MiddlewareID))
+		return
+	}
+	reason := err.Error()
+	if ctx.Err() != nil {
+		reason = "cancelled by user"
+	}
+	s.rollback(deployment, plan.host, reason)
+}
+
+func (s *DeployService) executeSteps(ctx context.Context, plan *deployPlan) error {
+	client, err := newSSHClient(plan.host)
+	if err != nil {
+		return fmt.Errorf("failed to connect to host: %v", err)
+	}
+	defer client.Close()
+
+	for i := range plan.deployment.Steps {
+		step := &plan.deployment.Steps[i]
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		startedAt := time.Now()
+		step.Status = "running"
+		step.StartedAt = &startedAt
+		s.saveStep(step)
+
+		out, err := s.executeStep(ctx, client, plan, step)
+		finishedAt := time.Now()
+		step.FinishedAt = &finishedAt
+		step.Output = truncateOutput(strings.TrimSpace(out))
+		step.Status = "success"
+		if err != nil {
+			step.Status = "failed"
+			step.Error = err.Error()
+		}
+		s.saveStep(step)
+		if err != nil {
+			return fmt.Errorf("step %s failed: %v", step.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *DeployService) executeStep(ctx context.Context, client *ssh.Client, plan *deployPlan, step *model.DeploymentStep) (string, error) {
+	switch step.Name {
+	case stepRegister:
+		return s.registerMiddleware(plan)
+	case stepVerify:
+		return s.verifyMiddleware(ctx, plan.middleware)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deployStepTimeout)
+	defer cancel()
+	// 超时或取消时关闭连接以中断命令，之后的步骤不再执行
+	defer closeOnCancel(ctx, client)()
+	out, err := runRemoteCommand(client, step.Script)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return out, fmt.Errorf("timed out after %s", deployStepTimeout)
+	}
+	return out, err
+}
+
+// registerMiddleware 注册部署的中间件，启停方式为模板中的 systemd unit
+func (s *DeployService) registerMiddleware(plan *deployPlan) (string, error) {
+	deployment := plan.deployment
+	hostID := plan.host.ID
+	mw := &model.Middleware{
+		Name:        deployment.Name,
+		Type:        plan.tmpl.MiddlewareType,
+		Version:     plan.tmpl.Version,
+		Host:        plan.host.IP,
+		Port:        deployment.Params["port"],
+		Credentials: deployment.Params["password"],
+		HostID:      &hostID,
+		Control:     &model.MiddlewareControl{Method: model.ControlSystemd, Target: plan.unit, Sudo: deployment.Sudo},
+	}
+	if err := s.middlewares.Create(mw); err != nil {
+		return "", err
+	}
+	plan.middleware = mw
+	deployment.MiddlewareID = &mw.ID
+	if err := s.repo.UpdateDeployment(deployment); err != nil {
+		log.Printf("Failed to update deployment %d: %v", deployment.ID, err)
+	}
+	return fmt.Sprintf("registered middleware %d", mw.ID), nil
+}
+
+// verifyMiddleware 等待注册的中间件通过健康检查；没有可用健康检查的类型（如 mysql）只确认端口可以连接
+func (s *DeployService) verifyMiddleware(ctx context.Context, mw *model.Middleware) (string, error) {
+	check, name := func() error { return s.middlewares.CheckHealth(mw) }, "health check"
+	if !hasHealthCheck(mw.Type) {
+		check, name = func() error {
+			ctx, cancel := context.WithTimeout(ctx, deployPortCheckTimeout)
+			defer cancel()
+			return probeTCP(ctx, mw).Err
+		}, fmt.Sprintf("port check of %s:%s", mw.Host, mw.Port)
+	}
+	ok, lastErr := verifyAction(ctx, model.ActionStart, check, defaultControlVerifyTimeout, controlVerifyInterval)
+	if !ok {
+		return "", fmt.Errorf("%s did not pass within %s: %v", name, defaultControlVerifyTimeout, lastErr)
+	}
+	return name + " passed", nil
+}
+
+// rollbackSteps 需要回滚的步骤：已成功、失败或被中断的步骤，按相反顺序
+func rollbackSteps(steps []model.DeploymentStep) []*model.DeploymentStep {
+	var result []*model.DeploymentStep
+	for i := len(steps) - 1; i >= 0; i-- {
+		step := &steps[i]
+		if step.RollbackCommand == "" {
+			continue
+		}
+		switch step.Status {
+		case "success", "failed", "running":
+			result = append(result, step)
+		}
+	}
+	return result
+}
+
+// rollback 按相反顺序撤销已执行的步骤并删除已注册的中间件，未执行的步骤标记为 skipped
+func (s *DeployService) rollback(deployment *model.Deployment, host *model.Host, reason string) {
+	ctx, cancel := context.WithTimeout(context.Background(), deployRollbackTimeout)
+	defer cancel()
+
+	for i := range deployment.Steps {
+		if step := &deployment.Steps[i]; step.Status == "pending" {
+			step.Status = "skipped"
+			s.saveStep(step)
+		}
+	}
+
+	var client *ssh.Client
+	var connErr error
+	defer func() {
+		if client != nil {
+			client.Close()
+		}
+	}()
+	failed := 0
+	for _, step := range rollbackSteps(deployment.Steps) {
+		var out string
+		var err error
+		switch {
+		case step.Name == stepRegister:
+			if deployment.MiddlewareID != nil {
+				err = s.middlewares.Delete(*deployment.MiddlewareID)
+				if err == nil {
+					out = fmt.Sprintf("deleted middleware %d", *deployment.MiddlewareID)
+					deployment.MiddlewareID = nil
+				}
+			}
+		default:
+			if client == nil && connErr == nil {
+				client, connErr = newSSHClient(host)
+				if connErr == nil {
+					defer closeOnCancel(ctx, client)()
+				}
+			}
+			if connErr != nil {
+				err = fmt.Errorf("failed to connect to host: %v", connErr)
+			} else {
+				out, err = runRemoteCommand(client, step.RollbackCommand)
+			}
+		}
+
+		step.RollbackOutput = truncateOutput(strings.TrimSpace(out))
+		step.Status = "rolled_back"
+		if err != nil {
+			failed++
+			step.Status = "rollback_failed"
+			if step.Error != "" {
+				step.Error += "; "
+			}
+			step.Error += "rollback: " + err.Error()
+		}
+		s.saveStep(step)
+	}
+
+	if failed > 0 {
+		s.finishDeployment(deployment, DeployFailed,
+			fmt.Sprintf("%s; %d rollback steps failed, manual cleanup required", reason, failed))
+		return
+	}
+	s.finishDeployment(deployment, DeployRolledBack, reason+"; rolled back")
+}
+
+// recoverDeployments 回滚上次停止时未完成的部署，中断的步骤无法安全地继续执行
+func (s *DeployService) recoverDeployments() {
+	deployments, err := s.repo.FindDeploymentsByStatus(DeployPending, DeployRunning)
+	if err != nil {
+		log.Printf("Failed to load unfinished deployments: %v", err)
+		return
+	}
+	for _, deployment := range deployments {
+		go s.recoverDeployment(deployment.ID)
+	}
+}
+
+func (s *DeployService) recoverDeployment(id uint) {
+	deployment, err := s.repo.FindDeploymentByID(id)
+	if err != nil {
+		log.Printf("Failed to load deployment %d: %v", id, err)
+		return
+	}
+	host, err := s.hostRepo.FindByID(deployment.HostID)
+	if err != nil {
+		s.finishDeployment(deployment, DeployFailed,
+			fmt.Sprintf("interrupted by restart, host %d not found for rollback: %v", deployment.HostID, err))
+		return
+	}
+	if !s.acquireHost(host.ID) {
+		return
+	}
+	defer s.releaseHost(host.ID)
+	s.rollback(deployment, host, "interrupted by restart")
+}
+
+func (s *DeployService) saveStep(step *model.DeploymentStep) {
+	if err := s.repo.UpdateStep(step); err != nil {
+		log.Printf("Failed to update deployment step %d: %v", step.ID, err)
+	}
+}
+
+func (s *DeployService) finishDeployment(deployment *model.Deployment, status, message string) {
+	now := time.Now()
+	deployment.Status = status
+	deployment.Message = message
+	deployment.FinishedAt = &now
+	if err := s.repo.UpdateDeployment(deployment); err != nil {
+		log.Printf("Failed to update deployment %d: %v", deployment.ID, err)
+	}
+	log.Printf("Deployment %d finished: %s, %s", deployment.ID, status, message)
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"middleware-platform/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func redisTemplate() *model.DeployTemplate {
+	return &model.DeployTemplate{
+		Name:           "redis",
+		Version:        "7.2.4",
+		MiddlewareType: "redis",
+		InstallMethod:  model.InstallTarball,
+		TarballURL:     "https://download.example.com/redis-{{.Version}}.tar.gz",
+		InstallDir:     "/opt/redis-{{.Params.port}}",
+		ConfigPath:     "/etc/redis/{{.Params.port}}.conf",
+		ConfigTemplate: "bind {{.Host}}\nport {{.Params.port}}\n{{if .Params.password}}requirepass {{.Params.password}}\n{{end}}",
+		UnitName:       "redis-{{.Params.port}}",
+		UnitTemplate:   "[Service]\nExecStart=/opt/redis-{{.Params.port}}/bin/redis-server /etc/redis/{{.Params.port}}.conf\n",
+		Parameters: []model.DeployParameter{
+			{Name: "port", Default: "6379"},
+			{Name: "password", Required: true},
+		},
+	}
+}
+
+func TestValidateTemplate(t *testing.T) {
+	assert.NoError(t, validateTemplate(redisTemplate()))
+
+	broken := []func(*model.DeployTemplate){
+		func(tmpl *model.DeployTemplate) { tmpl.UnitName = "" },
+		func(tmpl *model.DeployTemplate) { tmpl.InstallMethod = "rpm" },
+		func(tmpl *model.DeployTemplate) { tmpl.InstallDir = "" },
+		func(tmpl *model.DeployTemplate) { tmpl.ConfigPath = "" },
+		func(tmpl *model.DeployTemplate) { tmpl.Parameters = tmpl.Parameters[1:] },
+		func(tmpl *model.DeployTemplate) { tmpl.Parameters = append(tmpl.Parameters, model.DeployParameter{Name: "port"}) },
+		func(tmpl *model.DeployTemplate) { tmpl.Parameters[1].Name = "pass-word" },
+		func(tmpl *model.DeployTemplate) { tmpl.ConfigTemplate = "port {{.Params.port" },
+	}
+	for i, modify := range broken {
+		tmpl := redisTemplate()
+		modify(tmpl)
+		assert.ErrorIs(t, validateTemplate(tmpl), ErrInvalidTemplate, i)
+	}
+}
+
+func TestResolveDeployParams(t *testing.T) {
+	tmpl := redisTemplate()
+	params, err := resolveDeployParams(tmpl, map[string]string{"password": "s3cret"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"port": "6379", "password": "s3cret"}, params)
+
+	_, err = resolveDeployParams(tmpl, nil)
+	assert.EqualError(t, err, "parameter password is required")
+	_, err = resolveDeployParams(tmpl, map[string]string{"password": "x", "maxmemory": "1gb"})
+	assert.EqualError(t, err, "unknown parameter maxmemory")
+	_, err = resolveDeployParams(tmpl, map[string]string{"password": "x", "port": "70000"})
+	assert.EqualError(t, err, `invalid port "70000"`)
+}
+
+func TestRenderDeployTemplate(t *testing.T) {
+	tmpl := redisTemplate()
+	data := deployData{Name: "cache", Version: tmpl.Version, Host: "10.0.0.5",
+		Params: map[string]string{"port": "6380", "password": "s3cret"}}
+	r, err := renderDeployTemplate(tmpl, data)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, "https://download.example.com/redis-7.2.4.tar.gz", r.TarballURL)
+	assert.Equal(t, "/opt/redis-6380", r.InstallDir)
+	assert.Equal(t, "/etc/redis/6380.conf", r.ConfigPath)
+	assert.Equal(t, "bind 10.0.0.5\nport 6380\nrequirepass s3cret\n", r.Config)
+	assert.Equal(t, "redis-6380.service", r.Unit)
+
+	// 引用未定义的参数
+	tmpl.ConfigTemplate = "maxmemory {{.Params.maxmemory}}"
+	_, err = renderDeployTemplate(tmpl, data)
+	assert.Error(t, err)
+
+	tmpl = redisTemplate()
+	tmpl.InstallDir = "/{{.Params.dir}}"
+	_, err = renderDeployTemplate(tmpl, deployData{Params: map[string]string{"port": "6379", "password": "", "dir": ""}})
+	assert.ErrorContains(t, err, "install_dir must be an absolute path other than /")
+}
+
+func TestBuildDeploySteps(t *testing.T) {
+	tmpl := redisTemplate()
+	r, _ := renderDeployTemplate(tmpl, deployData{Version: tmpl.Version, Host: "10.0.0.5", Params: map[string]string{"port": "6380", "password": "s3cret"}})
+	steps := buildDeploySteps(tmpl, r, "6380", false, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC))
+
+	var names []string
+	for i, step := range steps {
+		names = append(names, step.Name)
+		assert.Equal(t, i+1, step.Seq)
+		assert.Equal(t, "pending", step.Status)
+	}
+	assert.Equal(t, []string{"precheck", "install", "config", "unit", "start", "register", "verify"}, names)
+	assert.Contains(t, steps[0].Script, "port 6380 is already in use")
+	assert.Contains(t, steps[0].Script, "install dir /opt/redis-6380 is not empty")
+	assert.Equal(t, "mkdir -p '/opt/redis-6380' && curl -fsSL 'https://download.example.com/redis-7.2.4.tar.gz' | "+
+		"tar -xz -C '/opt/redis-6380' --strip-components=1", steps[1].Script)
+	assert.Equal(t, "rm -rf '/opt/redis-6380'", steps[1].RollbackCommand)
+	// 配置内容可能包含密码，只在不保存的 Script 中出现
+	assert.Equal(t, "write /etc/redis/6380.conf (43 bytes)", steps[2].Command)
+	assert.NotContains(t, steps[2].Command+steps[2].RollbackCommand, "s3cret")
+	assert.Equal(t, "systemctl enable 'redis-6380.service' && systemctl restart 'redis-6380.service'", steps[4].Script)
+	assert.Equal(t, "systemctl disable --now 'redis-6380.service'", steps[4].RollbackCommand)
+	assert.Empty(t, steps[5].Script)
+	assert.Empty(t, steps[6].RollbackCommand)
+
+	tmpl.InstallMethod = model.InstallPackage
+	tmpl.Package = "redis-server=5:7.0.15-1"
+	tmpl.ConfigTemplate, tmpl.UnitTemplate = "", ""
+	r, _ = renderDeployTemplate(tmpl, deployData{Params: map[string]string{"port": "6379", "password": "x"}})
+	steps = buildDeploySteps(tmpl, r, "6379", true, time.Now())
+	if !assert.Len(t, steps, 5) {
+		return
+	}
+	assert.Contains(t, steps[0].Script, "package redis-server is already installed")
+	assert.True(t, strings.HasPrefix(steps[1].Script, "sudo -n sh -c 'if command -v apt-get"), steps[1].Script)
+	assert.Contains(t, steps[1].Script, "apt-get install -y '\\''redis-server=5:7.0.15-1'\\''")
+	assert.Contains(t, steps[1].RollbackCommand, "apt-get purge -y '\\''redis-server'\\''")
+	assert.Equal(t, "delete registered middleware", steps[3].RollbackCommand)
+}
+
+func TestDeployConfigStepScripts(t *testing.T) {
+	if _, err := exec.LookPath("base64"); err != nil {
+		t.Skip("base64 not available")
+	}
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "conf", "redis.conf")
+	tmpl := redisTemplate()
+	tmpl.ConfigPath = conf
+	r, err := renderDeployTemplate(tmpl, deployData{Host: "127.0.0.1", Params: map[string]string{"port": "6379", "password": "it's"}})
+	if !assert.NoError(t, err) {
+		return
+	}
+	step := buildDeploySteps(tmpl, r, "6379", false, time.Now())[2]
+	run := func(script string) {
+		out, err := exec.Command("sh", "-c", script).CombinedOutput()
+		assert.NoError(t, err, string(out))
+	}
+	read := func() string {
+		data, _ := os.ReadFile(conf)
+		return string(data)
+	}
+
+	// 新文件回滚时删除
+	run(step.Script)
+	assert.Equal(t, r.Config, read())
+	run(step.RollbackCommand)
+	_, err = os.Stat(conf)
+	assert.True(t, os.IsNotExist(err))
+
+	// 已有文件回滚时恢复
+	assert.NoError(t, os.WriteFile(conf, []byte("port 6379\n"), 0o644))
+	run(step.Script)
+	assert.Equal(t, "bind 127.0.0.1\nport 6379\nrequirepass it's\n", read())
+	run(step.RollbackCommand)
+	assert.Equal(t, "port 6379\n", read())
+	entries, _ := os.ReadDir(filepath.Dir(conf))
+	assert.Len(t, entries, 1)
+}
+
+func TestRollbackSteps(t *testing.T) {
+	steps := []model.DeploymentStep{
+		{Seq: 1, Name: stepPrecheck, Status: "success"},
+		{Seq: 2, Name: stepInstall, Status: "success", RollbackCommand: "rm -rf /opt/redis"},
+		{Seq: 3, Name: stepConfig, Status: "success", RollbackCommand: "restore config"},
+		{Seq: 4, Name: stepStart, Status: "failed", RollbackCommand: "systemctl disable --now redis"},
+		{Seq: 5, Name: stepRegister, Status: "pending", RollbackCommand: "delete registered middleware"},
+	}
+	var seqs []int
+	for _, step := range rollbackSteps(steps) {
+		seqs = append(seqs, step.Seq)
+	}
+	assert.Equal(t, []int{4, 3, 2}, seqs)
+}
+
+func TestVerifyMiddlewareWithoutHealthCheck(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer ln.Close()
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+
+	// mysql 没有可用的健康检查，端口可以连接即验证通过，不会回滚
+	s := &DeployService{middlewares: &MiddlewareService{}}
+	mw := &model.Middleware{Type: "mysql", Host: host, Port: port}
+	out, err := s.verifyMiddleware(context.Background(), mw)
+	assert.NoError(t, err)
+	assert.Equal(t, "port check of "+ln.Addr().String()+" passed", out)
+
+	ln.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = s.verifyMiddleware(ctx, mw)
+	assert.ErrorContains(t, err, "port check of "+ln.Addr().String()+" did not pass")
+}
@@ -0,0 +1,464 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"middleware-platform/internal/model"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	defaultDistributionBatch = 5
+	// 保存的命令输出上限，避免 reload 等命令的大量输出撑大数据库
+	maxCommandOutput = 4096
+)
+
+// DistributionSummary 分发任务按主机状态的汇总
+type DistributionSummary struct {
+	Total   int `json:"total"`
+	Pending int `json:"pending"`
+	Running int `json:"running"`
+	Success int `json:"success"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+	// 推送成功但校验和与源文件不一致的主机
+	ChecksumMismatch []uint `json:"checksum_mismatch"`
+}
+
+// runningJobs 执行中的后台任务（滚动分发、文件收集），用于防止重复执行和取消
+type runningJobs struct {
+	mu      sync.Mutex
+	ctx     context.Context
+	cancels map[uint]context.CancelFunc
+}
+
+func (r *runningJobs) start(id uint) (context.Context, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.cancels[id]; exists {
+		return nil, false
+	}
+	parent := r.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithCancel(parent)
+	r.cancels[id] = cancel
+	return ctx, true
+}
+
+func (r *runningJobs) done(id uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if cancel, exists := r.cancels[id]; exists {
+		cancel()
+		delete(r.cancels, id)
+	}
+}
+
+// stopping 服务是否正在停止，停止时中断的任务保持原状态，重启后继续执行
+func (r *runningJobs) stopping() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ctx != nil && r.ctx.Err() != nil
+}
+
+func (r *runningJobs) cancel(id uint) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cancel, exists := r.cancels[id]
+	if exists {
+		cancel()
+	}
+	return exists
+}
+
+// CreateDistribution 创建分发任务并在后台按批次执行
+func (s *HostService) CreateDistribution(distribution *model.Distribution) error {
+	if distribution.FileSyncID != 0 {
+		fileSync, err := s.repo.FindFileSyncByID(distribution.FileSyncID)
+		if err != nil {
+			return fmt.Errorf("file sync %d not found: %v", distribution.FileSyncID, err)
+		}
+		if distribution.SourcePath == "" {
+			distribution.SourcePath = fileSync.SourcePath
+		}
+		if distribution.TargetPath == "" {
+			distribution.TargetPath = fileSync.TargetPath
+		}
+	}
+	if distribution.SourcePath == "" || distribution.TargetPath == "" {
+		return fmt.Errorf("sourcePath and targetPath are required")
+	}
+	if len(distribution.HostIDs) == 0 {
+		return fmt.Errorf("host_ids is required")
+	}
+	if distribution.BatchSize <= 0 {
+		distribution.BatchSize = defaultDistributionBatch
+	}
+	if distribution.MaxFailures < 0 {
+		return fmt.Errorf("max_failures must not be negative")
+	}
+	if err := validateTransferSettings(distribution.BandwidthLimit, distribution.TransferWindow); err != nil {
+		return err
+	}
+	if _, _, err := getFileInfo(distribution.SourcePath); err != nil {
+		return err
+	}
+
+	seen := make(map[uint]bool)
+	distribution.Targets = nil
+	for _, hostID := range distribution.HostIDs {
+		if seen[hostID] {
+			continue
+		}
+		seen[hostID] = true
+
+		host, err := s.repo.FindByID(hostID)
+		if err != nil {
+			return fmt.Errorf("host %d not found: %v", hostID, err)
+		}
+		distribution.Targets = append(distribution.Targets, model.DistributionTarget{
+			HostID:   host.ID,
+			HostName: host.Name,
+			HostIP:   host.IP,
+			Batch:    len(distribution.Targets)/distribution.BatchSize + 1,
+			Status:   "pending",
+		})
+	}
+
+	distribution.Status = "pending"
+	if err := s.repo.CreateDistribution(distribution); err != nil {
+		return err
+	}
+
+	go s.runDistribution(distribution.ID)
+	return nil
+}
+
+// GetDistribution 获取分发任务及各主机的执行结果
+func (s *HostService) GetDistribution(id uint) (*model.Distribution, DistributionSummary, error) {
+	distribution, err := s.repo.FindDistributionByID(id)
+	if err != nil {
+		return nil, DistributionSummary{}, err
+	}
+	return distribution, summarizeDistribution(distribution), nil
+}
+
+// GetDistributions 获取最近的分发任务
+func (s *HostService) GetDistributions() ([]model.Distribution, error) {
+	return s.repo.FindDistributions(100)
+}
+
+// CancelDistribution 取消执行中的分发任务，正在推送的主机会被中断，后续主机跳过
+func (s *HostService) CancelDistribution(id uint) error {
+	if !s.distributions.cancel(id) {
+		return fmt.Errorf("distribution %d is not running", id)
+	}
+	return nil
+}
+
+// resumeDistributions 重启后继续执行未完成的分发任务，已成功的主机不会重复推送
+func (s *HostService) resumeDistributions() {
+	distributions, err := s.repo.FindDistributionsByStatus("pending", "waiting", "running")
+	if err != nil {
+		log.Printf("Failed to load unfinished distributions: %v", err)
+		return
+	}
+	for _, distribution := range distributions {
+		go s.runDistribution(distribution.ID)
+	}
+}
+
+func summarizeDistribution(distribution *model.Distribution) DistributionSummary {
+	summary := DistributionSummary{Total: len(distribution.Targets), ChecksumMismatch: []uint{}}
+	for _, target := range distribution.Targets {
+		switch target.Status {
+		case "pending":
+			summary.Pending++
+		case "running":
+			summary.Running++
+		case "success":
+			summary.Success++
+		case "failed":
+			summary.Failed++
+		case "skipped":
+			summary.Skipped++
+		}
+		if target.Checksum != "" && target.Checksum != distribution.SHA256 {
+			summary.ChecksumMismatch = append(summary.ChecksumMismatch, target.HostID)
+		}
+	}
+	return summary
+}
+
+func (s *HostService) runDistribution(id uint) {
+	ctx, ok := s.distributions.start(id)
+	if !ok {
+		return
+	}
+	defer s.distributions.done(id)
+
+	distribution, err := s.repo.FindDistributionByID(id)
+	if err != nil {
+		log.Printf("Failed to load distribution %d: %v", id, err)
+		return
+	}
+
+	now := time.Now()
+	distribution.Status = "running"
+	distribution.StartedAt = &now
+	if err := s.repo.UpdateDistribution(distribution); err != nil {
+		log.Printf("Failed to update distribution %d: %v", id, err)
+	}
+
+	// 以开始执行时的源文件内容为准
+	_, size, err := getFileInfo(distribution.SourcePath)
+	if err == nil {
+		var sums fileChecksums
+		sums, err = calculateFileChecksums(distribution.SourcePath)
+		distribution.FileSize = size
+		distribution.MD5 = sums.MD5
+		distribution.SHA256 = sums.SHA256
+	}
+	if err != nil {
+		s.finishDistribution(distribution, "failed", err.Error())
+		return
+	}
+
+	// 窗口外等待，等待期间可以取消；服务停止时保持waiting，重启后继续等待
+	if window := s.transferWindowFor(distribution.TransferWindow, size); window != nil && !window.contains(time.Now()) {
+		s.waitForWindow(ctx, distribution, window)
+		if s.distributions.stopping() {
+			return
+		}
+		if ctx.Err() == nil {
+			distribution.Status = "running"
+			distribution.Message = ""
+			if err := s.repo.UpdateDistribution(distribution); err != nil {
+				log.Printf("Failed to update distribution %d: %v", id, err)
+			}
+		}
+	}
+
+	// 整个分发任务共享一个令牌桶，并发推送的主机平分带宽
+	limiter := newTokenBucket(int64(distribution.BandwidthLimit) * 1024)
+
+	targets := make([]*model.DistributionTarget, len(distribution.Targets))
+	for i := range distribution.Targets {
+		target := &distribution.Targets[i]
+		// 上次执行被中断的主机重新推送
+		if target.Status == "running" {
+			target.Status = "pending"
+		}
+		targets[i] = target
+	}
+
+	failures, halted := rollout(ctx, targets, distribution.MaxFailures, func(ctx context.Context, target *model.DistributionTarget) error {
+		return s.distributeToHost(ctx, distribution, target, limiter)
+	})
+	if s.distributions.stopping() {
+		return
+	}
+
+	reason := "cancelled"
+	if halted {
+		reason = fmt.Sprintf("halted after %d failures", failures)
+	}
+	for _, target := range targets {
+		if target.Status == "pending" {
+			target.Status = "skipped"
+			target.Error = reason
+			if err := s.repo.UpdateDistributionTarget(target); err != nil {
+				log.Printf("Failed to update distribution target %d: %v", target.ID, err)
+			}
+		}
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		s.finishDistribution(distribution, "cancelled", "cancelled by user")
+	case halted:
+		s.finishDistribution(distribution, "halted", fmt.Sprintf("%d hosts failed, exceeding max_failures %d", failures, distribution.MaxFailures))
+	case failures > 0:
+		s.finishDistribution(distribution, "failed", fmt.Sprintf("%d of %d hosts failed", failures, len(targets)))
+	default:
+		s.finishDistribution(distribution, "completed", fmt.Sprintf("distributed to %d hosts", len(targets)))
+	}
+}
+
+// waitForWindow 将分发任务置为waiting并阻塞到传输窗口打开或ctx取消
+func (s *HostService) waitForWindow(ctx context.Context, distribution *model.Distribution, window *transferWindow) {
+	now := time.Now()
+	open := window.nextOpen(now)
+	distribution.Status = "waiting"
+	distribution.Message = fmt.Sprintf("waiting for transfer window %s, starts at %s", window, open.Format("2006-01-02 15:04"))
+	if err := s.repo.UpdateDistribution(distribution); err != nil {
+		log.Printf("Failed to update distribution %d: %v", distribution.ID, err)
+	}
+
+	timer := time.NewTimer(open.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+func (s *HostService) finishDistribution(distribution *model.Distribution, status, message string) {
+	now := time.Now()
+	distribution.Status = status
+	distribution.Message = message
+	distribution.FinishedAt = &now
+	if err := s.repo.UpdateDistribution(distribution); err != nil {
+		log.Printf("Failed to update distribution %d: %v", distribution.ID, err)
+	}
+}
+
+// rollout 按批次并发执行pending的目标主机，每批结束后检查失败数，超过maxFailures时中止。
+// 返回累计失败数（包含之前执行失败的主机）和是否中止。ctx取消时被中断的主机不计为失败，也不返回中止。
+func rollout(ctx context.Context, targets []*model.DistributionTarget, maxFailures int, run func(context.Context, *model.DistributionTarget) error) (int, bool) {
+	batches := make(map[int][]*model.DistributionTarget)
+	failures := 0
+	for _, target := range targets {
+		batches[target.Batch] = append(batches[target.Batch], target)
+		if target.Status == "failed" {
+			failures++
+		}
+	}
+	order := make([]int, 0, len(batches))
+	for batch := range batches {
+		order = append(order, batch)
+	}
+	sort.Ints(order)
+
+	for _, batch := range order {
+		if failures > maxFailures {
+			return failures, true
+		}
+		if ctx.Err() != nil {
+			return failures, false
+		}
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		for _, target := range batches[batch] {
+			if target.Status != "pending" {
+				continue
+			}
+			wg.Add(1)
+			go func(target *model.DistributionTarget) {
+				defer wg.Done()
+				if err := run(ctx, target); err != nil && ctx.Err() == nil {
+					mu.Lock()
+					failures++
+					mu.Unlock()
+				}
+			}(target)
+		}
+		wg.Wait()
+	}
+	if ctx.Err() != nil {
+		return failures, false
+	}
+	return failures, failures > maxFailures
+}
+
+// distributeToHost 在单台主机上执行：前置命令、推送、校验、后置命令
+func (s *HostService) distributeToHost(ctx context.Context, distribution *model.Distribution, target *model.DistributionTarget, limiter *tokenBucket) error {
+	started := time.Now()
+	target.Status = "running"
+	target.StartedAt = &started
+	target.Error = ""
+	if err := s.repo.UpdateDistributionTarget(target); err != nil {
+		log.Printf("Failed to update distribution target %d: %v", target.ID, err)
+	}
+
+	err := s.pushToHost(ctx, distribution, target, limiter)
+
+	finished := time.Now()
+	target.FinishedAt = &finished
+	switch {
+	case err == nil:
+		target.Status = "success"
+	case ctx.Err() != nil:
+		// 被取消或服务停止而中断，不计为该主机失败
+		target.Status = "pending"
+		target.Error = "interrupted"
+	default:
+		target.Status = "failed"
+		target.Error = err.Error()
+	}
+	if err := s.repo.UpdateDistributionTarget(target); err != nil {
+		log.Printf("Failed to update distribution target %d: %v", target.ID, err)
+	}
+	return err
+}
+
+func (s *HostService) pushToHost(ctx context.Context, distribution *model.Distribution, target *model.DistributionTarget, limiter *tokenBucket) error {
+	host, err := s.repo.FindByID(target.HostID)
+	if err != nil {
+		return err
+	}
+
+	client, err := newSSHClient(host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	defer closeOnCancel(ctx, client)()
+
+	if distribution.PreCommand != "" {
+		out, err := runRemoteCommand(client, distribution.PreCommand)
+		target.PreOutput = truncateOutput(out)
+		if err != nil {
+			return fmt.Errorf("pre command failed: %v", err)
+		}
+	}
+
+	src, err := os.Open(distribution.SourcePath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	name := filepath.Base(distribution.SourcePath)
+	if err := scpUpload(client, s.throttle(ctx, src, limiter), info.Size(), info.Mode(), distribution.TargetPath, name); err != nil {
+		return fmt.Errorf("transfer failed: %v", err)
+	}
+
+	checksum, exists, err := remoteSHA256(client, distribution.TargetPath, name)
+	if err != nil {
+		return err
+	}
+	target.Checksum = checksum
+	if !exists || checksum != distribution.SHA256 {
+		return fmt.Errorf("checksum mismatch: local sha256 %s, remote %q", distribution.SHA256, checksum)
+	}
+
+	if distribution.PostCommand != "" {
+		out, err := runRemoteCommand(client, distribution.PostCommand)
+		target.PostOutput = truncateOutput(out)
+		if err != nil {
+			return fmt.Errorf("post command failed: %v", err)
+		}
+	}
+	return nil
+}
+
+// truncateOutput 保留输出末尾，错误信息通常在最后
+func truncateOutput(out string) string {
+	if len(out) > maxCommandOutput {
+		return out[len(out)-maxCommandOutput:]
+	}
+	return out
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"middleware-platform/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTargets(n, batchSize int) []*model.DistributionTarget {
+	targets := make([]*model.DistributionTarget, n)
+	for i := range targets {
+		targets[i] = &model.DistributionTarget{HostID: uint(i + 1), Batch: i/batchSize + 1, Status: "pending"}
+	}
+	return targets
+}
+
+func TestRollout_AllBatches(t *testing.T) {
+	targets := newTargets(7, 3)
+	var mu sync.Mutex
+	var order []int
+
+	failures, halted := rollout(context.Background(), targets, 0, func(ctx context.Context, target *model.DistributionTarget) error {
+		mu.Lock()
+		order = append(order, target.Batch)
+		mu.Unlock()
+		target.Status = "success"
+		return nil
+	})
+
+	assert.Equal(t, 0, failures)
+	assert.False(t, halted)
+	assert.Equal(t, []int{1, 1, 1, 2, 2, 2, 3}, order)
+}
+
+func TestRollout_HaltsAfterMaxFailures(t *testing.T) {
+	targets := newTargets(6, 2)
+
+	failures, halted := rollout(context.Background(), targets, 1, func(ctx context.Context, target *model.DistributionTarget) error {
+		// 第2批全部失败
+		if target.Batch == 2 {
+			target.Status = "failed"
+			return errors.New("config test failed")
+		}
+		target.Status = "success"
+		return nil
+	})
+
+	assert.Equal(t, 2, failures)
+	assert.True(t, halted)
+	for _, target := range targets[4:] {
+		assert.Equal(t, "pending", target.Status)
+	}
+}
+
+func TestRollout_SkipsFinishedTargets(t *testing.T) {
+	targets := newTargets(4, 2)
+	targets[0].Status = "success"
+	targets[1].Status = "failed"
+
+	var mu sync.Mutex
+	var ran []uint
+	failures, halted := rollout(context.Background(), targets, 1, func(ctx context.Context, target *model.DistributionTarget) error {
+		mu.Lock()
+		ran = append(ran, target.HostID)
+		mu.Unlock()
+		target.Status = "success"
+		return nil
+	})
+
+	assert.Equal(t, 1, failures)
+	assert.False(t, halted)
+	assert.ElementsMatch(t, []uint{3, 4}, ran)
+}
+
+func TestRollout_InterruptedTargetsAreNotFailures(t *testing.T) {
+	targets := newTargets(4, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	failures, halted := rollout(ctx, targets, 0, func(ctx context.Context, target *model.DistributionTarget) error {
+		// 服务停止时推送被中断，主机恢复为pending等待重启后继续
+		cancel()
+		target.Status = "pending"
+		return ctx.Err()
+	})
+
+	assert.Equal(t, 0, failures)
+	assert.False(t, halted)
+	for _, target := range targets {
+		assert.Equal(t, "pending", target.Status)
+	}
+}
+
+func TestSummarizeDistribution(t *testing.T) {
+	distribution := &model.Distribution{
+		SHA256: "abc",
+		Targets: []model.DistributionTarget{
+			{HostID: 1, Status: "success", Checksum: "abc"},
+			{HostID: 2, Status: "failed", Checksum: "def"},
+			{HostID: 3, Status: "skipped"},
+		},
+	}
+
+	summary := summarizeDistribution(distribution)
+	assert.Equal(t, 3, summary.Total)
+	assert.Equal(t, 1, summary.Success)
+	assert.Equal(t, 1, summary.Failed)
+	assert.Equal(t, 1, summary.Skipped)
+	assert.Equal(t, []uint{2}, summary.ChecksumMismatch)
+}
@@ -0,0 +1,354 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"middleware-platform/internal/model"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrESClusterRed 集群可以访问但有主分片未分配
+	ErrESClusterRed = errors.New("elasticsearch cluster health is red")
+	ErrNoESCluster  = errors.New("no elasticsearch cluster checked for this middleware")
+)
+
+// esDefaultWatermarks 未能读取集群设置时使用的默认磁盘水位
+var esDefaultWatermarks = map[string]string{
+	"low":         "85%",
+	"high":        "90%",
+	"flood_stage": "95%",
+}
+
+// esWatermarkLevels 按严重程度从低到高
+var esWatermarkLevels = []string{"low", "high", "flood_stage"}
+
+// esClusterHealth GET /_cluster/health 的响应
+type esClusterHealth struct {
+	ClusterName         string  `json:"cluster_name"`
+	Status              string  `json:"status"`
+	NumberOfNodes       int     `json:"number_of_nodes"`
+	NumberOfDataNodes   int     `json:"number_of_data_nodes"`
+	ActiveShards        int     `json:"active_shards"`
+	RelocatingShards    int     `json:"relocating_shards"`
+	InitializingShards  int     `json:"initializing_shards"`
+	UnassignedShards    int     `json:"unassigned_shards"`
+	ActiveShardsPercent float64 `json:"active_shards_percent_as_number"`
+}
+
+// esNodesStats GET /_nodes/stats/jvm,indices,fs 的响应
+type esNodesStats struct {
+	Nodes map[string]struct {
+		Name string `json:"name"`
+		Host string `json:"host"`
+		JVM  struct {
+			Mem struct {
+				HeapUsedPercent float64 `json:"heap_used_percent"`
+			} `json:"mem"`
+		} `json:"jvm"`
+		Indices struct {
+			Indexing struct {
+				IndexTotal int64 `json:"index_total"`
+			} `json:"indexing"`
+			Search struct {
+				QueryTotal int64 `json:"query_total"`
+			} `json:"search"`
+		} `json:"indices"`
+		FS struct {
+			Total struct {
+				TotalInBytes     int64 `json:"total_in_bytes"`
+				AvailableInBytes int64 `json:"available_in_bytes"`
+			} `json:"total"`
+		} `json:"fs"`
+	} `json:"nodes"`
+}
+
+// ESNode Elasticsearch 节点的 JVM 和磁盘状态
+type ESNode struct {
+	ID              string  `json:"id"`
+	Name            string  `json:"name"`
+	Host            string  `json:"host"`
+	HeapUsedPercent float64 `json:"heap_used_percent"`
+	DiskTotal       int64   `json:"disk_total"`
+	DiskAvailable   int64   `json:"disk_available"`
+	DiskUsedPercent float64 `json:"disk_used_percent"`
+	Watermark       string  `json:"watermark"` // 已超过的最高磁盘水位：low, high, flood_stage，未超过时为空
+}
+
+// ESCluster Elasticsearch 集群最近一次检查的状态
+type ESCluster struct {
+	MiddlewareID       uint              `json:"middleware_id"`
+	ClusterName        string            `json:"cluster_name"`
+	Status             string            `json:"status"`
+	UnassignedShards   int               `json:"unassigned_shards"`
+	InitializingShards int               `json:"initializing_shards"`
+	RelocatingShards   int               `json:"relocating_shards"`
+	Watermarks         map[string]string `json:"watermarks"`
+	Nodes              []ESNode          `json:"nodes"`
+	IndexingTotal      int64             `json:"indexing_total"`
+	SearchTotal        int64             `json:"search_total"`
+	IndexingRate       float64           `json:"indexing_rate"` // 与上一次检查之间每秒的文档索引数
+	SearchRate         float64           `json:"search_rate"`   // 与上一次检查之间每秒的查询数
+	CheckedAt          time.Time         `json:"checked_at"`
+}
+
+// GetESCluster 获取最近一次检查的集群健康和节点状态
+func (s *MetricsService) GetESCluster(middlewareID uint) (*ESCluster, error) {
+	cluster, _ := s.clusters.get(middlewareID).(*ESCluster)
+	if cluster == nil {
+		return nil, ErrNoESCluster
+	}
+	return cluster, nil
+}
+
+func (s *MetricsService) collectESMetrics(ctx context.Context, mw model.Middleware) ([]model.Metrics, error) {
+	endpoint, release, err := s.clients.httpEndpoint(&mw)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	var health esClusterHealth
+	err = endpoint.getJSON(ctx, "/_cluster/health", &health)
+	s.clients.report(&mw, clientHTTP, err)
+	if err != nil {
+		return nil, err
+	}
+	var stats esNodesStats
+	if err := endpoint.getJSON(ctx, "/_nodes/stats/jvm,indices,fs", &stats); err != nil {
+		return nil, err
+	}
+	// 读取集群设置需要 monitor 以上的权限，失败时使用默认水位
+	watermarks, err := esWatermarks(ctx, endpoint)
+	if err != nil {
+		log.Printf("Failed to get disk watermarks of middleware %d: %v", mw.ID, err)
+	}
+
+	cluster := buildESCluster(&health, &stats, watermarks)
+	cluster.MiddlewareID = mw.ID
+	cluster.CheckedAt = time.Now()
+	previous, _ := s.clusters.get(mw.ID).(*ESCluster)
+	esRates(cluster, previous)
+	s.clusters.set(mw.ID, cluster)
+
+	return esMetrics(cluster, &health), nil
+}
+
+// esWatermarks 读取生效的磁盘水位，优先级 transient > persistent > 默认值
+func esWatermarks(ctx context.Context, endpoint *httpEndpoint) (map[string]string, error) {
+	watermarks := make(map[string]string, len(esDefaultWatermarks))
+	for level, value := range esDefaultWatermarks {
+		watermarks[level] = value
+	}
+
+	var settings map[string]map[string]interface{}
+	err := endpoint.getJSON(ctx, "/_cluster/settings?include_defaults=true&flatten_settings=true", &settings)
+	if err != nil {
+		return watermarks, err
+	}
+	for _, scope := range []string{"defaults", "persistent", "transient"} {
+		for _, level := range esWatermarkLevels {
+			if v, ok := settings[scope]["cluster.routing.allocation.disk.watermark."+level].(string); ok && v != "" {
+				watermarks[level] = v
+			}
+		}
+	}
+	return watermarks, nil
+}
+
+func buildESCluster(health *esClusterHealth, stats *esNodesStats, watermarks map[string]string) *ESCluster {
+	if watermarks == nil {
+		watermarks = esDefaultWatermarks
+	}
+	cluster := &ESCluster{
+		ClusterName:        health.ClusterName,
+		Status:             health.Status,
+		UnassignedShards:   health.UnassignedShards,
+		InitializingShards: health.InitializingShards,
+		RelocatingShards:   health.RelocatingShards,
+		Watermarks:         watermarks,
+	}
+	for id, n := range stats.Nodes {
+		node := ESNode{
+			ID:              id,
+			Name:            n.Name,
+			Host:            n.Host,
+			HeapUsedPercent: n.JVM.Mem.HeapUsedPercent,
+			DiskTotal:       n.FS.Total.TotalInBytes,
+			DiskAvailable:   n.FS.Total.AvailableInBytes,
+		}
+		if node.DiskTotal > 0 {
+			node.DiskUsedPercent = float64(node.DiskTotal-node.DiskAvailable) / float64(node.DiskTotal) * 100
+			for _, level := range esWatermarkLevels {
+				if esWatermarkExceeded(watermarks[level], node.DiskTotal, node.DiskAvailable) {
+					node.Watermark = level
+				}
+			}
+		}
+		cluster.IndexingTotal += n.Indices.Indexing.IndexTotal
+		cluster.SearchTotal += n.Indices.Search.QueryTotal
+		cluster.Nodes = append(cluster.Nodes, node)
+	}
+	sort.Slice(cluster.Nodes, func(i, j int) bool { return cluster.Nodes[i].Name < cluster.Nodes[j].Name })
+	return cluster
+}
+
+// esWatermarkExceeded 水位可以是已用比例（"85%"、"0.85"）或最少剩余空间（"500mb"）
+func esWatermarkExceeded(watermark string, total, available int64) bool {
+	watermark = strings.ToLower(strings.TrimSpace(watermark))
+	if watermark == "" || total <= 0 {
+		return false
+	}
+	used := float64(total-available) / float64(total) * 100
+	if strings.HasSuffix(watermark, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(watermark, "%"), 64)
+		return err == nil && used >= percent
+	}
+	if ratio, err := strconv.ParseFloat(watermark, 64); err == nil {
+		return used >= ratio*100
+	}
+	free, err := parseESBytes(watermark)
+	return err == nil && available <= free
+}
+
+// parseESBytes 解析 Elasticsearch 的字节大小，如 500mb、1.5gb
+func parseESBytes(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		size   float64
+	}{
+		{"pb", 1 << 50}, {"tb", 1 << 40}, {"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10}, {"b", 1},
+	}
+	for _, unit := range units {
+		if strings.HasSuffix(s, unit.suffix) {
+			v, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid byte size %q", s)
+			}
+			return int64(v * unit.size), nil
+		}
+	}
+	return 0, fmt.Errorf("invalid byte size %q", s)
+}
+
+// esRates 根据上一次检查的累计值计算索引和查询速率，节点重启导致计数减小时不计算
+func esRates(cluster, previous *ESCluster) {
+	if previous == nil {
+		return
+	}
+	elapsed := cluster.CheckedAt.Sub(previous.CheckedAt).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	if d := cluster.IndexingTotal - previous.IndexingTotal; d >= 0 {
+		cluster.IndexingRate = float64(d) / elapsed
+	}
+	if d := cluster.SearchTotal - previous.SearchTotal; d >= 0 {
+		cluster.SearchRate = float64(d) / elapsed
+	}
+}
+
+// esStatusValue 健康颜色转换为数值：green 0、yellow 1、red 2
+func esStatusValue(status string) float64 {
+	switch status {
+	case "green":
+		return 0
+	case "yellow":
+		return 1
+	}
+	return 2
+}
+
+// esMetrics 集群健康、分片、JVM 堆、索引和查询速率以及磁盘水位指标，节点级指标取最大值
+func esMetrics(cluster *ESCluster, health *esClusterHealth) []model.Metrics {
+	var metrics []model.Metrics
+	add := func(name string, value float64, unit string) {
+		metrics = append(metrics, model.Metrics{
+			MiddlewareID: cluster.MiddlewareID,
+			Type:         name,
+			Value:        value,
+			Unit:         unit,
+			Timestamp:    cluster.CheckedAt,
+		})
+	}
+
+	add("es_status", esStatusValue(health.Status), "")
+	add("es_nodes", float64(health.NumberOfNodes), "")
+	add("es_data_nodes", float64(health.NumberOfDataNodes), "")
+	add("es_active_shards", float64(health.ActiveShards), "")
+	add("es_relocating_shards", float64(health.RelocatingShards), "")
+	add("es_initializing_shards", float64(health.InitializingShards), "")
+	add("es_unassigned_shards", float64(health.UnassignedShards), "")
+	add("es_active_shards_percent", health.ActiveShardsPercent, "%")
+
+	var heap, disk float64
+	exceeded := make(map[string]int)
+	for _, node := range cluster.Nodes {
+		if node.HeapUsedPercent > heap {
+			heap = node.HeapUsedPercent
+		}
+		if node.DiskUsedPercent > disk {
+			disk = node.DiskUsedPercent
+		}
+		// 超过高水位的节点也计入低水位
+		if node.Watermark == "" {
+			continue
+		}
+		for _, level := range esWatermarkLevels {
+			exceeded[level]++
+			if level == node.Watermark {
+				break
+			}
+		}
+	}
+	if len(cluster.Nodes) > 0 {
+		add("es_jvm_heap_used_max", heap, "%")
+		add("es_disk_used_max", disk, "%")
+	}
+	for _, level := range esWatermarkLevels {
+		add("es_nodes_disk_"+level, float64(exceeded[level]), "")
+	}
+
+	add("es_indexing_total", float64(cluster.IndexingTotal), "")
+	add("es_search_total", float64(cluster.SearchTotal), "")
+	add("es_indexing_rate", cluster.IndexingRate, "/s")
+	add("es_search_rate", cluster.SearchRate, "/s")
+	return metrics
+}
+
+// checkESHealth 通过 /_cluster/health 检查集群，区分无法连接和集群为 red
+func (s *MiddlewareService) checkESHealth(m *model.Middleware) error {
+	endpoint, release, err := s.clients.httpEndpoint(m)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	data, code, err := endpoint.do(ctx, http.MethodGet, "/_cluster/health", nil)
+	s.clients.report(m, clientHTTP, err)
+	if code == 0 {
+		return fmt.Errorf("elasticsearch unreachable: %v", err)
+	}
+	if err != nil {
+		return err
+	}
+	var health esClusterHealth
+	if err := json.Unmarshal(data, &health); err != nil {
+		return fmt.Errorf("invalid /_cluster/health response: %v", err)
+	}
+	// yellow 时数据仍然可用，通过 es_status 和 es_unassigned_shards 告警
+	if health.Status == "red" {
+		return ErrESClusterRed
+	}
+	return nil
+}
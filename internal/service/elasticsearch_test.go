@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"middleware-platform/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const esNodesStatsJSON = `{"nodes":{
+	"a":{"name":"es1","host":"10.0.0.1","jvm":{"mem":{"heap_used_percent":62}},
+		"indices":{"indexing":{"index_total":1000},"search":{"query_total":500}},
+		"fs":{"total":{"total_in_bytes":1000,"available_in_bytes":80}}},
+	"b":{"name":"es2","host":"10.0.0.2","jvm":{"mem":{"heap_used_percent":71}},
+		"indices":{"indexing":{"index_total":2000},"search":{"query_total":100}},
+		"fs":{"total":{"total_in_bytes":1000,"available_in_bytes":130}}},
+	"c":{"name":"es3","host":"10.0.0.3","jvm":{"mem":{"heap_used_percent":40}},
+		"indices":{"indexing":{"index_total":0},"search":{"query_total":0}},
+		"fs":{"total":{"total_in_bytes":1000,"available_in_bytes":500}}}}}`
+
+// fakeES 返回固定内容的 Elasticsearch stand-in，status 为集群健康颜色
+func fakeES(t *testing.T, status string) *model.Middleware {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "elastic", user)
+		assert.Equal(t, "secret", password)
+		switch r.URL.Path {
+		case "/_cluster/health":
+			io.WriteString(w, `{"cluster_name":"logs","status":"`+status+`","number_of_nodes":3,"number_of_data_nodes":3,
+				"active_shards":10,"unassigned_shards":2,"active_shards_percent_as_number":83.3}`)
+		case "/_nodes/stats/jvm,indices,fs":
+			io.WriteString(w, esNodesStatsJSON)
+		case "/_cluster/settings":
+			io.WriteString(w, `{"persistent":{"cluster.routing.allocation.disk.watermark.high":"88%"},
+				"defaults":{"cluster.routing.allocation.disk.watermark.low":"85%","cluster.routing.allocation.disk.watermark.high":"90%",
+				"cluster.routing.allocation.disk.watermark.flood_stage":"100b"}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	return &model.Middleware{ID: 5, Type: "elasticsearch", Host: host, Port: port, Credentials: "secret",
+		Options: json.RawMessage(`{"username":"elastic"}`)}
+}
+
+func TestCollectESMetrics(t *testing.T) {
+	mw := fakeES(t, "yellow")
+	s := &MetricsService{clients: NewClientPool(0)}
+
+	metrics, err := s.collectESMetrics(context.Background(), *mw)
+	assert.NoError(t, err)
+	values := metricValues(metrics)
+	assert.Equal(t, 1.0, values["es_status"])
+	assert.Equal(t, 2.0, values["es_unassigned_shards"])
+	assert.Equal(t, 71.0, values["es_jvm_heap_used_max"])
+	assert.Equal(t, 92.0, values["es_disk_used_max"])
+	assert.Equal(t, 2.0, values["es_nodes_disk_low"])
+	assert.Equal(t, 1.0, values["es_nodes_disk_high"])
+	assert.Equal(t, 1.0, values["es_nodes_disk_flood_stage"])
+	assert.Equal(t, 3000.0, values["es_indexing_total"])
+
+	cluster, err := s.GetESCluster(mw.ID)
+	if !assert.NoError(t, err) || !assert.Len(t, cluster.Nodes, 3) {
+		return
+	}
+	assert.Equal(t, "88%", cluster.Watermarks["high"])
+	assert.Equal(t, []string{"flood_stage", "low", ""},
+		[]string{cluster.Nodes[0].Watermark, cluster.Nodes[1].Watermark, cluster.Nodes[2].Watermark})
+}
+
+func TestESRates(t *testing.T) {
+	now := time.Now()
+	previous := &ESCluster{IndexingTotal: 1000, SearchTotal: 600, CheckedAt: now.Add(-10 * time.Second)}
+	cluster := &ESCluster{IndexingTotal: 1500, SearchTotal: 500, CheckedAt: now}
+
+	esRates(cluster, previous)
+	assert.Equal(t, 50.0, cluster.IndexingRate)
+	// 节点重启后计数减小，不计算速率
+	assert.Equal(t, 0.0, cluster.SearchRate)
+}
+
+func TestESWatermarkExceeded(t *testing.T) {
+	assert.True(t, esWatermarkExceeded("85%", 100, 10))
+	assert.False(t, esWatermarkExceeded("85%", 100, 20))
+	assert.True(t, esWatermarkExceeded("0.8", 100, 20))
+	assert.True(t, esWatermarkExceeded("1gb", 10<<30, 1<<30))
+	assert.False(t, esWatermarkExceeded("1gb", 10<<30, 2<<30))
+	assert.False(t, esWatermarkExceeded("bogus", 100, 0))
+}
+
+func TestCheckESHealth(t *testing.T) {
+	s := &MiddlewareService{clients: NewClientPool(0)}
+
+	assert.NoError(t, s.checkESHealth(fakeES(t, "yellow")))
+	assert.ErrorIs(t, s.checkESHealth(fakeES(t, "red")), ErrESClusterRed)
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"middleware-platform/internal/model"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	clientHTTP = "http"
+	// 单个 HTTP 响应的大小上限
+	maxEndpointResponse = 16 << 20
+)
+
+// endpointOptions 基于 HTTP 的中间件（etcd 等）在 Middleware.Options 中的连接选项
+type endpointOptions struct {
+	Scheme             string `json:"scheme"`               // http（默认）或 https
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"` // 不校验服务端证书
+	Username           string `json:"username"`             // 设置时以 HTTP Basic 认证，密码为凭据
+}
+
+// decodeOptions 将 Middleware.Options 解析到v，未设置时保持v的零值
+func decodeOptions(mw *model.Middleware, v interface{}) error {
+	if len(mw.Options) == 0 || string(mw.Options) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(mw.Options, v); err != nil {
+		return fmt.Errorf("invalid options of middleware %d: %v", mw.ID, err)
+	}
+	return nil
+}
+
+// httpEndpoint 一个中间件的 HTTP 访问入口
+type httpEndpoint struct {
+	client  *http.Client
+	baseURL string
+	header  http.Header // 每个请求附带的请求头，如访问令牌
+}
+
+func (e *httpEndpoint) Close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// httpEndpoint 获取中间件的 HTTP 客户端，超时由调用方的 ctx 控制，使用完后调用release
+func (p *ClientPool) httpEndpoint(mw *model.Middleware) (*httpEndpoint, func(), error) {
+	client, release, err := p.get(mw, clientHTTP, func() (io.Closer, error) {
+		var opts endpointOptions
+		if err := decodeOptions(mw, &opts); err != nil {
+			return nil, err
+		}
+		scheme := strings.ToLower(opts.Scheme)
+		switch scheme {
+		case "":
+			scheme = "http"
+		case "http", "https":
+		default:
+			return nil, fmt.Errorf("unsupported scheme %q", opts.Scheme)
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.MaxIdleConnsPerHost = clientPoolSize
+		if opts.InsecureSkipVerify {
+			transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		}
+		endpoint := &httpEndpoint{
+			client:  &http.Client{Transport: transport},
+			baseURL: scheme + "://" + net.JoinHostPort(mw.Host, mw.Port),
+			header:  make(http.Header),
+		}
+		switch {
+		case opts.Username != "":
+			auth := base64.StdEncoding.EncodeToString([]byte(opts.Username + ":" + mw.Credentials))
+			endpoint.header.Set("Authorization", "Basic "+auth)
+		// Consul 的凭据是 ACL token
+		case strings.EqualFold(mw.Type, "consul") && mw.Credentials != "":
+			endpoint.header.Set("X-Consul-Token", mw.Credentials)
+		}
+		return endpoint, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return client.(*httpEndpoint), release, nil
+}
+
+// do 发送请求并返回响应内容，非 2xx 响应作为错误返回
+func (e *httpEndpoint) do(ctx context.Context, method, path string, body []byte) ([]byte, int, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, e.baseURL+path, reader)
+	if err != nil {
+		return nil, 0, err
+	}
+	for key, values := range e.header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxEndpointResponse))
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return data, resp.StatusCode, fmt.Errorf("%s %s returned %s", method, path, resp.Status)
+	}
+	return data, resp.StatusCode, nil
+}
+
+// getJSON 请求path并将响应解析到v
+func (e *httpEndpoint) getJSON(ctx context.Context, path string, v interface{}) error {
+	data, _, err := e.do(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// postJSON 以 JSON 请求体调用path并将响应解析到v
+func (e *httpEndpoint) postJSON(ctx context.Context, path string, body, v interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	data, _, err := e.do(ctx, http.MethodPost, path, payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,339 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"middleware-platform/internal/model"
+	"middleware-platform/internal/prom"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AlertEventEtcdLeaderChanged etcd 集群的 leader 发生变化
+const AlertEventEtcdLeaderChanged = "etcd_leader_changed"
+
+var (
+	// ErrEtcdNoLeader 成员可以访问但集群没有 leader，与无法连接区分
+	ErrEtcdNoLeader  = errors.New("etcd member has no leader")
+	ErrNoEtcdCluster = errors.New("no etcd cluster discovered for this middleware")
+)
+
+// etcdNumber grpc-gateway 将 64 位整数编码为字符串，兼容字符串和数字两种形式
+type etcdNumber string
+
+func (n *etcdNumber) UnmarshalJSON(b []byte) error {
+	*n = etcdNumber(strings.Trim(string(b), `"`))
+	return nil
+}
+
+func (n etcdNumber) Float64() float64 {
+	v, _ := strconv.ParseFloat(string(n), 64)
+	return v
+}
+
+// etcdStatus POST /v3/maintenance/status 的响应
+type etcdStatus struct {
+	Header struct {
+		ClusterID etcdNumber `json:"cluster_id"`
+		MemberID  etcdNumber `json:"member_id"`
+	} `json:"header"`
+	Version          string     `json:"version"`
+	DBSize           etcdNumber `json:"dbSize"`
+	DBSizeInUse      etcdNumber `json:"dbSizeInUse"`
+	Leader           etcdNumber `json:"leader"`
+	RaftIndex        etcdNumber `json:"raftIndex"`
+	RaftTerm         etcdNumber `json:"raftTerm"`
+	RaftAppliedIndex etcdNumber `json:"raftAppliedIndex"`
+	IsLearner        bool       `json:"isLearner"`
+	Errors           []string   `json:"errors"`
+}
+
+// etcdMemberList POST /v3/cluster/member/list 的响应
+type etcdMemberList struct {
+	Members []struct {
+		ID         etcdNumber `json:"ID"`
+		Name       string     `json:"name"`
+		PeerURLs   []string   `json:"peerURLs"`
+		ClientURLs []string   `json:"clientURLs"`
+		IsLearner  bool       `json:"isLearner"`
+	} `json:"members"`
+}
+
+// EtcdMember etcd 集群成员
+type EtcdMember struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	PeerURLs     []string `json:"peer_urls"`
+	ClientURLs   []string `json:"client_urls"`
+	Role         string   `json:"role"` // leader, follower, learner
+	MiddlewareID uint     `json:"middleware_id"`
+}
+
+// EtcdCluster etcd 集群最近一次检查的状态
+type EtcdCluster struct {
+	MiddlewareID uint         `json:"middleware_id"`
+	ClusterID    string       `json:"cluster_id"`
+	Version      string       `json:"version"`
+	LeaderID     string       `json:"leader_id"`
+	Leader       string       `json:"leader"` // leader 成员名称
+	RaftTerm     int64        `json:"raft_term"`
+	DBSize       int64        `json:"db_size"`
+	DBSizeInUse  int64        `json:"db_size_in_use"`
+	Quota        int64        `json:"quota"`
+	Members      []EtcdMember `json:"members"`
+	Errors       []string     `json:"errors"` // 成员报告的告警，如 NOSPACE
+	CheckedAt    time.Time    `json:"checked_at"`
+}
+
+// GetEtcdCluster 获取最近一次检查的集群成员和 leader
+func (s *MetricsService) GetEtcdCluster(middlewareID uint) (*EtcdCluster, error) {
+	cluster, _ := s.clusters.get(middlewareID).(*EtcdCluster)
+	if cluster == nil {
+		return nil, ErrNoEtcdCluster
+	}
+	return cluster, nil
+}
+
+// etcdMetricNames 从 /metrics 采集的指标及保存时使用的名称
+var etcdMetricNames = []struct {
+	source string
+	name   string
+	unit   string
+}{
+	{"etcd_server_has_leader", "etcd_has_leader", ""},
+	{"etcd_server_is_leader", "etcd_is_leader", ""},
+	{"etcd_server_leader_changes_seen_total", "etcd_leader_changes", ""},
+	{"etcd_server_proposals_failed_total", "etcd_proposals_failed", ""},
+	{"etcd_server_proposals_pending", "etcd_proposals_pending", ""},
+	{"etcd_server_proposals_committed_total", "etcd_proposals_committed", ""},
+	{"etcd_server_proposals_applied_total", "etcd_proposals_applied", ""},
+	{"etcd_mvcc_db_total_size_in_bytes", "etcd_db_size", "bytes"},
+	{"etcd_mvcc_db_total_size_in_use_in_bytes", "etcd_db_size_in_use", "bytes"},
+	{"etcd_server_quota_backend_bytes", "etcd_db_quota", "bytes"},
+}
+
+// etcdMetrics 从 /metrics 和 maintenance status 生成指标，包括数据库大小占配额的比例和 raft 应用延迟
+func etcdMetrics(middlewareID uint, samples []prom.TextSample, status *etcdStatus, now time.Time) []model.Metrics {
+	values := make(map[string]float64)
+	var metrics []model.Metrics
+	add := func(name string, value float64, unit string) {
+		values[name] = value
+		metrics = append(metrics, model.Metrics{
+			MiddlewareID: middlewareID,
+			Type:         name,
+			Value:        value,
+			Unit:         unit,
+			Timestamp:    now,
+		})
+	}
+
+	for _, m := range etcdMetricNames {
+		if v, ok := prom.Sum(samples, m.source); ok {
+			add(m.name, v, m.unit)
+		}
+	}
+	// 3.4 之前数据库大小只在 debugging 指标中
+	if _, ok := values["etcd_db_size"]; !ok {
+		if v, ok := prom.Sum(samples, "etcd_debugging_mvcc_db_total_size_in_bytes"); ok {
+			add("etcd_db_size", v, "bytes")
+		} else if status != nil && status.DBSize != "" {
+			add("etcd_db_size", status.DBSize.Float64(), "bytes")
+		}
+	}
+	if quota := values["etcd_db_quota"]; quota > 0 {
+		add("etcd_db_quota_usage", values["etcd_db_size"]/quota*100, "%")
+	}
+	if status != nil && status.RaftAppliedIndex != "" {
+		add("etcd_raft_apply_lag", status.RaftIndex.Float64()-status.RaftAppliedIndex.Float64(), "")
+	}
+	return metrics
+}
+
+func (s *MetricsService) collectEtcdMetrics(ctx context.Context, mw model.Middleware) ([]model.Metrics, error) {
+	endpoint, release, err := s.clients.httpEndpoint(&mw)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	data, _, err := endpoint.do(ctx, http.MethodGet, "/metrics", nil)
+	s.clients.report(&mw, clientHTTP, err)
+	if err != nil {
+		return nil, err
+	}
+	samples, err := prom.ParseText(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid /metrics response: %v", err)
+	}
+
+	// maintenance status 失败不影响 /metrics 中的指标
+	var status *etcdStatus
+	var st etcdStatus
+	if err := endpoint.postJSON(ctx, "/v3/maintenance/status", struct{}{}, &st); err != nil {
+		log.Printf("Failed to get etcd status of middleware %d: %v", mw.ID, err)
+	} else {
+		status = &st
+	}
+	metrics := etcdMetrics(mw.ID, samples, status, time.Now())
+
+	// 成员只从用户添加的实例发现
+	if mw.ParentID == nil {
+		cluster, err := s.discoverEtcdCluster(ctx, endpoint, &mw, status, samples)
+		if err != nil {
+			log.Printf("Failed to discover etcd cluster of middleware %d: %v", mw.ID, err)
+		} else {
+			metrics = append(metrics, model.Metrics{
+				MiddlewareID: mw.ID,
+				Type:         "etcd_members",
+				Value:        float64(len(cluster.Members)),
+				Timestamp:    cluster.CheckedAt,
+			})
+		}
+	}
+	return metrics, nil
+}
+
+// discoverEtcdCluster 获取成员列表并同步为子实例，leader 变化时告警
+func (s *MetricsService) discoverEtcdCluster(ctx context.Context, endpoint *httpEndpoint, mw *model.Middleware,
+	status *etcdStatus, samples []prom.TextSample) (*EtcdCluster, error) {
+	var list etcdMemberList
+	if err := endpoint.postJSON(ctx, "/v3/cluster/member/list", struct{}{}, &list); err != nil {
+		return nil, err
+	}
+	cluster := buildEtcdCluster(list, status)
+	cluster.MiddlewareID = mw.ID
+	cluster.CheckedAt = time.Now()
+	if quota, ok := prom.Sum(samples, "etcd_server_quota_backend_bytes"); ok {
+		cluster.Quota = int64(quota)
+	}
+
+	var members []discoveredMember
+	for _, m := range cluster.Members {
+		if host, port, ok := etcdClientAddr(m.ClientURLs); ok {
+			members = append(members, discoveredMember{Host: host, Port: port, Role: m.Role})
+		}
+	}
+	ids, err := s.syncMembers(mw, members)
+	if err != nil {
+		return nil, err
+	}
+	for i := range cluster.Members {
+		if host, port, ok := etcdClientAddr(cluster.Members[i].ClientURLs); ok {
+			cluster.Members[i].MiddlewareID = ids[memberAddr(host, port)]
+		}
+	}
+
+	previous, _ := s.clusters.get(mw.ID).(*EtcdCluster)
+	if previous != nil && previous.LeaderID != "" && cluster.LeaderID != "" && previous.LeaderID != cluster.LeaderID {
+		s.raiseEvent(AlertEventEtcdLeaderChanged, mw.ID, fmt.Sprintf("etcd cluster %s leader changed from %s to %s",
+			mw.Name, previous.Leader, cluster.Leader))
+	}
+	s.clusters.set(mw.ID, cluster)
+	return cluster, nil
+}
+
+// buildEtcdCluster 根据成员列表和状态中的 leader 确定每个成员的角色
+func buildEtcdCluster(list etcdMemberList, status *etcdStatus) *EtcdCluster {
+	cluster := &EtcdCluster{}
+	if status != nil {
+		cluster.ClusterID = string(status.Header.ClusterID)
+		cluster.Version = status.Version
+		cluster.LeaderID = string(status.Leader)
+		cluster.RaftTerm = int64(status.RaftTerm.Float64())
+		cluster.DBSize = int64(status.DBSize.Float64())
+		cluster.DBSizeInUse = int64(status.DBSizeInUse.Float64())
+		cluster.Errors = status.Errors
+	}
+	for _, m := range list.Members {
+		member := EtcdMember{
+			ID:         string(m.ID),
+			Name:       m.Name,
+			PeerURLs:   m.PeerURLs,
+			ClientURLs: m.ClientURLs,
+			Role:       "follower",
+		}
+		switch {
+		case m.IsLearner:
+			member.Role = "learner"
+		case member.ID == cluster.LeaderID:
+			member.Role = "leader"
+			cluster.Leader = m.Name
+		}
+		cluster.Members = append(cluster.Members, member)
+	}
+	// 没有 leader 时 status 中的 leader 为 0
+	if cluster.LeaderID == "0" {
+		cluster.LeaderID = ""
+	}
+	return cluster
+}
+
+// etcdClientAddr 取第一个客户端地址，尚未启动的成员没有客户端地址
+func etcdClientAddr(clientURLs []string) (string, string, bool) {
+	if len(clientURLs) == 0 {
+		return "", "", false
+	}
+	u, err := url.Parse(clientURLs[0])
+	if err != nil || u.Hostname() == "" {
+		return "", "", false
+	}
+	port := u.Port()
+	if port == "" {
+		port = "2379"
+	}
+	return u.Hostname(), port, true
+}
+
+// checkEtcdHealth 通过 /health 检查成员，区分无法连接和集群没有 leader
+func (s *MiddlewareService) checkEtcdHealth(m *model.Middleware) error {
+	endpoint, release, err := s.clients.httpEndpoint(m)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	// 不健康时 /health 返回 503，响应内容仍是 JSON
+	data, code, err := endpoint.do(ctx, http.MethodGet, "/health", nil)
+	if code == 0 {
+		s.clients.report(m, clientHTTP, err)
+		return fmt.Errorf("etcd unreachable: %v", err)
+	}
+	s.clients.report(m, clientHTTP, nil)
+
+	var health struct {
+		Health string `json:"health"`
+		Reason string `json:"reason"`
+	}
+	if jsonErr := json.Unmarshal(data, &health); jsonErr != nil {
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("invalid /health response: %v", jsonErr)
+	}
+	if health.Health == "true" {
+		return nil
+	}
+	if strings.Contains(strings.ToUpper(health.Reason), "NO LEADER") {
+		return ErrEtcdNoLeader
+	}
+	// 3.5 之前的 /health 不返回原因，通过 /metrics 判断是否有 leader
+	if health.Reason == "" {
+		if data, _, err := endpoint.do(ctx, http.MethodGet, "/metrics", nil); err == nil {
+			samples, _ := prom.ParseText(bytes.NewReader(data))
+			if v, ok := prom.Sum(samples, "etcd_server_has_leader"); ok && v == 0 {
+				return ErrEtcdNoLeader
+			}
+		}
+		return errors.New("etcd reports unhealthy")
+	}
+	return fmt.Errorf("etcd unhealthy: %s", health.Reason)
+}
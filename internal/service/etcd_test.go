@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"middleware-platform/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const etcdMetricsText = `# HELP etcd_server_has_leader Whether or not a leader exists. 1 is existence, 0 is not.
+# TYPE etcd_server_has_leader gauge
+etcd_server_has_leader 1
+etcd_server_is_leader 0
+etcd_server_leader_changes_seen_total 2
+etcd_server_proposals_failed_total 1
+etcd_server_proposals_pending 0
+etcd_mvcc_db_total_size_in_bytes 5.36870912e+08
+etcd_server_quota_backend_bytes 2.147483648e+09
+`
+
+// fakeEtcd 返回固定内容的 etcd stand-in，health 为 /health 的响应
+func fakeEtcd(t *testing.T, health string, healthCode int) *model.Middleware {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/health":
+			w.WriteHeader(healthCode)
+			io.WriteString(w, health)
+		case "/metrics":
+			io.WriteString(w, etcdMetricsText)
+		case "/v3/maintenance/status":
+			assert.Equal(t, http.MethodPost, r.Method)
+			io.WriteString(w, `{"header":{"cluster_id":"14841639068965178418","member_id":"10276657743932975437"},
+				"version":"3.5.9","dbSize":"536870912","leader":"10276657743932975437",
+				"raftIndex":"120","raftTerm":"3","raftAppliedIndex":"118"}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	parentID := uint(1)
+	return &model.Middleware{ID: 2, Type: "etcd", Host: host, Port: port, ParentID: &parentID}
+}
+
+func TestCollectEtcdMetrics(t *testing.T) {
+	mw := fakeEtcd(t, `{"health":"true"}`, http.StatusOK)
+	s := &MetricsService{clients: NewClientPool(0)}
+
+	metrics, err := s.collectEtcdMetrics(context.Background(), *mw)
+	assert.NoError(t, err)
+	values := metricValues(metrics)
+	assert.Equal(t, 1.0, values["etcd_has_leader"])
+	assert.Equal(t, 2.0, values["etcd_leader_changes"])
+	assert.Equal(t, 1.0, values["etcd_proposals_failed"])
+	assert.Equal(t, 25.0, values["etcd_db_quota_usage"])
+	assert.Equal(t, 2.0, values["etcd_raft_apply_lag"])
+}
+
+func TestCheckEtcdHealth(t *testing.T) {
+	s := &MiddlewareService{clients: NewClientPool(0)}
+
+	assert.NoError(t, s.checkEtcdHealth(fakeEtcd(t, `{"health":"true","reason":""}`, http.StatusOK)))
+
+	err := s.checkEtcdHealth(fakeEtcd(t, `{"health":"false","reason":"RAFT NO LEADER"}`, http.StatusServiceUnavailable))
+	assert.ErrorIs(t, err, ErrEtcdNoLeader)
+
+	err = s.checkEtcdHealth(fakeEtcd(t, `{"health":"false","reason":"ALARM NOSPACE"}`, http.StatusServiceUnavailable))
+	assert.EqualError(t, err, "etcd unhealthy: ALARM NOSPACE")
+
+	// 无法连接与没有 leader 的错误不同
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+	err = s.checkEtcdHealth(&model.Middleware{ID: 3, Type: "etcd", Host: host, Port: port})
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrEtcdNoLeader)
+	assert.Contains(t, err.Error(), "etcd unreachable")
+}
+
+func TestBuildEtcdCluster(t *testing.T) {
+	var list etcdMemberList
+	assert.NoError(t, json.Unmarshal([]byte(`{"members":[
+		{"ID":"10276657743932975437","name":"etcd1","peerURLs":["http://10.0.0.1:2380"],"clientURLs":["http://10.0.0.1:2379"]},
+		{"ID":"2","name":"etcd2","clientURLs":["https://10.0.0.2:2379"]},
+		{"ID":"3","name":"etcd3","isLearner":true,"clientURLs":["http://10.0.0.3"]},
+		{"ID":"4","peerURLs":["http://10.0.0.4:2380"]}]}`), &list))
+	status := &etcdStatus{Leader: "10276657743932975437", Version: "3.5.9"}
+
+	cluster := buildEtcdCluster(list, status)
+	if !assert.Len(t, cluster.Members, 4) {
+		return
+	}
+	assert.Equal(t, "etcd1", cluster.Leader)
+	assert.Equal(t, []string{"leader", "follower", "learner", "follower"},
+		[]string{cluster.Members[0].Role, cluster.Members[1].Role, cluster.Members[2].Role, cluster.Members[3].Role})
+
+	host, port, ok := etcdClientAddr(cluster.Members[2].ClientURLs)
+	assert.True(t, ok)
+	assert.Equal(t, "10.0.0.3", host)
+	assert.Equal(t, "2379", port)
+	// 尚未启动的成员没有客户端地址
+	_, _, ok = etcdClientAddr(cluster.Members[3].ClientURLs)
+	assert.False(t, ok)
+
+	// 没有 leader
+	cluster = buildEtcdCluster(list, &etcdStatus{Leader: "0"})
+	assert.Equal(t, "", cluster.LeaderID)
+	assert.Equal(t, "", cluster.Leader)
+}
+
+func TestDecodeOptions(t *testing.T) {
+	var opts endpointOptions
+	assert.NoError(t, decodeOptions(&model.Middleware{}, &opts))
+	assert.NoError(t, decodeOptions(&model.Middleware{Options: json.RawMessage(`{"scheme":"https","insecure_skip_verify":true}`)}, &opts))
+	assert.Equal(t, endpointOptions{Scheme: "https", InsecureSkipVerify: true}, opts)
+	assert.Error(t, decodeOptions(&model.Middleware{Options: json.RawMessage(`[1]`)}, &opts))
+}
@@ -2,57 +2,100 @@ package service
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
 	"middleware-platform/internal/model"
+	"strings"
 	"time"
 
-	"github.com/go-redis/redis/v8"
-	"github.com/go-zookeeper/zk"
 	_ "github.com/lib/pq"
 )
 
+// healthCheckTimeout 单次健康检查的超时
+const healthCheckTimeout = 5 * time.Second
+
 func (s *MiddlewareService) checkRedisHealth(m *model.Middleware) error {
-	client := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%s", m.Host, m.Port),
-		Password: m.Credentials,
-		DB:       0,
-	})
-	
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	client, release, err := s.clients.redisClient(m)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
 	defer cancel()
-	
-	return client.Ping(ctx).Err()
+
+	err = client.Ping(ctx).Err()
+	s.clients.report(m, clientRedis, err)
+	return err
 }
 
 func (s *MiddlewareService) checkMySQLHealth(m *model.Middleware) error {
-	dsn := fmt.Sprintf("user:password@tcp(%s:%s)/", m.Host, m.Port)
-	db, err := sql.Open("mysql", dsn)
-	if err != nil {
-		return err
-	}
-	defer db.Close()
-	
-	return db.Ping()
+	return s.checkSQLHealth(m)
 }
 
 func (s *MiddlewareService) checkPgHealth(m *model.Middleware) error {
-	dsn := fmt.Sprintf("host=%s port=%s user=postgres sslmode=disable", m.Host, m.Port)
-	db, err := sql.Open("postgres", dsn)
+	return s.checkSQLHealth(m)
+}
+
+func (s *MiddlewareService) checkSQLHealth(m *model.Middleware) error {
+	db, release, err := s.clients.sqlDB(m)
 	if err != nil {
 		return err
 	}
-	defer db.Close()
-	
-	return db.Ping()
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	s.clients.report(m, clientSQL, err)
+	return err
 }
 
+// checkZKHealth 通过 srvr 确认节点在提供服务，失去法定人数的节点可以连接但拒绝请求。
+// srvr 未加入四字命令白名单时依次退回到 ruok 和客户端读请求
 func (s *MiddlewareService) checkZKHealth(m *model.Middleware) error {
-	conn, _, err := zk.Connect([]string{fmt.Sprintf("%s:%s", m.Host, m.Port)}, time.Second*5)
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	addr := memberAddr(m.Host, m.Port)
+	_, err := zkServerStats(ctx, addr)
+	if !errors.Is(err, ErrZKCommandNotAllowed) {
+		return err
+	}
+	out, err := zkCommand(ctx, addr, "ruok")
+	if err == nil {
+		if strings.TrimSpace(out) != "imok" {
+			return fmt.Errorf("zookeeper %s answered ruok with %q", addr, out)
+		}
+		return nil
+	}
+	if !errors.Is(err, ErrZKCommandNotAllowed) {
+		return err
+	}
+	return s.checkZKSession(m)
+}
+
+// checkZKSession zk.Connect 不等待连接建立，通过一次读请求确认服务可用
+func (s *MiddlewareService) checkZKSession(m *model.Middleware) error {
+	conn, release, err := s.clients.zkConn(m)
 	if err != nil {
 		return err
 	}
-	defer conn.Close()
-	
-	return nil
-} 
\ No newline at end of file
+
+	// 超时返回后请求可能仍在使用连接，请求结束时才归还
+	done := make(chan error, 1)
+	go func() {
+		defer release()
+		_, _, err := conn.Exists("/")
+		done <- err
+	}()
+
+	select {
+	case err = <-done:
+	case <-time.After(healthCheckTimeout):
+		err = fmt.Errorf("zookeeper %s:%s did not respond within %s", m.Host, m.Port, healthCheckTimeout)
+	}
+	s.clients.report(m, clientZK, err)
+	return err
+}
@@ -1,31 +1,76 @@
 package service
 
 import (
+	"context"
 	"crypto/md5"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"io"
+	"log"
 	"middleware-platform/internal/model"
 	"middleware-platform/internal/repository"
+	"middleware-platform/internal/telemetry"
 	"os"
-	"sync"
+	"path/filepath"
+	"strconv"
 	"time"
-	"log"
-	"golang.org/x/crypto/ssh"
 )
 
+// progressInterval 进度推送的最小间隔
+const progressInterval = 500 * time.Millisecond
+
 type HostService struct {
 	repo *repository.HostRepository
-	// 添加同步任务管理
-	syncTasks map[uint]chan struct{} // key: FileSyncID, value: control channel
-	mu        sync.RWMutex
+	// 文件同步任务队列
+	queue *SyncQueue
+	// 定时/监听触发
+	scheduler *syncScheduler
+	alerter   EventAlerter
+	// 执行中的滚动分发任务
+	distributions runningJobs
+	// 执行中的文件收集任务及收集结果的存储目录
+	collections runningJobs
+	storageDir  string
+	// 推送版本的存储目录和保留数量，用于回滚
+	revisionDir       string
+	revisionRetention int
+	// 全局带宽上限与大文件传输窗口，见 SetTransferPolicy
+	bandwidth       *tokenBucket
+	largeFileSize   int64
+	largeFileWindow *transferWindow
 }
 
-func NewHostService(repo *repository.HostRepository) *HostService {
-	return &HostService{
-		repo:      repo,
-		syncTasks: make(map[uint]chan struct{}),
+func NewHostService(repo *repository.HostRepository, syncWorkers, syncQueueSize int) *HostService {
+	s := &HostService{
+		repo:          repo,
+		queue:         NewSyncQueue(syncWorkers, syncQueueSize),
+		distributions: runningJobs{cancels: make(map[uint]context.CancelFunc)},
+		collections:   runningJobs{cancels: make(map[uint]context.CancelFunc)},
+		storageDir:    defaultCollectionDir,
+
+		revisionDir:       defaultRevisionDir,
+		revisionRetention: defaultRevisionRetention,
 	}
+	s.scheduler = newSyncScheduler(func() ([]model.FileSync, error) {
+		return repo.FindFileSyncsByTriggerMode(SyncTriggerCron, SyncTriggerWatch)
+	}, s.TriggerSync, defaultWatchInterval)
+
+	telemetry.Default.GaugeFunc("middleware_platform_sync_queue_depth",
+		"File syncs waiting in the queue for a worker.", func() float64 {
+			return float64(s.SyncQueueDepth())
+		})
+	return s
+}
+
+// SyncQueueDepth 返回排队等待执行的同步任务数
+func (s *HostService) SyncQueueDepth() int {
+	return s.queue.Depth()
+}
+
+// SetAlerter 设置同步失败时的告警出口
+func (s *HostService) SetAlerter(alerter EventAlerter) {
+	s.alerter = alerter
 }
 
 func (s *HostService) GetAll() ([]model.Host, error) {
@@ -54,26 +99,7 @@ func (s *HostService) Delete(id uint) error {
 }
 
 func (s *HostService) testConnection(host *model.Host) error {
-	config := &ssh.ClientConfig{
-		User: host.Username,
-		Auth: []ssh.AuthMethod{},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         5 * time.Second,
-	}
-
-	if host.Password != "" {
-		config.Auth = append(config.Auth, ssh.Password(host.Password))
-	}
-
-	if host.SSHKey != "" {
-		signer, err := ssh.ParsePrivateKey([]byte(host.SSHKey))
-		if err != nil {
-			return fmt.Errorf("failed to parse SSH key: %v", err)
-		}
-		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
-	}
-
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host.IP, host.Port), config)
+	client, err := newSSHClient(host)
 	if err != nil {
 		log.Printf("Failed to ssh host: %v", err)
 		return err
@@ -82,20 +108,30 @@ func (s *HostService) testConnection(host *model.Host) error {
 	return nil
 }
 
-// 计算文件MD5
-func calculateFileMD5(filePath string) (string, error) {
+// fileChecksums 文件校验和：MD5用于增量判断，SHA-256用于远程校验
+type fileChecksums struct {
+	MD5    string
+	SHA256 string
+}
+
+// 一次读取同时计算文件MD5和SHA-256
+func calculateFileChecksums(filePath string) (fileChecksums, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
-		return "", err
+		return fileChecksums{}, err
 	}
 	defer file.Close()
 
-	hash := md5.New()
-	if _, err := io.Copy(hash, file); err != nil {
-		return "", err
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(md5Hash, sha256Hash), file); err != nil {
+		return fileChecksums{}, err
 	}
 
-	return hex.EncodeToString(hash.Sum(nil)), nil
+	return fileChecksums{
+		MD5:    hex.EncodeToString(md5Hash.Sum(nil)),
+		SHA256: hex.EncodeToString(sha256Hash.Sum(nil)),
+	}, nil
 }
 
 // 获取文件信息
@@ -111,49 +147,217 @@ func getFileInfo(filePath string) (int64, int64, error) {
 // 添加进度跟踪的 io.Reader 包装器
 type progressReader struct {
 	io.Reader
-	total    int64
-	current  int64
-	progress chan<- float64
-	speed    chan<- float64
-	start    time.Time
-	control  <-chan struct{}
-	fileSync *model.FileSync
-	repo     *repository.HostRepository
+	ctx        context.Context
+	task       *syncTask
+	total      int64
+	current    int64
+	lastSize   int64
+	lastReport time.Time
+	report     func(current int64, speed float64)
 }
 
 func (pr *progressReader) Read(p []byte) (int, error) {
 	// 检查是否取消
-	select {
-	case <-pr.control:
+	if err := pr.ctx.Err(); err != nil {
 		return 0, fmt.Errorf("sync cancelled")
-	default:
 	}
 
-	// 检查是否暂停
-	if pr.fileSync.IsPaused {
-		time.Sleep(time.Second)
-		return 0, nil
+	// 暂停期间阻塞
+	if pr.task != nil && pr.task.isPaused() {
+		if err := pr.task.waitIfPaused(); err != nil {
+			return 0, fmt.Errorf("sync cancelled")
+		}
+		// 暂停时间不计入速度
+		pr.lastReport = time.Now()
+		pr.lastSize = pr.current
 	}
 
 	n, err := pr.Reader.Read(p)
 	if n > 0 {
 		pr.current += int64(n)
-		progress := float64(pr.current) * 100 / float64(pr.total)
-		pr.progress <- progress
 
-		elapsed := time.Since(pr.start).Seconds()
-		if elapsed > 0 {
-			speed := float64(pr.current) / elapsed
-			pr.speed <- speed
+		// 按间隔推送进度，不再每次读取都写库
+		elapsed := time.Since(pr.lastReport)
+		if elapsed >= progressInterval || pr.current == pr.total {
+			speed := float64(pr.current-pr.lastSize) / elapsed.Seconds()
+			pr.report(pr.current, speed)
+			pr.lastReport = time.Now()
+			pr.lastSize = pr.current
 		}
-
-		// 更新已同步大小
-		pr.fileSync.SyncedSize = pr.current
-		pr.repo.UpdateFileSync(pr.fileSync)
 	}
 	return n, err
 }
 
+// StartSyncWorkers 启动同步worker，并将重启前未完成的同步、分发和收集任务继续执行
+func (s *HostService) StartSyncWorkers(ctx context.Context) {
+	s.queue.Start(ctx, s.runSyncTask)
+
+	s.distributions.mu.Lock()
+	s.distributions.ctx = ctx
+	s.distributions.mu.Unlock()
+	s.resumeDistributions()
+
+	s.collections.mu.Lock()
+	s.collections.ctx = ctx
+	s.collections.mu.Unlock()
+	s.resumeCollections()
+
+	fileSyncs, err := s.repo.FindFileSyncsByStatus("pending", "syncing", "waiting")
+	if err != nil {
+		log.Printf("Failed to load unfinished file syncs: %v", err)
+		return
+	}
+	for _, fileSync := range fileSyncs {
+		if err := s.repo.UpdateFileSyncStatus(fileSync.ID, "pending"); err != nil {
+			log.Printf("Failed to reset file sync %d: %v", fileSync.ID, err)
+			continue
+		}
+		if err := s.queue.Enqueue(fileSync.ID, fileSync.LastTrigger, fileSync.Priority); err != nil {
+			log.Printf("Failed to requeue file sync %d: %v", fileSync.ID, err)
+		}
+	}
+}
+
+// StartSyncScheduler 启动定时和源文件监听触发，watchInterval为源文件轮询间隔
+func (s *HostService) StartSyncScheduler(ctx context.Context, watchInterval time.Duration) {
+	if watchInterval > 0 {
+		s.scheduler.interval = watchInterval
+	}
+	go s.scheduler.run(ctx)
+}
+
+// SubmitSync 持久化同步任务并放入队列，由worker异步执行。
+// 定时/监听任务在首次同步后由调度器继续触发。
+func (s *HostService) SubmitSync(fileSync *model.FileSync) error {
+	if _, err := s.repo.FindByID(fileSync.HostID); err != nil {
+		return fmt.Errorf("host %d not found: %v", fileSync.HostID, err)
+	}
+	if err := validateSyncTrigger(fileSync); err != nil {
+		return err
+	}
+	if err := validateTransferSettings(fileSync.BandwidthLimit, fileSync.TransferWindow); err != nil {
+		return err
+	}
+
+	// 重新执行已有任务时，不允许打断未结束的任务
+	if fileSync.ID != 0 {
+		existing, err := s.repo.FindFileSyncByID(fileSync.ID)
+		if err != nil {
+			return err
+		}
+		if !IsFinalSyncStatus(existing.Status) {
+			return fmt.Errorf("file sync %d is %s", fileSync.ID, existing.Status)
+		}
+	}
+
+	fileSync.Status = "pending"
+	fileSync.Progress = 0
+	fileSync.Speed = 0
+	fileSync.SyncedSize = 0
+	fileSync.IsPaused = false
+	fileSync.RollbackRevision = 0
+
+	var err error
+	if fileSync.ID == 0 {
+		err = s.repo.CreateFileSync(fileSync)
+	} else {
+		err = s.repo.UpdateFileSync(fileSync)
+	}
+	if err != nil {
+		return err
+	}
+
+	if fileSync.TriggerMode != SyncTriggerManual {
+		s.scheduler.Reload()
+	}
+
+	if err := s.queue.Enqueue(fileSync.ID, SyncTriggerManual, fileSync.Priority); err != nil {
+		s.failSync(fileSync, fileChecksums{}, 0, err)
+		return err
+	}
+	return nil
+}
+
+// TriggerSync 由定时或源文件变化重新执行已有的同步任务，上一次执行未结束时返回ErrSyncBusy
+func (s *HostService) TriggerSync(fileSyncID uint, trigger string) error {
+	fileSync, err := s.repo.FindFileSyncByID(fileSyncID)
+	if err != nil {
+		return err
+	}
+	if !IsFinalSyncStatus(fileSync.Status) {
+		return ErrSyncBusy
+	}
+
+	if err := s.repo.UpdateFileSyncStatus(fileSyncID, "pending"); err != nil {
+		return err
+	}
+	if err := s.queue.Enqueue(fileSyncID, trigger, fileSync.Priority); err != nil {
+		fileSync.LastTrigger = trigger
+		s.failSync(fileSync, fileChecksums{MD5: fileSync.MD5, SHA256: fileSync.SHA256}, fileSync.FileSize, err)
+		return err
+	}
+	return nil
+}
+
+// UpdateFileSyncDefinition 修改同步任务的路径和触发配置，执行中的任务不允许修改
+func (s *HostService) UpdateFileSyncDefinition(fileSyncID uint, input *model.FileSync) (*model.FileSync, error) {
+	fileSync, err := s.repo.FindFileSyncByID(fileSyncID)
+	if err != nil {
+		return nil, err
+	}
+	if fileSync.Status == "pending" || fileSync.Status == "syncing" {
+		return nil, ErrSyncBusy
+	}
+	if err := validateSyncTrigger(input); err != nil {
+		return nil, err
+	}
+	if err := validateTransferSettings(input.BandwidthLimit, input.TransferWindow); err != nil {
+		return nil, err
+	}
+
+	fileSync.SourcePath = input.SourcePath
+	fileSync.TargetPath = input.TargetPath
+	fileSync.Description = input.Description
+	fileSync.IsIncremental = input.IsIncremental
+	fileSync.TriggerMode = input.TriggerMode
+	fileSync.Schedule = input.Schedule
+	fileSync.DebounceSeconds = input.DebounceSeconds
+	fileSync.Priority = input.Priority
+	fileSync.BandwidthLimit = input.BandwidthLimit
+	fileSync.TransferWindow = input.TransferWindow
+	if err := s.repo.UpdateFileSync(fileSync); err != nil {
+		return nil, err
+	}
+
+	s.scheduler.Reload()
+	return fileSync, nil
+}
+
+// runSyncTask worker执行同步任务的入口
+func (s *HostService) runSyncTask(task *syncTask) {
+	fileSync, err := s.repo.FindFileSyncByID(task.id)
+	if err != nil {
+		log.Printf("Failed to load file sync %d: %v", task.id, err)
+		return
+	}
+	if task.trigger != "" {
+		fileSync.LastTrigger = task.trigger
+	}
+	if err := s.SyncFile(task.ctx, fileSync); err != nil {
+		log.Printf("File sync %d finished with error: %v", task.id, err)
+	}
+}
+
+// GetFileSync 获取同步任务
+func (s *HostService) GetFileSync(fileSyncID uint) (*model.FileSync, error) {
+	return s.repo.FindFileSyncByID(fileSyncID)
+}
+
+// SubscribeSyncProgress 订阅同步任务的实时进度，返回的函数用于取消订阅
+func (s *HostService) SubscribeSyncProgress(fileSyncID uint) (<-chan SyncProgress, func()) {
+	return s.queue.progress.subscribe(fileSyncID)
+}
+
 // PauseSync 暂停同步
 func (s *HostService) PauseSync(fileSyncID uint) error {
 	fileSync, err := s.repo.FindFileSyncByID(fileSyncID)
@@ -161,13 +365,17 @@ func (s *HostService) PauseSync(fileSyncID uint) error {
 		return err
 	}
 
-	if fileSync.Status != "syncing" {
+	if fileSync.Status != "syncing" && fileSync.Status != "pending" {
 		return fmt.Errorf("file sync is not in progress")
 	}
 
-	fileSync.IsPaused = true
+	if err := s.queue.Pause(fileSyncID); err != nil {
+		return err
+	}
+
 	fileSync.Status = "paused"
-	return s.repo.UpdateFileSync(fileSync)
+	s.publishProgress(fileSync, "")
+	return s.repo.UpdateFileSyncStatus(fileSyncID, "paused")
 }
 
 // ResumeSync 恢复同步
@@ -181,201 +389,302 @@ func (s *HostService) ResumeSync(fileSyncID uint) error {
 		return fmt.Errorf("file sync is not paused")
 	}
 
-	fileSync.IsPaused = false
-	fileSync.Status = "syncing"
-	go s.SyncFile(fileSync) // 重新开始同步
-	return s.repo.UpdateFileSync(fileSync)
+	// 传输中暂停的任务直接继续，否则重新入队
+	if err := s.queue.Resume(fileSyncID); err == nil {
+		fileSync.Status = "syncing"
+		s.publishProgress(fileSync, "")
+		return s.repo.UpdateFileSyncStatus(fileSyncID, "syncing")
+	}
+
+	if err := s.repo.UpdateFileSyncStatus(fileSyncID, "pending"); err != nil {
+		return err
+	}
+	fileSync.Status = "pending"
+	s.publishProgress(fileSync, "")
+	return s.queue.Enqueue(fileSyncID, fileSync.LastTrigger, fileSync.Priority)
 }
 
 // CancelSync 取消同步
 func (s *HostService) CancelSync(fileSyncID uint) error {
-	s.mu.Lock()
-	if ch, exists := s.syncTasks[fileSyncID]; exists {
-		close(ch)
-		delete(s.syncTasks, fileSyncID)
-	}
-	s.mu.Unlock()
-
 	fileSync, err := s.repo.FindFileSyncByID(fileSyncID)
 	if err != nil {
 		return err
 	}
 
+	if IsFinalSyncStatus(fileSync.Status) {
+		return fmt.Errorf("file sync already %s", fileSync.Status)
+	}
+
+	s.queue.Cancel(fileSyncID)
+
+	if err := s.repo.UpdateFileSyncStatus(fileSyncID, "cancelled"); err != nil {
+		return err
+	}
+	if fileSync.RollbackRevision != 0 {
+		if err := s.repo.ClearFileSyncRollback(fileSyncID); err != nil {
+			return err
+		}
+	}
 	fileSync.Status = "cancelled"
-	return s.repo.UpdateFileSync(fileSync)
+	s.publishProgress(fileSync, "cancelled by user")
+	return s.repo.CreateSyncHistory(&model.FileSyncHistory{
+		FileSyncID: fileSync.ID,
+		Status:     "cancelled",
+		Message:    "cancelled by user",
+		MD5:        fileSync.MD5,
+		SHA256:     fileSync.SHA256,
+		FileSize:   fileSync.FileSize,
+		SyncType:   getSyncType(fileSync.IsIncremental),
+		Trigger:    fileSync.LastTrigger,
+	})
 }
 
-// SyncFile 同步文件到远程主机
-func (s *HostService) SyncFile(fileSync *model.FileSync) error {
-	// 创建控制通道
-	s.mu.Lock()
-	controlCh := make(chan struct{})
-	s.syncTasks[fileSync.ID] = controlCh
-	s.mu.Unlock()
+// SyncFile 同步文件到远程主机，ctx取消时中断传输
+func (s *HostService) SyncFile(ctx context.Context, fileSync *model.FileSync) error {
+	fileSync.Status = "syncing"
+	if err := s.repo.UpdateFileSyncStatus(fileSync.ID, "syncing"); err != nil {
+		return err
+	}
+	s.publishProgress(fileSync, "")
 
-	defer func() {
-		s.mu.Lock()
-		delete(s.syncTasks, fileSync.ID)
-		s.mu.Unlock()
-	}()
+	if fileSync.RollbackRevision > 0 {
+		return s.rollbackSync(ctx, fileSync)
+	}
 
 	// 获取源文件信息
 	modTime, size, err := getFileInfo(fileSync.SourcePath)
 	if err != nil {
-		log.Printf("Failed to get file info: %v", err)
-		return err
+		return s.failSync(fileSync, fileChecksums{}, 0, err)
+	}
+
+	// 窗口外不占用worker，等窗口打开后重新入队
+	if window := s.transferWindowFor(fileSync.TransferWindow, size); window != nil && !window.contains(time.Now()) {
+		return s.deferSync(fileSync, window)
 	}
 
-	// 计算MD5
-	md5sum, err := calculateFileMD5(fileSync.SourcePath)
+	// 计算校验和
+	sums, err := calculateFileChecksums(fileSync.SourcePath)
 	if err != nil {
-		log.Printf("Failed to calculate file MD5: %v", err)
-		return err
+		log.Printf("Failed to calculate file checksums: %v", err)
+		return s.failSync(fileSync, fileChecksums{}, size, err)
 	}
 
 	// 检查是否需要同步
-	if fileSync.IsIncremental && fileSync.MD5 == md5sum {
+	if fileSync.IsIncremental && fileSync.MD5 == sums.MD5 {
 		// 文件未变化，不需要同步
-		return nil
+		return s.completeSync(fileSync, sums, modTime, size, "skipped", "source unchanged", "")
+	}
+
+	// 首次同步前备份目标上的原有文件
+	if err := s.ensureBaseline(ctx, fileSync); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return s.failSync(fileSync, sums, size, err)
 	}
 
-	// 执行同步
-	if err := s.doSync(fileSync, size, controlCh); err != nil {
-		// 记录同步失败历史
+	// 源文件快照为新版本，推送快照内容
+	revision, err := s.repo.FindMaxSyncRevision(fileSync.ID)
+	if err != nil {
+		return s.failSync(fileSync, sums, size, err)
+	}
+	revision++
+	storagePath, snapshot, snapshotSize, err := s.snapshotSource(fileSync, revision)
+	if err != nil {
+		return s.failSync(fileSync, sums, size, fmt.Errorf("failed to save revision: %v", err))
+	}
+	sums, size = snapshot, snapshotSize
+
+	// 执行同步并校验远程文件
+	if err := s.doSync(ctx, fileSync, storagePath, size, sums.SHA256); err != nil {
+		os.Remove(storagePath)
+		// 取消或服务停止：状态由取消方记录，停止时保留syncing以便重启后恢复
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		log.Printf("Failed to sync file: %v", err)
-		s.repo.CreateSyncHistory(&model.FileSyncHistory{
-			FileSyncID: fileSync.ID,
-			Status:     "failed",
-			Message:    err.Error(),
-			MD5:        md5sum,
-			FileSize:   size,
-			SyncType:   getSyncType(fileSync.IsIncremental),
-		})
+		return s.failSync(fileSync, sums, size, err)
+	}
+
+	// 传输完成后才被取消：取消状态已由CancelSync记录，不再覆盖为completed
+	if ctx.Err() != nil {
+		os.Remove(storagePath)
+		return ctx.Err()
+	}
+
+	fileSync.Revision = revision
+	s.markInSync(fileSync)
+	err = s.completeSync(fileSync, sums, modTime, size, "success",
+		fmt.Sprintf("sync completed as revision %d, remote sha256 verified", revision), storagePath)
+	s.pruneRevisions(fileSync)
+	return err
+}
+
+// deferSync 将任务置为waiting，在传输窗口打开时重新入队；
+// 窗口只限制开始时间，已开始的传输不会在窗口关闭时中断
+func (s *HostService) deferSync(fileSync *model.FileSync, window *transferWindow) error {
+	now := time.Now()
+	open := window.nextOpen(now)
+	fileSync.Status = "waiting"
+	if err := s.repo.UpdateFileSyncStatus(fileSync.ID, "waiting"); err != nil {
 		return err
 	}
+	s.publishProgress(fileSync, fmt.Sprintf("waiting for transfer window %s, starts at %s", window, open.Format("2006-01-02 15:04")))
+
+	id, trigger, priority := fileSync.ID, fileSync.LastTrigger, fileSync.Priority
+	time.AfterFunc(open.Sub(now), func() {
+		current, err := s.repo.FindFileSyncByID(id)
+		// 等待期间被取消或重新提交
+		if err != nil || current.Status != "waiting" {
+			return
+		}
+		if err := s.repo.UpdateFileSyncStatus(id, "pending"); err != nil {
+			log.Printf("Failed to requeue file sync %d: %v", id, err)
+			return
+		}
+		if err := s.queue.Enqueue(id, trigger, priority); err != nil {
+			log.Printf("Failed to requeue file sync %d: %v", id, err)
+		}
+	})
+	return nil
+}
 
-	// 更新同步状态
+// completeSync 更新同步状态并记录成功历史，storagePath为本次产生的新版本内容
+func (s *HostService) completeSync(fileSync *model.FileSync, sums fileChecksums, modTime, size int64, status, message, storagePath string) error {
 	fileSync.Status = "completed"
+	fileSync.Progress = 100
 	fileSync.LastSyncAt = time.Now().Format("2006-01-02 15:04:05")
-	fileSync.MD5 = md5sum
+	fileSync.MD5 = sums.MD5
+	fileSync.SHA256 = sums.SHA256
 	fileSync.ModifiedTime = modTime
 	fileSync.FileSize = size
+	fileSync.SyncedSize = size
+	fileSync.IsPaused = false
 
 	if err := s.repo.UpdateFileSync(fileSync); err != nil {
 		log.Printf("Failed to update file sync: %v", err)
-			return err
+		return err
 	}
+	s.publishProgress(fileSync, message)
 
-	// 记录同步成功历史
 	return s.repo.CreateSyncHistory(&model.FileSyncHistory{
 		FileSyncID: fileSync.ID,
-		Status:     "success",
-		Message:    "sync completed",
-		MD5:        md5sum,
-		FileSize:   size,
-		SyncType:   getSyncType(fileSync.IsIncremental),
+		Status:      status,
+		Message:     message,
+		MD5:         sums.MD5,
+		SHA256:      sums.SHA256,
+		Revision:    fileSync.Revision,
+		StoragePath: storagePath,
+		FileSize:    size,
+		SyncType:    getSyncType(fileSync.IsIncremental),
+		Trigger:     fileSync.LastTrigger,
 	})
 }
 
-// doSync 执行实际的文件同步
-func (s *HostService) doSync(fileSync *model.FileSync, size int64, controlCh chan struct{}) error {
-	host, err := s.repo.FindByID(1)
-	if err != nil {
-		log.Printf("FindByID Failed to find host: %v", err)
-		return err
+// failSync 标记同步失败并记录失败历史，返回原始错误
+func (s *HostService) failSync(fileSync *model.FileSync, sums fileChecksums, size int64, cause error) error {
+	fileSync.Status = "failed"
+	fileSync.IsPaused = false
+	if err := s.repo.UpdateFileSync(fileSync); err != nil {
+		log.Printf("Failed to update file sync: %v", err)
 	}
+	s.publishProgress(fileSync, cause.Error())
 
-	// 创建SSH客户端配置
-	config := &ssh.ClientConfig{
-		User: host.Username,
-		Auth: []ssh.AuthMethod{},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
-		Timeout:         5 * time.Second,
+	if err := s.repo.CreateSyncHistory(&model.FileSyncHistory{
+		FileSyncID: fileSync.ID,
+		Status:     "failed",
+		Message:    cause.Error(),
+		MD5:        sums.MD5,
+		SHA256:     sums.SHA256,
+		FileSize:   size,
+		SyncType:   getSyncType(fileSync.IsIncremental),
+		Trigger:    fileSync.LastTrigger,
+	}); err != nil {
+		log.Printf("Failed to record sync history: %v", err)
 	}
 
-	if host.Password != "" {
-		config.Auth = append(config.Auth, ssh.Password(host.Password))
+	if s.alerter != nil {
+		message := fmt.Sprintf("file sync %d (%s -> host %d:%s, trigger %s) failed: %v",
+			fileSync.ID, fileSync.SourcePath, fileSync.HostID, fileSync.TargetPath, fileSync.LastTrigger, cause)
+		if err := s.alerter.RaiseEvent(AlertEventFileSyncFailed, strconv.FormatUint(uint64(fileSync.ID), 10), message); err != nil {
+			log.Printf("Failed to raise file sync alert: %v", err)
+		}
 	}
+	return cause
+}
 
-	if host.SSHKey != "" {
-		signer, err := ssh.ParsePrivateKey([]byte(host.SSHKey))
-		if err != nil {
-			log.Printf("Failed to parse SSH key: %v", err)
-			return fmt.Errorf("failed to parse SSH key: %v", err)
-		}
-		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+func (s *HostService) publishProgress(fileSync *model.FileSync, message string) {
+	s.queue.progress.publish(SyncProgress{
+		FileSyncID: fileSync.ID,
+		Status:     fileSync.Status,
+		Progress:   fileSync.Progress,
+		Speed:      fileSync.Speed,
+		SyncedSize: fileSync.SyncedSize,
+		FileSize:   fileSync.FileSize,
+		Message:    message,
+	})
+}
+
+// doSync 将srcPath的内容推送到目标主机，传输完成后在目标主机计算SHA-256并与本地比对
+func (s *HostService) doSync(ctx context.Context, fileSync *model.FileSync, srcPath string, size int64, sha256sum string) error {
+	host, err := s.repo.FindByID(fileSync.HostID)
+	if err != nil {
+		log.Printf("FindByID Failed to find host: %v", err)
+		return err
 	}
 
 	// 连接到远程主机
-	client, err := ssh.Dial("tcp", fmt.Sprintf("%s:%d", host.IP, host.Port), config)
+	client, err := newSSHClient(host)
 	if err != nil {
 		log.Printf("Failed to ssh host: %v", err)
 		return err
 	}
 	defer client.Close()
 
-	// 创建SFTP会话
-	session, err := client.NewSession()
-	if err != nil {
-		return err
-	}
-	defer session.Close()
+	// 取消时关闭连接，中断阻塞中的传输
+	defer closeOnCancel(ctx, client)()
 
 	// 读取源文件
-	src, err := os.Open(fileSync.SourcePath)
+	src, err := os.Open(srcPath)
 	if err != nil {
 		return err
 	}
 	defer src.Close()
 
-	// 创建目标文件
-	dst, err := session.StdinPipe()
+	info, err := src.Stat()
 	if err != nil {
 		return err
 	}
 
-	// 启动scp命令
-	if err := session.Start(fmt.Sprintf("scp -t %s", fileSync.TargetPath)); err != nil {
+	fileSync.FileSize = size
+	reader := &progressReader{
+		Reader:     s.throttle(ctx, src, newTokenBucket(int64(fileSync.BandwidthLimit)*1024)),
+		ctx:        ctx,
+		task:       s.queue.task(fileSync.ID),
+		total:      size,
+		lastReport: time.Now(),
+		report: func(current int64, speed float64) {
+			fileSync.SyncedSize = current
+			fileSync.Progress = float64(current) * 100 / float64(size)
+			fileSync.Speed = speed
+			s.publishProgress(fileSync, "")
+		},
+	}
+
+	name := filepath.Base(fileSync.SourcePath)
+	if err := scpUpload(client, reader, size, info.Mode(), fileSync.TargetPath, name); err != nil {
 		return err
 	}
 
-	// 创建进度和速度通道
-	progressCh := make(chan float64)
-	speedCh := make(chan float64)
-	defer close(progressCh)
-	defer close(speedCh)
-
-	// 启动goroutine更新进度
-	go func() {
-		for {
-			select {
-			case progress := <-progressCh:
-				fileSync.Progress = progress
-				s.repo.UpdateFileSync(fileSync)
-			case speed := <-speedCh:
-				fileSync.Speed = speed
-				s.repo.UpdateFileSync(fileSync)
-			case <-time.After(5 * time.Second):
-				return
-			}
-		}
-	}()
-
-	// 创建带进度的Reader
-	reader := &progressReader{
-		Reader:   src,
-		total:    size,
-		progress: progressCh,
-		speed:    speedCh,
-		start:    time.Now(),
-		control:  controlCh,
-		fileSync: fileSync,
-		repo:     s.repo,
-	}
-
-	// 复制文件内容
-	_, err = io.Copy(dst, reader)
-	return err
+	remote, exists, err := remoteSHA256(client, fileSync.TargetPath, name)
+	if err != nil {
+		return fmt.Errorf("remote verification failed: %v", err)
+	}
+	fileSync.RemoteSHA256 = remote
+	if !exists || remote != sha256sum {
+		return fmt.Errorf("remote verification failed: local sha256 %s, remote %q", sha256sum, remote)
+	}
+	return nil
 }
 
 // getSyncType 根据是否增量同步返回同步类型
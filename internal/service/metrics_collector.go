@@ -2,26 +2,24 @@ package service
 
 import (
 	"context"
-	"database/sql"
-	"fmt"
+	"log"
 	"middleware-platform/internal/model"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/go-redis/redis/v8"
 	_ "github.com/lib/pq"
 )
 
 func (s *MetricsService) collectRedisMetrics(ctx context.Context, mw model.Middleware) ([]model.Metrics, error) {
-	client := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%s", mw.Host, mw.Port),
-		Password: mw.Credentials,
-		DB:       0,
-	})
-	defer client.Close()
+	client, release, err := s.clients.redisClient(&mw)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
 	info, err := client.Info(ctx).Result()
+	s.clients.report(&mw, clientRedis, err)
 	if err != nil {
 		return nil, err
 	}
@@ -70,6 +68,25 @@ func (s *MetricsService) collectRedisMetrics(ctx context.Context, mw model.Middl
 		}
 	}
 
+	metrics = append(metrics, redisDetailMetrics(mw.ID, infoMap, time.Now())...)
+
+	mode := infoMap["redis_mode"]
+	// 拓扑只从用户添加的实例发现，自动创建的成员不再发现
+	if mw.ParentID == nil && (mode == redisModeCluster || mode == redisModeSentinel) {
+		topology, err := s.discoverRedisTopology(ctx, client, &mw, mode)
+		if err != nil {
+			log.Printf("Failed to discover redis %s topology of middleware %d: %v", mode, mw.ID, err)
+		}
+		metrics = append(metrics, topology...)
+	}
+
+	// 慢查询采集失败不影响指标，Sentinel 不支持 SLOWLOG
+	if mode != redisModeSentinel {
+		if err := s.captureSlowLog(ctx, client, mw); err != nil {
+			log.Printf("Failed to capture slowlog of middleware %d: %v", mw.ID, err)
+		}
+	}
+
 	return metrics, nil
 }
 
@@ -95,20 +112,17 @@ func parseRedisInfo(info string) map[string]string {
 }
 
 func (s *MetricsService) collectDBMetrics(ctx context.Context, mw model.Middleware) ([]model.Metrics, error) {
-	var dsn string
-	if mw.Type == "postgresql" {
-		dsn = fmt.Sprintf("host=%s port=%s user=postgres password=%s sslmode=disable",
-			mw.Host, mw.Port, mw.Credentials)
-	} else {
-		dsn = fmt.Sprintf("%s:%s@tcp(%s:%s)/",
-			"user", mw.Credentials, mw.Host, mw.Port)
+	db, release, err := s.clients.sqlDB(&mw)
+	if err != nil {
+		return nil, err
 	}
-
-	db, err := sql.Open(mw.Type, dsn)
+	defer release()
+	// 连接失败时整个采集失败，而不是返回空结果
+	err = db.PingContext(ctx)
+	s.clients.report(&mw, clientSQL, err)
 	if err != nil {
 		return nil, err
 	}
-	defer db.Close()
 
 	metrics := []model.Metrics{}
 
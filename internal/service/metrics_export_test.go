@@ -0,0 +1,55 @@
+package service
+
+import (
+	"bytes"
+	"middleware-platform/internal/model"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteMiddlewareGauges(t *testing.T) {
+	middlewares := []model.Middleware{
+		{ID: 1, Name: "cache", Type: "redis", Host: "10.0.0.1"},
+		{ID: 2, Name: "orders", Type: "postgresql", Host: "10.0.0.2"},
+	}
+	metrics := []model.Metrics{
+		{MiddlewareID: 2, Type: "connections", Value: 12},
+		{MiddlewareID: 1, Type: "memory_usage", Value: 512.5, Unit: "MB"},
+		{MiddlewareID: 1, Type: "connections", Value: 3},
+		// 已删除的中间件
+		{MiddlewareID: 9, Type: "connections", Value: 1},
+	}
+
+	var buf bytes.Buffer
+	writeMiddlewareGauges(&buf, metrics, middlewares)
+	assert.Equal(t, `# HELP middleware_connections Latest collected connections value.
+# TYPE middleware_connections gauge
+middleware_connections{middleware_id="1",name="cache",type="redis",host="10.0.0.1"} 3
+middleware_connections{middleware_id="2",name="orders",type="postgresql",host="10.0.0.2"} 12
+# HELP middleware_memory_usage Latest collected memory_usage value in MB.
+# TYPE middleware_memory_usage gauge
+middleware_memory_usage{middleware_id="1",name="cache",type="redis",host="10.0.0.1"} 512.5
+`, buf.String())
+}
+
+func TestWriteMiddlewareGauges_SeriesLabels(t *testing.T) {
+	middlewares := []model.Middleware{{ID: 1, Name: "broker", Type: "kafka", Host: "10.0.0.3"}}
+	metrics := []model.Metrics{
+		{MiddlewareID: 1, Type: "consumer_lag", Value: 40, Labels: map[string]string{"topic": "payments", "group": "billing"}},
+		{MiddlewareID: 1, Type: "consumer_lag", Value: 7, Labels: map[string]string{"topic": "orders", "group": "billing"}},
+		// 与中间件标签同名的序列标签
+		{MiddlewareID: 1, Type: "up", Value: 1, Labels: map[string]string{"host": "kafka-0", "job": "kafka"}},
+	}
+
+	var buf bytes.Buffer
+	writeMiddlewareGauges(&buf, metrics, middlewares)
+	assert.Equal(t, `# HELP middleware_consumer_lag Latest collected consumer_lag value.
+# TYPE middleware_consumer_lag gauge
+middleware_consumer_lag{middleware_id="1",name="broker",type="kafka",host="10.0.0.3",group="billing",topic="orders"} 7
+middleware_consumer_lag{middleware_id="1",name="broker",type="kafka",host="10.0.0.3",group="billing",topic="payments"} 40
+# HELP middleware_up Latest collected up value.
+# TYPE middleware_up gauge
+middleware_up{middleware_id="1",name="broker",type="kafka",host="10.0.0.3",exported_host="kafka-0",job="kafka"} 1
+`, buf.String())
+}
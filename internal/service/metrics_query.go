@@ -0,0 +1,330 @@
+package service
+
+import (
+	"fmt"
+	"math"
+	"middleware-platform/internal/model"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 支持的聚合方式
+const (
+	AggregationAvg  = "avg"
+	AggregationMin  = "min"
+	AggregationMax  = "max"
+	AggregationSum  = "sum"
+	AggregationP95  = "p95"
+	AggregationRate = "rate"
+)
+
+// maxQueryPoints 单条序列返回的最大点数
+const maxQueryPoints = 11000
+
+// MetricsQuery 指标查询条件
+type MetricsQuery struct {
+	MiddlewareIDs []uint
+	// 按中间件属性选择：type、name、host、status，与 MiddlewareIDs 取并集
+	Selector    map[string]string
+	Metrics     []string // 为空时返回所选中间件的全部指标
+	Start       time.Time
+	End         time.Time
+	Step        time.Duration // 为0时按 maxChartPoints 自动计算
+	Aggregation string
+}
+
+// InvalidQueryError 查询条件不合法
+type InvalidQueryError struct {
+	msg string
+}
+
+func (e *InvalidQueryError) Error() string {
+	return e.msg
+}
+
+func invalidQuery(format string, args ...interface{}) error {
+	return &InvalidQueryError{msg: fmt.Sprintf(format, args...)}
+}
+
+// MetricsQueryResult 所有序列共享同一组时间点，便于图表对齐和跨实例比较
+type MetricsQueryResult struct {
+	Start       time.Time       `json:"start"`
+	End         time.Time       `json:"end"`
+	Step        float64         `json:"step"` // 秒
+	Resolution  string          `json:"resolution"`
+	Aggregation string          `json:"aggregation"`
+	Timestamps  []time.Time     `json:"timestamps"`
+	Series      []QueriedSeries `json:"series"`
+}
+
+// QueriedSeries 一条序列在每个时间点的聚合值，没有数据的点为 null
+type QueriedSeries struct {
+	MiddlewareID uint              `json:"middleware_id"`
+	Middleware   string            `json:"middleware"`
+	Metric       string            `json:"metric"`
+	Unit         string            `json:"unit"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	Values       []*float64        `json:"values"`
+}
+
+// QueryMetrics 按条件查询多个中间件的指标，按step对齐并聚合
+func (s *MetricsService) QueryMetrics(q MetricsQuery) (*MetricsQueryResult, error) {
+	if q.Aggregation == "" {
+		q.Aggregation = AggregationAvg
+	}
+	if !validAggregation(q.Aggregation) {
+		return nil, invalidQuery("unsupported aggregation %q", q.Aggregation)
+	}
+	if !q.End.After(q.Start) {
+		return nil, invalidQuery("end must be after start")
+	}
+	if q.Step < 0 {
+		return nil, invalidQuery("step must be positive")
+	}
+	if q.Step == 0 {
+		q.Step = (q.End.Sub(q.Start) / maxChartPoints).Round(time.Second)
+		if q.Step < time.Second {
+			q.Step = time.Second
+		}
+	}
+	if len(q.MiddlewareIDs) == 0 && len(q.Selector) == 0 {
+		return nil, invalidQuery("middleware ids or selector required")
+	}
+
+	// 起点对齐到step，同样的查询在不同时刻得到相同的时间点
+	start := q.Start.Truncate(q.Step)
+	count := int(q.End.Sub(start)/q.Step) + 1
+	if count > maxQueryPoints {
+		return nil, invalidQuery("too many points (%d), increase step", count)
+	}
+
+	middlewares, err := s.selectMiddlewares(q.MiddlewareIDs, q.Selector)
+	if err != nil {
+		return nil, err
+	}
+	resolution := s.resolutionForStep(start, q.Step)
+	result := &MetricsQueryResult{
+		Start:       start,
+		End:         q.End,
+		Step:        q.Step.Seconds(),
+		Resolution:  resolution.Name,
+		Aggregation: q.Aggregation,
+		Timestamps:  make([]time.Time, count),
+		Series:      []QueriedSeries{},
+	}
+	for i := range result.Timestamps {
+		result.Timestamps[i] = start.Add(time.Duration(i) * q.Step)
+	}
+	if len(middlewares) == 0 {
+		return result, nil
+	}
+
+	ids := make([]uint, 0, len(middlewares))
+	names := make(map[uint]string, len(middlewares))
+	for _, mw := range middlewares {
+		ids = append(ids, mw.ID)
+		names[mw.ID] = mw.Name
+	}
+	series, err := s.metricsRepo.FindSeries(ids, q.Metrics)
+	if err != nil {
+		return nil, err
+	}
+	seriesIDs := make([]uint, 0, len(series))
+	for _, ser := range series {
+		seriesIDs = append(seriesIDs, ser.ID)
+	}
+
+	// rate 需要前一个时间段的值来计算第一个点
+	from := start
+	if q.Aggregation == AggregationRate {
+		from = start.Add(-q.Step)
+	}
+	points, err := s.metricsRepo.FindSeriesPoints(seriesIDs, resolution.Name, from, q.End)
+	if err != nil {
+		return nil, err
+	}
+	bySeries := make(map[uint][]model.MetricPoint, len(series))
+	for _, p := range points {
+		bySeries[p.SeriesID] = append(bySeries[p.SeriesID], p)
+	}
+
+	for _, ser := range series {
+		result.Series = append(result.Series, QueriedSeries{
+			MiddlewareID: ser.MiddlewareID,
+			Middleware:   names[ser.MiddlewareID],
+			Metric:       ser.Name,
+			Unit:         ser.Unit,
+			Labels:       ser.LabelMap(),
+			Values:       aggregateBuckets(bySeries[ser.ID], start, q.Step, count, q.Aggregation),
+		})
+	}
+	return result, nil
+}
+
+func validAggregation(agg string) bool {
+	switch agg {
+	case AggregationAvg, AggregationMin, AggregationMax, AggregationSum, AggregationP95, AggregationRate:
+		return true
+	}
+	return false
+}
+
+// selectMiddlewares 返回ID在ids中或属性匹配selector的中间件
+func (s *MetricsService) selectMiddlewares(ids []uint, selector map[string]string) ([]model.Middleware, error) {
+	for key := range selector {
+		switch key {
+		case "type", "name", "host", "status":
+		default:
+			return nil, invalidQuery("unsupported selector %q", key)
+		}
+	}
+	all, err := s.middlewareRepo.FindAll()
+	if err != nil {
+		return nil, err
+	}
+
+	wanted := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	var selected []model.Middleware
+	for _, mw := range all {
+		if wanted[mw.ID] || (len(selector) > 0 && matchSelector(mw, selector)) {
+			selected = append(selected, mw)
+		}
+	}
+	return selected, nil
+}
+
+// matchSelector 所有条件都满足时匹配，比较不区分大小写
+func matchSelector(mw model.Middleware, selector map[string]string) bool {
+	for key, value := range selector {
+		var field string
+		switch key {
+		case "type":
+			field = mw.Type
+		case "name":
+			field = mw.Name
+		case "host":
+			field = mw.Host
+		case "status":
+			field = mw.Status
+		}
+		if !strings.EqualFold(field, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// resolutionForStep 选择不比step粗、且数据在保留期内覆盖start的最粗粒度，减少读取的行数
+func (s *MetricsService) resolutionForStep(start time.Time, step time.Duration) model.Resolution {
+	retained := func(resolution string) bool {
+		ttl := s.retention.For(resolution)
+		return ttl <= 0 || !start.Before(time.Now().Add(-ttl))
+	}
+	for i := len(model.RollupResolutions) - 1; i >= 0; i-- {
+		res := model.RollupResolutions[i]
+		if res.Step <= step && retained(res.Name) {
+			return res
+		}
+	}
+	if retained(model.ResolutionRaw) {
+		return model.Resolution{Name: model.ResolutionRaw}
+	}
+	// step 比所有保留的数据都细，只能使用仍保留的最细聚合
+	for _, res := range model.RollupResolutions {
+		if retained(res.Name) {
+			return res
+		}
+	}
+	return model.RollupResolutions[len(model.RollupResolutions)-1]
+}
+
+// aggregateBuckets 将按时间排序的点归入 [start+i*step, start+(i+1)*step) 的时间段并聚合。
+// 聚合粒度下 p95 按时间桶的平均值计算，是近似值；rate 为时间段之间最后一个值的每秒增量，
+// 计数器重置时该点为空。
+func aggregateBuckets(points []model.MetricPoint, start time.Time, step time.Duration, count int, agg string) []*float64 {
+	values := make([]*float64, count)
+	if len(points) == 0 {
+		return values
+	}
+
+	// rate 需要 start 之前一个时间段的值，下标从 -1 开始
+	buckets := make([][]model.MetricPoint, count+1)
+	for _, p := range points {
+		offset := p.Timestamp.Sub(start)
+		if offset < -step {
+			continue
+		}
+		i := int(math.Floor(float64(offset)/float64(step))) + 1
+		if i > count {
+			continue
+		}
+		buckets[i] = append(buckets[i], p)
+	}
+
+	for i := 0; i < count; i++ {
+		bucket := buckets[i+1]
+		if len(bucket) == 0 {
+			continue
+		}
+		var v float64
+		switch agg {
+		case AggregationAvg:
+			var sum float64
+			var n int64
+			for _, p := range bucket {
+				sum += p.Sum
+				n += p.Count
+			}
+			if n == 0 {
+				continue
+			}
+			v = sum / float64(n)
+		case AggregationMin:
+			v = bucket[0].Min
+			for _, p := range bucket[1:] {
+				v = math.Min(v, p.Min)
+			}
+		case AggregationMax:
+			v = bucket[0].Max
+			for _, p := range bucket[1:] {
+				v = math.Max(v, p.Max)
+			}
+		case AggregationSum:
+			for _, p := range bucket {
+				v += p.Sum
+			}
+		case AggregationP95:
+			samples := make([]float64, 0, len(bucket))
+			for _, p := range bucket {
+				samples = append(samples, p.Avg())
+			}
+			v = percentile(samples, 0.95)
+		case AggregationRate:
+			prev := buckets[i]
+			if len(prev) == 0 {
+				continue
+			}
+			delta := bucket[len(bucket)-1].Last - prev[len(prev)-1].Last
+			if delta < 0 {
+				continue
+			}
+			v = delta / step.Seconds()
+		}
+		values[i] = &v
+	}
+	return values
+}
+
+// percentile 最近秩法计算分位数
+func percentile(samples []float64, q float64) float64 {
+	sort.Float64s(samples)
+	rank := int(math.Ceil(q*float64(len(samples)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return samples[rank]
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"middleware-platform/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChooseResolution(t *testing.T) {
+	s := &MetricsService{retention: DefaultRetentionPolicy()}
+	end := time.Now()
+	cases := []struct {
+		span time.Duration
+		want string
+	}{
+		{time.Hour, model.ResolutionRaw},
+		{6 * time.Hour, model.ResolutionRaw},
+		{24 * time.Hour, model.Resolution1m},
+		{3 * 24 * time.Hour, model.Resolution5m},
+		{30 * 24 * time.Hour, model.Resolution1h},
+		{2 * 365 * 24 * time.Hour, model.Resolution1h},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, s.chooseResolution(end.Add(-c.span), end).Name, c.span.String())
+	}
+
+	// 原始样本只保留7天，10天前的1小时查询只能用1m聚合；1m 聚合也已清理时用5m
+	start := end.Add(-10 * day)
+	assert.Equal(t, model.Resolution1m, s.chooseResolution(start, start.Add(time.Hour)).Name)
+	start = end.Add(-30 * day)
+	assert.Equal(t, model.Resolution5m, s.chooseResolution(start, start.Add(time.Hour)).Name)
+}
+
+func TestAggregateBuckets(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	step := time.Minute
+	raw := func(offset time.Duration, v float64) model.MetricPoint {
+		return model.MetricPoint{Timestamp: start.Add(offset), Count: 1, Sum: v, Min: v, Max: v, Last: v}
+	}
+	points := []model.MetricPoint{
+		raw(-30*time.Second, 100), // start 之前，只用于 rate
+		raw(0, 110),
+		raw(30*time.Second, 130),
+		raw(2*time.Minute, 190),
+	}
+	values := func(agg string) []interface{} {
+		var out []interface{}
+		for _, v := range aggregateBuckets(points, start, step, 3, agg) {
+			if v == nil {
+				out = append(out, nil)
+				continue
+			}
+			out = append(out, *v)
+		}
+		return out
+	}
+
+	assert.Equal(t, []interface{}{120.0, nil, 190.0}, values(AggregationAvg))
+	assert.Equal(t, []interface{}{110.0, nil, 190.0}, values(AggregationMin))
+	assert.Equal(t, []interface{}{130.0, nil, 190.0}, values(AggregationMax))
+	assert.Equal(t, []interface{}{240.0, nil, 190.0}, values(AggregationSum))
+	assert.Equal(t, []interface{}{130.0, nil, 190.0}, values(AggregationP95))
+	// 第一个点相对 start 之前的值增加了30，第三个点的前一个时间段没有数据
+	assert.Equal(t, []interface{}{0.5, nil, nil}, values(AggregationRate))
+
+	assert.Equal(t, []*float64{nil, nil}, aggregateBuckets(nil, start, step, 2, AggregationAvg))
+}
+
+func TestAggregateBuckets_CounterReset(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	points := []model.MetricPoint{
+		{Timestamp: start, Count: 1, Last: 50},
+		{Timestamp: start.Add(time.Minute), Count: 1, Last: 5},
+		{Timestamp: start.Add(2 * time.Minute), Count: 1, Last: 65},
+	}
+	values := aggregateBuckets(points, start, time.Minute, 3, AggregationRate)
+	assert.Nil(t, values[0])
+	assert.Nil(t, values[1])
+	assert.Equal(t, 1.0, *values[2])
+}
+
+func TestMatchSelector(t *testing.T) {
+	mw := model.Middleware{Name: "cache", Type: "Redis", Host: "10.0.0.1", Status: "running"}
+	assert.True(t, matchSelector(mw, map[string]string{"type": "redis"}))
+	assert.True(t, matchSelector(mw, map[string]string{"type": "redis", "host": "10.0.0.1"}))
+	assert.False(t, matchSelector(mw, map[string]string{"type": "redis", "name": "db"}))
+}
+
+func TestResolutionForStep(t *testing.T) {
+	s := &MetricsService{retention: DefaultRetentionPolicy()}
+	now := time.Now()
+	assert.Equal(t, model.ResolutionRaw, s.resolutionForStep(now.Add(-time.Hour), 15*time.Second).Name)
+	assert.Equal(t, model.Resolution1m, s.resolutionForStep(now.Add(-time.Hour), 2*time.Minute).Name)
+	assert.Equal(t, model.Resolution5m, s.resolutionForStep(now.Add(-time.Hour), 30*time.Minute).Name)
+	assert.Equal(t, model.Resolution1h, s.resolutionForStep(now.Add(-30*day), 6*time.Hour).Name)
+	// 原始样本和1m聚合都已过期，细step也只能用5m
+	assert.Equal(t, model.Resolution5m, s.resolutionForStep(now.Add(-30*day), 15*time.Second).Name)
+}
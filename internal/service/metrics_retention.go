@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"log"
+	"middleware-platform/internal/model"
+	"middleware-platform/internal/repository"
+	"middleware-platform/internal/telemetry"
+	"time"
+)
+
+const (
+	defaultJanitorBatchSize = 5000
+	// 两批删除之间的间隔，避免长时间占用数据库
+	janitorBatchPause = 100 * time.Millisecond
+	day               = 24 * time.Hour
+)
+
+var retentionDeleted = telemetry.Default.Counter("middleware_platform_retention_deleted_rows_total",
+	"Rows deleted by the retention janitor per table.", "table")
+
+// RetentionPolicy 各粒度指标和告警历史的保留时长，0 表示永久保留
+type RetentionPolicy struct {
+	Raw          time.Duration
+	Rollup1m     time.Duration
+	Rollup5m     time.Duration
+	Rollup1h     time.Duration
+	AlertHistory time.Duration
+}
+
+// DefaultRetentionPolicy 原始样本7天，1m 聚合14天，5m 聚合90天，1h 聚合2年，告警历史180天
+func DefaultRetentionPolicy() RetentionPolicy {
+	return RetentionPolicy{
+		Raw:          7 * day,
+		Rollup1m:     14 * day,
+		Rollup5m:     90 * day,
+		Rollup1h:     730 * day,
+		AlertHistory: 180 * day,
+	}
+}
+
+// For 返回指定粒度的保留时长
+func (p RetentionPolicy) For(resolution string) time.Duration {
+	switch resolution {
+	case model.ResolutionRaw:
+		return p.Raw
+	case model.Resolution1m:
+		return p.Rollup1m
+	case model.Resolution5m:
+		return p.Rollup5m
+	case model.Resolution1h:
+		return p.Rollup1h
+	}
+	return 0
+}
+
+// SetRetention 设置保留策略，查询时不会选择数据已被清理的粒度
+func (s *MetricsService) SetRetention(policy RetentionPolicy) {
+	s.retention = policy
+}
+
+// GetStorageUsage 按中间件统计指标占用的存储，用于估算数据库磁盘
+func (s *MetricsService) GetStorageUsage() (*model.MetricStorageReport, error) {
+	return s.metricsRepo.StorageUsage()
+}
+
+// RetentionJanitor 按保留策略分批清理过期的指标和告警历史
+type RetentionJanitor struct {
+	metricsRepo *repository.MetricsRepository
+	alertRepo   *repository.AlertRepository
+	policy      RetentionPolicy
+	batchSize   int
+}
+
+func NewRetentionJanitor(metricsRepo *repository.MetricsRepository, alertRepo *repository.AlertRepository, policy RetentionPolicy, batchSize int) *RetentionJanitor {
+	if batchSize <= 0 {
+		batchSize = defaultJanitorBatchSize
+	}
+	return &RetentionJanitor{
+		metricsRepo: metricsRepo,
+		alertRepo:   alertRepo,
+		policy:      policy,
+		batchSize:   batchSize,
+	}
+}
+
+// Start 启动时清理一次，之后每隔interval清理，interval<=0 时不启动
+func (j *RetentionJanitor) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := j.Run(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("Retention cleanup failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Run 依次清理原始样本（及 Redis 慢查询）、各粒度聚合和告警历史
+func (j *RetentionJanitor) Run(ctx context.Context) error {
+	now := time.Now()
+
+	if ttl := j.policy.Raw; ttl > 0 {
+		cutoff := now.Add(-ttl)
+		if err := j.deleteInBatches(ctx, "metrics", func(limit int) (int64, error) {
+			return j.metricsRepo.DeleteSamplesBefore(cutoff, limit)
+		}); err != nil {
+			return err
+		}
+		// Redis 慢查询与原始样本保留相同时长
+		if err := j.deleteInBatches(ctx, "redis_slow_logs", func(limit int) (int64, error) {
+			return j.metricsRepo.DeleteSlowLogsBefore(cutoff, limit)
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, res := range model.RollupResolutions {
+		ttl := j.policy.For(res.Name)
+		if ttl <= 0 {
+			continue
+		}
+		resolution, cutoff := res.Name, now.Add(-ttl)
+		if err := j.deleteInBatches(ctx, "metric_rollups_"+resolution, func(limit int) (int64, error) {
+			return j.metricsRepo.DeleteRollupsBefore(resolution, cutoff, limit)
+		}); err != nil {
+			return err
+		}
+	}
+
+	if ttl := j.policy.AlertHistory; ttl > 0 {
+		cutoff := now.Add(-ttl)
+		if err := j.deleteInBatches(ctx, "alert_histories", func(limit int) (int64, error) {
+			return j.alertRepo.DeleteHistoryBefore(cutoff, limit)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteInBatches 每次删除至多batchSize行，直到没有过期数据或ctx取消
+func (j *RetentionJanitor) deleteInBatches(ctx context.Context, table string, del func(limit int) (int64, error)) error {
+	var total int64
+	defer func() {
+		if total > 0 {
+			log.Printf("Retention cleanup removed %d rows from %s", total, table)
+		}
+	}()
+
+	for {
+		n, err := del(j.batchSize)
+		if err != nil {
+			return err
+		}
+		total += n
+		retentionDeleted.Add(float64(n), table)
+		if n < int64(j.batchSize) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(janitorBatchPause):
+		}
+	}
+}
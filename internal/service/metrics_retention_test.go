@@ -0,0 +1,49 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"middleware-platform/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetentionJanitor_DeleteInBatches(t *testing.T) {
+	j := &RetentionJanitor{batchSize: 10}
+
+	// 25行过期数据：10 + 10 + 5，最后一批不满时停止
+	remaining := int64(25)
+	var calls []int
+	err := j.deleteInBatches(context.Background(), "test", func(limit int) (int64, error) {
+		calls = append(calls, limit)
+		n := remaining
+		if n > int64(limit) {
+			n = int64(limit)
+		}
+		remaining -= n
+		return n, nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []int{10, 10, 10}, calls)
+	assert.Equal(t, int64(0), remaining)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = j.deleteInBatches(ctx, "test", func(limit int) (int64, error) { return int64(limit), nil })
+	assert.ErrorIs(t, err, context.Canceled)
+
+	boom := errors.New("boom")
+	err = j.deleteInBatches(context.Background(), "test", func(int) (int64, error) { return 0, boom })
+	assert.ErrorIs(t, err, boom)
+}
+
+func TestRetentionPolicy_For(t *testing.T) {
+	policy := DefaultRetentionPolicy()
+	assert.Equal(t, 7*day, policy.For(model.ResolutionRaw))
+	assert.Equal(t, 90*day, policy.For(model.Resolution5m))
+	assert.Equal(t, 730*day, policy.For(model.Resolution1h))
+	assert.Equal(t, time.Duration(0), policy.For("10s"))
+}
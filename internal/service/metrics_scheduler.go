@@ -0,0 +1,316 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"middleware-platform/internal/model"
+	"middleware-platform/internal/telemetry"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultScrapeWorkers  = 8
+	defaultScrapeInterval = 30 * time.Second
+	defaultScrapeTimeout  = 10 * time.Second
+	// 重新加载中间件列表的间隔，新增或修改的中间件在该时间内生效
+	scrapeTargetRefresh = 15 * time.Second
+	scrapeTick          = time.Second
+)
+
+var (
+	scrapesSkipped = telemetry.Default.Counter("middleware_platform_scrapes_skipped_total",
+		"Scrapes skipped because the previous scrape of the same middleware was still running.", "collector")
+	scrapesDropped = telemetry.Default.Counter("middleware_platform_scrapes_dropped_total",
+		"Scrapes skipped because all scrape workers were busy.", "collector")
+)
+
+// ScrapeConfig 指标采集调度配置，中间件自己的 ScrapeInterval/ScrapeTimeout 优先于按类型的配置
+type ScrapeConfig struct {
+	Workers       int
+	Interval      time.Duration
+	Timeout       time.Duration
+	TypeIntervals map[string]time.Duration
+	TypeTimeouts  map[string]time.Duration
+}
+
+// interval 返回中间件的采集间隔
+func (c ScrapeConfig) interval(mw model.Middleware) time.Duration {
+	if mw.ScrapeInterval > 0 {
+		return time.Duration(mw.ScrapeInterval) * time.Second
+	}
+	if d, ok := c.TypeIntervals[strings.ToLower(mw.Type)]; ok && d > 0 {
+		return d
+	}
+	if c.Interval > 0 {
+		return c.Interval
+	}
+	return defaultScrapeInterval
+}
+
+// timeout 返回单次采集的超时，不超过采集间隔
+func (c ScrapeConfig) timeout(mw model.Middleware) time.Duration {
+	timeout := defaultScrapeTimeout
+	switch d, ok := c.TypeTimeouts[strings.ToLower(mw.Type)]; {
+	case mw.ScrapeTimeout > 0:
+		timeout = time.Duration(mw.ScrapeTimeout) * time.Second
+	case ok && d > 0:
+		timeout = d
+	case c.Timeout > 0:
+		timeout = c.Timeout
+	}
+	if interval := c.interval(mw); timeout > interval {
+		timeout = interval
+	}
+	return timeout
+}
+
+// scrapeOffset 中间件在采集周期内的固定偏移，把采集均匀分散到整个周期，避免同时发起
+func scrapeOffset(id uint, interval time.Duration) time.Duration {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d", id)
+	return time.Duration(h.Sum64() % uint64(interval))
+}
+
+// nextScrape 返回now之后下一个对齐到 偏移+k*interval 的时刻
+func nextScrape(now time.Time, id uint, interval time.Duration) time.Time {
+	offset := scrapeOffset(id, interval)
+	base := now.Truncate(interval).Add(offset)
+	if !base.After(now) {
+		base = base.Add(interval)
+	}
+	return base
+}
+
+type scrapeTarget struct {
+	mw       model.Middleware
+	interval time.Duration
+	timeout  time.Duration
+	next     time.Time
+	running  bool
+}
+
+// StartCollector 启动指标采集调度：每个中间件按自己的间隔采集，由固定数量的worker并发执行；
+// 上一次采集未结束或worker全忙时跳过本次，调度不会被慢的采集阻塞
+func (s *MetricsService) StartCollector(ctx context.Context, cfg ScrapeConfig) {
+	workers := cfg.Workers
+	if workers <= 0 {
+		workers = defaultScrapeWorkers
+	}
+
+	// 缓冲让同一轮到期的采集在worker间排队，缓冲也满时丢弃
+	jobs := make(chan *scrapeTarget, workers)
+	var mu sync.Mutex
+	for i := 0; i < workers; i++ {
+		go func() {
+			for target := range jobs {
+				mu.Lock()
+				mw, timeout := target.mw, target.timeout
+				mu.Unlock()
+
+				s.scrape(ctx, mw, timeout)
+
+				mu.Lock()
+				target.running = false
+				mu.Unlock()
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		ticker := time.NewTicker(scrapeTick)
+		defer ticker.Stop()
+
+		targets := make(map[uint]*scrapeTarget)
+		var refreshed time.Time
+		for {
+			now := time.Now()
+			if now.Sub(refreshed) >= scrapeTargetRefresh {
+				if err := s.refreshScrapeTargets(targets, cfg, &mu, now); err != nil {
+					log.Printf("Failed to load middlewares for collection: %v", err)
+				} else {
+					refreshed = now
+				}
+			}
+
+			dispatchScrapes(targets, now, &mu, jobs, func(target *scrapeTarget, running bool) {
+				if running {
+					scrapesSkipped.Inc(target.mw.Type)
+					s.recordSkippedScrape(target.mw.ID)
+					return
+				}
+				scrapesDropped.Inc(target.mw.Type)
+			})
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// dispatchScrapes 把到期的目标交给worker，不阻塞：上一次采集未结束（running为true）
+// 或worker全忙时跳过本次并调用skipped，目标在下一个周期再采集
+func dispatchScrapes(targets map[uint]*scrapeTarget, now time.Time, mu *sync.Mutex, jobs chan<- *scrapeTarget,
+	skipped func(target *scrapeTarget, running bool)) {
+	for _, target := range targets {
+		mu.Lock()
+		due := !now.Before(target.next)
+		if due {
+			target.next = nextScrape(now, target.mw.ID, target.interval)
+		}
+		busy := target.running
+		if due && !busy {
+			target.running = true
+		}
+		mu.Unlock()
+		if !due {
+			continue
+		}
+
+		if busy {
+			skipped(target, true)
+			continue
+		}
+		select {
+		case jobs <- target:
+		default:
+			mu.Lock()
+			target.running = false
+			mu.Unlock()
+			skipped(target, false)
+		}
+	}
+}
+
+// refreshScrapeTargets 同步中间件列表：新增的中间件按偏移安排首次采集，间隔变化时重新安排，已删除的移除
+func (s *MetricsService) refreshScrapeTargets(targets map[uint]*scrapeTarget, cfg ScrapeConfig, mu *sync.Mutex, now time.Time) error {
+	middlewares, err := s.middlewareRepo.FindAll()
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	seen := make(map[uint]bool, len(middlewares))
+	for _, mw := range middlewares {
+		if !hasCollector(mw.Type) {
+			continue
+		}
+		seen[mw.ID] = true
+		interval := cfg.interval(mw)
+		target, ok := targets[mw.ID]
+		if !ok {
+			target = &scrapeTarget{}
+			targets[mw.ID] = target
+		}
+		if !ok || target.interval != interval {
+			target.next = nextScrape(now, mw.ID, interval)
+		}
+		target.mw = mw
+		target.interval = interval
+		target.timeout = cfg.timeout(mw)
+	}
+	for id := range targets {
+		if !seen[id] {
+			delete(targets, id)
+		}
+	}
+	return nil
+}
+
+// scrape 在超时内采集一个中间件、写入样本并记录采集结果
+func (s *MetricsService) scrape(ctx context.Context, mw model.Middleware, timeout time.Duration) {
+	scrapeCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	metrics, err := s.collect(scrapeCtx, mw)
+	duration := time.Since(start)
+	collectionDuration.Observe(duration.Seconds(), mw.Type)
+	if err == nil {
+		err = s.metricsRepo.SaveSamples(metrics)
+	}
+	if ctx.Err() != nil {
+		// 服务停止，不记录结果
+		return
+	}
+
+	status, findErr := s.metricsRepo.FindScrapeStatus(mw.ID)
+	if findErr != nil {
+		status = &model.ScrapeStatus{MiddlewareID: mw.ID}
+	}
+	status.LastScrapeAt = &start
+	status.LastDuration = duration.Seconds()
+	status.Samples = len(metrics)
+	switch {
+	case err == nil:
+		status.Health = "ok"
+		status.LastError = ""
+		status.LastSuccessAt = &start
+		status.ConsecutiveFailures = 0
+	case errors.Is(scrapeCtx.Err(), context.DeadlineExceeded):
+		collectorErrors.Inc(mw.Type)
+		status.Health = "timeout"
+		status.LastError = fmt.Sprintf("scrape timed out after %s: %v", timeout, err)
+		status.ConsecutiveFailures++
+	default:
+		collectorErrors.Inc(mw.Type)
+		status.Health = "error"
+		status.LastError = err.Error()
+		status.ConsecutiveFailures++
+	}
+	if err := s.metricsRepo.SaveScrapeStatus(status); err != nil {
+		log.Printf("Failed to save scrape status of middleware %d: %v", mw.ID, err)
+	}
+}
+
+func (s *MetricsService) recordSkippedScrape(middlewareID uint) {
+	if err := s.metricsRepo.IncrementScrapeSkipped(middlewareID); err != nil {
+		log.Printf("Failed to save scrape status of middleware %d: %v", middlewareID, err)
+	}
+}
+
+// hasCollector 判断该类型的中间件是否支持指标采集
+func hasCollector(mwType string) bool {
+	switch strings.ToLower(mwType) {
+	case "redis", "mysql", "postgresql", "zookeeper", "etcd", "consul", "mongodb", "elasticsearch", "probe":
+		return true
+	}
+	return false
+}
+
+// collect 根据中间件类型收集不同的指标
+func (s *MetricsService) collect(ctx context.Context, mw model.Middleware) ([]model.Metrics, error) {
+	switch strings.ToLower(mw.Type) {
+	case "redis":
+		return s.collectRedisMetrics(ctx, mw)
+	case "mysql", "postgresql":
+		return s.collectDBMetrics(ctx, mw)
+	case "zookeeper":
+		return s.collectZKMetrics(ctx, mw)
+	case "etcd":
+		return s.collectEtcdMetrics(ctx, mw)
+	case "consul":
+		return s.collectConsulMetrics(ctx, mw)
+	case "mongodb":
+		return s.collectMongoMetrics(ctx, mw)
+	case "elasticsearch":
+		return s.collectESMetrics(ctx, mw)
+	case "probe":
+		return s.collectProbeMetrics(ctx, mw)
+	}
+	return nil, fmt.Errorf("no collector for middleware type %q", mw.Type)
+}
+
+// GetScrapeStatuses 获取所有中间件最近一次采集的结果
+func (s *MetricsService) GetScrapeStatuses() ([]model.ScrapeStatus, error) {
+	return s.metricsRepo.FindScrapeStatuses()
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"middleware-platform/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScrapeConfig_IntervalAndTimeout(t *testing.T) {
+	cfg := ScrapeConfig{
+		Interval:      time.Minute,
+		Timeout:       20 * time.Second,
+		TypeIntervals: map[string]time.Duration{"redis": 15 * time.Second},
+		TypeTimeouts:  map[string]time.Duration{"mysql": 5 * time.Second},
+	}
+
+	redis := model.Middleware{Type: "Redis"}
+	assert.Equal(t, 15*time.Second, cfg.interval(redis))
+	// 超时不超过采集间隔
+	assert.Equal(t, 15*time.Second, cfg.timeout(redis))
+
+	mysql := model.Middleware{Type: "mysql"}
+	assert.Equal(t, time.Minute, cfg.interval(mysql))
+	assert.Equal(t, 5*time.Second, cfg.timeout(mysql))
+
+	custom := model.Middleware{Type: "redis", ScrapeInterval: 120, ScrapeTimeout: 30}
+	assert.Equal(t, 2*time.Minute, cfg.interval(custom))
+	assert.Equal(t, 30*time.Second, cfg.timeout(custom))
+
+	assert.Equal(t, defaultScrapeInterval, ScrapeConfig{}.interval(mysql))
+	assert.Equal(t, defaultScrapeTimeout, ScrapeConfig{}.timeout(mysql))
+}
+
+func TestNextScrape(t *testing.T) {
+	interval := 30 * time.Second
+	now := time.Date(2024, 1, 1, 0, 0, 7, 0, time.UTC)
+
+	next := nextScrape(now, 42, interval)
+	assert.True(t, next.After(now))
+	assert.True(t, next.Sub(now) <= interval)
+	// 每个周期内的偏移固定
+	assert.Equal(t, scrapeOffset(42, interval), next.Sub(next.Truncate(interval)))
+	assert.Equal(t, next.Add(interval), nextScrape(next, 42, interval))
+
+	// 不同中间件的偏移不同，采集被分散开
+	offsets := make(map[time.Duration]bool)
+	for id := uint(1); id <= 20; id++ {
+		offsets[scrapeOffset(id, interval)] = true
+	}
+	assert.Greater(t, len(offsets), 10)
+}
+
+func TestDispatchScrapes_DoesNotBlock(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	targets := map[uint]*scrapeTarget{
+		1: {mw: model.Middleware{ID: 1}, interval: time.Minute, next: now},
+		2: {mw: model.Middleware{ID: 2}, interval: time.Minute, next: now},
+		3: {mw: model.Middleware{ID: 3}, interval: time.Minute, next: now, running: true},
+		4: {mw: model.Middleware{ID: 4}, interval: time.Minute, next: now.Add(time.Second)},
+	}
+	// 只能再接收一个采集，其余worker都在执行慢的采集
+	jobs := make(chan *scrapeTarget, 1)
+	var mu sync.Mutex
+	running, dropped := map[uint]bool{}, map[uint]bool{}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dispatchScrapes(targets, now, &mu, jobs, func(target *scrapeTarget, isRunning bool) {
+			if isRunning {
+				running[target.mw.ID] = true
+			} else {
+				dropped[target.mw.ID] = true
+			}
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("dispatch blocked on busy workers")
+	}
+
+	assert.Equal(t, map[uint]bool{3: true}, running)
+	sent := <-jobs
+	assert.Contains(t, []uint{1, 2}, sent.mw.ID)
+	assert.True(t, sent.running)
+	if assert.Len(t, dropped, 1) {
+		for id := range dropped {
+			assert.NotEqual(t, sent.mw.ID, id)
+			// 丢弃的目标不标记为执行中，下一个周期照常采集
+			assert.False(t, targets[id].running)
+			assert.True(t, targets[id].next.After(now))
+		}
+	}
+	assert.Equal(t, now.Add(time.Second), targets[4].next)
+}
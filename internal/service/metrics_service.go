@@ -3,23 +3,52 @@ package service
 import (
 	"context"
 	"fmt"
+	"io"
 	"middleware-platform/internal/model"
+	"middleware-platform/internal/prom"
 	"middleware-platform/internal/repository"
+	"middleware-platform/internal/telemetry"
+	"sort"
+	"strconv"
 	"time"
 )
 
+// exportStaleness 超过该时间未更新的指标不再通过 /metrics 输出
+const exportStaleness = 10 * time.Minute
+
+var (
+	collectionDuration = telemetry.Default.Summary("middleware_platform_collection_duration_seconds",
+		"Time spent collecting metrics from one middleware instance.", "collector")
+	collectorErrors = telemetry.Default.Counter("middleware_platform_collector_errors_total",
+		"Failed metric collections per collector.", "collector")
+)
+
 type MetricsService struct {
 	metricsRepo *repository.MetricsRepository
 	middlewareRepo *repository.MiddlewareRepository
+	remoteWrite    bool
+	prometheus     *prom.Client
+	retention      RetentionPolicy
+	clients        *ClientPool
+	alerter        EventAlerter
+	zkAdminPort    int
+	clusters       clusterStates
 }
 
 func NewMetricsService(metricsRepo *repository.MetricsRepository, middlewareRepo *repository.MiddlewareRepository) *MetricsService {
 	return &MetricsService{
 		metricsRepo:     metricsRepo,
 		middlewareRepo:  middlewareRepo,
+		retention:       DefaultRetentionPolicy(),
+		clients:         NewClientPool(0),
 	}
 }
 
+// SetClientPool 设置采集使用的客户端缓存，与健康检查共享
+func (s *MetricsService) SetClientPool(clients *ClientPool) {
+	s.clients = clients
+}
+
 func (s *MetricsService) CollectMetrics(ctx context.Context) error {
 	// 获取所有中间件
 	middlewares, err := s.middlewareRepo.FindAll()
@@ -27,34 +56,26 @@ func (s *MetricsService) CollectMetrics(ctx context.Context) error {
 		return err
 	}
 
-	// 收集每个中间件的指标
+	// 依次收集每个中间件的指标，整个周期的样本一次写入；定期采集由 StartCollector 并发执行
+	var samples []model.Metrics
 	for _, mw := range middlewares {
-		metrics := []model.Metrics{}
-		
-		// 根据中间件类型收集不同的指标
-		switch mw.Type {
-		case "redis":
-			m, err := s.collectRedisMetrics(ctx, mw)
-			if err != nil {
-				continue
-			}
-			metrics = append(metrics, m...)
-		case "mysql", "postgresql":
-			m, err := s.collectDBMetrics(ctx, mw)
-			if err != nil {
-				continue
-			}
-			metrics = append(metrics, m...)
+		if !hasCollector(mw.Type) {
+			continue
 		}
-
-		// 保存指标
-		for _, m := range metrics {
-			if err := s.metricsRepo.Create(&m); err != nil {
-				fmt.Printf("Failed to save metrics for middleware %d: %v\n", mw.ID, err)
-			}
+		start := time.Now()
+		metrics, err := s.collect(ctx, mw)
+		collectionDuration.Observe(time.Since(start).Seconds(), mw.Type)
+		if err != nil {
+			collectorErrors.Inc(mw.Type)
+			continue
 		}
+		samples = append(samples, metrics...)
 	}
 
+	// 保存指标
+	if err := s.metricsRepo.SaveSamples(samples); err != nil {
+		return fmt.Errorf("failed to save %d samples: %v", len(samples), err)
+	}
 	return nil
 }
 
@@ -74,24 +95,153 @@ func (s *MetricsService) GetLatestMetrics(middlewareID uint) (map[string]interfa
 func (s *MetricsService) GetPerformanceMetrics(middlewareID uint, duration time.Duration) (map[string][]interface{}, error) {
 	end := time.Now()
 	start := end.Add(-duration)
-	
-	metrics, err := s.metricsRepo.FindByTimeRange(middlewareID, start, end)
+
+	series, err := s.metricsRepo.FindSeries([]uint{middlewareID}, nil)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(series))
+	byID := make(map[uint]model.MetricSeries, len(series))
+	for _, ser := range series {
+		ids = append(ids, ser.ID)
+		byID[ser.ID] = ser
+	}
+
+	resolution := s.chooseResolution(start, end)
+	points, err := s.metricsRepo.FindSeriesPoints(ids, resolution.Name, start, end)
 	if err != nil {
 		return nil, err
 	}
 
-	// 按类型分组
+	// 按类型分组，聚合粒度下取时间桶内的平均值
 	result := make(map[string][]interface{})
+	for _, p := range points {
+		ser := byID[p.SeriesID]
+		point := map[string]interface{}{
+			"timestamp": p.Timestamp,
+			"value":     p.Avg(),
+			"unit":      ser.Unit,
+		}
+		if ser.Labels != "" {
+			point["labels"] = ser.LabelMap()
+		}
+		result[ser.Name] = append(result[ser.Name], point)
+	}
+
+	return result, nil
+}
+
+// 一张图表的目标点数上限，用于选择查询粒度
+const maxChartPoints = 1500
+
+// rawQuerySpan 原始样本只用于不超过该跨度的查询
+const rawQuerySpan = 6 * time.Hour
+
+// chooseResolution 选择点数不超过 maxChartPoints、且数据在保留期内覆盖start的最细粒度
+func (s *MetricsService) chooseResolution(start, end time.Time) model.Resolution {
+	span := end.Sub(start)
+	retained := func(resolution string) bool {
+		ttl := s.retention.For(resolution)
+		return ttl <= 0 || !start.Before(time.Now().Add(-ttl))
+	}
+
+	if span <= rawQuerySpan && retained(model.ResolutionRaw) {
+		return model.Resolution{Name: model.ResolutionRaw}
+	}
+	for _, res := range model.RollupResolutions {
+		if span/res.Step <= maxChartPoints && retained(res.Name) {
+			return res
+		}
+	}
+	return model.RollupResolutions[len(model.RollupResolutions)-1]
+}
+
+// WritePrometheus 以 Prometheus 文本格式输出每个中间件最新的指标和平台自身的运行指标
+func (s *MetricsService) WritePrometheus(w io.Writer) error {
+	metrics, err := s.metricsRepo.FindLatestPerSeries(time.Now().Add(-exportStaleness))
+	if err != nil {
+		return err
+	}
+	middlewares, err := s.middlewareRepo.FindAll()
+	if err != nil {
+		return err
+	}
+
+	writeMiddlewareGauges(w, metrics, middlewares)
+	return telemetry.Default.Write(w)
+}
+
+// writeMiddlewareGauges 每种指标输出为一个 middleware_<type> 仪表，按中间件打标签，
+// 序列自身的标签附加在后面，与中间件标签同名时加 exported_ 前缀；已删除的中间件的指标不输出
+func writeMiddlewareGauges(w io.Writer, metrics []model.Metrics, middlewares []model.Middleware) {
+	byID := make(map[uint]model.Middleware, len(middlewares))
+	for _, mw := range middlewares {
+		byID[mw.ID] = mw
+	}
+
+	families := make(map[string][]model.Metrics)
+	units := make(map[string]string)
 	for _, m := range metrics {
-		if _, ok := result[m.Type]; !ok {
-			result[m.Type] = make([]interface{}, 0)
+		if _, ok := byID[m.MiddlewareID]; !ok {
+			continue
 		}
-		result[m.Type] = append(result[m.Type], map[string]interface{}{
-			"timestamp": m.Timestamp,
-			"value": m.Value,
-			"unit": m.Unit,
+		name := "middleware_" + telemetry.SanitizeName(m.Type)
+		families[name] = append(families[name], m)
+		units[name] = m.Unit
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		samples := families[name]
+		sort.Slice(samples, func(i, j int) bool {
+			if samples[i].MiddlewareID != samples[j].MiddlewareID {
+				return samples[i].MiddlewareID < samples[j].MiddlewareID
+			}
+			return model.SeriesLabels(samples[i].Labels) < model.SeriesLabels(samples[j].Labels)
 		})
+
+		help := fmt.Sprintf("Latest collected %s value", samples[0].Type)
+		if units[name] != "" {
+			help += " in " + units[name]
+		}
+		telemetry.WriteHeader(w, name, help+".", "gauge")
+		for _, m := range samples {
+			mw := byID[m.MiddlewareID]
+			labels, values := gaugeLabels(mw, m.Labels)
+			telemetry.WriteSample(w, name, labels, values, m.Value)
+		}
 	}
+}
 
-	return result, nil
-} 
\ No newline at end of file
+// gaugeLabels 中间件标签加上按名称排序的序列标签
+func gaugeLabels(mw model.Middleware, series map[string]string) ([]string, []string) {
+	labels := []string{"middleware_id", "name", "type", "host"}
+	values := []string{strconv.FormatUint(uint64(mw.ID), 10), mw.Name, mw.Type, mw.Host}
+	if len(series) == 0 {
+		return labels, values
+	}
+
+	reserved := make(map[string]bool, len(labels))
+	for _, label := range labels {
+		reserved[label] = true
+	}
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		label := telemetry.SanitizeName(key)
+		if reserved[label] {
+			label = "exported_" + label
+		}
+		labels = append(labels, label)
+		values = append(values, series[key])
+	}
+	return labels, values
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"middleware-platform/internal/model"
+	"net"
+	"strings"
+	"sync"
+)
+
+// discoveredMember 从集群拓扑或服务目录中发现的成员实例
+type discoveredMember struct {
+	Host string
+	Port string
+	Role string
+	// 成员的中间件类型和名称，为空时与父实例类型相同、按地址命名
+	Type string
+	Name string
+}
+
+func memberAddr(host, port string) string {
+	return net.JoinHostPort(host, port)
+}
+
+// memberKey 同一地址上不同类型的成员分别对应不同的子实例
+func memberKey(mwType, addr string) string {
+	return strings.ToLower(mwType) + "/" + addr
+}
+
+// syncMembers 将发现的成员同步为父实例的子中间件：新成员自动创建，角色变化时更新，不再出现的成员删除。
+// 与父实例类型和地址相同的成员就是父实例本身，只更新其角色。与父实例同类型的成员继承凭据、连接选项和采集设置。
+// 返回成员地址到中间件ID的映射。
+func (s *MetricsService) syncMembers(parent *model.Middleware, members []discoveredMember) (map[string]uint, error) {
+	ids := make(map[string]uint, len(members))
+	// 发现结果为空多半是节点异常，不据此删除已有成员
+	if len(members) == 0 {
+		return ids, nil
+	}
+
+	children, err := s.middlewareRepo.FindChildren(parent.ID)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]model.Middleware, len(children))
+	for _, child := range children {
+		existing[memberKey(child.Type, memberAddr(child.Host, child.Port))] = child
+	}
+
+	parentKey := memberKey(parent.Type, memberAddr(parent.Host, parent.Port))
+	seen := make(map[string]bool, len(members))
+	for _, m := range members {
+		mwType := m.Type
+		if mwType == "" {
+			mwType = parent.Type
+		}
+		addr := memberAddr(m.Host, m.Port)
+		key := memberKey(mwType, addr)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if key == parentKey {
+			ids[addr] = parent.ID
+			if parent.Role != m.Role {
+				if err := s.middlewareRepo.UpdateRole(parent.ID, m.Role); err != nil {
+					return nil, err
+				}
+				parent.Role = m.Role
+			}
+			continue
+		}
+		if child, ok := existing[key]; ok {
+			ids[addr] = child.ID
+			delete(existing, key)
+			if child.Role != m.Role {
+				if err := s.middlewareRepo.UpdateRole(child.ID, m.Role); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		parentID := parent.ID
+		child := &model.Middleware{
+			Name:     m.Name,
+			Type:     mwType,
+			Status:   model.StatusUnknown,
+			Host:     m.Host,
+			Port:     m.Port,
+			ParentID: &parentID,
+			Role:     m.Role,
+		}
+		if child.Name == "" {
+			child.Name = fmt.Sprintf("%s/%s", parent.Name, addr)
+		}
+		if strings.EqualFold(mwType, parent.Type) {
+			child.Version = parent.Version
+			child.Credentials = parent.Credentials
+			child.Options = parent.Options
+			child.ScrapeInterval = parent.ScrapeInterval
+			child.ScrapeTimeout = parent.ScrapeTimeout
+		}
+		if err := s.middlewareRepo.Create(child); err != nil {
+			return nil, err
+		}
+		log.Printf("Discovered %s %s %s of middleware %d", mwType, m.Role, addr, parent.ID)
+		ids[addr] = child.ID
+	}
+
+	for key, child := range existing {
+		if err := s.middlewareRepo.Delete(child.ID); err != nil {
+			return nil, err
+		}
+		s.clients.Evict(child.ID)
+		log.Printf("Removed member %s of middleware %d, no longer discovered", key, parent.ID)
+	}
+	return ids, nil
+}
+
+// clusterStates 各实例最近一次检查的集群状态（如 *ZKEnsemble、*EtcdCluster），
+// 用于与下一次检查比较以及接口查询，重启后重新建立
+type clusterStates struct {
+	mu     sync.Mutex
+	states map[uint]interface{}
+}
+
+func (c *clusterStates) get(id uint) interface{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.states[id]
+}
+
+func (c *clusterStates) set(id uint, state interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.states == nil {
+		c.states = make(map[uint]interface{})
+	}
+	c.states[id] = state
+}
@@ -0,0 +1,248 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"middleware-platform/internal/model"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHealthInterval         = 30 * time.Second
+	defaultHealthLatencyThreshold = time.Second
+	defaultHealthFailureThreshold = 3
+	// 同时执行的健康检查数
+	healthCheckConcurrency = 8
+	// 健康接口返回的最近状态变化数
+	recentStatusChanges = 20
+)
+
+// HealthConfig 健康检查调度配置
+type HealthConfig struct {
+	Interval time.Duration
+	// 检查成功但耗时超过该值时为 degraded
+	LatencyThreshold time.Duration
+	// 连续失败达到该次数才判定为 down，之前为 degraded
+	FailureThreshold int
+}
+
+// AvailabilityWindows 可用率统计的时间窗口
+var AvailabilityWindows = []struct {
+	Name     string
+	Duration time.Duration
+}{
+	{"day", 24 * time.Hour},
+	{"week", 7 * 24 * time.Hour},
+	{"month", 30 * 24 * time.Hour},
+}
+
+// Availability 一个时间窗口内的可用率，unknown 的时间不计入分母
+type Availability struct {
+	Window       string             `json:"window"`
+	Availability *float64           `json:"availability"` // up 和 degraded 的时间占比（%），没有数据时为 null
+	Uptime       *float64           `json:"uptime"`       // 仅 up 的时间占比（%）
+	Seconds      map[string]float64 `json:"seconds"`      // 每种状态的累计秒数
+}
+
+// MiddlewareHealth 中间件当前健康状态和最近的状态变化
+type MiddlewareHealth struct {
+	Middleware   *model.Middleware              `json:"middleware"`
+	Changes      []model.MiddlewareStatusChange `json:"changes"`
+	Availability []Availability                 `json:"availability"`
+}
+
+// hasHealthCheck 判断该类型的中间件是否支持健康检查，不支持的状态为 unknown。
+// mysql 没有注册驱动，CheckHealth 无法连接，不计入以免误判为宕机
+func hasHealthCheck(mwType string) bool {
+	switch strings.ToLower(mwType) {
+	case "redis", "postgresql", "zookeeper", "etcd", "consul", "mongodb", "elasticsearch", "probe":
+		return true
+	}
+	return false
+}
+
+// StartHealthChecks 定期检查所有中间件并更新状态，interval<=0 时使用默认间隔
+func (s *MiddlewareService) StartHealthChecks(ctx context.Context, cfg HealthConfig) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = defaultHealthInterval
+	}
+	if cfg.LatencyThreshold <= 0 {
+		cfg.LatencyThreshold = defaultHealthLatencyThreshold
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultHealthFailureThreshold
+	}
+
+	go func() {
+		failures := make(map[uint]int)
+		ticker := time.NewTicker(cfg.Interval)
+		defer ticker.Stop()
+		for {
+			if err := s.checkAll(ctx, cfg, failures); err != nil {
+				log.Printf("Health check failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// checkAll 并发检查所有中间件，failures 记录每个中间件的连续失败次数
+func (s *MiddlewareService) checkAll(ctx context.Context, cfg HealthConfig, failures map[uint]int) error {
+	middlewares, err := s.repo.FindAll()
+	if err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, healthCheckConcurrency)
+	for i := range middlewares {
+		mw := &middlewares[i]
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			start := time.Now()
+			var checkErr error
+			if hasHealthCheck(mw.Type) {
+				checkErr = s.CheckHealth(mw)
+			}
+			latency := time.Since(start)
+
+			mu.Lock()
+			if checkErr != nil {
+				failures[mw.ID]++
+			} else {
+				delete(failures, mw.ID)
+			}
+			failed := failures[mw.ID]
+			mu.Unlock()
+
+			status, message := evaluateHealth(mw.Type, checkErr, latency, failed, cfg)
+			s.recordHealth(mw, status, message, latency, start)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// evaluateHealth 根据检查结果、耗时和连续失败次数确定状态
+func evaluateHealth(mwType string, checkErr error, latency time.Duration, failures int, cfg HealthConfig) (string, string) {
+	switch {
+	case !hasHealthCheck(mwType):
+		return model.StatusUnknown, fmt.Sprintf("no health check for type %q", mwType)
+	case checkErr != nil && failures >= cfg.FailureThreshold:
+		return model.StatusDown, checkErr.Error()
+	case checkErr != nil:
+		return model.StatusDegraded, fmt.Sprintf("check failed (%d/%d): %v", failures, cfg.FailureThreshold, checkErr)
+	case latency > cfg.LatencyThreshold:
+		return model.StatusDegraded, fmt.Sprintf("slow response: %s", latency.Round(time.Millisecond))
+	}
+	return model.StatusUp, ""
+}
+
+// recordHealth 保存检查结果，状态变化时记录历史
+func (s *MiddlewareService) recordHealth(mw *model.Middleware, status, message string, latency time.Duration, checkedAt time.Time) {
+	previous := mw.Status
+	mw.Status = status
+	mw.HealthMessage = message
+	mw.Latency = float64(latency.Microseconds()) / 1000
+	mw.LastCheckAt = &checkedAt
+	if err := s.repo.UpdateHealth(mw); err != nil {
+		log.Printf("Failed to update health of middleware %d: %v", mw.ID, err)
+		return
+	}
+
+	if previous == status {
+		return
+	}
+	if err := s.repo.CreateStatusChange(&model.MiddlewareStatusChange{
+		MiddlewareID: mw.ID,
+		From:         previous,
+		To:           status,
+		Message:      message,
+		CreatedAt:    checkedAt,
+	}); err != nil {
+		log.Printf("Failed to record status change of middleware %d: %v", mw.ID, err)
+	}
+}
+
+// GetHealth 获取中间件的健康状态、最近的状态变化和各时间窗口的可用率
+func (s *MiddlewareService) GetHealth(id uint) (*MiddlewareHealth, error) {
+	mw, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := s.repo.FindRecentStatusChanges(id, recentStatusChanges)
+	if err != nil {
+		return nil, err
+	}
+	availability, err := s.GetAvailability(id)
+	if err != nil {
+		return nil, err
+	}
+	return &MiddlewareHealth{Middleware: mw, Changes: changes, Availability: availability}, nil
+}
+
+// GetAvailability 计算中间件在最近一天、一周、一个月内的可用率
+func (s *MiddlewareService) GetAvailability(id uint) ([]Availability, error) {
+	now := time.Now()
+	longest := AvailabilityWindows[len(AvailabilityWindows)-1].Duration
+	changes, err := s.repo.FindStatusChanges(id, now.Add(-longest))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]Availability, 0, len(AvailabilityWindows))
+	for _, w := range AvailabilityWindows {
+		a := computeAvailability(changes, now.Add(-w.Duration), now)
+		a.Window = w.Name
+		result = append(result, a)
+	}
+	return result, nil
+}
+
+// computeAvailability 按时间顺序的状态变化计算 [start, end) 内每种状态的时长。
+// 第一次记录之前的时间视为 unknown。
+func computeAvailability(changes []model.MiddlewareStatusChange, start, end time.Time) Availability {
+	seconds := make(map[string]float64)
+	status := model.StatusUnknown
+	at := start
+	for _, c := range changes {
+		if !c.CreatedAt.After(start) {
+			status = c.To
+			continue
+		}
+		if !c.CreatedAt.Before(end) {
+			break
+		}
+		seconds[status] += c.CreatedAt.Sub(at).Seconds()
+		status = c.To
+		at = c.CreatedAt
+	}
+	seconds[status] += end.Sub(at).Seconds()
+
+	a := Availability{Seconds: seconds}
+	known := seconds[model.StatusUp] + seconds[model.StatusDegraded] + seconds[model.StatusDown]
+	if known > 0 {
+		availability := (seconds[model.StatusUp] + seconds[model.StatusDegraded]) / known * 100
+		uptime := seconds[model.StatusUp] / known * 100
+		a.Availability = &availability
+		a.Uptime = &uptime
+	}
+	return a
+}
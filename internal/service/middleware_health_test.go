@@ -0,0 +1,61 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"middleware-platform/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateHealth(t *testing.T) {
+	cfg := HealthConfig{LatencyThreshold: time.Second, FailureThreshold: 3}
+	boom := errors.New("connection refused")
+
+	status, _ := evaluateHealth("redis", nil, 10*time.Millisecond, 0, cfg)
+	assert.Equal(t, model.StatusUp, status)
+
+	status, msg := evaluateHealth("redis", nil, 2*time.Second, 0, cfg)
+	assert.Equal(t, model.StatusDegraded, status)
+	assert.Contains(t, msg, "slow")
+
+	status, _ = evaluateHealth("redis", boom, time.Millisecond, 1, cfg)
+	assert.Equal(t, model.StatusDegraded, status)
+
+	status, msg = evaluateHealth("redis", boom, time.Millisecond, 3, cfg)
+	assert.Equal(t, model.StatusDown, status)
+	assert.Equal(t, "connection refused", msg)
+
+	status, _ = evaluateHealth("rabbitmq", nil, 0, 0, cfg)
+	assert.Equal(t, model.StatusUnknown, status)
+
+	// mysql 检查无法连接，失败不应计为宕机
+	status, _ = evaluateHealth("mysql", boom, time.Millisecond, 3, cfg)
+	assert.Equal(t, model.StatusUnknown, status)
+}
+
+func TestComputeAvailability(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(10 * time.Hour)
+	changes := []model.MiddlewareStatusChange{
+		{To: model.StatusUp, CreatedAt: start.Add(-time.Hour)}, // 窗口开始前的状态
+		{To: model.StatusDown, CreatedAt: start.Add(6 * time.Hour)},
+		{To: model.StatusDegraded, CreatedAt: start.Add(7 * time.Hour)},
+		{To: model.StatusUnknown, CreatedAt: start.Add(8 * time.Hour)},
+	}
+
+	a := computeAvailability(changes, start, end)
+	assert.Equal(t, 6*3600.0, a.Seconds[model.StatusUp])
+	assert.Equal(t, 3600.0, a.Seconds[model.StatusDown])
+	assert.Equal(t, 2*3600.0, a.Seconds[model.StatusUnknown])
+	// unknown 不计入分母：(6+1)/8
+	assert.InDelta(t, 87.5, *a.Availability, 0.001)
+	assert.InDelta(t, 75.0, *a.Uptime, 0.001)
+
+	// 没有任何记录时可用率为空
+	empty := computeAvailability(nil, start, end)
+	assert.Nil(t, empty.Availability)
+	assert.Equal(t, 10*3600.0, empty.Seconds[model.StatusUnknown])
+}
@@ -0,0 +1,381 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"middleware-platform/internal/model"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	// 启停命令的执行超时
+	controlCommandTimeout = 2 * time.Minute
+	// 操作后等待健康检查结果的默认时间
+	defaultControlVerifyTimeout = time.Minute
+	// 操作审计接口返回的最近记录数
+	recentOperations = 50
+)
+
+// 操作状态
+const (
+	OperationRunning = "running"
+	OperationSuccess = "success"
+	OperationFailed  = "failed"
+	// 服务停止时被中断，启动时仍为 running 的记录也标记为中断
+	OperationInterrupted = "interrupted"
+)
+
+var (
+	ErrInvalidAction  = errors.New("invalid action, must be one of start, stop, restart, reload")
+	ErrInvalidControl = errors.New("invalid control options")
+	ErrNoControl      = errors.New("middleware has no linked host or control method")
+	ErrOperationBusy  = errors.New("another operation is running on this middleware")
+)
+
+// controlVerifyInterval 操作后健康检查的轮询间隔
+var controlVerifyInterval = 2 * time.Second
+
+func isControlAction(action string) bool {
+	switch action {
+	case model.ActionStart, model.ActionStop, model.ActionRestart, model.ActionReload:
+		return true
+	}
+	return false
+}
+
+// validateControl 创建和修改中间件时校验启停方式
+func validateControl(mw *model.Middleware) error {
+	ctrl := mw.Control
+	if ctrl == nil {
+		return nil
+	}
+	if mw.HostID == nil {
+		return fmt.Errorf("%w: host_id is required", ErrInvalidControl)
+	}
+	switch ctrl.Method {
+	case model.ControlSystemd, model.ControlDocker, model.ControlSupervisor:
+		if strings.TrimSpace(ctrl.Target) == "" {
+			return fmt.Errorf("%w: target is required for %s", ErrInvalidControl, ctrl.Method)
+		}
+	case model.ControlScript:
+		if len(ctrl.Scripts) == 0 {
+			return fmt.Errorf("%w: scripts is required for script", ErrInvalidControl)
+		}
+		for action, script := range ctrl.Scripts {
+			if !isControlAction(action) {
+				return fmt.Errorf("%w: unknown action %q in scripts", ErrInvalidControl, action)
+			}
+			if strings.TrimSpace(script) == "" {
+				return fmt.Errorf("%w: empty script for %s", ErrInvalidControl, action)
+			}
+		}
+	default:
+		return fmt.Errorf("%w: unsupported method %q", ErrInvalidControl, ctrl.Method)
+	}
+	if ctrl.VerifyTimeout < 0 {
+		return fmt.Errorf("%w: verify_timeout must not be negative", ErrInvalidControl)
+	}
+	return nil
+}
+
+// controlCommand 生成执行操作的命令。容器和 supervisor 程序没有 reload，改为发送 SIGHUP
+func controlCommand(ctrl *model.MiddlewareControl, action string) (string, error) {
+	target := shellQuote(ctrl.Target)
+	var cmd string
+	switch ctrl.Method {
+	case model.ControlSystemd:
+		cmd = "systemctl " + action + " " + target
+	case model.ControlDocker:
+		if action == model.ActionReload {
+			cmd = "docker kill -s HUP " + target
+		} else {
+			cmd = "docker " + action + " " + target
+		}
+	case model.ControlSupervisor:
+		if action == model.ActionReload {
+			cmd = "supervisorctl signal HUP " + target
+		} else {
+			cmd = "supervisorctl " + action + " " + target
+		}
+	case model.ControlScript:
+		script := strings.TrimSpace(ctrl.Scripts[action])
+		if script == "" {
+			return "", fmt.Errorf("no script configured for %s", action)
+		}
+		if ctrl.Sudo {
+			return "sudo -n sh -c " + shellQuote(script), nil
+		}
+		return script, nil
+	default:
+		return "", fmt.Errorf("unsupported control method %q", ctrl.Method)
+	}
+	if ctrl.Sudo {
+		cmd = "sudo -n " + cmd
+	}
+	return cmd, nil
+}
+
+// preCheckCommand 操作前确认管理工具可用、目标存在，并记录当前状态；script 方式不检查
+func preCheckCommand(ctrl *model.MiddlewareControl) string {
+	target := shellQuote(ctrl.Target)
+	var cmd string
+	switch ctrl.Method {
+	case model.ControlSystemd:
+		cmd = "systemctl show -p LoadState -p ActiveState -p SubState " + target
+	case model.ControlDocker:
+		cmd = "docker inspect -f '{{.State.Status}}' " + target
+	case model.ControlSupervisor:
+		cmd = "supervisorctl status " + target
+	default:
+		return ""
+	}
+	if ctrl.Sudo {
+		cmd = "sudo -n " + cmd
+	}
+	return cmd
+}
+
+// evaluatePreCheck 根据检查命令的输出判断能否执行操作
+func evaluatePreCheck(method, out string, err error) error {
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitStatus() == 127 {
+		return fmt.Errorf("%s is not installed on the host", method)
+	}
+	switch method {
+	case model.ControlSystemd:
+		if err != nil {
+			return fmt.Errorf("systemctl show failed: %v: %s", err, out)
+		}
+		if strings.Contains(out, "LoadState=not-found") {
+			return errors.New("systemd unit not found")
+		}
+	case model.ControlDocker:
+		if err != nil {
+			return fmt.Errorf("container not found: %s", out)
+		}
+	case model.ControlSupervisor:
+		// 程序未运行时 supervisorctl status 也以非零退出
+		if strings.Contains(out, "no such process") {
+			return errors.New("supervisor program not found")
+		}
+		if err != nil && exitErr == nil {
+			return fmt.Errorf("supervisorctl status failed: %v: %s", err, out)
+		}
+	}
+	return nil
+}
+
+// Start 绑定启停操作的生命周期，服务停止时中断执行中的操作；
+// 上次停止时未记录结果的操作标记为中断
+func (s *MiddlewareService) Start(ctx context.Context) {
+	s.opMu.Lock()
+	s.ctx = ctx
+	s.opMu.Unlock()
+
+	count, err := s.repo.FinishRunningOperations(OperationInterrupted, "interrupted by service restart", time.Now())
+	if err != nil {
+		log.Printf("Failed to mark unfinished middleware operations: %v", err)
+		return
+	}
+	if count > 0 {
+		log.Printf("Marked %d unfinished middleware operations as interrupted", count)
+	}
+}
+
+// GetOperations 最近的启停操作记录，从新到旧
+func (s *MiddlewareService) GetOperations(id uint) ([]model.MiddlewareOperation, error) {
+	return s.repo.FindOperations(id, recentOperations)
+}
+
+// RunAction 在中间件所在主机上执行启停操作。操作在后台执行，返回的记录在结束后更新为最终结果；
+// 同一中间件上一次操作未结束时返回 ErrOperationBusy
+func (s *MiddlewareService) RunAction(id uint, action, operator string) (*model.MiddlewareOperation, error) {
+	if !isControlAction(action) {
+		return nil, ErrInvalidAction
+	}
+	mw, err := s.repo.FindByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if mw.HostID == nil || mw.Control == nil || s.hostRepo == nil {
+		return nil, ErrNoControl
+	}
+	cmd, err := controlCommand(mw.Control, action)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoControl, err)
+	}
+	host, err := s.hostRepo.FindByID(*mw.HostID)
+	if err != nil {
+		return nil, fmt.Errorf("linked host %d: %v", *mw.HostID, err)
+	}
+
+	ctx, ok := s.beginOperation(id)
+	if !ok {
+		return nil, ErrOperationBusy
+	}
+	op := &model.MiddlewareOperation{
+		MiddlewareID: mw.ID,
+		HostID:       host.ID,
+		Action:       action,
+		Method:       mw.Control.Method,
+		Command:      cmd,
+		Operator:     operator,
+		Status:       OperationRunning,
+		StartedAt:    time.Now(),
+	}
+	if err := s.repo.CreateOperation(op); err != nil {
+		s.endOperation(id)
+		return nil, err
+	}
+
+	record := *op
+	go func() {
+		defer s.endOperation(id)
+		s.runOperation(ctx, mw, host, &record)
+	}()
+	return op, nil
+}
+
+// beginOperation 占用中间件的操作权，返回操作使用的服务生命周期 ctx
+func (s *MiddlewareService) beginOperation(id uint) (context.Context, bool) {
+	s.opMu.Lock()
+	defer s.opMu.Unlock()
+	if s.operating == nil {
+		s.operating = make(map[uint]bool)
+	}
+	if s.operating[id] {
+		return nil, false
+	}
+	s.operating[id] = true
+	if s.ctx == nil {
+		return context.Background(), true
+	}
+	return s.ctx, true
+}
+
+func (s *MiddlewareService) endOperation(id uint) {
+	s.opMu.Lock()
+	delete(s.operating, id)
+	s.opMu.Unlock()
+}
+
+// runOperation 执行操作前检查、操作命令和操作后的健康检查，并保存审计记录
+func (s *MiddlewareService) runOperation(ctx context.Context, mw *model.Middleware, host *model.Host, op *model.MiddlewareOperation) {
+	err := s.executeOperation(ctx, mw, host, op)
+	if err == nil {
+		err = s.verifyOperation(ctx, mw, op)
+	}
+
+	finishedAt := time.Now()
+	op.FinishedAt = &finishedAt
+	op.Status, op.Error = operationResult(ctx, err)
+	if err := s.repo.UpdateOperation(op); err != nil {
+		log.Printf("Failed to save operation %d of middleware %d: %v", op.ID, mw.ID, err)
+	}
+	log.Printf("Middleware %d %s via %s on host %d by %s: %s %s", mw.ID, op.Action, op.Method, host.ID,
+		op.Operator, op.Status, op.Error)
+}
+
+// operationResult 根据执行结果得到操作状态和错误信息，服务停止导致的失败记为中断
+func operationResult(ctx context.Context, err error) (string, string) {
+	switch {
+	case ctx.Err() != nil:
+		message := "interrupted by service shutdown"
+		if err != nil {
+			message += ": " + err.Error()
+		}
+		return OperationInterrupted, message
+	case err != nil:
+		return OperationFailed, err.Error()
+	}
+	return OperationSuccess, ""
+}
+
+func (s *MiddlewareService) executeOperation(ctx context.Context, mw *model.Middleware, host *model.Host, op *model.MiddlewareOperation) error {
+	ctx, cancel := context.WithTimeout(ctx, controlCommandTimeout)
+	defer cancel()
+
+	client, err := newSSHClient(host)
+	if err != nil {
+		return fmt.Errorf("failed to connect to host: %v", err)
+	}
+	defer client.Close()
+	defer closeOnCancel(ctx, client)()
+
+	if check := preCheckCommand(mw.Control); check != "" {
+		out, err := runRemoteCommand(client, check)
+		op.PreCheck = truncateOutput(strings.TrimSpace(out))
+		if err := evaluatePreCheck(mw.Control.Method, op.PreCheck, err); err != nil {
+			return fmt.Errorf("pre-check failed: %v", err)
+		}
+	}
+
+	out, err := runRemoteCommand(client, op.Command)
+	op.Output = truncateOutput(strings.TrimSpace(out))
+	if ctx.Err() != nil {
+		return fmt.Errorf("%s timed out after %s", op.Action, controlCommandTimeout)
+	}
+	if err != nil {
+		return fmt.Errorf("%s failed: %v", op.Action, err)
+	}
+	return nil
+}
+
+// verifyOperation 操作后通过 CheckHealth 确认结果，并立即更新中间件的健康状态
+func (s *MiddlewareService) verifyOperation(ctx context.Context, mw *model.Middleware, op *model.MiddlewareOperation) error {
+	if !hasHealthCheck(mw.Type) {
+		op.HealthStatus = model.StatusUnknown
+		op.HealthMessage = fmt.Sprintf("no health check for type %q", mw.Type)
+		return nil
+	}
+	// 缓存的连接指向操作前的进程
+	s.clients.Evict(mw.ID)
+
+	timeout := defaultControlVerifyTimeout
+	if mw.Control.VerifyTimeout > 0 {
+		timeout = time.Duration(mw.Control.VerifyTimeout) * time.Second
+	}
+	start := time.Now()
+	ok, lastErr := verifyAction(ctx, op.Action, func() error { return s.CheckHealth(mw) }, timeout, controlVerifyInterval)
+
+	op.HealthStatus = model.StatusUp
+	if lastErr != nil {
+		op.HealthStatus = model.StatusDown
+		op.HealthMessage = lastErr.Error()
+	}
+	s.recordHealth(mw, op.HealthStatus, op.HealthMessage, time.Since(start), time.Now())
+	switch {
+	case ok:
+		return nil
+	case op.Action == model.ActionStop:
+		return fmt.Errorf("still healthy %s after stop", timeout)
+	default:
+		return fmt.Errorf("health check did not pass within %s: %v", timeout, lastErr)
+	}
+}
+
+// verifyAction 轮询健康检查直到结果符合预期：stop 之后应当检查失败，其他操作之后应当检查通过。
+// 返回超时前是否达到预期，以及最近一次检查的错误
+func verifyAction(ctx context.Context, action string, check func() error, timeout, interval time.Duration) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := check()
+		if (err != nil) == (action == model.ActionStop) {
+			return true, err
+		}
+		select {
+		case <-ctx.Done():
+			return false, err
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"middleware-platform/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateControl(t *testing.T) {
+	hostID := uint(3)
+	assert.NoError(t, validateControl(&model.Middleware{}))
+	assert.NoError(t, validateControl(&model.Middleware{HostID: &hostID,
+		Control: &model.MiddlewareControl{Method: model.ControlSystemd, Target: "redis-server"}}))
+	assert.NoError(t, validateControl(&model.Middleware{HostID: &hostID,
+		Control: &model.MiddlewareControl{Method: model.ControlScript, Scripts: map[string]string{"start": "/opt/app/start.sh"}}}))
+
+	invalid := []*model.Middleware{
+		{Control: &model.MiddlewareControl{Method: model.ControlDocker, Target: "redis"}},
+		{HostID: &hostID, Control: &model.MiddlewareControl{Method: model.ControlDocker}},
+		{HostID: &hostID, Control: &model.MiddlewareControl{Method: "k8s", Target: "redis"}},
+		{HostID: &hostID, Control: &model.MiddlewareControl{Method: model.ControlScript}},
+		{HostID: &hostID, Control: &model.MiddlewareControl{Method: model.ControlScript, Scripts: map[string]string{"scale": "x"}}},
+	}
+	for _, mw := range invalid {
+		assert.ErrorIs(t, validateControl(mw), ErrInvalidControl)
+	}
+}
+
+func TestControlCommand(t *testing.T) {
+	cases := []struct {
+		ctrl   model.MiddlewareControl
+		action string
+		want   string
+	}{
+		{model.MiddlewareControl{Method: model.ControlSystemd, Target: "redis-server"}, "restart", "systemctl restart 'redis-server'"},
+		{model.MiddlewareControl{Method: model.ControlSystemd, Target: "nginx", Sudo: true}, "reload", "sudo -n systemctl reload 'nginx'"},
+		{model.MiddlewareControl{Method: model.ControlDocker, Target: "mysql"}, "stop", "docker stop 'mysql'"},
+		{model.MiddlewareControl{Method: model.ControlDocker, Target: "mysql"}, "reload", "docker kill -s HUP 'mysql'"},
+		{model.MiddlewareControl{Method: model.ControlSupervisor, Target: "zk"}, "start", "supervisorctl start 'zk'"},
+		{model.MiddlewareControl{Method: model.ControlSupervisor, Target: "zk"}, "reload", "supervisorctl signal HUP 'zk'"},
+		{model.MiddlewareControl{Method: model.ControlScript, Scripts: map[string]string{"stop": "/opt/app/bin/stop.sh -f"}}, "stop", "/opt/app/bin/stop.sh -f"},
+		{model.MiddlewareControl{Method: model.ControlScript, Sudo: true, Scripts: map[string]string{"stop": "kill $(cat /run/app.pid)"}}, "stop",
+			`sudo -n sh -c 'kill $(cat /run/app.pid)'`},
+	}
+	for _, c := range cases {
+		cmd, err := controlCommand(&c.ctrl, c.action)
+		assert.NoError(t, err)
+		assert.Equal(t, c.want, cmd)
+	}
+
+	_, err := controlCommand(&model.MiddlewareControl{Method: model.ControlScript, Scripts: map[string]string{"stop": "x"}}, "start")
+	assert.EqualError(t, err, "no script configured for start")
+	assert.Empty(t, preCheckCommand(&model.MiddlewareControl{Method: model.ControlScript}))
+}
+
+func TestEvaluatePreCheck(t *testing.T) {
+	exit := errors.New("Process exited with status 3")
+	assert.NoError(t, evaluatePreCheck(model.ControlSystemd, "LoadState=loaded\nActiveState=inactive\nSubState=dead", nil))
+	assert.EqualError(t, evaluatePreCheck(model.ControlSystemd, "LoadState=not-found\nActiveState=inactive", nil),
+		"systemd unit not found")
+	assert.NoError(t, evaluatePreCheck(model.ControlDocker, "exited", nil))
+	assert.EqualError(t, evaluatePreCheck(model.ControlDocker, "Error: No such object: mysql", exit),
+		"container not found: Error: No such object: mysql")
+	assert.EqualError(t, evaluatePreCheck(model.ControlSupervisor, "zk: ERROR (no such process)", exit),
+		"supervisor program not found")
+	assert.NoError(t, evaluatePreCheck(model.ControlSupervisor, "zk  RUNNING   pid 42, uptime 1:00:00", nil))
+}
+
+func TestVerifyAction(t *testing.T) {
+	down := errors.New("connection refused")
+	// 第三次检查时恢复
+	calls := 0
+	recovering := func() error {
+		calls++
+		if calls < 3 {
+			return down
+		}
+		return nil
+	}
+	ok, err := verifyAction(context.Background(), model.ActionRestart, recovering, time.Second, time.Millisecond)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, calls)
+
+	ok, err = verifyAction(context.Background(), model.ActionStart, func() error { return down }, 20*time.Millisecond, time.Millisecond)
+	assert.False(t, ok)
+	assert.Equal(t, down, err)
+
+	// stop 之后检查失败才算成功
+	ok, err = verifyAction(context.Background(), model.ActionStop, func() error { return down }, time.Second, time.Millisecond)
+	assert.True(t, ok)
+	assert.Equal(t, down, err)
+	ok, err = verifyAction(context.Background(), model.ActionStop, func() error { return nil }, 20*time.Millisecond, time.Millisecond)
+	assert.False(t, ok)
+	assert.NoError(t, err)
+}
+
+func TestOperationResult(t *testing.T) {
+	status, message := operationResult(context.Background(), nil)
+	assert.Equal(t, OperationSuccess, status)
+	assert.Empty(t, message)
+
+	status, message = operationResult(context.Background(), errors.New("restart failed: exit status 1"))
+	assert.Equal(t, OperationFailed, status)
+	assert.Equal(t, "restart failed: exit status 1", message)
+
+	// 服务停止中断的操作不记为失败
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	status, message = operationResult(ctx, errors.New("restart timed out after 2m0s"))
+	assert.Equal(t, OperationInterrupted, status)
+	assert.Equal(t, "interrupted by service shutdown: restart timed out after 2m0s", message)
+}
+
+func TestVerifyOperationWithoutHealthCheck(t *testing.T) {
+	s := &MiddlewareService{}
+	for _, mwType := range []string{"mysql", "nginx"} {
+		mw := &model.Middleware{Type: mwType, Control: &model.MiddlewareControl{Method: model.ControlSystemd, Target: mwType}}
+		for _, action := range []string{model.ActionStart, model.ActionStop} {
+			op := &model.MiddlewareOperation{Action: action}
+			// 不轮询健康检查，也不更新中间件状态
+			assert.NoError(t, s.verifyOperation(context.Background(), mw, op), mwType)
+			assert.Equal(t, model.StatusUnknown, op.HealthStatus)
+			assert.Contains(t, op.HealthMessage, "no health check")
+		}
+	}
+}
@@ -1,16 +1,36 @@
 package service
 
 import (
+	"context"
 	"middleware-platform/internal/model"
 	"middleware-platform/internal/repository"
+	"strings"
+	"sync"
 )
 
 type MiddlewareService struct {
-	repo *repository.MiddlewareRepository
+	repo    *repository.MiddlewareRepository
+	clients *ClientPool
+	// 启停操作通过 SSH 在中间件所在主机上执行
+	hostRepo *repository.HostRepository
+
+	opMu      sync.Mutex
+	ctx       context.Context // 启停操作的生命周期，由 Start 设置
+	operating map[uint]bool
 }
 
 func NewMiddlewareService(repo *repository.MiddlewareRepository) *MiddlewareService {
-	return &MiddlewareService{repo: repo}
+	return &MiddlewareService{repo: repo, clients: NewClientPool(0)}
+}
+
+// SetClientPool 与指标采集共享客户端缓存
+func (s *MiddlewareService) SetClientPool(clients *ClientPool) {
+	s.clients = clients
+}
+
+// SetHostRepository 设置启停操作使用的主机仓储
+func (s *MiddlewareService) SetHostRepository(hostRepo *repository.HostRepository) {
+	s.hostRepo = hostRepo
 }
 
 // GetAll 获取所有中间件列表
@@ -25,22 +45,52 @@ func (s *MiddlewareService) GetList(middlewareType string) ([]model.Middleware,
 
 // Create 创建中间件
 func (s *MiddlewareService) Create(middleware *model.Middleware) error {
+	if err := validateProbeOptions(middleware); err != nil {
+		return err
+	}
+	if err := validateControl(middleware); err != nil {
+		return err
+	}
 	return s.repo.Create(middleware)
 }
 
 // Update 更新中间件
 func (s *MiddlewareService) Update(middleware *model.Middleware) error {
-	return s.repo.Update(middleware)
+	if err := validateProbeOptions(middleware); err != nil {
+		return err
+	}
+	if err := validateControl(middleware); err != nil {
+		return err
+	}
+	if err := s.repo.Update(middleware); err != nil {
+		return err
+	}
+	s.clients.Evict(middleware.ID)
+	return nil
 }
 
-// Delete 删除中间件
+// Delete 删除中间件，自动发现的成员一并删除
 func (s *MiddlewareService) Delete(id uint) error {
-	return s.repo.Delete(id)
+	children, err := s.repo.FindChildren(id)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(id); err != nil {
+		return err
+	}
+	s.clients.Evict(id)
+	for _, child := range children {
+		if err := s.repo.Delete(child.ID); err != nil {
+			return err
+		}
+		s.clients.Evict(child.ID)
+	}
+	return nil
 }
 
 // CheckHealth 检查中间件健康状态
 func (s *MiddlewareService) CheckHealth(middleware *model.Middleware) error {
-	switch middleware.Type {
+	switch strings.ToLower(middleware.Type) {
 	case "redis":
 		return s.checkRedisHealth(middleware)
 	case "mysql":
@@ -49,6 +99,16 @@ func (s *MiddlewareService) CheckHealth(middleware *model.Middleware) error {
 		return s.checkPgHealth(middleware)
 	case "zookeeper":
 		return s.checkZKHealth(middleware)
+	case "etcd":
+		return s.checkEtcdHealth(middleware)
+	case "consul":
+		return s.checkConsulHealth(middleware)
+	case "mongodb":
+		return s.checkMongoHealth(middleware)
+	case "elasticsearch":
+		return s.checkESHealth(middleware)
+	case "probe":
+		return s.checkProbeHealth(middleware)
 	default:
 		return nil
 	}
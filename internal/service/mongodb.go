@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"middleware-platform/internal/model"
+	"middleware-platform/internal/mongowire"
+	"net"
+	"sync"
+	"time"
+)
+
+const clientMongo = "mongodb"
+
+// replSetGetStatus 在非副本集节点上的错误码：NoReplicationEnabled、NotYetInitialized、mongos 上的 CommandNotFound
+var mongoNoReplSetCodes = []int32{76, 94, 59}
+
+// mongoOptions MongoDB 在 Middleware.Options 中的连接选项，凭据为密码
+type mongoOptions struct {
+	Username           string `json:"username"`
+	AuthSource         string `json:"auth_source"` // 认证数据库，默认 admin
+	TLS                bool   `json:"tls"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+// mongoClient 单连接的 MongoDB 客户端，连接断开后在下一次命令时重新建立
+type mongoClient struct {
+	addr      string
+	opts      mongoOptions
+	password  string
+	tlsConfig *tls.Config
+
+	mu   sync.Mutex
+	conn *mongowire.Conn
+}
+
+// runCommand 在admin库上执行命令
+func (c *mongoClient) runCommand(ctx context.Context, cmd mongowire.D) (mongowire.D, error) {
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return conn.RunCommand(ctx, "admin", cmd)
+}
+
+func (c *mongoClient) connect(ctx context.Context) (*mongowire.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn != nil && !c.conn.Broken() {
+		return c.conn, nil
+	}
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+
+	conn, err := mongowire.Dial(ctx, c.addr, c.tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	if c.opts.Username != "" {
+		source := c.opts.AuthSource
+		if source == "" {
+			source = "admin"
+		}
+		if err := conn.Auth(ctx, source, c.opts.Username, c.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	c.conn = conn
+	return conn, nil
+}
+
+func (c *mongoClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// mongoClient 获取中间件的 MongoDB 客户端，连接在第一次执行命令时建立，使用完后调用release
+func (p *ClientPool) mongoClient(mw *model.Middleware) (*mongoClient, func(), error) {
+	client, release, err := p.get(mw, clientMongo, func() (io.Closer, error) {
+		var opts mongoOptions
+		if err := decodeOptions(mw, &opts); err != nil {
+			return nil, err
+		}
+		client := &mongoClient{
+			addr:     net.JoinHostPort(mw.Host, mw.Port),
+			opts:     opts,
+			password: mw.Credentials,
+		}
+		if opts.TLS {
+			client.tlsConfig = &tls.Config{ServerName: mw.Host, InsecureSkipVerify: opts.InsecureSkipVerify}
+		}
+		return client, nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return client.(*mongoClient), release, nil
+}
+
+func (s *MetricsService) collectMongoMetrics(ctx context.Context, mw model.Middleware) ([]model.Metrics, error) {
+	client, release, err := s.clients.mongoClient(&mw)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	status, err := client.runCommand(ctx, mongowire.D{{Key: "serverStatus", Value: 1}})
+	s.clients.report(&mw, clientMongo, err)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	metrics := mongoServerMetrics(mw.ID, status, now)
+
+	// 单机和 mongos 没有副本集状态
+	replStatus, err := client.runCommand(ctx, mongowire.D{{Key: "replSetGetStatus", Value: 1}})
+	switch {
+	case err == nil:
+		metrics = append(metrics, mongoReplMetrics(mw.ID, replStatus, now)...)
+	case isMongoNoReplSet(err):
+	default:
+		log.Printf("Failed to get replica set status of middleware %d: %v", mw.ID, err)
+	}
+	return metrics, nil
+}
+
+func isMongoNoReplSet(err error) bool {
+	for _, code := range mongoNoReplSetCodes {
+		if mongowire.IsCode(err, code) {
+			return true
+		}
+	}
+	return false
+}
+
+// mongoServerMetrics 从 serverStatus 生成操作计数、连接数和 WiredTiger 缓存指标，操作计数为累计值
+func mongoServerMetrics(middlewareID uint, status mongowire.D, now time.Time) []model.Metrics {
+	var metrics []model.Metrics
+	add := func(name string, value float64, unit string) {
+		metrics = append(metrics, model.Metrics{
+			MiddlewareID: middlewareID,
+			Type:         name,
+			Value:        value,
+			Unit:         unit,
+			Timestamp:    now,
+		})
+	}
+
+	for _, op := range []string{"insert", "query", "update", "delete", "getmore", "command"} {
+		if v, ok := status.Number("opcounters", op); ok {
+			add("mongodb_opcounters_"+op, v, "")
+		}
+	}
+
+	current, hasCurrent := status.Number("connections", "current")
+	available, hasAvailable := status.Number("connections", "available")
+	if hasCurrent {
+		add("mongodb_connections_current", current, "")
+	}
+	if hasAvailable {
+		add("mongodb_connections_available", available, "")
+	}
+	if hasCurrent && hasAvailable && current+available > 0 {
+		add("mongodb_connections_usage", current/(current+available)*100, "%")
+	}
+	if v, ok := status.Number("mem", "resident"); ok {
+		add("mongodb_memory_resident", v, "MB")
+	}
+
+	// 其他存储引擎没有 wiredTiger 字段
+	cached, hasCached := status.Number("wiredTiger", "cache", "bytes currently in the cache")
+	maxBytes, hasMax := status.Number("wiredTiger", "cache", "maximum bytes configured")
+	if hasCached {
+		add("mongodb_wt_cache_bytes", cached, "bytes")
+	}
+	if hasMax {
+		add("mongodb_wt_cache_max_bytes", maxBytes, "bytes")
+	}
+	if hasCached && hasMax && maxBytes > 0 {
+		add("mongodb_wt_cache_usage", cached/maxBytes*100, "%")
+	}
+	if v, ok := status.Number("wiredTiger", "cache", "tracked dirty bytes in the cache"); ok {
+		add("mongodb_wt_cache_dirty_bytes", v, "bytes")
+	}
+	return metrics
+}
+
+// mongoReplMetrics 从 replSetGetStatus 生成副本集指标，复制延迟为 primary 与最慢的 secondary 的 optime 之差
+func mongoReplMetrics(middlewareID uint, status mongowire.D, now time.Time) []model.Metrics {
+	var metrics []model.Metrics
+	add := func(name string, value float64, unit string) {
+		metrics = append(metrics, model.Metrics{
+			MiddlewareID: middlewareID,
+			Type:         name,
+			Value:        value,
+			Unit:         unit,
+			Timestamp:    now,
+		})
+	}
+
+	if state, ok := status.Number("myState"); ok {
+		add("mongodb_repl_state", state, "")
+	}
+
+	members, _ := status.Lookup("members").([]interface{})
+	var primary time.Time
+	var secondaries []time.Time
+	healthy := 0
+	for _, item := range members {
+		member, ok := item.(mongowire.D)
+		if !ok {
+			continue
+		}
+		if h, _ := member.Number("health"); h == 1 {
+			healthy++
+		}
+		optime, _ := member.Lookup("optimeDate").(time.Time)
+		switch state, _ := member.Number("state"); state {
+		case 1:
+			primary = optime
+		case 2:
+			// 无法访问的成员没有 optime
+			if !optime.IsZero() {
+				secondaries = append(secondaries, optime)
+			}
+		}
+	}
+	add("mongodb_repl_members", float64(len(members)), "")
+	add("mongodb_repl_members_healthy", float64(healthy), "")
+	add("mongodb_repl_has_primary", boolValue(!primary.IsZero()), "")
+
+	if !primary.IsZero() && len(secondaries) > 0 {
+		var lag time.Duration
+		for _, optime := range secondaries {
+			if d := primary.Sub(optime); d > lag {
+				lag = d
+			}
+		}
+		add("mongodb_repl_lag", lag.Seconds(), "s")
+	}
+	return metrics
+}
+
+// checkMongoHealth 执行 ping 命令
+func (s *MiddlewareService) checkMongoHealth(m *model.Middleware) error {
+	client, release, err := s.clients.mongoClient(m)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	_, err = client.runCommand(ctx, mongowire.D{{Key: "ping", Value: 1}})
+	s.clients.report(m, clientMongo, err)
+	if err != nil {
+		return fmt.Errorf("mongodb ping failed: %v", err)
+	}
+	return nil
+}
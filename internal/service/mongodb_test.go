@@ -0,0 +1,84 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"middleware-platform/internal/mongowire"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMongoServerMetrics(t *testing.T) {
+	status := mongowire.D{
+		{Key: "opcounters", Value: mongowire.D{
+			{Key: "insert", Value: int64(10)},
+			{Key: "query", Value: int32(20)},
+			{Key: "command", Value: int64(300)},
+		}},
+		{Key: "connections", Value: mongowire.D{
+			{Key: "current", Value: int32(25)},
+			{Key: "available", Value: int32(75)},
+		}},
+		{Key: "wiredTiger", Value: mongowire.D{
+			{Key: "cache", Value: mongowire.D{
+				{Key: "bytes currently in the cache", Value: int64(512)},
+				{Key: "maximum bytes configured", Value: 2048.0},
+				{Key: "tracked dirty bytes in the cache", Value: int64(64)},
+			}},
+		}},
+	}
+
+	values := metricValues(mongoServerMetrics(1, status, time.Now()))
+	assert.Equal(t, 10.0, values["mongodb_opcounters_insert"])
+	assert.Equal(t, 20.0, values["mongodb_opcounters_query"])
+	assert.Equal(t, 300.0, values["mongodb_opcounters_command"])
+	assert.NotContains(t, values, "mongodb_opcounters_update")
+	assert.Equal(t, 25.0, values["mongodb_connections_usage"])
+	assert.Equal(t, 25.0, values["mongodb_wt_cache_usage"])
+	assert.Equal(t, 64.0, values["mongodb_wt_cache_dirty_bytes"])
+
+	// 没有 WiredTiger 时不输出缓存指标
+	values = metricValues(mongoServerMetrics(1, mongowire.D{}, time.Now()))
+	assert.NotContains(t, values, "mongodb_wt_cache_usage")
+}
+
+func TestMongoReplMetrics(t *testing.T) {
+	now := time.Now().UTC()
+	member := func(state int32, health float64, optime time.Time) mongowire.D {
+		d := mongowire.D{{Key: "state", Value: state}, {Key: "health", Value: health}}
+		if !optime.IsZero() {
+			d = append(d, mongowire.E{Key: "optimeDate", Value: optime})
+		}
+		return d
+	}
+	status := mongowire.D{
+		{Key: "myState", Value: int32(1)},
+		{Key: "members", Value: []interface{}{
+			member(1, 1, now),
+			member(2, 1, now.Add(-3*time.Second)),
+			member(2, 1, now.Add(-12*time.Second)),
+			member(8, 0, time.Time{}),
+		}},
+	}
+
+	values := metricValues(mongoReplMetrics(1, status, now))
+	assert.Equal(t, 1.0, values["mongodb_repl_state"])
+	assert.Equal(t, 4.0, values["mongodb_repl_members"])
+	assert.Equal(t, 3.0, values["mongodb_repl_members_healthy"])
+	assert.Equal(t, 1.0, values["mongodb_repl_has_primary"])
+	assert.Equal(t, 12.0, values["mongodb_repl_lag"])
+
+	// 没有 primary 时无法计算延迟
+	status[1].Value = []interface{}{member(2, 1, now)}
+	values = metricValues(mongoReplMetrics(1, status, now))
+	assert.Equal(t, 0.0, values["mongodb_repl_has_primary"])
+	assert.NotContains(t, values, "mongodb_repl_lag")
+}
+
+func TestIsMongoNoReplSet(t *testing.T) {
+	assert.True(t, isMongoNoReplSet(&mongowire.CommandError{Code: 76, Name: "NoReplicationEnabled"}))
+	assert.False(t, isMongoNoReplSet(&mongowire.CommandError{Code: 13, Name: "Unauthorized"}))
+	assert.False(t, isMongoNoReplSet(errors.New("connection reset")))
+}
@@ -0,0 +1,245 @@
+package service
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"middleware-platform/internal/model"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 探测方式
+const (
+	ProbeTCP   = "tcp"
+	ProbeTLS   = "tls"
+	ProbeHTTP  = "http"
+	ProbeHTTPS = "https"
+)
+
+// 检查响应内容时最多读取的字节数
+const maxProbeBody = 1 << 20
+
+var ErrInvalidProbe = errors.New("invalid probe options")
+
+// probeOptions probe 类型在 Middleware.Options 中的探测配置
+type probeOptions struct {
+	Mode string `json:"mode"` // tcp（默认）、tls、http、https
+	// HTTP 探测的请求路径，默认 /
+	Path string `json:"path"`
+	// 期望的状态码，为空时接受 2xx 和 3xx
+	ExpectedStatus []int `json:"expected_status"`
+	// 响应内容需要匹配的正则表达式
+	BodyRegex          string `json:"body_regex"`
+	ServerName         string `json:"server_name"` // TLS SNI，默认使用 Host
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+// probeResult 一次探测的结果
+type probeResult struct {
+	Success    bool
+	Duration   time.Duration
+	StatusCode int
+	// 服务端证书（叶子证书）的过期时间，非 TLS 探测时为零值
+	CertNotAfter time.Time
+	Err          error
+}
+
+// probeConfig 解析并校验探测配置
+func probeConfig(mw *model.Middleware) (probeOptions, *regexp.Regexp, error) {
+	var opts probeOptions
+	if err := decodeOptions(mw, &opts); err != nil {
+		return opts, nil, err
+	}
+	opts.Mode = strings.ToLower(opts.Mode)
+	switch opts.Mode {
+	case "":
+		opts.Mode = ProbeTCP
+	case ProbeTCP, ProbeTLS, ProbeHTTP, ProbeHTTPS:
+	default:
+		return opts, nil, fmt.Errorf("unsupported probe mode %q", opts.Mode)
+	}
+	for _, code := range opts.ExpectedStatus {
+		if code < 100 || code > 599 {
+			return opts, nil, fmt.Errorf("invalid expected status %d", code)
+		}
+	}
+	var bodyRegex *regexp.Regexp
+	if opts.BodyRegex != "" {
+		re, err := regexp.Compile(opts.BodyRegex)
+		if err != nil {
+			return opts, nil, fmt.Errorf("invalid body_regex: %v", err)
+		}
+		bodyRegex = re
+	}
+	if opts.ServerName == "" {
+		opts.ServerName = mw.Host
+	}
+	return opts, bodyRegex, nil
+}
+
+// validateProbeOptions 创建和修改 probe 中间件时校验探测配置
+func validateProbeOptions(mw *model.Middleware) error {
+	if !strings.EqualFold(mw.Type, "probe") {
+		return nil
+	}
+	if _, _, err := probeConfig(mw); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidProbe, err)
+	}
+	return nil
+}
+
+// runProbe 按配置探测一次。每次探测都新建连接，耗时包含建立连接和 TLS 握手
+func runProbe(ctx context.Context, mw *model.Middleware, opts probeOptions, bodyRegex *regexp.Regexp) probeResult {
+	start := time.Now()
+	var result probeResult
+	switch opts.Mode {
+	case ProbeTCP:
+		result = probeTCP(ctx, mw)
+	case ProbeTLS:
+		result = probeTLS(ctx, mw, opts)
+	default:
+		result = probeHTTP(ctx, mw, opts, bodyRegex)
+	}
+	result.Duration = time.Since(start)
+	result.Success = result.Err == nil
+	return result
+}
+
+func probeTCP(ctx context.Context, mw *model.Middleware) probeResult {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(mw.Host, mw.Port))
+	if err != nil {
+		return probeResult{Err: err}
+	}
+	conn.Close()
+	return probeResult{}
+}
+
+func probeTLS(ctx context.Context, mw *model.Middleware, opts probeOptions) probeResult {
+	d := tls.Dialer{Config: probeTLSConfig(opts)}
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(mw.Host, mw.Port))
+	if err != nil {
+		return probeResult{Err: err}
+	}
+	defer conn.Close()
+	return probeResult{CertNotAfter: leafNotAfter(conn.(*tls.Conn).ConnectionState().PeerCertificates)}
+}
+
+func probeHTTP(ctx context.Context, mw *model.Middleware, opts probeOptions, bodyRegex *regexp.Regexp) probeResult {
+	path := opts.Path
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	url := opts.Mode + "://" + net.JoinHostPort(mw.Host, mw.Port) + path
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return probeResult{Err: err}
+	}
+	transport := &http.Transport{
+		Proxy:             http.ProxyFromEnvironment,
+		TLSClientConfig:   probeTLSConfig(opts),
+		DisableKeepAlives: true,
+	}
+	defer transport.CloseIdleConnections()
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return probeResult{Err: err}
+	}
+	defer resp.Body.Close()
+
+	result := probeResult{StatusCode: resp.StatusCode}
+	if resp.TLS != nil {
+		result.CertNotAfter = leafNotAfter(resp.TLS.PeerCertificates)
+	}
+	if !expectedStatus(resp.StatusCode, opts.ExpectedStatus) {
+		result.Err = fmt.Errorf("unexpected status %s", resp.Status)
+		return result
+	}
+	if bodyRegex != nil {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBody))
+		if err != nil {
+			result.Err = fmt.Errorf("failed to read body: %v", err)
+			return result
+		}
+		if !bodyRegex.Match(body) {
+			result.Err = fmt.Errorf("body does not match %q", bodyRegex.String())
+		}
+	}
+	return result
+}
+
+func probeTLSConfig(opts probeOptions) *tls.Config {
+	return &tls.Config{ServerName: opts.ServerName, InsecureSkipVerify: opts.InsecureSkipVerify}
+}
+
+func leafNotAfter(certs []*x509.Certificate) time.Time {
+	if len(certs) == 0 {
+		return time.Time{}
+	}
+	return certs[0].NotAfter
+}
+
+func expectedStatus(code int, expected []int) bool {
+	if len(expected) == 0 {
+		return code >= 200 && code < 400
+	}
+	for _, c := range expected {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// probeMetrics 探测结果指标：是否成功、耗时、HTTP 状态码和证书剩余天数
+func probeMetrics(middlewareID uint, result probeResult, now time.Time) []model.Metrics {
+	metrics := []model.Metrics{
+		{MiddlewareID: middlewareID, Type: "probe_success", Value: boolValue(result.Success), Timestamp: now},
+		{MiddlewareID: middlewareID, Type: "probe_duration", Value: float64(result.Duration.Microseconds()) / 1000,
+			Unit: "ms", Timestamp: now},
+	}
+	if result.StatusCode != 0 {
+		metrics = append(metrics, model.Metrics{MiddlewareID: middlewareID, Type: "probe_http_status",
+			Value: float64(result.StatusCode), Timestamp: now})
+	}
+	if !result.CertNotAfter.IsZero() {
+		metrics = append(metrics, model.Metrics{MiddlewareID: middlewareID, Type: "probe_cert_expiry_days",
+			Value: result.CertNotAfter.Sub(now).Hours() / 24, Unit: "days", Timestamp: now})
+	}
+	return metrics
+}
+
+// collectProbeMetrics 探测失败仍记录指标（probe_success 为 0），只有配置错误时采集失败
+func (s *MetricsService) collectProbeMetrics(ctx context.Context, mw model.Middleware) ([]model.Metrics, error) {
+	opts, bodyRegex, err := probeConfig(&mw)
+	if err != nil {
+		return nil, err
+	}
+	result := runProbe(ctx, &mw, opts, bodyRegex)
+	return probeMetrics(mw.ID, result, time.Now()), nil
+}
+
+// checkProbeHealth 探测失败即不健康
+func (s *MiddlewareService) checkProbeHealth(m *model.Middleware) error {
+	opts, bodyRegex, err := probeConfig(m)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	result := runProbe(ctx, m, opts, bodyRegex)
+	if result.Err != nil {
+		return fmt.Errorf("%s probe failed: %v", opts.Mode, result.Err)
+	}
+	return nil
+}
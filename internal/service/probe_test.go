@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"middleware-platform/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func probeTarget(rawURL string, options string) *model.Middleware {
+	u, _ := url.Parse(rawURL)
+	return &model.Middleware{ID: 7, Type: "probe", Host: u.Hostname(), Port: u.Port(),
+		Options: json.RawMessage(options)}
+}
+
+func TestProbeHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, `{"status":"UP"}`)
+	}))
+	defer server.Close()
+	s := &MetricsService{}
+
+	metrics, err := s.collectProbeMetrics(context.Background(),
+		*probeTarget(server.URL, `{"mode":"http","path":"/health","body_regex":"\"status\":\"UP\""}`))
+	assert.NoError(t, err)
+	values := metricValues(metrics)
+	assert.Equal(t, 1.0, values["probe_success"])
+	assert.Equal(t, 200.0, values["probe_http_status"])
+	assert.NotContains(t, values, "probe_cert_expiry_days")
+
+	// 探测失败仍记录指标
+	metrics, err = s.collectProbeMetrics(context.Background(), *probeTarget(server.URL, `{"mode":"http","path":"/down"}`))
+	assert.NoError(t, err)
+	values = metricValues(metrics)
+	assert.Equal(t, 0.0, values["probe_success"])
+	assert.Equal(t, 503.0, values["probe_http_status"])
+
+	m := &MiddlewareService{}
+	assert.NoError(t, m.checkProbeHealth(probeTarget(server.URL, `{"mode":"http","expected_status":[200]}`)))
+	err = m.checkProbeHealth(probeTarget(server.URL, `{"mode":"http","body_regex":"DOWN"}`))
+	assert.EqualError(t, err, `http probe failed: body does not match "DOWN"`)
+}
+
+func TestProbeTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	s := &MetricsService{}
+
+	for _, mode := range []string{"tls", "https"} {
+		metrics, err := s.collectProbeMetrics(context.Background(),
+			*probeTarget(server.URL, `{"mode":"`+mode+`","insecure_skip_verify":true}`))
+		assert.NoError(t, err)
+		values := metricValues(metrics)
+		assert.Equal(t, 1.0, values["probe_success"], mode)
+		expiry := server.Certificate().NotAfter
+		assert.InDelta(t, time.Until(expiry).Hours()/24, values["probe_cert_expiry_days"], 0.01, mode)
+	}
+
+	// 证书不受信任时失败
+	m := &MiddlewareService{}
+	assert.Error(t, m.checkProbeHealth(probeTarget(server.URL, `{"mode":"tls"}`)))
+}
+
+func TestProbeTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+	addr := "tcp://" + ln.Addr().String()
+	m := &MiddlewareService{}
+	assert.NoError(t, m.checkProbeHealth(probeTarget(addr, ``)))
+
+	ln.Close()
+	err = m.checkProbeHealth(probeTarget(addr, `{"mode":"tcp"}`))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "tcp probe failed")
+}
+
+func TestValidateProbeOptions(t *testing.T) {
+	assert.NoError(t, validateProbeOptions(&model.Middleware{Type: "probe"}))
+	assert.NoError(t, validateProbeOptions(&model.Middleware{Type: "redis", Options: json.RawMessage(`{"mode":"icmp"}`)}))
+
+	err := validateProbeOptions(&model.Middleware{Type: "probe", Options: json.RawMessage(`{"mode":"icmp"}`)})
+	assert.ErrorIs(t, err, ErrInvalidProbe)
+	assert.ErrorIs(t, validateProbeOptions(&model.Middleware{Type: "probe", Options: json.RawMessage(`{"body_regex":"("}`)}), ErrInvalidProbe)
+	assert.ErrorIs(t, validateProbeOptions(&model.Middleware{Type: "probe", Options: json.RawMessage(`{"expected_status":[1000]}`)}), ErrInvalidProbe)
+}
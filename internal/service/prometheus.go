@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"middleware-platform/internal/model"
+	"middleware-platform/internal/prom"
+	"middleware-platform/internal/telemetry"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 告警规则的数据来源
+const (
+	AlertSourceBuiltin    = "builtin"
+	AlertSourcePrometheus = "prometheus"
+)
+
+var (
+	ErrRemoteWriteDisabled     = errors.New("remote write is disabled")
+	ErrPrometheusNotConfigured = errors.New("no prometheus query source configured")
+
+	remoteWriteSamples = telemetry.Default.Counter("middleware_platform_remote_write_samples_total",
+		"Samples received through remote write by result (stored, unmapped, invalid).", "result")
+)
+
+// SetRemoteWrite 开启或关闭 remote_write 接收
+func (s *MetricsService) SetRemoteWrite(enabled bool) {
+	s.remoteWrite = enabled
+}
+
+// SetPrometheus 设置外部 Prometheus 查询源，nil表示不使用
+func (s *MetricsService) SetPrometheus(client *prom.Client) {
+	s.prometheus = client
+}
+
+// IngestRemoteWrite 保存 remote_write 推送的样本。序列按标签对应到中间件：
+// middleware_id 为中间件ID，middleware 为中间件名称，instance 为 host:port；
+// 指标类型取 __name__。无法对应到中间件的序列被丢弃。
+func (s *MetricsService) IngestRemoteWrite(series []prom.TimeSeries) (stored, dropped int, err error) {
+	if !s.remoteWrite {
+		return 0, 0, ErrRemoteWriteDisabled
+	}
+	middlewares, err := s.middlewareRepo.FindAll()
+	if err != nil {
+		return 0, 0, err
+	}
+	resolve := newMiddlewareResolver(middlewares)
+
+	var metrics []model.Metrics
+	for _, ts := range series {
+		name := ts.Label("__name__")
+		mw, ok := resolve(ts)
+		if name == "" || !ok {
+			dropped += len(ts.Samples)
+			remoteWriteSamples.Add(float64(len(ts.Samples)), "unmapped")
+			continue
+		}
+		labels := seriesLabels(ts)
+		for _, sample := range ts.Samples {
+			if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+				// 包括 Prometheus 用于标记序列结束的 stale NaN
+				dropped++
+				remoteWriteSamples.Inc("invalid")
+				continue
+			}
+			metrics = append(metrics, model.Metrics{
+				MiddlewareID: mw.ID,
+				Type:         name,
+				Value:        sample.Value,
+				Timestamp:    time.UnixMilli(sample.Timestamp),
+				Labels:       labels,
+			})
+		}
+	}
+
+	if len(metrics) > 0 {
+		if err := s.metricsRepo.SaveSamples(metrics); err != nil {
+			return 0, dropped, err
+		}
+	}
+	remoteWriteSamples.Add(float64(len(metrics)), "stored")
+	return len(metrics), dropped, nil
+}
+
+// newMiddlewareResolver 按 middleware_id、middleware、instance 标签依次查找中间件
+func newMiddlewareResolver(middlewares []model.Middleware) func(prom.TimeSeries) (model.Middleware, bool) {
+	byID := make(map[string]model.Middleware, len(middlewares))
+	byName := make(map[string]model.Middleware, len(middlewares))
+	byAddr := make(map[string]model.Middleware, len(middlewares))
+	for _, mw := range middlewares {
+		byID[strconv.FormatUint(uint64(mw.ID), 10)] = mw
+		byName[mw.Name] = mw
+		byAddr[net.JoinHostPort(mw.Host, mw.Port)] = mw
+	}
+
+	return func(ts prom.TimeSeries) (model.Middleware, bool) {
+		if id := ts.Label("middleware_id"); id != "" {
+			mw, ok := byID[id]
+			return mw, ok
+		}
+		if name := ts.Label("middleware"); name != "" {
+			mw, ok := byName[name]
+			return mw, ok
+		}
+		mw, ok := byAddr[ts.Label("instance")]
+		return mw, ok
+	}
+}
+
+// seriesLabels 序列保留的标签，去掉指标名和用于对应中间件的标签
+func seriesLabels(ts prom.TimeSeries) map[string]string {
+	labels := make(map[string]string, len(ts.Labels))
+	for _, l := range ts.Labels {
+		switch l.Name {
+		case "__name__", "middleware_id", "middleware":
+			continue
+		}
+		labels[l.Name] = l.Value
+	}
+	return labels
+}
+
+// QueryPrometheus 在外部 Prometheus 上执行即时查询，at为零值时使用当前时间
+func (s *MetricsService) QueryPrometheus(ctx context.Context, expr string, at time.Time) ([]prom.Series, error) {
+	if s.prometheus == nil {
+		return nil, ErrPrometheusNotConfigured
+	}
+	return s.prometheus.Query(ctx, expr, at)
+}
+
+// QueryPrometheusRange 在外部 Prometheus 上执行区间查询，用于图表
+func (s *MetricsService) QueryPrometheusRange(ctx context.Context, expr string, start, end time.Time, step time.Duration) ([]prom.Series, error) {
+	if s.prometheus == nil {
+		return nil, ErrPrometheusNotConfigured
+	}
+	if !end.After(start) {
+		return nil, fmt.Errorf("end must be after start")
+	}
+	if step <= 0 {
+		return nil, fmt.Errorf("step must be positive")
+	}
+	return s.prometheus.QueryRange(ctx, expr, start, end, step)
+}
+
+// SetPrometheus 设置 Source 为 prometheus 的告警规则使用的查询源
+func (s *AlertService) SetPrometheus(client *prom.Client) {
+	s.prometheus = client
+}
+
+// checkPrometheusRule 执行规则的 PromQL 表达式，结果中每条序列单独与阈值比较
+func (s *AlertService) checkPrometheusRule(ctx context.Context, rule model.AlertRule) error {
+	if s.prometheus == nil {
+		return ErrPrometheusNotConfigured
+	}
+	series, err := s.prometheus.Query(ctx, rule.Expr, time.Time{})
+	if err != nil {
+		return err
+	}
+
+	for _, ts := range series {
+		if len(ts.Points) == 0 {
+			continue
+		}
+		value := ts.Points[len(ts.Points)-1].Value
+		if !s.shouldTriggerAlert(rule, model.Metrics{Value: value}) {
+			alertEvaluations.Inc("ok")
+			continue
+		}
+		alertEvaluations.Inc("triggered")
+
+		s.alertRepo.CreateHistory(&model.AlertHistory{
+			RuleID: rule.ID,
+			Message: fmt.Sprintf("%s%s exceeded threshold: %v (threshold: %s %s)",
+				rule.Type, formatSeriesLabels(ts.Metric), value, rule.Operator, rule.Threshold),
+			Status: "triggered",
+		})
+	}
+	return nil
+}
+
+// formatSeriesLabels 按 Prometheus 的写法输出标签，如 {instance="a:9100"}
+func formatSeriesLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s=%q", name, labels[name]))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"testing"
+
+	"middleware-platform/internal/model"
+	"middleware-platform/internal/prom"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareResolver(t *testing.T) {
+	resolve := newMiddlewareResolver([]model.Middleware{
+		{ID: 1, Name: "cache", Host: "10.0.0.1", Port: "6379"},
+		{ID: 2, Name: "db", Host: "10.0.0.2", Port: "5432"},
+	})
+
+	series := func(labels ...prom.Label) prom.TimeSeries {
+		return prom.TimeSeries{Labels: labels}
+	}
+
+	mw, ok := resolve(series(prom.Label{Name: "middleware_id", Value: "2"}))
+	assert.True(t, ok)
+	assert.Equal(t, uint(2), mw.ID)
+
+	mw, ok = resolve(series(prom.Label{Name: "middleware", Value: "cache"}))
+	assert.True(t, ok)
+	assert.Equal(t, uint(1), mw.ID)
+
+	mw, ok = resolve(series(prom.Label{Name: "instance", Value: "10.0.0.2:5432"}))
+	assert.True(t, ok)
+	assert.Equal(t, uint(2), mw.ID)
+
+	// middleware_id 优先，不再回退到 instance
+	_, ok = resolve(series(
+		prom.Label{Name: "middleware_id", Value: "9"},
+		prom.Label{Name: "instance", Value: "10.0.0.1:6379"},
+	))
+	assert.False(t, ok)
+
+	_, ok = resolve(series(prom.Label{Name: "instance", Value: "10.0.0.3:9100"}))
+	assert.False(t, ok)
+}
+
+func TestFormatSeriesLabels(t *testing.T) {
+	assert.Equal(t, "", formatSeriesLabels(nil))
+	assert.Equal(t, `{instance="a:9100",job="node"}`,
+		formatSeriesLabels(map[string]string{"job": "node", "instance": "a:9100"}))
+}
+
+func TestValidateRuleSource(t *testing.T) {
+	rule := &model.AlertRule{}
+	assert.NoError(t, validateRuleSource(rule))
+	assert.Equal(t, AlertSourceBuiltin, rule.Source)
+
+	assert.Error(t, validateRuleSource(&model.AlertRule{Source: AlertSourcePrometheus}))
+	assert.NoError(t, validateRuleSource(&model.AlertRule{Source: AlertSourcePrometheus, Expr: "up == 0"}))
+	assert.Error(t, validateRuleSource(&model.AlertRule{Source: "graphite"}))
+}
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"middleware-platform/internal/model"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// 每次采集读取的慢查询条数
+	slowLogFetchSize = 128
+	// 保存的慢查询命令最大长度
+	maxSlowLogCommand = 512
+
+	defaultBigKeyScanLimit = 10000
+	maxBigKeyScanLimit     = 1000000
+	defaultBigKeyTop       = 20
+	bigKeyScanTimeout      = 60 * time.Second
+	// MEMORY USAGE 对聚合类型抽样的元素数
+	bigKeyMemorySamples = 5
+)
+
+// ErrNotRedis 对非 Redis 中间件执行 Redis 专有操作
+var ErrNotRedis = errors.New("middleware is not a redis instance")
+
+// redisDetailMetrics 从 INFO 中提取命中率、淘汰/过期、碎片率、复制和持久化状态
+func redisDetailMetrics(middlewareID uint, info map[string]string, now time.Time) []model.Metrics {
+	var metrics []model.Metrics
+	add := func(metricType string, value float64, unit string) {
+		metrics = append(metrics, model.Metrics{
+			MiddlewareID: middlewareID,
+			Type:         metricType,
+			Value:        value,
+			Unit:         unit,
+			Timestamp:    now,
+		})
+	}
+	number := func(key string) (float64, bool) {
+		v, err := strconv.ParseFloat(info[key], 64)
+		return v, err == nil
+	}
+	status := func(metricType, key string) {
+		if v, ok := info[key]; ok {
+			add(metricType, boolValue(v == "ok"), "")
+		}
+	}
+
+	hits, okHits := number("keyspace_hits")
+	misses, okMisses := number("keyspace_misses")
+	if okHits && okMisses {
+		add("keyspace_hits", hits, "")
+		add("keyspace_misses", misses, "")
+		if hits+misses > 0 {
+			add("keyspace_hit_ratio", hits/(hits+misses)*100, "%")
+		}
+	}
+	for key, metricType := range map[string]string{
+		"evicted_keys":                "evicted_keys",
+		"expired_keys":                "expired_keys",
+		"rdb_changes_since_last_save": "rdb_changes_since_last_save",
+		"aof_enabled":                 "aof_enabled",
+		"connected_slaves":            "connected_replicas",
+	} {
+		if v, ok := number(key); ok {
+			add(metricType, v, "")
+		}
+	}
+	if v, ok := number("mem_fragmentation_ratio"); ok {
+		add("mem_fragmentation_ratio", v, "")
+	}
+	status("rdb_last_bgsave_ok", "rdb_last_bgsave_status")
+	if info["aof_enabled"] == "1" {
+		status("aof_last_write_ok", "aof_last_write_status")
+		status("aof_last_rewrite_ok", "aof_last_bgrewrite_status")
+	}
+
+	switch info["role"] {
+	case "master":
+		// 主节点：复制偏移量与最慢副本的差值
+		if offset, ok := number("master_repl_offset"); ok {
+			lag := 0.0
+			for key, value := range info {
+				if !strings.HasPrefix(key, "slave") || key == "slave_repl_offset" {
+					continue
+				}
+				if replica, ok := parseRedisFields(value)["offset"]; ok {
+					if n, err := strconv.ParseFloat(replica, 64); err == nil && offset-n > lag {
+						lag = offset - n
+					}
+				}
+			}
+			add("replication_offset_lag", lag, "bytes")
+		}
+	case "slave":
+		add("master_link_up", boolValue(info["master_link_status"] == "up"), "")
+		if v, ok := number("master_last_io_seconds_ago"); ok && v >= 0 {
+			add("master_last_io_seconds_ago", v, "s")
+		}
+	}
+	return metrics
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// parseRedisFields 解析 INFO 中 a=1,b=2 形式的值，如 slave0 和 db0
+func parseRedisFields(value string) map[string]string {
+	fields := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		if k, v, ok := strings.Cut(part, "="); ok {
+			fields[k] = v
+		}
+	}
+	return fields
+}
+
+// captureSlowLog 读取最近的慢查询并保存，已保存的条目按ID去重
+func (s *MetricsService) captureSlowLog(ctx context.Context, client *redis.Client, mw model.Middleware) error {
+	entries, err := client.SlowLogGet(ctx, slowLogFetchSize).Result()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	logs := make([]model.RedisSlowLog, 0, len(entries))
+	for _, e := range entries {
+		command := strings.Join(e.Args, " ")
+		if len(command) > maxSlowLogCommand {
+			command = command[:maxSlowLogCommand] + "..."
+		}
+		logs = append(logs, model.RedisSlowLog{
+			MiddlewareID: mw.ID,
+			EntryID:      e.ID,
+			ExecutedAt:   e.Time,
+			Duration:     e.Duration.Microseconds(),
+			Command:      command,
+			ClientAddr:   e.ClientAddr,
+			ClientName:   e.ClientName,
+		})
+	}
+	return s.metricsRepo.SaveSlowLogs(logs)
+}
+
+// GetSlowLogs 分页浏览保存的慢查询，从新到旧
+func (s *MetricsService) GetSlowLogs(middlewareID uint, limit, offset int) ([]model.RedisSlowLog, int64, error) {
+	return s.metricsRepo.FindSlowLogs(middlewareID, limit, offset)
+}
+
+// BigKey 大 key 扫描结果中的一个 key
+type BigKey struct {
+	Key   string `json:"key"`
+	Type  string `json:"type"`
+	Bytes int64  `json:"bytes"`
+}
+
+// BigKeyReport 大 key 扫描报告
+type BigKeyReport struct {
+	MiddlewareID uint             `json:"middleware_id"`
+	Scanned      int              `json:"scanned"`  // 检查过的 key 数
+	Complete     bool             `json:"complete"` // 是否遍历了整个 keyspace
+	TotalBytes   int64            `json:"total_bytes"`
+	ByType       map[string]int64 `json:"by_type"`  // 各类型的字节数
+	Keys         []BigKey         `json:"keys"`     // 占用最大的 key
+	Duration     float64          `json:"duration"` // 秒
+}
+
+// BigKeyScanOptions limit 为最多检查的 key 数，top 为返回的 key 数，match 为 SCAN 的匹配模式
+type BigKeyScanOptions struct {
+	Limit int
+	Top   int
+	Match string
+}
+
+// ScanBigKeys 用 SCAN 遍历 keyspace，对每个 key 执行 MEMORY USAGE（聚合类型抽样），返回占用最大的 key。
+// SCAN 不阻塞服务器，但会给实例带来额外负载，检查的 key 数受 Limit 限制。
+func (s *MetricsService) ScanBigKeys(ctx context.Context, middlewareID uint, opts BigKeyScanOptions) (*BigKeyReport, error) {
+	mw, err := s.middlewareRepo.FindByID(middlewareID)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(mw.Type, "redis") {
+		return nil, ErrNotRedis
+	}
+	if opts.Limit <= 0 {
+		opts.Limit = defaultBigKeyScanLimit
+	}
+	if opts.Limit > maxBigKeyScanLimit {
+		opts.Limit = maxBigKeyScanLimit
+	}
+	if opts.Top <= 0 {
+		opts.Top = defaultBigKeyTop
+	}
+	client, release, err := s.clients.redisClient(mw)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(ctx, bigKeyScanTimeout)
+	defer cancel()
+
+	start := time.Now()
+	report := &BigKeyReport{MiddlewareID: middlewareID, ByType: make(map[string]int64)}
+	var keys []BigKey
+	var cursor uint64
+	for {
+		batch, next, err := client.Scan(ctx, cursor, opts.Match, 100).Result()
+		if err != nil {
+			s.clients.report(mw, clientRedis, err)
+			return nil, err
+		}
+		truncated := false
+		if remaining := opts.Limit - report.Scanned; len(batch) > remaining {
+			batch, truncated = batch[:remaining], true
+		}
+
+		// 同一批 key 的 MEMORY USAGE 和 TYPE 通过一次管道发送
+		pipe := client.Pipeline()
+		usages := make([]*redis.IntCmd, len(batch))
+		types := make([]*redis.StatusCmd, len(batch))
+		for i, key := range batch {
+			usages[i] = pipe.MemoryUsage(ctx, key, bigKeyMemorySamples)
+			types[i] = pipe.Type(ctx, key)
+		}
+		if len(batch) > 0 {
+			// 扫描过程中被删除的 key 返回 nil，单条命令的错误在下面逐个判断
+			if _, err := pipe.Exec(ctx); err != nil && ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+		}
+		for i, key := range batch {
+			report.Scanned++
+			if usages[i].Err() != nil || types[i].Err() != nil {
+				continue
+			}
+			bytes, t := usages[i].Val(), types[i].Val()
+			report.TotalBytes += bytes
+			report.ByType[t] += bytes
+			keys = append(keys, BigKey{Key: key, Type: t, Bytes: bytes})
+		}
+		// 只保留当前最大的 top 个，控制内存
+		if len(keys) > opts.Top*4 {
+			keys = topBigKeys(keys, opts.Top)
+		}
+
+		cursor = next
+		if cursor == 0 && !truncated {
+			report.Complete = true
+			break
+		}
+		if truncated || report.Scanned >= opts.Limit {
+			break
+		}
+	}
+	s.clients.report(mw, clientRedis, nil)
+
+	report.Keys = topBigKeys(keys, opts.Top)
+	report.Duration = time.Since(start).Seconds()
+	return report, nil
+}
+
+// topBigKeys 按占用从大到小返回前n个
+func topBigKeys(keys []BigKey, n int) []BigKey {
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Bytes != keys[j].Bytes {
+			return keys[i].Bytes > keys[j].Bytes
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	return keys
+}
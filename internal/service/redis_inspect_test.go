@@ -0,0 +1,91 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"middleware-platform/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const masterInfo = "# Stats\r\n" +
+	"keyspace_hits:750\r\n" +
+	"keyspace_misses:250\r\n" +
+	"evicted_keys:3\r\n" +
+	"expired_keys:42\r\n" +
+	"# Memory\r\n" +
+	"mem_fragmentation_ratio:1.37\r\n" +
+	"# Persistence\r\n" +
+	"rdb_changes_since_last_save:12\r\n" +
+	"rdb_last_bgsave_status:err\r\n" +
+	"aof_enabled:1\r\n" +
+	"aof_last_write_status:ok\r\n" +
+	"aof_last_bgrewrite_status:ok\r\n" +
+	"# Replication\r\n" +
+	"role:master\r\n" +
+	"connected_slaves:2\r\n" +
+	"slave0:ip=10.0.0.2,port=6379,state=online,offset=1000,lag=0\r\n" +
+	"slave1:ip=10.0.0.3,port=6379,state=online,offset=400,lag=1\r\n" +
+	"master_repl_offset:1024\r\n"
+
+func metricValues(metrics []model.Metrics) map[string]float64 {
+	values := make(map[string]float64)
+	for _, m := range metrics {
+		values[m.Type] = m.Value
+	}
+	return values
+}
+
+func TestRedisDetailMetrics_Master(t *testing.T) {
+	now := time.Now()
+	metrics := redisDetailMetrics(7, parseRedisInfo(masterInfo), now)
+	for _, m := range metrics {
+		assert.Equal(t, uint(7), m.MiddlewareID)
+		assert.Equal(t, now, m.Timestamp)
+	}
+
+	values := metricValues(metrics)
+	assert.Equal(t, 75.0, values["keyspace_hit_ratio"])
+	assert.Equal(t, 3.0, values["evicted_keys"])
+	assert.Equal(t, 42.0, values["expired_keys"])
+	assert.Equal(t, 1.37, values["mem_fragmentation_ratio"])
+	assert.Equal(t, 12.0, values["rdb_changes_since_last_save"])
+	assert.Equal(t, 0.0, values["rdb_last_bgsave_ok"])
+	assert.Equal(t, 1.0, values["aof_last_write_ok"])
+	assert.Equal(t, 2.0, values["connected_replicas"])
+	// 与最慢副本的偏移量差
+	assert.Equal(t, 624.0, values["replication_offset_lag"])
+	assert.NotContains(t, values, "master_link_up")
+}
+
+func TestRedisDetailMetrics_Replica(t *testing.T) {
+	info := "role:slave\r\n" +
+		"master_link_status:down\r\n" +
+		"master_last_io_seconds_ago:-1\r\n" +
+		"keyspace_hits:0\r\n" +
+		"keyspace_misses:0\r\n" +
+		"aof_enabled:0\r\n" +
+		"aof_last_write_status:ok\r\n"
+
+	values := metricValues(redisDetailMetrics(1, parseRedisInfo(info), time.Now()))
+	assert.Equal(t, 0.0, values["master_link_up"])
+	assert.NotContains(t, values, "master_last_io_seconds_ago")
+	// 没有请求时不计算命中率
+	assert.NotContains(t, values, "keyspace_hit_ratio")
+	// 未开启 AOF 时不报告写入状态
+	assert.NotContains(t, values, "aof_last_write_ok")
+	assert.NotContains(t, values, "replication_offset_lag")
+}
+
+func TestTopBigKeys(t *testing.T) {
+	keys := []BigKey{
+		{Key: "a", Bytes: 10},
+		{Key: "b", Bytes: 300},
+		{Key: "c", Bytes: 50},
+		{Key: "d", Bytes: 300},
+	}
+	top := topBigKeys(keys, 3)
+	assert.Equal(t, []string{"b", "d", "c"}, []string{top[0].Key, top[1].Key, top[2].Key})
+	assert.Len(t, topBigKeys(keys, 10), 4)
+}
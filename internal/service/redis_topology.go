@@ -0,0 +1,407 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"middleware-platform/internal/model"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis 拓扑相关的告警事件
+const (
+	AlertEventRedisSlotsFailed = "redis_cluster_slots_failed"
+	AlertEventRedisFailover    = "redis_failover"
+)
+
+const (
+	redisModeCluster  = "cluster"
+	redisModeSentinel = "sentinel"
+
+	clusterSlots = 16384
+)
+
+var ErrNoTopology = errors.New("no cluster or sentinel topology discovered for this middleware")
+
+// SetAlerter 设置槽位失效和主从切换时的告警出口
+func (s *MetricsService) SetAlerter(alerter EventAlerter) {
+	s.alerter = alerter
+}
+
+// GetRedisTopology 获取最近一次发现的拓扑及节点
+func (s *MetricsService) GetRedisTopology(middlewareID uint) (*model.RedisTopology, error) {
+	topology, err := s.middlewareRepo.FindRedisTopology(middlewareID)
+	if err != nil {
+		return nil, ErrNoTopology
+	}
+	return topology, nil
+}
+
+// GetFailoverEvents 获取最近的主从切换记录
+func (s *MetricsService) GetFailoverEvents(middlewareID uint, limit int) ([]model.RedisFailoverEvent, error) {
+	return s.middlewareRepo.FindFailoverEvents(middlewareID, limit)
+}
+
+// discoverRedisTopology 对 Cluster 或 Sentinel 模式的实例发现拓扑，返回拓扑指标。
+// 发现的节点保存为子实例，检测主从切换，槽位开始失效时告警。
+func (s *MetricsService) discoverRedisTopology(ctx context.Context, client *redis.Client, mw *model.Middleware, mode string) ([]model.Metrics, error) {
+	var topology *model.RedisTopology
+	var err error
+	switch mode {
+	case redisModeCluster:
+		topology, err = discoverCluster(ctx, client)
+	case redisModeSentinel:
+		topology, err = discoverSentinel(ctx, client)
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	topology.MiddlewareID = mw.ID
+
+	members := make([]discoveredMember, 0, len(topology.Nodes)+1)
+	if mode == redisModeSentinel {
+		members = append(members, discoveredMember{Host: mw.Host, Port: mw.Port, Role: "sentinel"})
+	}
+	for _, node := range topology.Nodes {
+		members = append(members, discoveredMember{Host: node.Host, Port: node.Port, Role: node.Role})
+	}
+	ids, err := s.syncMembers(mw, members)
+	if err != nil {
+		return nil, err
+	}
+	for i := range topology.Nodes {
+		node := &topology.Nodes[i]
+		node.ParentID = mw.ID
+		node.MiddlewareID = ids[memberAddr(node.Host, node.Port)]
+	}
+
+	// 与上一次的拓扑比较，首次发现时没有可比较的对象
+	previous, err := s.middlewareRepo.FindRedisTopology(mw.ID)
+	if err != nil {
+		previous = nil
+	}
+	if err := s.middlewareRepo.SaveRedisTopology(topology); err != nil {
+		return nil, err
+	}
+
+	if previous != nil {
+		for _, event := range detectFailovers(mode, previous.Nodes, topology.Nodes) {
+			event.MiddlewareID = mw.ID
+			if err := s.middlewareRepo.CreateFailoverEvent(&event); err != nil {
+				log.Printf("Failed to record failover of middleware %d: %v", mw.ID, err)
+			}
+			s.raiseEvent(AlertEventRedisFailover, mw.ID, fmt.Sprintf("redis %s failover on %s: %s -> %s (%s)",
+				mode, mw.Name, event.OldMaster, event.NewMaster, event.MasterName))
+		}
+	}
+	if mode == redisModeCluster && !clusterHealthy(topology) && (previous == nil || clusterHealthy(previous)) {
+		s.raiseEvent(AlertEventRedisSlotsFailed, mw.ID, fmt.Sprintf(
+			"redis cluster %s is unhealthy: state=%s, %d slots failed, %d slots unassigned",
+			mw.Name, topology.State, topology.SlotsFail, clusterSlots-topology.SlotsAssigned))
+	}
+
+	return topologyMetrics(topology, time.Now()), nil
+}
+
+func (s *MetricsService) raiseEvent(eventType string, middlewareID uint, message string) {
+	if s.alerter == nil {
+		return
+	}
+	if err := s.alerter.RaiseEvent(eventType, strconv.FormatUint(uint64(middlewareID), 10), message); err != nil {
+		log.Printf("Failed to raise %s alert for middleware %d: %v", eventType, middlewareID, err)
+	}
+}
+
+// clusterHealthy 集群状态正常且全部槽位已分配、没有失效的槽位；pfail 只是单个节点的怀疑，不算失效
+func clusterHealthy(t *model.RedisTopology) bool {
+	return t.State == "ok" && t.SlotsFail == 0 && t.SlotsAssigned == clusterSlots
+}
+
+// discoverCluster 通过 CLUSTER INFO 获取槽位状态，通过 CLUSTER NODES 获取节点和主从关系
+func discoverCluster(ctx context.Context, client *redis.Client) (*model.RedisTopology, error) {
+	info, err := client.ClusterInfo(ctx).Result()
+	if err != nil {
+		return nil, fmt.Errorf("cluster info: %v", err)
+	}
+	nodes, err := client.ClusterNodes(ctx).Result()
+	if err != nil {
+		return nil, fmt.Errorf("cluster nodes: %v", err)
+	}
+	return clusterTopology(parseRedisInfo(info), parseClusterNodes(nodes)), nil
+}
+
+func clusterTopology(info map[string]string, nodes []model.RedisNode) *model.RedisTopology {
+	number := func(key string) int {
+		n, _ := strconv.Atoi(info[key])
+		return n
+	}
+	topology := &model.RedisTopology{
+		Mode:          redisModeCluster,
+		State:         info["cluster_state"],
+		SlotsAssigned: number("cluster_slots_assigned"),
+		SlotsOK:       number("cluster_slots_ok"),
+		SlotsPfail:    number("cluster_slots_pfail"),
+		SlotsFail:     number("cluster_slots_fail"),
+		KnownNodes:    number("cluster_known_nodes"),
+		Nodes:         nodes,
+	}
+	countRoles(topology)
+	return topology
+}
+
+func countRoles(topology *model.RedisTopology) {
+	for _, node := range topology.Nodes {
+		switch node.Role {
+		case "master":
+			topology.Masters++
+		case "replica":
+			topology.Replicas++
+		}
+	}
+}
+
+// parseClusterNodes 解析 CLUSTER NODES 输出，每行格式：
+// <id> <ip:port@cport[,hostname]> <flags> <master> <ping-sent> <pong-recv> <config-epoch> <link-state> <slot> ...
+// 握手中和没有地址的节点忽略
+func parseClusterNodes(output string) []model.RedisNode {
+	var nodes []model.RedisNode
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 8 {
+			continue
+		}
+		flags := fields[2]
+		if hasFlag(flags, "handshake") || hasFlag(flags, "noaddr") {
+			continue
+		}
+		addr := fields[1]
+		if i := strings.IndexAny(addr, "@,"); i >= 0 {
+			addr = addr[:i]
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil || host == "" || port == "0" {
+			continue
+		}
+
+		node := model.RedisNode{
+			NodeID:    fields[0],
+			Host:      host,
+			Port:      port,
+			Flags:     flags,
+			LinkState: fields[7],
+		}
+		switch {
+		case hasFlag(flags, "master"):
+			node.Role = "master"
+		case hasFlag(flags, "slave"):
+			node.Role = "replica"
+			if fields[3] != "-" {
+				node.MasterNodeID = fields[3]
+			}
+		}
+		var slots []string
+		for _, slot := range fields[8:] {
+			// [slot->-node] 和 [slot-<-node] 是迁移中的槽位
+			if strings.HasPrefix(slot, "[") {
+				continue
+			}
+			slots = append(slots, slot)
+			node.SlotCount += slotRangeSize(slot)
+		}
+		node.Slots = strings.Join(slots, ",")
+		nodes = append(nodes, node)
+	}
+
+	// 补充 replica 所属主节点的地址
+	addrs := make(map[string]string, len(nodes))
+	for _, node := range nodes {
+		addrs[node.NodeID] = memberAddr(node.Host, node.Port)
+	}
+	for i := range nodes {
+		if nodes[i].MasterNodeID != "" {
+			nodes[i].MasterAddr = addrs[nodes[i].MasterNodeID]
+		}
+	}
+	return nodes
+}
+
+func hasFlag(flags, flag string) bool {
+	for _, f := range strings.Split(flags, ",") {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
+// slotRangeSize 计算 "5461" 或 "0-5460" 包含的槽位数
+func slotRangeSize(slot string) int {
+	from, to, isRange := strings.Cut(slot, "-")
+	start, err := strconv.Atoi(from)
+	if err != nil {
+		return 0
+	}
+	if !isRange {
+		return 1
+	}
+	end, err := strconv.Atoi(to)
+	if err != nil || end < start {
+		return 0
+	}
+	return end - start + 1
+}
+
+// discoverSentinel 通过 SENTINEL MASTERS 和 SENTINEL REPLICAS 获取监控的主从节点
+func discoverSentinel(ctx context.Context, client *redis.Client) (*model.RedisTopology, error) {
+	reply, err := client.Do(ctx, "SENTINEL", "MASTERS").Result()
+	if err != nil {
+		return nil, fmt.Errorf("sentinel masters: %v", err)
+	}
+	masters := sentinelEntries(reply)
+
+	replicas := make(map[string][]map[string]string, len(masters))
+	for _, master := range masters {
+		name := master["name"]
+		reply, err := client.Do(ctx, "SENTINEL", "REPLICAS", name).Result()
+		if err != nil {
+			// REPLICAS 从 Redis 5.0 开始提供，之前的版本使用 SLAVES
+			reply, err = client.Do(ctx, "SENTINEL", "SLAVES", name).Result()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("sentinel replicas %s: %v", name, err)
+		}
+		replicas[name] = sentinelEntries(reply)
+	}
+	return sentinelTopology(masters, replicas), nil
+}
+
+func sentinelTopology(masters []map[string]string, replicas map[string][]map[string]string) *model.RedisTopology {
+	topology := &model.RedisTopology{Mode: redisModeSentinel, State: "ok"}
+	for _, master := range masters {
+		name := master["name"]
+		if hasFlag(master["flags"], "o_down") {
+			topology.State = "fail"
+		}
+		masterAddr := memberAddr(master["ip"], master["port"])
+		topology.Nodes = append(topology.Nodes, model.RedisNode{
+			NodeID:     master["runid"],
+			Host:       master["ip"],
+			Port:       master["port"],
+			Role:       "master",
+			MasterName: name,
+			Flags:      master["flags"],
+		})
+		for _, replica := range replicas[name] {
+			topology.Nodes = append(topology.Nodes, model.RedisNode{
+				NodeID:     replica["runid"],
+				Host:       replica["ip"],
+				Port:       replica["port"],
+				Role:       "replica",
+				MasterAddr: masterAddr,
+				MasterName: name,
+				Flags:      replica["flags"],
+				LinkState:  replica["master-link-status"],
+			})
+		}
+	}
+	topology.KnownNodes = len(topology.Nodes)
+	countRoles(topology)
+	return topology
+}
+
+// sentinelEntries 将 SENTINEL 命令返回的 [[k1 v1 k2 v2 ...] ...] 转换为键值表
+func sentinelEntries(reply interface{}) []map[string]string {
+	items, _ := reply.([]interface{})
+	entries := make([]map[string]string, 0, len(items))
+	for _, item := range items {
+		fields, ok := item.([]interface{})
+		if !ok {
+			continue
+		}
+		entry := make(map[string]string, len(fields)/2)
+		for i := 0; i+1 < len(fields); i += 2 {
+			entry[fmt.Sprint(fields[i])] = fmt.Sprint(fields[i+1])
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// detectFailovers 比较前后两次拓扑：Cluster 中 replica 晋升为 master，或 Sentinel 中同名主节点的地址变化
+func detectFailovers(mode string, previous, current []model.RedisNode) []model.RedisFailoverEvent {
+	var events []model.RedisFailoverEvent
+	switch mode {
+	case redisModeCluster:
+		before := make(map[string]model.RedisNode, len(previous))
+		for _, node := range previous {
+			before[node.NodeID] = node
+		}
+		for _, node := range current {
+			prev, ok := before[node.NodeID]
+			if !ok || prev.Role != "replica" || node.Role != "master" {
+				continue
+			}
+			events = append(events, model.RedisFailoverEvent{
+				MasterName: node.Slots,
+				OldMaster:  prev.MasterAddr,
+				NewMaster:  memberAddr(node.Host, node.Port),
+			})
+		}
+	case redisModeSentinel:
+		before := make(map[string]string)
+		for _, node := range previous {
+			if node.Role == "master" {
+				before[node.MasterName] = memberAddr(node.Host, node.Port)
+			}
+		}
+		for _, node := range current {
+			if node.Role != "master" {
+				continue
+			}
+			addr := memberAddr(node.Host, node.Port)
+			if old, ok := before[node.MasterName]; ok && old != addr {
+				events = append(events, model.RedisFailoverEvent{
+					MasterName: node.MasterName,
+					OldMaster:  old,
+					NewMaster:  addr,
+				})
+			}
+		}
+	}
+	return events
+}
+
+// topologyMetrics 拓扑概况作为父实例的指标，可以配置告警规则，如 cluster_slots_fail > 0
+func topologyMetrics(t *model.RedisTopology, now time.Time) []model.Metrics {
+	values := map[string]float64{
+		"masters":     float64(t.Masters),
+		"replicas":    float64(t.Replicas),
+		"known_nodes": float64(t.KnownNodes),
+		"state_ok":    boolValue(t.State == "ok"),
+	}
+	if t.Mode == redisModeCluster {
+		values["slots_assigned"] = float64(t.SlotsAssigned)
+		values["slots_ok"] = float64(t.SlotsOK)
+		values["slots_pfail"] = float64(t.SlotsPfail)
+		values["slots_fail"] = float64(t.SlotsFail)
+	}
+
+	metrics := make([]model.Metrics, 0, len(values))
+	for name, value := range values {
+		metrics = append(metrics, model.Metrics{
+			MiddlewareID: t.MiddlewareID,
+			Type:         t.Mode + "_" + name,
+			Value:        value,
+			Timestamp:    now,
+		})
+	}
+	return metrics
+}
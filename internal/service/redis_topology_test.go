@@ -0,0 +1,121 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"middleware-platform/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const clusterNodes = `07c37dfe 10.0.0.1:6379@16379 myself,master - 0 0 1 connected 0-5460
+67ed2db8 10.0.0.2:6379@16379,redis-2 master - 0 1426238316232 2 connected 5461-10922 [10923->-292f8b36]
+292f8b36 10.0.0.3:6379@16379 master,fail - 1426238316232 1426238316232 3 disconnected 10923-16383
+e7d1eecc 10.0.0.4:6379@16379 slave 07c37dfe 0 1426238317741 1 connected
+6ec23923 10.0.0.5:6379@16379 slave 292f8b36 0 1426238316232 3 connected
+abcdef00 :0@0 master,noaddr - 0 0 0 disconnected
+`
+
+func TestParseClusterNodes(t *testing.T) {
+	nodes := parseClusterNodes(clusterNodes)
+	if !assert.Len(t, nodes, 5) {
+		return
+	}
+
+	assert.Equal(t, "master", nodes[0].Role)
+	assert.Equal(t, "0-5460", nodes[0].Slots)
+	assert.Equal(t, 5461, nodes[0].SlotCount)
+
+	// 主机名和迁移中的槽位不影响解析
+	assert.Equal(t, "10.0.0.2", nodes[1].Host)
+	assert.Equal(t, "5461-10922", nodes[1].Slots)
+	assert.Equal(t, 5462, nodes[1].SlotCount)
+
+	assert.Equal(t, "disconnected", nodes[2].LinkState)
+	assert.Equal(t, "replica", nodes[3].Role)
+	assert.Equal(t, "07c37dfe", nodes[3].MasterNodeID)
+	assert.Equal(t, "10.0.0.1:6379", nodes[3].MasterAddr)
+}
+
+func TestClusterTopology(t *testing.T) {
+	info := parseRedisInfo("cluster_state:fail\r\ncluster_slots_assigned:16384\r\ncluster_slots_ok:10923\r\n" +
+		"cluster_slots_pfail:0\r\ncluster_slots_fail:5461\r\ncluster_known_nodes:5\r\n")
+	topology := clusterTopology(info, parseClusterNodes(clusterNodes))
+
+	assert.Equal(t, 3, topology.Masters)
+	assert.Equal(t, 2, topology.Replicas)
+	assert.Equal(t, 5461, topology.SlotsFail)
+	assert.False(t, clusterHealthy(topology))
+
+	topology.State, topology.SlotsFail = "ok", 0
+	assert.True(t, clusterHealthy(topology))
+	topology.SlotsAssigned = clusterSlots - 1
+	assert.False(t, clusterHealthy(topology))
+}
+
+func TestSentinelTopology(t *testing.T) {
+	reply := []interface{}{
+		[]interface{}{"name", "mymaster", "ip", "10.0.0.1", "port", "6379", "runid", "r1", "flags", "master"},
+		[]interface{}{"name", "cache", "ip", "10.0.1.1", "port", "6380", "flags", "master,o_down"},
+	}
+	masters := sentinelEntries(reply)
+	if !assert.Len(t, masters, 2) {
+		return
+	}
+	replicas := map[string][]map[string]string{
+		"mymaster": sentinelEntries([]interface{}{
+			[]interface{}{"ip", "10.0.0.2", "port", "6379", "flags", "slave", "master-link-status", "ok"},
+		}),
+	}
+
+	topology := sentinelTopology(masters, replicas)
+	assert.Equal(t, "fail", topology.State)
+	assert.Equal(t, 2, topology.Masters)
+	assert.Equal(t, 1, topology.Replicas)
+	assert.Equal(t, 3, topology.KnownNodes)
+	assert.Equal(t, "10.0.0.1:6379", topology.Nodes[1].MasterAddr)
+	assert.Equal(t, "mymaster", topology.Nodes[1].MasterName)
+}
+
+func TestDetectFailovers(t *testing.T) {
+	previous := []model.RedisNode{
+		{NodeID: "a", Host: "10.0.0.1", Port: "6379", Role: "master", Slots: "0-5460"},
+		{NodeID: "b", Host: "10.0.0.2", Port: "6379", Role: "replica", MasterAddr: "10.0.0.1:6379"},
+	}
+	current := []model.RedisNode{
+		{NodeID: "a", Host: "10.0.0.1", Port: "6379", Role: "master", Flags: "master,fail"},
+		{NodeID: "b", Host: "10.0.0.2", Port: "6379", Role: "master", Slots: "0-5460"},
+	}
+	events := detectFailovers(redisModeCluster, previous, current)
+	if !assert.Len(t, events, 1) {
+		return
+	}
+	assert.Equal(t, "10.0.0.1:6379", events[0].OldMaster)
+	assert.Equal(t, "10.0.0.2:6379", events[0].NewMaster)
+	assert.Equal(t, "0-5460", events[0].MasterName)
+
+	previous = []model.RedisNode{{Host: "10.0.0.1", Port: "6379", Role: "master", MasterName: "mymaster"}}
+	current = []model.RedisNode{{Host: "10.0.0.2", Port: "6379", Role: "master", MasterName: "mymaster"}}
+	events = detectFailovers(redisModeSentinel, previous, current)
+	if !assert.Len(t, events, 1) {
+		return
+	}
+	assert.Equal(t, "mymaster", events[0].MasterName)
+	assert.Equal(t, "10.0.0.2:6379", events[0].NewMaster)
+
+	assert.Empty(t, detectFailovers(redisModeSentinel, current, current))
+}
+
+func TestTopologyMetrics(t *testing.T) {
+	topology := &model.RedisTopology{MiddlewareID: 3, Mode: redisModeCluster, State: "ok", SlotsFail: 2, Masters: 3}
+	values := metricValues(topologyMetrics(topology, time.Now()))
+	assert.Equal(t, 2.0, values["cluster_slots_fail"])
+	assert.Equal(t, 1.0, values["cluster_state_ok"])
+	assert.Equal(t, 3.0, values["cluster_masters"])
+
+	topology.Mode = redisModeSentinel
+	values = metricValues(topologyMetrics(topology, time.Now()))
+	assert.NotContains(t, values, "sentinel_slots_fail")
+	assert.Contains(t, values, "sentinel_masters")
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"middleware-platform/internal/model"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// newSSHClient 根据主机配置建立SSH连接
+func newSSHClient(host *model.Host) (*ssh.Client, error) {
+	config := &ssh.ClientConfig{
+		User:            host.Username,
+		Auth:            []ssh.AuthMethod{},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:         5 * time.Second,
+	}
+
+	if host.Password != "" {
+		config.Auth = append(config.Auth, ssh.Password(host.Password))
+	}
+
+	if host.SSHKey != "" {
+		signer, err := ssh.ParsePrivateKey([]byte(host.SSHKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SSH key: %v", err)
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	}
+
+	return ssh.Dial("tcp", fmt.Sprintf("%s:%d", host.IP, host.Port), config)
+}
+
+// closeOnCancel ctx取消时关闭连接以中断阻塞中的传输或命令，返回的函数用于停止监听
+func closeOnCancel(ctx context.Context, client *ssh.Client) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			client.Close()
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// runRemoteCommand 在远程主机执行命令，返回合并后的stdout和stderr
+func runRemoteCommand(client *ssh.Client, cmd string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	out, err := session.CombinedOutput(cmd)
+	return string(out), err
+}
+
+// remoteFileExpr 生成把推送结果路径赋给$f的shell片段：与scpUpload一致，目标是目录时为 目录/name
+func remoteFileExpr(target, name string) string {
+	return fmt.Sprintf(`f=%s; [ -d "$f" ] && f="$f"/%s; `, shellQuote(target), shellQuote(name))
+}
+
+// remoteMissingMarker 远程文件不存在时校验命令的输出
+const remoteMissingMarker = "__missing__"
+
+// remoteSHA256 计算推送到远程主机的文件的SHA-256，文件不存在时exists为false。
+// 没有sha256sum的系统（如BSD）回退到shasum。
+func remoteSHA256(client *ssh.Client, target, name string) (sum string, exists bool, err error) {
+	cmd := remoteFileExpr(target, name) +
+		`if [ ! -e "$f" ]; then echo ` + remoteMissingMarker + `; exit 0; fi; ` +
+		`sha256sum "$f" 2>/dev/null || shasum -a 256 "$f"`
+	out, err := runRemoteCommand(client, cmd)
+	if err != nil {
+		return "", false, fmt.Errorf("sha256sum failed: %v: %s", err, strings.TrimSpace(out))
+	}
+	return parseChecksumOutput(out)
+}
+
+// parseChecksumOutput 解析 sha256sum/shasum 的输出
+func parseChecksumOutput(out string) (string, bool, error) {
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return "", false, fmt.Errorf("checksum command returned no output")
+	}
+	if fields[0] == remoteMissingMarker {
+		return "", false, nil
+	}
+	return strings.ToLower(fields[0]), true, nil
+}
+
+// remotePathKind 返回远程路径的类型：file、dir 或 missing
+func remotePathKind(client *ssh.Client, path string) (string, error) {
+	cmd := fmt.Sprintf(`f=%s; if [ -d "$f" ]; then echo dir; elif [ -f "$f" ]; then echo file; else echo missing; fi`, shellQuote(path))
+	out, err := runRemoteCommand(client, cmd)
+	if err != nil {
+		return "", fmt.Errorf("stat failed: %v: %s", err, strings.TrimSpace(out))
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// remoteDownload 将远程文件内容写入w；isDir为true时以 tar.gz 打包目录内容
+func remoteDownload(client *ssh.Client, path string, isDir bool, w io.Writer) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stdout = w
+	session.Stderr = &stderr
+
+	cmd := "cat " + shellQuote(path)
+	if isDir {
+		cmd = "tar -C " + shellQuote(path) + " -czf - ."
+	}
+	if err := session.Run(cmd); err != nil {
+		return fmt.Errorf("%v: %s", err, truncateOutput(strings.TrimSpace(stderr.String())))
+	}
+	return nil
+}
+
+// remoteReadFile 读取推送目标上的现有文件写入w，文件不存在时exists为false
+func remoteReadFile(client *ssh.Client, target, name string, w io.Writer) (exists bool, err error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return false, err
+	}
+	defer session.Close()
+
+	var stderr bytes.Buffer
+	session.Stdout = w
+	session.Stderr = &stderr
+
+	// 退出码3表示文件不存在
+	err = session.Run(remoteFileExpr(target, name) + `[ -f "$f" ] || exit 3; cat "$f"`)
+	if exitErr, ok := err.(*ssh.ExitError); ok && exitErr.ExitStatus() == 3 {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%v: %s", err, truncateOutput(strings.TrimSpace(stderr.String())))
+	}
+	return true, nil
+}
+
+// shellQuote 将参数包装为单引号字符串，避免路径中的特殊字符被远端shell解释
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// scpUpload 通过scp协议（sink模式）将src写入远程主机的target；
+// target是已存在的目录时写入 target/name
+func scpUpload(client *ssh.Client, src io.Reader, size int64, mode os.FileMode, target, name string) error {
+	session, err := client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	acks := bufio.NewReader(stdout)
+
+	if err := session.Start("scp -t " + shellQuote(target)); err != nil {
+		return err
+	}
+	if err := readSCPAck(acks); err != nil {
+		return err
+	}
+
+	// 文件头: C<权限> <大小> <文件名>
+	if _, err := fmt.Fprintf(stdin, "C%04o %d %s\n", mode.Perm(), size, name); err != nil {
+		return err
+	}
+	if err := readSCPAck(acks); err != nil {
+		return err
+	}
+
+	n, err := io.Copy(stdin, src)
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("short write: sent %d of %d bytes", n, size)
+	}
+	if _, err := stdin.Write([]byte{0}); err != nil {
+		return err
+	}
+	if err := readSCPAck(acks); err != nil {
+		return err
+	}
+
+	stdin.Close()
+	return session.Wait()
+}
+
+// readSCPAck 读取scp的应答字节，0表示成功，1/2后跟错误信息
+func readSCPAck(r *bufio.Reader) error {
+	code, err := r.ReadByte()
+	if err != nil {
+		return err
+	}
+	if code == 0 {
+		return nil
+	}
+	msg, _ := r.ReadString('\n')
+	return fmt.Errorf("scp: %s", strings.TrimSpace(msg))
+}
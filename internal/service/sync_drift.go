@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"middleware-platform/internal/model"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// 远程文件的漂移状态
+const (
+	DriftInSync  = "in_sync"
+	DriftDrifted = "drifted"
+	DriftMissing = "missing"
+	DriftError   = "error"
+)
+
+// classifyDrift 根据目标主机上的校验结果判断漂移状态
+func classifyDrift(expected, remote string, exists bool) (string, string) {
+	switch {
+	case !exists:
+		return DriftMissing, "target file no longer exists"
+	case remote != expected:
+		return DriftDrifted, fmt.Sprintf("target modified out-of-band: expected sha256 %s, found %s", expected, remote)
+	default:
+		return DriftInSync, ""
+	}
+}
+
+// StartDriftScanner 定期重新校验所有已完成同步任务的远程文件，interval<=0 时不启动
+func (s *HostService) StartDriftScanner(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.ScanDrift(ctx); err != nil {
+					log.Printf("Drift scan failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// ScanDrift 按主机分组校验已完成的同步任务，每台主机只建立一次SSH连接
+func (s *HostService) ScanDrift(ctx context.Context) error {
+	fileSyncs, err := s.repo.FindFileSyncsByStatus("completed")
+	if err != nil {
+		return err
+	}
+
+	byHost := make(map[uint][]model.FileSync)
+	for _, fs := range fileSyncs {
+		// 升级前同步的任务没有SHA-256基线，重新同步后才参与检测
+		if fs.SHA256 == "" {
+			continue
+		}
+		byHost[fs.HostID] = append(byHost[fs.HostID], fs)
+	}
+
+	for hostID, group := range byHost {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		s.checkHostDrift(ctx, hostID, group)
+	}
+	return nil
+}
+
+// VerifyFileSync 立即校验单个同步任务的远程文件
+func (s *HostService) VerifyFileSync(id uint) (*model.FileSync, error) {
+	fileSync, err := s.repo.FindFileSyncByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if fileSync.Status != "completed" {
+		return nil, fmt.Errorf("file sync %d is %s, only completed syncs can be verified", id, fileSync.Status)
+	}
+	if fileSync.SHA256 == "" {
+		return nil, fmt.Errorf("file sync %d has no sha256 baseline, run the sync again first", id)
+	}
+
+	group := []model.FileSync{*fileSync}
+	s.checkHostDrift(context.Background(), fileSync.HostID, group)
+	return &group[0], nil
+}
+
+// GetDriftedFileSyncs 返回远程文件漂移、丢失或无法校验的同步任务
+func (s *HostService) GetDriftedFileSyncs() ([]model.FileSync, error) {
+	return s.repo.FindFileSyncsByDriftStatus(DriftDrifted, DriftMissing, DriftError)
+}
+
+// checkHostDrift 校验同一主机上的一组同步任务并记录结果
+func (s *HostService) checkHostDrift(ctx context.Context, hostID uint, group []model.FileSync) {
+	host, err := s.repo.FindByID(hostID)
+	if err == nil {
+		client, dialErr := newSSHClient(host)
+		if dialErr == nil {
+			stop := closeOnCancel(ctx, client)
+			defer stop()
+			defer client.Close()
+
+			for i := range group {
+				if ctx.Err() != nil {
+					return
+				}
+				fs := &group[i]
+				remote, exists, err := remoteSHA256(client, fs.TargetPath, filepath.Base(fs.SourcePath))
+				if err != nil {
+					s.recordDrift(fs, DriftError, remote, err.Error())
+					continue
+				}
+				status, message := classifyDrift(fs.SHA256, remote, exists)
+				s.recordDrift(fs, status, remote, message)
+			}
+			return
+		}
+		err = fmt.Errorf("failed to connect to host: %v", dialErr)
+	}
+
+	for i := range group {
+		s.recordDrift(&group[i], DriftError, group[i].RemoteSHA256, err.Error())
+	}
+}
+
+// recordDrift 保存检测结果；新进入漂移或丢失状态时记录历史并触发告警
+func (s *HostService) recordDrift(fileSync *model.FileSync, status, remote, message string) {
+	previous := fileSync.DriftStatus
+	now := time.Now()
+	fileSync.DriftStatus = status
+	fileSync.RemoteSHA256 = remote
+	fileSync.DriftMessage = message
+	fileSync.DriftCheckedAt = &now
+
+	updated, err := s.repo.UpdateFileSyncDrift(fileSync)
+	if err != nil {
+		log.Printf("Failed to save drift status of file sync %d: %v", fileSync.ID, err)
+		return
+	}
+	// 检测期间任务被重新同步，结果已过期
+	if !updated || status == previous || (status != DriftDrifted && status != DriftMissing) {
+		return
+	}
+
+	if err := s.repo.CreateSyncHistory(&model.FileSyncHistory{
+		FileSyncID: fileSync.ID,
+		Status:     "drift",
+		Message:    message,
+		MD5:        fileSync.MD5,
+		SHA256:     remote,
+		FileSize:   fileSync.FileSize,
+		SyncType:   getSyncType(fileSync.IsIncremental),
+		Trigger:    "drift_scan",
+	}); err != nil {
+		log.Printf("Failed to record drift history: %v", err)
+	}
+
+	if s.alerter != nil {
+		alert := fmt.Sprintf("file sync %d (host %d:%s) %s: %s",
+			fileSync.ID, fileSync.HostID, fileSync.TargetPath, status, message)
+		if err := s.alerter.RaiseEvent(AlertEventFileSyncDrift, strconv.FormatUint(uint64(fileSync.ID), 10), alert); err != nil {
+			log.Printf("Failed to raise drift alert: %v", err)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseChecksumOutput(t *testing.T) {
+	sum, exists, err := parseChecksumOutput("ABC123  /etc/app.conf\n")
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, "abc123", sum)
+
+	sum, exists, err = parseChecksumOutput(remoteMissingMarker + "\n")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	assert.Empty(t, sum)
+
+	_, _, err = parseChecksumOutput("  \n")
+	assert.Error(t, err)
+}
+
+func TestClassifyDrift(t *testing.T) {
+	status, message := classifyDrift("abc", "abc", true)
+	assert.Equal(t, DriftInSync, status)
+	assert.Empty(t, message)
+
+	status, _ = classifyDrift("abc", "def", true)
+	assert.Equal(t, DriftDrifted, status)
+
+	status, _ = classifyDrift("abc", "", false)
+	assert.Equal(t, DriftMissing, status)
+}
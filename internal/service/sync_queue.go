@@ -0,0 +1,367 @@
+package service
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"log"
+	"sync"
+)
+
+var (
+	ErrSyncQueueFull = errors.New("sync queue is full")
+	ErrSyncNotActive = errors.New("file sync is not active")
+)
+
+const (
+	defaultSyncWorkers   = 4
+	defaultSyncQueueSize = 100
+)
+
+// SyncProgress 同步任务的实时进度，通过SSE推送给前端
+type SyncProgress struct {
+	FileSyncID uint    `json:"file_sync_id"`
+	Status     string  `json:"status"`
+	Progress   float64 `json:"progress"`
+	Speed      float64 `json:"speed"`
+	SyncedSize int64   `json:"synced_size"`
+	FileSize   int64   `json:"file_size"`
+	Message    string  `json:"message,omitempty"`
+}
+
+// IsFinalSyncStatus 判断同步状态是否为终态
+func IsFinalSyncStatus(status string) bool {
+	switch status {
+	case "completed", "failed", "cancelled":
+		return true
+	}
+	return false
+}
+
+// syncTask 排队中或执行中的同步任务的控制句柄
+type syncTask struct {
+	id      uint
+	trigger string
+	ctx     context.Context
+	cancel  context.CancelFunc
+
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{}
+}
+
+func newSyncTask(parent context.Context, id uint, trigger string) *syncTask {
+	ctx, cancel := context.WithCancel(parent)
+	return &syncTask{id: id, trigger: trigger, ctx: ctx, cancel: cancel}
+}
+
+func (t *syncTask) pause() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.paused {
+		t.paused = true
+		t.resumed = make(chan struct{})
+	}
+}
+
+func (t *syncTask) resume() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.paused {
+		t.paused = false
+		close(t.resumed)
+	}
+}
+
+func (t *syncTask) isPaused() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.paused
+}
+
+// waitIfPaused 暂停期间阻塞，直到恢复或任务被取消
+func (t *syncTask) waitIfPaused() error {
+	t.mu.Lock()
+	paused, resumed := t.paused, t.resumed
+	t.mu.Unlock()
+
+	if paused {
+		select {
+		case <-resumed:
+		case <-t.ctx.Done():
+		}
+	}
+	return t.ctx.Err()
+}
+
+// queuedSync 排队中的任务，优先级高的先执行，同优先级按入队顺序
+type queuedSync struct {
+	id       uint
+	priority int
+	seq      uint64
+}
+
+type syncHeap []queuedSync
+
+func (h syncHeap) Len() int { return len(h) }
+func (h syncHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+func (h syncHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *syncHeap) Push(x interface{}) { *h = append(*h, x.(queuedSync)) }
+func (h *syncHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// index 返回任务在队列中的位置，不在队列中时返回-1
+func (h syncHeap) index(id uint) int {
+	for i, item := range h {
+		if item.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// SyncQueue 有界的文件同步优先级队列，由固定数量的worker消费
+type SyncQueue struct {
+	// 每个排队任务对应一个信号，worker收到信号后取出当前优先级最高的任务
+	ready   chan struct{}
+	size    int
+	workers int
+	run     func(task *syncTask)
+
+	mu      sync.Mutex
+	ctx     context.Context
+	pending syncHeap
+	seq     uint64
+	tasks   map[uint]*syncTask
+	wg      sync.WaitGroup
+
+	progress *progressHub
+}
+
+func NewSyncQueue(workers, size int) *SyncQueue {
+	if workers <= 0 {
+		workers = defaultSyncWorkers
+	}
+	if size <= 0 {
+		size = defaultSyncQueueSize
+	}
+	return &SyncQueue{
+		ready:    make(chan struct{}, size),
+		size:     size,
+		workers:  workers,
+		ctx:      context.Background(),
+		tasks:    make(map[uint]*syncTask),
+		progress: newProgressHub(),
+	}
+}
+
+// Start 启动worker，ctx取消后worker退出且执行中的任务被中断
+func (q *SyncQueue) Start(ctx context.Context, run func(task *syncTask)) {
+	q.mu.Lock()
+	q.ctx = ctx
+	q.run = run
+	q.mu.Unlock()
+
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.worker(ctx)
+	}
+}
+
+// Wait 等待所有worker退出
+func (q *SyncQueue) Wait() {
+	q.wg.Wait()
+}
+
+func (q *SyncQueue) worker(ctx context.Context) {
+	defer q.wg.Done()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.ready:
+			if task := q.dequeue(); task != nil {
+				q.execute(task)
+			}
+		}
+	}
+}
+
+// dequeue 取出优先级最高的任务；排队期间被取消或暂停的任务直接丢弃，恢复时会重新入队
+func (q *SyncQueue) dequeue() *syncTask {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		return nil
+	}
+	id := heap.Pop(&q.pending).(queuedSync).id
+	task := q.tasks[id]
+	if task == nil {
+		return nil
+	}
+	if task.ctx.Err() != nil || task.isPaused() {
+		delete(q.tasks, id)
+		task.cancel()
+		return nil
+	}
+	return task
+}
+
+func (q *SyncQueue) execute(task *syncTask) {
+	defer q.remove(task.id, task)
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("File sync %d panicked: %v", task.id, r)
+		}
+	}()
+	q.run(task)
+}
+
+// Enqueue 按优先级将任务放入队列，队列已满时立即返回ErrSyncQueueFull。
+// 已取消的任务视为已结束：仍在排队的替换为新任务并沿用原有的队列位置和信号；
+// 执行中的重新入队，旧任务的worker返回时不会移除新任务
+func (q *SyncQueue) Enqueue(id uint, trigger string, priority int) error {
+	q.mu.Lock()
+	if existing, exists := q.tasks[id]; exists {
+		if existing.ctx.Err() == nil {
+			q.mu.Unlock()
+			return nil
+		}
+		if i := q.pending.index(id); i >= 0 {
+			q.tasks[id] = newSyncTask(q.ctx, id, trigger)
+			q.seq++
+			q.pending[i] = queuedSync{id: id, priority: priority, seq: q.seq}
+			heap.Fix(&q.pending, i)
+			q.mu.Unlock()
+			return nil
+		}
+	}
+	if len(q.pending) >= q.size {
+		q.mu.Unlock()
+		return ErrSyncQueueFull
+	}
+	q.tasks[id] = newSyncTask(q.ctx, id, trigger)
+	q.seq++
+	heap.Push(&q.pending, queuedSync{id: id, priority: priority, seq: q.seq})
+	q.mu.Unlock()
+
+	// 信号数不会超过排队任务数，不会阻塞
+	q.ready <- struct{}{}
+	return nil
+}
+
+// Depth 返回排队等待执行的任务数
+func (q *SyncQueue) Depth() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+func (q *SyncQueue) task(id uint) *syncTask {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.tasks[id]
+}
+
+func (q *SyncQueue) remove(id uint, task *syncTask) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.tasks[id] == task {
+		delete(q.tasks, id)
+	}
+	if task != nil {
+		task.cancel()
+	}
+}
+
+// Pause 暂停排队中或执行中的任务
+func (q *SyncQueue) Pause(id uint) error {
+	task := q.task(id)
+	if task == nil {
+		return ErrSyncNotActive
+	}
+	task.pause()
+	return nil
+}
+
+// Resume 恢复执行中的任务；任务不在队列中时返回ErrSyncNotActive，由调用方重新入队
+func (q *SyncQueue) Resume(id uint) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	task := q.tasks[id]
+	if task == nil || task.ctx.Err() != nil {
+		return ErrSyncNotActive
+	}
+	task.resume()
+	return nil
+}
+
+// Cancel 取消排队中或执行中的任务
+func (q *SyncQueue) Cancel(id uint) {
+	if task := q.task(id); task != nil {
+		task.cancel()
+	}
+}
+
+// progressHub 按任务ID分发同步进度给订阅者
+type progressHub struct {
+	mu   sync.Mutex
+	subs map[uint]map[chan SyncProgress]struct{}
+}
+
+func newProgressHub() *progressHub {
+	return &progressHub{subs: make(map[uint]map[chan SyncProgress]struct{})}
+}
+
+func (h *progressHub) subscribe(id uint) (<-chan SyncProgress, func()) {
+	ch := make(chan SyncProgress, 16)
+
+	h.mu.Lock()
+	if h.subs[id] == nil {
+		h.subs[id] = make(map[chan SyncProgress]struct{})
+	}
+	h.subs[id][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subs[id], ch)
+		if len(h.subs[id]) == 0 {
+			delete(h.subs, id)
+		}
+	}
+}
+
+// publish 非阻塞推送，慢订阅者会丢失中间进度，但不会影响传输；
+// 终态事件会挤掉最旧的一条，保证订阅者能够结束
+func (h *progressHub) publish(p SyncProgress) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[p.FileSyncID] {
+		select {
+		case ch <- p:
+			continue
+		default:
+		}
+		if IsFinalSyncStatus(p.Status) {
+			select {
+			case <-ch:
+			default:
+			}
+			select {
+			case ch <- p:
+			default:
+			}
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncQueue_RunsEnqueuedTasks(t *testing.T) {
+	queue := NewSyncQueue(2, 10)
+	done := make(chan uint, 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queue.Start(ctx, func(task *syncTask) {
+		done <- task.id
+	})
+
+	for id := uint(1); id <= 3; id++ {
+		assert.NoError(t, queue.Enqueue(id, SyncTriggerManual, 0))
+	}
+
+	seen := map[uint]bool{}
+	for i := 0; i < 3; i++ {
+		select {
+		case id := <-done:
+			seen[id] = true
+		case <-time.After(time.Second):
+			t.Fatal("task was not executed")
+		}
+	}
+	assert.Len(t, seen, 3)
+}
+
+func TestSyncQueue_Full(t *testing.T) {
+	queue := NewSyncQueue(1, 1)
+
+	assert.NoError(t, queue.Enqueue(1, SyncTriggerManual, 0))
+	assert.Equal(t, ErrSyncQueueFull, queue.Enqueue(2, SyncTriggerManual, 0))
+	assert.Equal(t, 1, queue.Depth())
+}
+
+func TestSyncQueue_PauseResumeCancel(t *testing.T) {
+	queue := NewSyncQueue(1, 10)
+	started := make(chan struct{})
+	proceed := make(chan struct{})
+	finished := make(chan error, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queue.Start(ctx, func(task *syncTask) {
+		close(started)
+		<-proceed
+		finished <- task.waitIfPaused()
+	})
+
+	assert.NoError(t, queue.Enqueue(1, SyncTriggerManual, 0))
+	<-started
+
+	// 执行中的任务：暂停后阻塞，直到被取消
+	assert.NoError(t, queue.Pause(1))
+	assert.NoError(t, queue.Resume(1))
+	assert.NoError(t, queue.Pause(1))
+	close(proceed)
+
+	select {
+	case <-finished:
+		t.Fatal("paused task should block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	queue.Cancel(1)
+	select {
+	case err := <-finished:
+		assert.Error(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("cancelled task did not finish")
+	}
+}
+
+func TestSyncQueue_PausedWhileQueuedIsDropped(t *testing.T) {
+	queue := NewSyncQueue(1, 10)
+	assert.NoError(t, queue.Enqueue(1, SyncTriggerManual, 0))
+	assert.NoError(t, queue.Pause(1))
+
+	<-queue.ready
+	assert.Nil(t, queue.dequeue())
+	assert.Equal(t, ErrSyncNotActive, queue.Resume(1))
+}
+
+func TestSyncQueue_ResubmitAfterCancelWhileQueued(t *testing.T) {
+	queue := NewSyncQueue(1, 10)
+	started := make(chan uint, 2)
+	release := make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queue.Start(ctx, func(task *syncTask) {
+		started <- task.id
+		if task.id == 1 {
+			<-release
+		}
+	})
+
+	// 唯一的worker忙于任务1，任务2在排队期间被取消后重新提交
+	assert.NoError(t, queue.Enqueue(1, SyncTriggerManual, 0))
+	assert.Equal(t, uint(1), <-started)
+	assert.NoError(t, queue.Enqueue(2, SyncTriggerManual, 0))
+	queue.Cancel(2)
+	assert.NoError(t, queue.Enqueue(2, SyncTriggerCron, 0))
+	assert.Equal(t, 1, queue.Depth())
+	close(release)
+
+	select {
+	case id := <-started:
+		assert.Equal(t, uint(2), id)
+	case <-time.After(time.Second):
+		t.Fatal("resubmitted task was not executed")
+	}
+}
+
+func TestSyncQueue_ResubmitAfterCancelWhileRunning(t *testing.T) {
+	queue := NewSyncQueue(2, 10)
+	started := make(chan *syncTask, 2)
+	finished := make(chan *syncTask, 2)
+	release := make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queue.Start(ctx, func(task *syncTask) {
+		started <- task
+		// 第一次执行在取消后仍未返回，重新提交的执行直到被取消
+		if task.trigger == SyncTriggerManual {
+			<-release
+		} else {
+			<-task.ctx.Done()
+		}
+		finished <- task
+	})
+
+	assert.NoError(t, queue.Enqueue(1, SyncTriggerManual, 0))
+	first := <-started
+	queue.Cancel(1)
+	assert.NoError(t, queue.Enqueue(1, SyncTriggerCron, 0))
+
+	var second *syncTask
+	select {
+	case second = <-started:
+	case <-time.After(time.Second):
+		t.Fatal("resubmitted task was not executed")
+	}
+	assert.NotSame(t, first, second)
+	assert.NoError(t, second.ctx.Err())
+
+	// 旧任务的worker返回时不移除新任务
+	close(release)
+	assert.Same(t, first, <-finished)
+	assert.Same(t, second, queue.task(1))
+
+	queue.Cancel(1)
+	assert.Same(t, second, <-finished)
+	assert.Eventually(t, func() bool { return queue.task(1) == nil }, time.Second, time.Millisecond)
+}
+
+func TestSyncQueue_PriorityOrder(t *testing.T) {
+	queue := NewSyncQueue(1, 10)
+	assert.NoError(t, queue.Enqueue(1, SyncTriggerManual, 0))
+	assert.NoError(t, queue.Enqueue(2, SyncTriggerManual, 10))
+	assert.NoError(t, queue.Enqueue(3, SyncTriggerManual, 0))
+	assert.NoError(t, queue.Enqueue(4, SyncTriggerManual, 5))
+
+	var order []uint
+	for queue.Depth() > 0 {
+		<-queue.ready
+		order = append(order, queue.dequeue().id)
+	}
+	assert.Equal(t, []uint{2, 4, 1, 3}, order)
+}
+
+func TestProgressHub_FinalEventIsDelivered(t *testing.T) {
+	hub := newProgressHub()
+	ch, unsubscribe := hub.subscribe(1)
+	defer unsubscribe()
+
+	for i := 0; i < 20; i++ {
+		hub.publish(SyncProgress{FileSyncID: 1, Status: "syncing", Progress: float64(i)})
+	}
+	hub.publish(SyncProgress{FileSyncID: 1, Status: "completed", Progress: 100})
+
+	var last SyncProgress
+	for len(ch) > 0 {
+		last = <-ch
+	}
+	assert.Equal(t, "completed", last.Status)
+}
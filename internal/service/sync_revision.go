@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"middleware-platform/internal/model"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRevisionDir       = "data/revisions"
+	defaultRevisionRetention = 10
+)
+
+// SetRevisionStorage 设置推送版本在平台上的存储目录和每个同步任务保留的版本数
+func (s *HostService) SetRevisionStorage(dir string, retention int) {
+	if dir != "" {
+		s.revisionDir = dir
+	}
+	if retention > 0 {
+		s.revisionRetention = retention
+	}
+}
+
+// GetSyncRevisions 获取内容仍保存在平台上、可以回滚的版本
+func (s *HostService) GetSyncRevisions(fileSyncID uint) ([]model.FileSyncHistory, error) {
+	return s.repo.FindSyncRevisions(fileSyncID)
+}
+
+// RollbackSync 将目标主机上的文件恢复为指定版本，回滚与普通同步一样经过队列执行
+func (s *HostService) RollbackSync(fileSyncID uint, revision int) error {
+	fileSync, err := s.repo.FindFileSyncByID(fileSyncID)
+	if err != nil {
+		return err
+	}
+	if !IsFinalSyncStatus(fileSync.Status) {
+		return ErrSyncBusy
+	}
+	rev, err := s.repo.FindSyncRevision(fileSyncID, revision)
+	if err != nil {
+		return fmt.Errorf("revision %d of file sync %d is not available", revision, fileSyncID)
+	}
+	if _, err := os.Stat(rev.StoragePath); err != nil {
+		return fmt.Errorf("revision %d content is missing: %v", revision, err)
+	}
+
+	fileSync.RollbackRevision = revision
+	fileSync.Status = "pending"
+	fileSync.Progress = 0
+	fileSync.Speed = 0
+	fileSync.SyncedSize = 0
+	fileSync.IsPaused = false
+	if err := s.repo.UpdateFileSync(fileSync); err != nil {
+		return err
+	}
+
+	if err := s.queue.Enqueue(fileSyncID, SyncTriggerRollback, fileSync.Priority); err != nil {
+		fileSync.RollbackRevision = 0
+		fileSync.LastTrigger = SyncTriggerRollback
+		s.failSync(fileSync, fileChecksums{MD5: fileSync.MD5, SHA256: fileSync.SHA256}, fileSync.FileSize, err)
+		return err
+	}
+	return nil
+}
+
+// rollbackSync 推送平台上保存的版本内容，成功后目标主机的版本号变为该版本
+func (s *HostService) rollbackSync(ctx context.Context, fileSync *model.FileSync) error {
+	revision := fileSync.RollbackRevision
+	rev, err := s.repo.FindSyncRevision(fileSync.ID, revision)
+	if err != nil {
+		fileSync.RollbackRevision = 0
+		return s.failSync(fileSync, fileChecksums{}, 0, fmt.Errorf("revision %d is not available: %v", revision, err))
+	}
+	sums := fileChecksums{MD5: rev.MD5, SHA256: rev.SHA256}
+
+	if err := s.doSync(ctx, fileSync, rev.StoragePath, rev.FileSize, rev.SHA256); err != nil {
+		// 服务停止时保留回滚目标，重启后继续回滚
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		fileSync.RollbackRevision = 0
+		return s.failSync(fileSync, sums, rev.FileSize, fmt.Errorf("rollback to revision %d failed: %v", revision, err))
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	fileSync.RollbackRevision = 0
+	fileSync.Revision = revision
+	s.markInSync(fileSync)
+	return s.completeSync(fileSync, sums, fileSync.ModifiedTime, rev.FileSize, "rollback",
+		fmt.Sprintf("rolled back to revision %d, remote sha256 verified", revision), "")
+}
+
+// markInSync 推送并校验成功后目标文件与基线一致
+func (s *HostService) markInSync(fileSync *model.FileSync) {
+	now := time.Now()
+	fileSync.DriftStatus = DriftInSync
+	fileSync.DriftMessage = ""
+	fileSync.DriftCheckedAt = &now
+}
+
+// revisionPath 版本内容的存储路径：<revisionDir>/<同步任务ID>/r<版本号>-<文件名>
+func (s *HostService) revisionPath(fileSync *model.FileSync, revision int) string {
+	return filepath.Join(s.revisionDir, strconv.FormatUint(uint64(fileSync.ID), 10),
+		fmt.Sprintf("r%d-%s", revision, filepath.Base(fileSync.SourcePath)))
+}
+
+// snapshotSource 将源文件复制到版本存储，之后推送的是快照内容，保证保存的版本与推送内容一致
+func (s *HostService) snapshotSource(fileSync *model.FileSync, revision int) (string, fileChecksums, int64, error) {
+	src, err := os.Open(fileSync.SourcePath)
+	if err != nil {
+		return "", fileChecksums{}, 0, err
+	}
+	defer src.Close()
+
+	path := s.revisionPath(fileSync, revision)
+	sums, size, err := writeRevision(path, func(w io.Writer) error {
+		_, err := io.Copy(w, src)
+		return err
+	})
+	return path, sums, size, err
+}
+
+// ensureBaseline 首次同步前备份目标主机上的原有文件，作为可以回滚的第一个版本；
+// 目标不存在时只记录一条备份历史，之后不再尝试，避免把失败推送留下的残缺文件当作原始内容
+func (s *HostService) ensureBaseline(ctx context.Context, fileSync *model.FileSync) error {
+	count, err := s.repo.CountSyncRevisions(fileSync.ID)
+	if err != nil || count > 0 {
+		return err
+	}
+
+	host, err := s.repo.FindByID(fileSync.HostID)
+	if err != nil {
+		return err
+	}
+	client, err := newSSHClient(host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	defer closeOnCancel(ctx, client)()
+
+	revision, err := s.repo.FindMaxSyncRevision(fileSync.ID)
+	if err != nil {
+		return err
+	}
+	revision++
+
+	history := &model.FileSyncHistory{
+		FileSyncID: fileSync.ID,
+		Status:     "backup",
+		SyncType:   getSyncType(fileSync.IsIncremental),
+		Trigger:    fileSync.LastTrigger,
+	}
+
+	path := s.revisionPath(fileSync, revision)
+	exists := false
+	sums, size, err := writeRevision(path, func(w io.Writer) error {
+		var err error
+		exists, err = remoteReadFile(client, fileSync.TargetPath, filepath.Base(fileSync.SourcePath), w)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to back up target before first sync: %v", err)
+	}
+
+	if exists {
+		history.Message = "original target content before first sync"
+		history.Revision = revision
+		history.StoragePath = path
+		history.MD5 = sums.MD5
+		history.SHA256 = sums.SHA256
+		history.FileSize = size
+	} else {
+		os.Remove(path)
+		history.Message = "target did not exist before first sync"
+	}
+	return s.repo.CreateSyncHistory(history)
+}
+
+// writeRevision 通过临时文件写入版本内容并计算校验和，成功后原子地重命名到path
+func writeRevision(path string, write func(w io.Writer) error) (fileChecksums, int64, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fileChecksums{}, 0, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".revision-*")
+	if err != nil {
+		return fileChecksums{}, 0, err
+	}
+	defer os.Remove(tmp.Name())
+
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+	counter := &countingWriter{}
+	err = write(io.MultiWriter(tmp, md5Hash, sha256Hash, counter))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fileChecksums{}, 0, err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fileChecksums{}, 0, err
+	}
+
+	return fileChecksums{
+		MD5:    hex.EncodeToString(md5Hash.Sum(nil)),
+		SHA256: hex.EncodeToString(sha256Hash.Sum(nil)),
+	}, counter.n, nil
+}
+
+// pruneRevisions 清理超出保留数量的旧版本内容，目标主机上当前的版本始终保留
+func (s *HostService) pruneRevisions(fileSync *model.FileSync) {
+	revisions, err := s.repo.FindSyncRevisions(fileSync.ID)
+	if err != nil {
+		log.Printf("Failed to load revisions of file sync %d: %v", fileSync.ID, err)
+		return
+	}
+
+	kept := 0
+	for _, rev := range revisions {
+		if kept < s.revisionRetention || rev.Revision == fileSync.Revision {
+			kept++
+			continue
+		}
+		if err := os.Remove(rev.StoragePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove revision %s: %v", rev.StoragePath, err)
+			continue
+		}
+		if err := s.repo.ClearSyncRevisionStorage(rev.ID); err != nil {
+			log.Printf("Failed to update revision %d of file sync %d: %v", rev.Revision, fileSync.ID, err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"io"
+	"middleware-platform/internal/model"
+	"middleware-platform/internal/repository"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestSnapshotSource(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "nginx.conf")
+	assert.NoError(t, os.WriteFile(source, []byte("worker_processes 4;\n"), 0644))
+
+	s := &HostService{revisionDir: filepath.Join(dir, "revisions")}
+	fileSync := &model.FileSync{SourcePath: source}
+	fileSync.ID = 7
+
+	path, sums, size, err := s.snapshotSource(fileSync, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "revisions", "7", "r3-nginx.conf"), path)
+	assert.Equal(t, int64(20), size)
+
+	expected, err := calculateFileChecksums(source)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, sums)
+
+	// 之后修改源文件不影响已保存的版本
+	assert.NoError(t, os.WriteFile(source, []byte("worker_processes 8;\n"), 0644))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "worker_processes 4;\n", string(data))
+}
+
+func TestWriteRevision_FailureLeavesNoFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "r1-app.conf")
+	_, _, err := writeRevision(path, func(w io.Writer) error {
+		_, err := io.Copy(w, strings.NewReader("partial"))
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	})
+	assert.Error(t, err)
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRollbackSync_AfterCancelWhileRunning(t *testing.T) {
+	mockDB, mock, err := sqlmock.New()
+	if !assert.NoError(t, err) {
+		return
+	}
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: mockDB, DriverName: "postgres"}), &gorm.Config{})
+	if !assert.NoError(t, err) {
+		return
+	}
+	s := &HostService{repo: repository.NewHostRepository(db), queue: NewSyncQueue(1, 10)}
+
+	// 执行中的同步被取消，worker尚未返回
+	running := newSyncTask(context.Background(), 1, SyncTriggerManual)
+	s.queue.tasks[1] = running
+	running.cancel()
+
+	content := filepath.Join(t.TempDir(), "r2-nginx.conf")
+	assert.NoError(t, os.WriteFile(content, []byte("worker_processes 2;\n"), 0644))
+	mock.ExpectQuery(`SELECT \* FROM "file_syncs"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "host_id", "status", "revision", "priority"}).AddRow(1, 1, "cancelled", 3, 5))
+	mock.ExpectQuery(`SELECT \* FROM "file_sync_histories"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "file_sync_id", "status", "revision", "storage_path"}).AddRow(7, 1, "success", 2, content))
+	mock.ExpectBegin()
+	mock.ExpectExec(`UPDATE "file_syncs"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, s.RollbackSync(1, 2))
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	// 回滚重新入队，而不是被仍在结束中的旧任务吞掉
+	assert.Equal(t, 1, s.queue.Depth())
+	task := s.queue.task(1)
+	if assert.NotNil(t, task) {
+		assert.NotSame(t, running, task)
+		assert.NoError(t, task.ctx.Err())
+		assert.Equal(t, SyncTriggerRollback, task.trigger)
+	}
+}
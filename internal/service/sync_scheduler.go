@@ -0,0 +1,232 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"middleware-platform/internal/model"
+	"os"
+	"sync"
+	"time"
+)
+
+// 同步任务的触发方式
+const (
+	SyncTriggerManual = "manual"
+	SyncTriggerCron   = "cron"
+	SyncTriggerWatch  = "watch"
+	// 回滚到历史版本，不作为任务的触发配置
+	SyncTriggerRollback = "rollback"
+)
+
+const (
+	defaultWatchInterval = 2 * time.Second
+	defaultSyncDebounce  = 5 * time.Second
+	scheduleReload       = time.Minute
+)
+
+var ErrSyncBusy = errors.New("file sync is already running")
+
+// validateSyncTrigger 校验并规范化同步任务的触发配置
+func validateSyncTrigger(fileSync *model.FileSync) error {
+	switch fileSync.TriggerMode {
+	case "", SyncTriggerManual:
+		fileSync.TriggerMode = SyncTriggerManual
+	case SyncTriggerCron:
+		if _, err := parseCron(fileSync.Schedule); err != nil {
+			return err
+		}
+	case SyncTriggerWatch:
+	default:
+		return fmt.Errorf("unknown trigger mode %q", fileSync.TriggerMode)
+	}
+	if fileSync.DebounceSeconds < 0 {
+		return fmt.Errorf("debounce_seconds must not be negative")
+	}
+	return nil
+}
+
+// syncSchedule 单个定时/监听任务的调度状态
+type syncSchedule struct {
+	fileSyncID uint
+	mode       string
+	spec       string
+	sourcePath string
+
+	cron *cronSchedule
+	next time.Time
+
+	// watch模式：上次观察到的文件状态，以及防抖到期时间（零值表示没有待触发的变化）
+	debounce time.Duration
+	modTime  time.Time
+	size     int64
+	exists   bool
+	fireAt   time.Time
+}
+
+// syncScheduler 按cron表达式或源文件变化触发同步任务。
+// 源文件变化通过定期stat轮询检测：vendor中没有fsnotify的源码，轮询也能覆盖
+// 编辑器先写临时文件再rename的保存方式。
+type syncScheduler struct {
+	list     func() ([]model.FileSync, error)
+	trigger  func(fileSyncID uint, trigger string) error
+	interval time.Duration
+
+	mu      sync.Mutex
+	entries map[uint]*syncSchedule
+	reload  chan struct{}
+}
+
+func newSyncScheduler(list func() ([]model.FileSync, error), trigger func(uint, string) error, interval time.Duration) *syncScheduler {
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	return &syncScheduler{
+		list:     list,
+		trigger:  trigger,
+		interval: interval,
+		entries:  make(map[uint]*syncSchedule),
+		reload:   make(chan struct{}, 1),
+	}
+}
+
+// Reload 通知调度器重新加载任务定义
+func (sc *syncScheduler) Reload() {
+	select {
+	case sc.reload <- struct{}{}:
+	default:
+	}
+}
+
+func (sc *syncScheduler) run(ctx context.Context) {
+	sc.load(time.Now())
+
+	tick := time.NewTicker(sc.interval)
+	defer tick.Stop()
+	refresh := time.NewTicker(scheduleReload)
+	defer refresh.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sc.reload:
+			sc.load(time.Now())
+		case <-refresh.C:
+			sc.load(time.Now())
+		case now := <-tick.C:
+			sc.check(now)
+		}
+	}
+}
+
+// load 从数据库加载定时/监听任务，定义未变化的任务保留原有调度状态
+func (sc *syncScheduler) load(now time.Time) {
+	fileSyncs, err := sc.list()
+	if err != nil {
+		log.Printf("Failed to load scheduled file syncs: %v", err)
+		return
+	}
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	entries := make(map[uint]*syncSchedule, len(fileSyncs))
+	for _, fs := range fileSyncs {
+		old := sc.entries[fs.ID]
+		if old != nil && old.mode == fs.TriggerMode && old.spec == fs.Schedule && old.sourcePath == fs.SourcePath {
+			old.debounce = syncDebounce(fs.DebounceSeconds)
+			entries[fs.ID] = old
+			continue
+		}
+
+		entry := &syncSchedule{
+			fileSyncID: fs.ID,
+			mode:       fs.TriggerMode,
+			spec:       fs.Schedule,
+			sourcePath: fs.SourcePath,
+			debounce:   syncDebounce(fs.DebounceSeconds),
+		}
+		switch fs.TriggerMode {
+		case SyncTriggerCron:
+			schedule, err := parseCron(fs.Schedule)
+			if err != nil {
+				log.Printf("File sync %d has invalid schedule: %v", fs.ID, err)
+				continue
+			}
+			entry.cron = schedule
+			entry.next = schedule.Next(now)
+		case SyncTriggerWatch:
+			// 以当前文件状态为基线，只有之后的修改才会触发
+			entry.observe(now)
+			entry.fireAt = time.Time{}
+		default:
+			continue
+		}
+		entries[fs.ID] = entry
+	}
+	sc.entries = entries
+}
+
+func (sc *syncScheduler) check(now time.Time) {
+	sc.mu.Lock()
+	var due []*syncSchedule
+	for _, entry := range sc.entries {
+		switch entry.mode {
+		case SyncTriggerCron:
+			if !entry.next.IsZero() && !now.Before(entry.next) {
+				entry.next = entry.cron.Next(now)
+				due = append(due, entry)
+			}
+		case SyncTriggerWatch:
+			entry.observe(now)
+			if !entry.fireAt.IsZero() && !now.Before(entry.fireAt) {
+				entry.fireAt = time.Time{}
+				due = append(due, entry)
+			}
+		}
+	}
+	sc.mu.Unlock()
+
+	for _, entry := range due {
+		err := sc.trigger(entry.fileSyncID, entry.mode)
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, ErrSyncBusy) && entry.mode == SyncTriggerWatch {
+			// 上一次同步还没结束，等它结束后再推送最新内容
+			sc.mu.Lock()
+			entry.fireAt = now.Add(entry.debounce)
+			sc.mu.Unlock()
+			continue
+		}
+		log.Printf("Failed to trigger file sync %d (%s): %v", entry.fileSyncID, entry.mode, err)
+	}
+}
+
+// observe 检查源文件是否变化，变化时（重新）开始防抖计时
+func (e *syncSchedule) observe(now time.Time) {
+	info, err := os.Stat(e.sourcePath)
+	exists := err == nil
+	var modTime time.Time
+	var size int64
+	if exists {
+		modTime, size = info.ModTime(), info.Size()
+	}
+
+	if exists != e.exists || !modTime.Equal(e.modTime) || size != e.size {
+		e.exists, e.modTime, e.size = exists, modTime, size
+		// 文件被删除（或rename过程中短暂不存在）时不触发
+		if exists {
+			e.fireAt = now.Add(e.debounce)
+		}
+	}
+}
+
+func syncDebounce(seconds int) time.Duration {
+	if seconds <= 0 {
+		return defaultSyncDebounce
+	}
+	return time.Duration(seconds) * time.Second
+}
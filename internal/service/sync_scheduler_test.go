@@ -0,0 +1,88 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"middleware-platform/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncScheduler_CronTrigger(t *testing.T) {
+	var triggered []string
+	scheduler := newSyncScheduler(func() ([]model.FileSync, error) {
+		return []model.FileSync{{TriggerMode: SyncTriggerCron, Schedule: "*/5 * * * *"}}, nil
+	}, func(id uint, trigger string) error {
+		triggered = append(triggered, trigger)
+		return nil
+	}, time.Second)
+
+	now := time.Date(2024, 3, 15, 10, 1, 0, 0, time.UTC)
+	scheduler.load(now)
+
+	scheduler.check(now.Add(3 * time.Minute))
+	assert.Empty(t, triggered)
+
+	scheduler.check(now.Add(4 * time.Minute))
+	assert.Equal(t, []string{SyncTriggerCron}, triggered)
+
+	// 同一个触发点只执行一次
+	scheduler.check(now.Add(4*time.Minute + time.Second))
+	assert.Len(t, triggered, 1)
+}
+
+func TestSyncScheduler_WatchDebounce(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "redis.conf")
+	assert.NoError(t, os.WriteFile(source, []byte("maxmemory 1gb\n"), 0644))
+
+	var triggered []uint
+	busy := false
+	fs := model.FileSync{SourcePath: source, TriggerMode: SyncTriggerWatch, DebounceSeconds: 5}
+	fs.ID = 7
+	scheduler := newSyncScheduler(func() ([]model.FileSync, error) {
+		return []model.FileSync{fs}, nil
+	}, func(id uint, trigger string) error {
+		if busy {
+			return ErrSyncBusy
+		}
+		triggered = append(triggered, id)
+		return nil
+	}, time.Second)
+
+	now := time.Now()
+	scheduler.load(now)
+
+	// 未修改时不触发
+	scheduler.check(now.Add(10 * time.Second))
+	assert.Empty(t, triggered)
+
+	// 修改后在防抖时间内不触发，再次修改重新计时
+	assert.NoError(t, os.WriteFile(source, []byte("maxmemory 2gb\n"), 0644))
+	scheduler.check(now.Add(11 * time.Second))
+	assert.NoError(t, os.WriteFile(source, []byte("maxmemory 16gb\n"), 0644))
+	scheduler.check(now.Add(14 * time.Second))
+	scheduler.check(now.Add(18 * time.Second))
+	assert.Empty(t, triggered)
+
+	// 上一次同步未结束时推迟触发
+	busy = true
+	scheduler.check(now.Add(19 * time.Second))
+	assert.Empty(t, triggered)
+
+	busy = false
+	scheduler.check(now.Add(24 * time.Second))
+	assert.Equal(t, []uint{7}, triggered)
+}
+
+func TestValidateSyncTrigger(t *testing.T) {
+	fs := &model.FileSync{}
+	assert.NoError(t, validateSyncTrigger(fs))
+	assert.Equal(t, SyncTriggerManual, fs.TriggerMode)
+
+	assert.Error(t, validateSyncTrigger(&model.FileSync{TriggerMode: SyncTriggerCron, Schedule: "bad"}))
+	assert.Error(t, validateSyncTrigger(&model.FileSync{TriggerMode: "hourly"}))
+	assert.Error(t, validateSyncTrigger(&model.FileSync{TriggerMode: SyncTriggerWatch, DebounceSeconds: -1}))
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TransferPolicy 文件传输的全局限制，对同步任务和滚动分发都生效
+type TransferPolicy struct {
+	// 所有传输共享的带宽上限（KB/s），0 表示不限制
+	BandwidthLimit int
+	// 不小于该大小（字节）的文件只在传输窗口内开始传输，0 表示不限制
+	LargeFileSize int64
+	// 大文件的传输窗口，如 "01:00-05:00"
+	Window string
+}
+
+// SetTransferPolicy 设置全局带宽上限和大文件传输窗口
+func (s *HostService) SetTransferPolicy(policy TransferPolicy) error {
+	if policy.BandwidthLimit < 0 {
+		return fmt.Errorf("bandwidth limit must not be negative")
+	}
+	var window *transferWindow
+	if policy.Window != "" {
+		w, err := parseTransferWindow(policy.Window)
+		if err != nil {
+			return err
+		}
+		window = w
+	}
+	s.bandwidth = newTokenBucket(int64(policy.BandwidthLimit) * 1024)
+	s.largeFileSize = policy.LargeFileSize
+	s.largeFileWindow = window
+	return nil
+}
+
+// validateTransferSettings 校验任务级别的带宽上限和传输窗口
+func validateTransferSettings(bandwidthLimit int, window string) error {
+	if bandwidthLimit < 0 {
+		return fmt.Errorf("bandwidth_limit must not be negative")
+	}
+	if window != "" {
+		if _, err := parseTransferWindow(window); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transferWindowFor 返回本次传输需要遵守的窗口：任务自己配置的窗口优先，
+// 否则大文件使用全局窗口；不受限制时返回nil
+func (s *HostService) transferWindowFor(window string, size int64) *transferWindow {
+	if window != "" {
+		w, err := parseTransferWindow(window)
+		if err == nil {
+			return w
+		}
+	}
+	if s.largeFileWindow != nil && s.largeFileSize > 0 && size >= s.largeFileSize {
+		return s.largeFileWindow
+	}
+	return nil
+}
+
+// throttle 按全局带宽上限和任务自己的令牌桶限制读取速度
+func (s *HostService) throttle(ctx context.Context, r io.Reader, jobBucket *tokenBucket) io.Reader {
+	var buckets []*tokenBucket
+	if s.bandwidth != nil {
+		buckets = append(buckets, s.bandwidth)
+	}
+	if jobBucket != nil {
+		buckets = append(buckets, jobBucket)
+	}
+	if len(buckets) == 0 {
+		return r
+	}
+	return &throttledReader{Reader: r, ctx: ctx, buckets: buckets}
+}
+
+// transferWindow 每天允许开始传输的时间段，按分钟计，end小于start时跨越午夜
+type transferWindow struct {
+	spec  string
+	start int
+	end   int
+}
+
+func parseTransferWindow(spec string) (*transferWindow, error) {
+	parts := strings.Split(strings.TrimSpace(spec), "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid transfer window %q, expected HH:MM-HH:MM", spec)
+	}
+	start, err := parseClock(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid transfer window %q: %v", spec, err)
+	}
+	end, err := parseClock(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid transfer window %q: %v", spec, err)
+	}
+	if start == end {
+		return nil, fmt.Errorf("invalid transfer window %q: start equals end", spec)
+	}
+	return &transferWindow{spec: strings.TrimSpace(spec), start: start, end: end}, nil
+}
+
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, err
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// contains 判断t（本地时间）是否在窗口内
+func (w *transferWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// nextOpen 返回t之后窗口下一次打开的时间
+func (w *transferWindow) nextOpen(t time.Time) time.Time {
+	open := time.Date(t.Year(), t.Month(), t.Day(), w.start/60, w.start%60, 0, 0, t.Location())
+	if !open.After(t) {
+		open = open.AddDate(0, 0, 1)
+	}
+	return open
+}
+
+func (w *transferWindow) String() string {
+	return w.spec
+}
+
+// tokenBucket 令牌桶限速，令牌单位为字节，可在多个传输之间共享
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// newTokenBucket bytesPerSecond<=0 时返回nil，表示不限速
+func newTokenBucket(bytesPerSecond int64) *tokenBucket {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	rate := float64(bytesPerSecond)
+	return &tokenBucket{rate: rate, burst: rate, tokens: rate, last: time.Now()}
+}
+
+// reserve 取走n个令牌并返回需要等待的时间；令牌不足时记为欠账，由后续调用者一并偿还
+func (b *tokenBucket) reserve(n int, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// wait 等待直到可以发送n字节，ctx取消时返回错误
+func (b *tokenBucket) wait(ctx context.Context, n int) error {
+	delay := b.reserve(n, time.Now())
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledReader 读取后按令牌桶限速
+type throttledReader struct {
+	io.Reader
+	ctx     context.Context
+	buckets []*tokenBucket
+}
+
+// maxThrottledRead 单次读取上限，避免低带宽时一次读取欠账过多导致长时间停顿
+const maxThrottledRead = 32 * 1024
+
+func (r *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > maxThrottledRead {
+		p = p[:maxThrottledRead]
+	}
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		for _, bucket := range r.buckets {
+			if werr := bucket.wait(r.ctx, n); werr != nil {
+				return n, werr
+			}
+		}
+	}
+	return n, err
+}
+
+// throttleWriter 拉取文件时按全局带宽上限限制写入速度
+func (s *HostService) throttleWriter(ctx context.Context, w io.Writer) io.Writer {
+	if s.bandwidth == nil {
+		return w
+	}
+	return &throttledWriter{Writer: w, ctx: ctx, bucket: s.bandwidth}
+}
+
+// throttledWriter 写入后按令牌桶限速
+type throttledWriter struct {
+	io.Writer
+	ctx    context.Context
+	bucket *tokenBucket
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	if n > 0 {
+		if werr := w.bucket.wait(w.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
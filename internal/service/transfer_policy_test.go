@@ -0,0 +1,76 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 3, 10, hour, minute, 0, 0, time.Local)
+	}
+
+	window, err := parseTransferWindow("01:00-05:00")
+	assert.NoError(t, err)
+	assert.True(t, window.contains(at(1, 0)))
+	assert.True(t, window.contains(at(4, 59)))
+	assert.False(t, window.contains(at(5, 0)))
+	assert.False(t, window.contains(at(14, 0)))
+	assert.Equal(t, at(1, 0).AddDate(0, 0, 1), window.nextOpen(at(14, 0)))
+	assert.Equal(t, at(1, 0), window.nextOpen(at(0, 30)))
+
+	// 跨越午夜
+	overnight, err := parseTransferWindow("22:00-02:00")
+	assert.NoError(t, err)
+	assert.True(t, overnight.contains(at(23, 0)))
+	assert.True(t, overnight.contains(at(1, 0)))
+	assert.False(t, overnight.contains(at(12, 0)))
+
+	for _, spec := range []string{"", "01:00", "1-5", "25:00-02:00", "03:00-03:00"} {
+		_, err := parseTransferWindow(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestTransferWindowFor(t *testing.T) {
+	s := &HostService{}
+	assert.NoError(t, s.SetTransferPolicy(TransferPolicy{LargeFileSize: 100, Window: "01:00-05:00"}))
+
+	assert.Nil(t, s.transferWindowFor("", 99))
+	assert.Equal(t, "01:00-05:00", s.transferWindowFor("", 100).String())
+	// 任务自己的窗口优先，且不受文件大小限制
+	assert.Equal(t, "20:00-23:00", s.transferWindowFor("20:00-23:00", 1).String())
+}
+
+func TestTokenBucket_Reserve(t *testing.T) {
+	bucket := newTokenBucket(1000)
+	now := bucket.last
+
+	// 初始令牌为一秒的量
+	assert.Equal(t, time.Duration(0), bucket.reserve(1000, now))
+	assert.Equal(t, 500*time.Millisecond, bucket.reserve(500, now))
+	// 欠账由后续调用者累计等待
+	assert.Equal(t, time.Second, bucket.reserve(500, now))
+	// 时间流逝补充令牌，但不超过桶容量
+	assert.Equal(t, time.Duration(0), bucket.reserve(1000, now.Add(3*time.Second)))
+
+	assert.Nil(t, newTokenBucket(0))
+}
+
+func TestThrottledReader_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s := &HostService{}
+	r := s.throttle(ctx, bytes.NewReader(make([]byte, 4096)), newTokenBucket(1024))
+	_, err := io.ReadAll(r)
+	assert.Equal(t, context.Canceled, err)
+
+	plain := bytes.NewReader(nil)
+	assert.Equal(t, plain, s.throttle(ctx, plain, nil))
+}
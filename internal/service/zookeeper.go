@@ -0,0 +1,476 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"middleware-platform/internal/model"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AlertEventZKQuorumLost ZooKeeper 集群失去法定人数或没有 leader
+const AlertEventZKQuorumLost = "zookeeper_quorum_lost"
+
+const (
+	zkCommandTimeout = 5 * time.Second
+	maxZKResponse    = 1 << 20
+	// 动态配置（3.5+）中的集群成员
+	zkConfigNode = "/zookeeper/config"
+	// 不提供服务的节点对 mntr 和 srvr 的响应
+	zkNotServing = "not currently serving requests"
+)
+
+var (
+	// ErrZKCommandNotAllowed 四字命令未加入 4lw.commands.whitelist
+	ErrZKCommandNotAllowed = errors.New("four letter word command is not in 4lw.commands.whitelist")
+	// ErrZKNotServing 节点可以连接但不提供服务，通常是失去了法定人数
+	ErrZKNotServing = errors.New("zookeeper is not currently serving requests")
+	ErrNoEnsemble   = errors.New("no zookeeper ensemble discovered for this middleware")
+)
+
+// ZKMember ZooKeeper 集群成员及最近一次检查到的状态
+type ZKMember struct {
+	ServerID     string `json:"server_id"`
+	Host         string `json:"host"`
+	Port         string `json:"port"` // 客户端端口
+	Type         string `json:"type"` // participant, observer
+	Mode         string `json:"mode"` // leader, follower, observer；无法获取时为空
+	MiddlewareID uint   `json:"middleware_id"`
+	Error        string `json:"error,omitempty"`
+}
+
+// ZKEnsemble ZooKeeper 集群最近一次检查的成员和法定人数
+type ZKEnsemble struct {
+	MiddlewareID uint       `json:"middleware_id"`
+	Members      []ZKMember `json:"members"`
+	Voters       int        `json:"voters"`    // 参与选举的成员数（不含 observer）
+	VotersUp     int        `json:"voters_up"` // 处于 leader 或 follower 状态的选举成员数
+	Quorum       int        `json:"quorum"`    // 法定人数
+	Leader       string     `json:"leader"`
+	QuorumOK     bool       `json:"quorum_ok"`
+	CheckedAt    time.Time  `json:"checked_at"`
+}
+
+// SetZKAdminPort 设置 ZooKeeper AdminServer 端口，mntr 未加入白名单时通过 AdminServer 采集，0 表示不使用
+func (s *MetricsService) SetZKAdminPort(port int) {
+	s.zkAdminPort = port
+}
+
+// GetZKEnsemble 获取最近一次检查的集群成员和法定人数
+func (s *MetricsService) GetZKEnsemble(middlewareID uint) (*ZKEnsemble, error) {
+	ensemble, _ := s.clusters.get(middlewareID).(*ZKEnsemble)
+	if ensemble == nil {
+		return nil, ErrNoEnsemble
+	}
+	return ensemble, nil
+}
+
+// zkCommand 发送四字命令并读取全部响应
+func zkCommand(ctx context.Context, addr, cmd string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, zkCommandTimeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	deadline, _ := ctx.Deadline()
+	conn.SetDeadline(deadline)
+
+	if _, err := io.WriteString(conn, cmd); err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(io.LimitReader(conn, maxZKResponse))
+	if err != nil {
+		return "", err
+	}
+	out := string(data)
+	if strings.Contains(out, "not in the whitelist") {
+		return "", fmt.Errorf("%s: %w", cmd, ErrZKCommandNotAllowed)
+	}
+	return out, nil
+}
+
+// zkServerStats 通过 srvr 获取节点状态，3.5 之后默认白名单中只有 srvr
+func zkServerStats(ctx context.Context, addr string) (map[string]string, error) {
+	out, err := zkCommand(ctx, addr, "srvr")
+	if err != nil {
+		return nil, err
+	}
+	return parseSrvr(out)
+}
+
+// zkStats 依次尝试 mntr、AdminServer 的 monitor 命令和 srvr，返回 mntr 格式的统计
+func (s *MetricsService) zkStats(ctx context.Context, mw *model.Middleware) (map[string]string, error) {
+	addr := memberAddr(mw.Host, mw.Port)
+	out, err := zkCommand(ctx, addr, "mntr")
+	if err == nil {
+		if strings.Contains(out, zkNotServing) {
+			return nil, ErrZKNotServing
+		}
+		return parseMntr(out), nil
+	}
+	if !errors.Is(err, ErrZKCommandNotAllowed) {
+		return nil, err
+	}
+	if s.zkAdminPort > 0 {
+		stats, adminErr := zkAdminMonitor(ctx, mw.Host, s.zkAdminPort)
+		if adminErr == nil {
+			return stats, nil
+		}
+		log.Printf("ZooKeeper AdminServer of middleware %d unavailable, falling back to srvr: %v", mw.ID, adminErr)
+	}
+	return zkServerStats(ctx, addr)
+}
+
+// parseMntr 解析 mntr 输出，每行为 "zk_key<TAB>value"
+func parseMntr(out string) map[string]string {
+	stats := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 {
+			stats[fields[0]] = fields[1]
+		}
+	}
+	return stats
+}
+
+// srvrKeys srvr 输出的字段对应的 mntr 键名
+var srvrKeys = map[string]string{
+	"Zookeeper version": "zk_version",
+	"Received":          "zk_packets_received",
+	"Sent":              "zk_packets_sent",
+	"Connections":       "zk_num_alive_connections",
+	"Outstanding":       "zk_outstanding_requests",
+	"Mode":              "zk_server_state",
+	"Node count":        "zk_znode_count",
+	"Zxid":              "zk_zxid",
+}
+
+// parseSrvr 将 srvr 输出转换为 mntr 格式的统计
+func parseSrvr(out string) (map[string]string, error) {
+	if strings.Contains(out, zkNotServing) {
+		return nil, ErrZKNotServing
+	}
+	stats := make(map[string]string)
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if key == "Latency min/avg/max" {
+			if parts := strings.Split(value, "/"); len(parts) == 3 {
+				stats["zk_min_latency"] = parts[0]
+				stats["zk_avg_latency"] = parts[1]
+				stats["zk_max_latency"] = parts[2]
+			}
+			continue
+		}
+		if name, ok := srvrKeys[key]; ok {
+			stats[name] = value
+		}
+	}
+	if stats["zk_server_state"] == "" {
+		return nil, fmt.Errorf("unexpected srvr response: %q", firstLine(out))
+	}
+	return stats, nil
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	return line
+}
+
+// zkAdminMonitor 通过 AdminServer 的 /commands/monitor 获取统计，键名与 mntr 相同但没有 zk_ 前缀
+func zkAdminMonitor(ctx context.Context, host string, port int) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, zkCommandTimeout)
+	defer cancel()
+
+	url := fmt.Sprintf("http://%s/commands/monitor", net.JoinHostPort(host, strconv.Itoa(port)))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxZKResponse)).Decode(&body); err != nil {
+		return nil, err
+	}
+	if msg, ok := body["error"].(string); ok && msg != "" {
+		return nil, errors.New(msg)
+	}
+	stats := make(map[string]string, len(body))
+	for key, value := range body {
+		if value == nil || key == "command" || key == "error" {
+			continue
+		}
+		stats["zk_"+key] = fmt.Sprint(value)
+	}
+	return stats, nil
+}
+
+// zkMetricUnits 采集的 mntr 指标及单位
+var zkMetricUnits = map[string]string{
+	"zk_avg_latency":                "ms",
+	"zk_max_latency":                "ms",
+	"zk_min_latency":                "ms",
+	"zk_outstanding_requests":       "",
+	"zk_znode_count":                "",
+	"zk_watch_count":                "",
+	"zk_ephemerals_count":           "",
+	"zk_num_alive_connections":      "",
+	"zk_approximate_data_size":      "bytes",
+	"zk_open_file_descriptor_count": "",
+	"zk_packets_received":           "",
+	"zk_packets_sent":               "",
+	"zk_followers":                  "",
+	"zk_synced_followers":           "",
+	"zk_pending_syncs":              "",
+}
+
+// zkMetrics 将统计转换为指标，另外用 zk_is_leader 表示节点角色
+func zkMetrics(middlewareID uint, stats map[string]string, now time.Time) []model.Metrics {
+	var metrics []model.Metrics
+	for key, unit := range zkMetricUnits {
+		value, err := strconv.ParseFloat(stats[key], 64)
+		if err != nil {
+			continue
+		}
+		metrics = append(metrics, model.Metrics{
+			MiddlewareID: middlewareID,
+			Type:         key,
+			Value:        value,
+			Unit:         unit,
+			Timestamp:    now,
+		})
+	}
+	if state := stats["zk_server_state"]; state != "" {
+		metrics = append(metrics, model.Metrics{
+			MiddlewareID: middlewareID,
+			Type:         "zk_is_leader",
+			Value:        boolValue(state == "leader"),
+			Timestamp:    now,
+		})
+	}
+	return metrics
+}
+
+func (s *MetricsService) collectZKMetrics(ctx context.Context, mw model.Middleware) ([]model.Metrics, error) {
+	stats, err := s.zkStats(ctx, &mw)
+	if err != nil {
+		return nil, err
+	}
+	metrics := zkMetrics(mw.ID, stats, time.Now())
+
+	// 集群只从用户添加的实例发现，单机模式没有集群
+	if mw.ParentID == nil && stats["zk_server_state"] != "standalone" {
+		ensemble, err := s.discoverZKEnsemble(ctx, &mw)
+		if err != nil {
+			log.Printf("Failed to discover zookeeper ensemble of middleware %d: %v", mw.ID, err)
+		} else {
+			metrics = append(metrics, ensembleMetrics(ensemble)...)
+		}
+	}
+	return metrics, nil
+}
+
+// discoverZKEnsemble 从 /zookeeper/config 读取集群成员，逐个通过 srvr 获取状态并计算法定人数；
+// 失去法定人数时集群不提供读服务，此时使用上一次发现的成员
+func (s *MetricsService) discoverZKEnsemble(ctx context.Context, mw *model.Middleware) (*ZKEnsemble, error) {
+	previous, _ := s.clusters.get(mw.ID).(*ZKEnsemble)
+
+	members, err := s.readZKConfig(ctx, mw)
+	if err != nil || len(members) == 0 {
+		if previous == nil {
+			if err == nil {
+				err = fmt.Errorf("%s is empty, dynamic configuration requires zookeeper 3.5+", zkConfigNode)
+			}
+			return nil, err
+		}
+		members = make([]ZKMember, len(previous.Members))
+		for i, m := range previous.Members {
+			members[i] = ZKMember{ServerID: m.ServerID, Host: m.Host, Port: m.Port, Type: m.Type}
+		}
+	}
+
+	probeZKMembers(ctx, members)
+	ensemble := evaluateEnsemble(members)
+	ensemble.MiddlewareID = mw.ID
+	ensemble.CheckedAt = time.Now()
+
+	discovered := make([]discoveredMember, 0, len(members))
+	for _, m := range members {
+		role := m.Mode
+		if role == "" {
+			role = m.Type
+		}
+		discovered = append(discovered, discoveredMember{Host: m.Host, Port: m.Port, Role: role})
+	}
+	ids, err := s.syncMembers(mw, discovered)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ensemble.Members {
+		ensemble.Members[i].MiddlewareID = ids[memberAddr(ensemble.Members[i].Host, ensemble.Members[i].Port)]
+	}
+
+	switch {
+	case !ensemble.QuorumOK && (previous == nil || previous.QuorumOK):
+		s.raiseEvent(AlertEventZKQuorumLost, mw.ID, fmt.Sprintf(
+			"zookeeper ensemble %s lost quorum: %d of %d voters up (quorum %d), leader %q",
+			mw.Name, ensemble.VotersUp, ensemble.Voters, ensemble.Quorum, ensemble.Leader))
+	case ensemble.QuorumOK && previous != nil && !previous.QuorumOK:
+		log.Printf("ZooKeeper ensemble %s regained quorum, leader %s", mw.Name, ensemble.Leader)
+	}
+	s.clusters.set(mw.ID, ensemble)
+	return ensemble, nil
+}
+
+// readZKConfig 通过客户端连接读取动态配置
+func (s *MetricsService) readZKConfig(ctx context.Context, mw *model.Middleware) ([]ZKMember, error) {
+	conn, release, err := s.clients.zkConn(mw)
+	if err != nil {
+		return nil, err
+	}
+
+	type result struct {
+		data []byte
+		err  error
+	}
+	// ctx 取消后请求可能仍在使用连接，请求结束时才归还
+	done := make(chan result, 1)
+	go func() {
+		defer release()
+		data, _, err := conn.Get(zkConfigNode)
+		done <- result{data, err}
+	}()
+
+	select {
+	case r := <-done:
+		s.clients.report(mw, clientZK, r.err)
+		if r.err != nil {
+			return nil, r.err
+		}
+		return parseZKConfig(string(r.data), mw.Port), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// parseZKConfig 解析动态配置中的成员，每行格式：
+// server.<id>=<host>:<quorum port>:<election port>[:<type>][;[<client address>:]<client port>]
+// 没有客户端端口时使用 defaultPort
+func parseZKConfig(config, defaultPort string) []ZKMember {
+	var members []ZKMember
+	for _, line := range strings.Split(config, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || !strings.HasPrefix(key, "server.") {
+			continue
+		}
+		server, client, _ := strings.Cut(value, ";")
+		parts := strings.Split(server, ":")
+		if parts[0] == "" {
+			continue
+		}
+		member := ZKMember{
+			ServerID: strings.TrimPrefix(key, "server."),
+			Host:     parts[0],
+			Port:     defaultPort,
+			Type:     "participant",
+		}
+		if len(parts) >= 4 && parts[3] != "" {
+			member.Type = parts[3]
+		}
+		if client != "" {
+			// 客户端地址是监听地址，如 0.0.0.0:2181，只取端口
+			if _, port, err := net.SplitHostPort(client); err == nil {
+				member.Port = port
+			} else {
+				member.Port = client
+			}
+		}
+		members = append(members, member)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ServerID < members[j].ServerID })
+	return members
+}
+
+// probeZKMembers 并发获取每个成员的模式
+func probeZKMembers(ctx context.Context, members []ZKMember) {
+	var wg sync.WaitGroup
+	for i := range members {
+		wg.Add(1)
+		go func(m *ZKMember) {
+			defer wg.Done()
+			stats, err := zkServerStats(ctx, memberAddr(m.Host, m.Port))
+			if err != nil {
+				m.Error = err.Error()
+				return
+			}
+			m.Mode = stats["zk_server_state"]
+		}(&members[i])
+	}
+	wg.Wait()
+}
+
+// evaluateEnsemble 计算法定人数：有 leader 且处于 leader/follower 状态的选举成员过半
+func evaluateEnsemble(members []ZKMember) *ZKEnsemble {
+	ensemble := &ZKEnsemble{Members: members}
+	for _, m := range members {
+		if m.Type == "observer" {
+			continue
+		}
+		ensemble.Voters++
+		switch m.Mode {
+		case "leader":
+			ensemble.Leader = memberAddr(m.Host, m.Port)
+			ensemble.VotersUp++
+		case "follower":
+			ensemble.VotersUp++
+		}
+	}
+	ensemble.Quorum = ensemble.Voters/2 + 1
+	ensemble.QuorumOK = ensemble.Leader != "" && ensemble.VotersUp >= ensemble.Quorum
+	return ensemble
+}
+
+// ensembleMetrics 集群状态作为父实例的指标
+func ensembleMetrics(e *ZKEnsemble) []model.Metrics {
+	now := e.CheckedAt
+	values := map[string]float64{
+		"zk_ensemble_voters":     float64(e.Voters),
+		"zk_ensemble_voters_up":  float64(e.VotersUp),
+		"zk_ensemble_has_leader": boolValue(e.Leader != ""),
+		"zk_ensemble_quorum_ok":  boolValue(e.QuorumOK),
+	}
+	metrics := make([]model.Metrics, 0, len(values))
+	for name, value := range values {
+		metrics = append(metrics, model.Metrics{
+			MiddlewareID: e.MiddlewareID,
+			Type:         name,
+			Value:        value,
+			Timestamp:    now,
+		})
+	}
+	return metrics
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"middleware-platform/internal/model"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeZK 对每个连接读取四字命令并返回responses中对应的内容
+func fakeZK(t *testing.T, responses map[string]string) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			buf := make([]byte, 4)
+			if _, err := io.ReadFull(conn, buf); err == nil {
+				io.WriteString(conn, responses[string(buf)])
+			}
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestParseSrvr(t *testing.T) {
+	stats, err := parseSrvr("Zookeeper version: 3.8.1-74db005175a4ec545697012f9069cb9dcc8cdda7, built on 2023-01-25\n" +
+		"Latency min/avg/max: 0/0.5/12\nReceived: 120\nSent: 119\nConnections: 3\nOutstanding: 1\n" +
+		"Zxid: 0x100000002\nMode: follower\nNode count: 42\n")
+	assert.NoError(t, err)
+	assert.Equal(t, "follower", stats["zk_server_state"])
+	assert.Equal(t, "0.5", stats["zk_avg_latency"])
+	assert.Equal(t, "42", stats["zk_znode_count"])
+	assert.Equal(t, "1", stats["zk_outstanding_requests"])
+
+	_, err = parseSrvr("This ZooKeeper instance is not currently serving requests\n")
+	assert.ErrorIs(t, err, ErrZKNotServing)
+}
+
+func TestZKMetrics(t *testing.T) {
+	stats := parseMntr("zk_version\t3.8.1\nzk_server_state\tleader\nzk_avg_latency\t1.5\n" +
+		"zk_watch_count\t7\nzk_synced_followers\t2\n")
+	values := metricValues(zkMetrics(1, stats, time.Now()))
+	assert.Equal(t, 1.5, values["zk_avg_latency"])
+	assert.Equal(t, 7.0, values["zk_watch_count"])
+	assert.Equal(t, 2.0, values["zk_synced_followers"])
+	assert.Equal(t, 1.0, values["zk_is_leader"])
+	assert.NotContains(t, values, "zk_version")
+}
+
+func TestZKStats_FallsBackToSrvr(t *testing.T) {
+	addr := fakeZK(t, map[string]string{
+		"mntr": "mntr is not executed because it is not in the whitelist.\n",
+		"srvr": "Zookeeper version: 3.8.1\nMode: leader\nNode count: 5\n",
+	})
+	host, port, _ := net.SplitHostPort(addr)
+
+	stats, err := (&MetricsService{}).zkStats(context.Background(), &model.Middleware{Host: host, Port: port})
+	assert.NoError(t, err)
+	assert.Equal(t, "leader", stats["zk_server_state"])
+	assert.Equal(t, "5", stats["zk_znode_count"])
+}
+
+func TestZKAdminMonitor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/commands/monitor", r.URL.Path)
+		io.WriteString(w, `{"command":"monitor","error":null,"server_state":"follower","znode_count":12,"avg_latency":0.25}`)
+	}))
+	defer server.Close()
+	host, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	n, _ := strconv.Atoi(port)
+
+	stats, err := zkAdminMonitor(context.Background(), host, n)
+	assert.NoError(t, err)
+	assert.Equal(t, "follower", stats["zk_server_state"])
+	assert.Equal(t, "12", stats["zk_znode_count"])
+	assert.Equal(t, "0.25", stats["zk_avg_latency"])
+	assert.NotContains(t, stats, "zk_error")
+}
+
+func TestParseZKConfig(t *testing.T) {
+	members := parseZKConfig("server.2=zk2:2888:3888:participant;0.0.0.0:2181\n"+
+		"server.1=zk1:2888:3888;2182\n"+
+		"server.3=zk3:2888:3888:observer\n"+
+		"version=100000000\n", "2181")
+	if !assert.Len(t, members, 3) {
+		return
+	}
+	assert.Equal(t, ZKMember{ServerID: "1", Host: "zk1", Port: "2182", Type: "participant"}, members[0])
+	assert.Equal(t, ZKMember{ServerID: "2", Host: "zk2", Port: "2181", Type: "participant"}, members[1])
+	assert.Equal(t, ZKMember{ServerID: "3", Host: "zk3", Port: "2181", Type: "observer"}, members[2])
+}
+
+func TestEvaluateEnsemble(t *testing.T) {
+	members := []ZKMember{
+		{Host: "zk1", Port: "2181", Type: "participant", Mode: "leader"},
+		{Host: "zk2", Port: "2181", Type: "participant", Mode: "follower"},
+		{Host: "zk3", Port: "2181", Type: "participant", Error: "connection refused"},
+		{Host: "zk4", Port: "2181", Type: "observer", Mode: "observer"},
+	}
+	ensemble := evaluateEnsemble(members)
+	assert.Equal(t, 3, ensemble.Voters)
+	assert.Equal(t, 2, ensemble.VotersUp)
+	assert.Equal(t, 2, ensemble.Quorum)
+	assert.Equal(t, "zk1:2181", ensemble.Leader)
+	assert.True(t, ensemble.QuorumOK)
+
+	// 只剩一个选举成员时没有 leader
+	members[0].Mode, members[0].Error = "", ErrZKNotServing.Error()
+	members[1].Mode = ""
+	ensemble = evaluateEnsemble(members)
+	assert.Equal(t, 0, ensemble.VotersUp)
+	assert.False(t, ensemble.QuorumOK)
+}
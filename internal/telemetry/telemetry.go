@@ -0,0 +1,255 @@
+// Package telemetry 平台自身运行指标的注册表，以 Prometheus 文本格式输出
+package telemetry
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default 全局注册表，由 GET /metrics 输出
+var Default = NewRegistry()
+
+// Registry 指标注册表
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]family
+}
+
+type family interface {
+	write(w *bufio.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]family)}
+}
+
+// Counter 注册（或返回已注册的）计数器
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name].(*CounterVec); ok {
+		return f
+	}
+	c := &CounterVec{vec: newVec(name, help, labels)}
+	r.families[name] = c
+	return c
+}
+
+// Summary 注册（或返回已注册的）摘要，只输出 _sum 和 _count
+func (r *Registry) Summary(name, help string, labels ...string) *SummaryVec {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if f, ok := r.families[name].(*SummaryVec); ok {
+		return f
+	}
+	s := &SummaryVec{vec: newVec(name, help, labels)}
+	r.families[name] = s
+	return s
+}
+
+// GaugeFunc 注册在输出时取值的仪表，同名注册会替换之前的函数
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families[name] = &gaugeFunc{name: name, help: help, fn: fn}
+}
+
+// Write 按指标名排序输出所有指标
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	families := make([]family, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		families = append(families, r.families[name])
+	}
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+// vec 按标签值分组的样本
+type vec struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string][]string
+	series map[string]*[2]float64
+}
+
+func newVec(name, help string, labels []string) vec {
+	return vec{
+		name:   name,
+		help:   help,
+		labels: labels,
+		values: make(map[string][]string),
+		series: make(map[string]*[2]float64),
+	}
+}
+
+func (v *vec) get(labelValues []string) *[2]float64 {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("telemetry: %s expects %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &[2]float64{}
+		v.series[key] = s
+		v.values[key] = append([]string(nil), labelValues...)
+	}
+	return s
+}
+
+func (v *vec) keys() []string {
+	keys := make([]string, 0, len(v.series))
+	for key := range v.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CounterVec 单调递增的计数器
+type CounterVec struct {
+	vec
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.get(labelValues)[0] += delta
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	WriteHeader(w, c.name, c.help, "counter")
+	for _, key := range c.keys() {
+		WriteSample(w, c.name, c.labels, c.values[key], c.series[key][0])
+	}
+}
+
+// SummaryVec 记录观测值的总和与次数，如采集耗时
+type SummaryVec struct {
+	vec
+}
+
+func (s *SummaryVec) Observe(value float64, labelValues ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sample := s.get(labelValues)
+	sample[0] += value
+	sample[1]++
+}
+
+func (s *SummaryVec) write(w *bufio.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	WriteHeader(w, s.name, s.help, "summary")
+	for _, key := range s.keys() {
+		WriteSample(w, s.name+"_sum", s.labels, s.values[key], s.series[key][0])
+		WriteSample(w, s.name+"_count", s.labels, s.values[key], s.series[key][1])
+	}
+}
+
+type gaugeFunc struct {
+	name string
+	help string
+	fn   func() float64
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	WriteHeader(w, g.name, g.help, "gauge")
+	WriteSample(w, g.name, nil, nil, g.fn())
+}
+
+// WriteHeader 输出 # HELP 和 # TYPE 行
+func WriteHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, escapeHelp(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, typ)
+}
+
+// WriteSample 输出一个样本行
+func WriteSample(w io.Writer, name string, labels, values []string, value float64) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(label)
+			b.WriteString(`="`)
+			b.WriteString(escapeLabelValue(values[i]))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatValue(value))
+	b.WriteByte('\n')
+	io.WriteString(w, b.String())
+}
+
+// SanitizeName 将任意字符串转换为合法的指标名：只保留字母、数字和下划线，且不以数字开头
+func SanitizeName(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_', r == ':':
+			b.WriteRune(r)
+		case r >= '0' && r <= '9':
+			if i == 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+func escapeLabelValue(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
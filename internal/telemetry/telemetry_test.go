@@ -0,0 +1,50 @@
+package telemetry
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	r := NewRegistry()
+	errors := r.Counter("collector_errors_total", "Failed collections.", "collector")
+	errors.Inc("redis")
+	errors.Add(2, "mysql")
+	// 重复注册返回同一个计数器
+	r.Counter("collector_errors_total", "Failed collections.", "collector").Inc("redis")
+
+	duration := r.Summary("collection_duration_seconds", "Collection time.", "collector")
+	duration.Observe(0.5, "redis")
+	duration.Observe(1.5, "redis")
+
+	r.GaugeFunc("queue_depth", "Queued jobs.", func() float64 { return 3 })
+
+	var buf bytes.Buffer
+	assert.NoError(t, r.Write(&buf))
+	assert.Equal(t, `# HELP collection_duration_seconds Collection time.
+# TYPE collection_duration_seconds summary
+collection_duration_seconds_sum{collector="redis"} 2
+collection_duration_seconds_count{collector="redis"} 2
+# HELP collector_errors_total Failed collections.
+# TYPE collector_errors_total counter
+collector_errors_total{collector="mysql"} 2
+collector_errors_total{collector="redis"} 2
+# HELP queue_depth Queued jobs.
+# TYPE queue_depth gauge
+queue_depth 3
+`, buf.String())
+}
+
+func TestWriteSample_Escaping(t *testing.T) {
+	var buf bytes.Buffer
+	WriteSample(&buf, "m", []string{"name"}, []string{"a\"b\\c\nd"}, 1.25)
+	assert.Equal(t, "m{name=\"a\\\"b\\\\c\\nd\"} 1.25\n", buf.String())
+}
+
+func TestSanitizeName(t *testing.T) {
+	assert.Equal(t, "cpu_usage", SanitizeName("cpu_usage"))
+	assert.Equal(t, "hit_rate_", SanitizeName("hit-rate%"))
+	assert.Equal(t, "_95th", SanitizeName("95th"))
+}